@@ -1,4 +1,6 @@
-// Package accesscontrol provides a middleware that allows you to restrict the commands the user can execute.
+// Package accesscontrol provides middlewares that restrict what users can do:
+// the commands they can execute, when they can connect, and what requires
+// elevated privileges.
 package accesscontrol
 
 import (
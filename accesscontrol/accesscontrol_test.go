@@ -2,7 +2,9 @@ package accesscontrol_test
 
 import (
 	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish/accesscontrol"
@@ -85,3 +87,167 @@ func setup(tb testing.TB, allowedCmds ...string) *gossh.Session {
 		}),
 	}, nil)
 }
+
+func TestShadow(t *testing.T) {
+	flagged := func(s ssh.Session) bool { return s.User() == "troll" }
+	app := func(s ssh.Session) {
+		if accesscontrol.IsShadowed(s.Context()) {
+			s.Write([]byte("degraded"))
+			return
+		}
+		s.Write([]byte(out))
+	}
+	run := func(tb testing.TB, sandbox ssh.Handler, user string) string {
+		tb.Helper()
+		sess := testsession.New(tb, &ssh.Server{
+			Handler: accesscontrol.Shadow(flagged, sandbox)(app),
+		}, &gossh.ClientConfig{User: user})
+		out, err := sess.Output("")
+		if err != nil {
+			tb.Fatal(err)
+		}
+		return string(out)
+	}
+	sandbox := func(s ssh.Session) {
+		s.Write([]byte("sandbox"))
+	}
+
+	for _, tc := range []struct {
+		name     string
+		sandbox  ssh.Handler
+		user     string
+		expected string
+	}{
+		{"not flagged", sandbox, "someone", out},
+		{"sandbox", sandbox, "troll", "sandbox"},
+		{"degraded", nil, "troll", "degraded"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := run(t, tc.sandbox, tc.user); got != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, got)
+			}
+		})
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	office := accesscontrol.Window{Days: accesscontrol.Weekdays, Start: 9 * time.Hour, End: 17 * time.Hour, Location: ny}
+	night := accesscontrol.Window{Days: []time.Weekday{time.Friday}, Start: 22 * time.Hour, End: 6 * time.Hour}
+	for _, tc := range []struct {
+		window   accesscontrol.Window
+		t        string
+		expected bool
+	}{
+		{office, "2024-03-04T14:00:00Z", true},  // Monday 9:00 in New York
+		{office, "2024-03-04T13:59:59Z", false}, // Monday 8:59
+		{office, "2024-03-11T13:00:00Z", true},  // Monday 9:00, after DST
+		{office, "2024-03-09T15:00:00Z", false}, // Saturday
+		{night, "2024-03-08T23:00:00Z", true},   // Friday night
+		{night, "2024-03-09T05:59:00Z", true},   // Saturday morning
+		{night, "2024-03-09T23:00:00Z", false},  // Saturday night
+		{night, "2024-03-08T05:00:00Z", false},  // Friday morning
+	} {
+		at, err := time.Parse(time.RFC3339, tc.t)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tc.window.Contains(at); got != tc.expected {
+			t.Errorf("%s: expected %v, got %v", tc.t, tc.expected, got)
+		}
+	}
+}
+
+func TestWindows(t *testing.T) {
+	secret := []byte("secret")
+	// a window closed today.
+	var days []time.Weekday
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if d != time.Now().UTC().Weekday() {
+			days = append(days, d)
+		}
+	}
+	closed := []accesscontrol.Window{{Days: days, End: 24 * time.Hour}}
+	always := []accesscontrol.Window{{End: 24 * time.Hour}}
+	mw := accesscontrol.Windows(
+		accesscontrol.VerifyOverride(secret),
+		accesscontrol.Rule{Match: accesscontrol.Users("contractor"), Windows: closed},
+		accesscontrol.Rule{Match: accesscontrol.Commands("deploy"), Windows: always},
+	)
+	run := func(tb testing.TB, user, token string) error {
+		tb.Helper()
+		sess := testsession.New(tb, &ssh.Server{
+			Handler: mw(func(s ssh.Session) {
+				s.Write([]byte(out))
+			}),
+		}, &gossh.ClientConfig{User: user})
+		if token != "" {
+			if err := sess.Setenv(accesscontrol.OverrideEnv, token); err != nil {
+				tb.Fatal(err)
+			}
+		}
+		return sess.Run("deploy")
+	}
+
+	for _, tc := range []struct {
+		name  string
+		user  string
+		token string
+		ok    bool
+	}{
+		{"not restricted", "employee", "", true},
+		{"outside window", "contractor", "", false},
+		{"override", "contractor", accesscontrol.NewOverride(secret, "contractor", time.Now().Add(time.Hour)), true},
+		{"expired override", "contractor", accesscontrol.NewOverride(secret, "contractor", time.Now().Add(-time.Second)), false},
+		{"override for someone else", "contractor", accesscontrol.NewOverride(secret, "someone", time.Now().Add(time.Hour)), false},
+		{"forged override", "contractor", accesscontrol.NewOverride([]byte("nope"), "contractor", time.Now().Add(time.Hour)), false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := run(t, tc.user, tc.token); (err == nil) != tc.ok {
+				t.Errorf("expected access to be %v, got %v", tc.ok, err)
+			}
+		})
+	}
+}
+
+func TestRequireElevation(t *testing.T) {
+	mw := accesscontrol.RequireElevation("Deleting things.", time.Hour, accesscontrol.Commands("delete"))
+	run := func(tb testing.TB, cmd string, pty bool, stdin string) (string, error) {
+		tb.Helper()
+		sess := testsession.New(tb, &ssh.Server{
+			Handler: mw(func(s ssh.Session) {
+				s.Write([]byte(out))
+			}),
+			PasswordHandler: func(_ ssh.Context, password string) bool {
+				return password == "secret"
+			},
+		}, &gossh.ClientConfig{
+			User: "admin",
+			Auth: []gossh.AuthMethod{gossh.Password("secret")},
+		})
+		if pty {
+			if err := sess.RequestPty("xterm", 24, 80, nil); err != nil {
+				tb.Fatal(err)
+			}
+		}
+		sess.Stdin = strings.NewReader(stdin)
+		b, err := sess.Output(cmd)
+		return string(b), err
+	}
+
+	if got, err := run(t, "list", false, ""); err != nil || got != out {
+		t.Errorf("expected unmatched sessions to go through, got %q, %v", got, err)
+	}
+	if got, err := run(t, "delete", true, "secret\r"); err != nil || !strings.HasSuffix(got, out) {
+		t.Errorf("expected elevated sessions to go through, got %q, %v", got, err)
+	}
+	if got, err := run(t, "delete", true, "wrong\r"); err == nil || strings.HasSuffix(got, out) {
+		t.Errorf("expected the session to be denied, got %q", got)
+	}
+	if _, err := run(t, "delete", false, ""); err == nil {
+		t.Error("expected sessions without a PTY to be denied")
+	}
+}
@@ -0,0 +1,30 @@
+package accesscontrol
+
+import (
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+// RequireElevation is a middleware requiring the sessions it matches, e.g.
+// with Commands, to have elevated privileges. Users without them are asked
+// to authenticate again with wish.Elevate, for the given reason, and get them
+// for ttl. Sessions failing to, e.g. because they have no PTY, exit 1.
+func RequireElevation(reason string, ttl time.Duration, match func(ssh.Session) bool) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if match != nil && !match(s) {
+				sh(s)
+				return
+			}
+			if err := wish.Elevate(s, reason, ttl); err != nil {
+				log.Warn("elevation required", "user", s.User(), "remote-addr", s.RemoteAddr(), "command", s.RawCommand(), "error", err)
+				wish.Exit(s, 1, "This requires elevated privileges: "+err.Error())
+				return
+			}
+			sh(s)
+		}
+	}
+}
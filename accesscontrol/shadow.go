@@ -0,0 +1,38 @@
+package accesscontrol
+
+import (
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+)
+
+type shadowKey struct{}
+
+// Shadow is a middleware soft banning the sessions for which flagged returns
+// true: they connect successfully, without being told anything, but are
+// handled by the sandbox handler instead of the next one. It's meant to deter
+// abusers without tipping them off.
+//
+// If sandbox is nil, flagged sessions are handled by the next handler, which
+// can check IsShadowed to degrade its functionality instead.
+func Shadow(flagged func(ssh.Session) bool, sandbox ssh.Handler) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if !flagged(s) {
+				sh(s)
+				return
+			}
+			s.Context().SetValue(shadowKey{}, true)
+			if sandbox != nil {
+				sandbox(s)
+				return
+			}
+			sh(s)
+		}
+	}
+}
+
+// IsShadowed returns whether the session was flagged by Shadow.
+func IsShadowed(ctx ssh.Context) bool {
+	shadowed, _ := ctx.Value(shadowKey{}).(bool)
+	return shadowed
+}
@@ -0,0 +1,183 @@
+package accesscontrol
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+// OverrideEnv is the environment variable users set an override token in, to
+// get access outside of their windows.
+const OverrideEnv = "WISH_ACCESS_OVERRIDE"
+
+// Window is a recurring window of time, e.g. from 9 to 17 on weekdays.
+type Window struct {
+	// Days are the days of the week the window is open. Empty means every
+	// day.
+	Days []time.Weekday
+
+	// Start and End are the times of the day the window opens and closes,
+	// as durations since midnight. If End is before Start, the window
+	// closes the next day, e.g. for night shifts.
+	Start, End time.Duration
+
+	// Location is the time zone of the window. Nil means UTC.
+	Location *time.Location
+}
+
+// Weekdays are the days from Monday to Friday.
+var Weekdays = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday}
+
+// Contains returns whether the window is open at the given time.
+func (w Window) Contains(t time.Time) bool {
+	loc := w.Location
+	if loc == nil {
+		loc = time.UTC
+	}
+	t = t.In(loc)
+	// wall clock time, so windows don't move on DST changes.
+	since := time.Duration(t.Hour())*time.Hour +
+		time.Duration(t.Minute())*time.Minute +
+		time.Duration(t.Second())*time.Second +
+		time.Duration(t.Nanosecond())
+	if w.Start <= w.End {
+		return w.open(t.Weekday()) && since >= w.Start && since < w.End
+	}
+	// the window spans midnight: it's either open since the start of
+	// today's window, or since the start of yesterday's.
+	return (w.open(t.Weekday()) && since >= w.Start) ||
+		(w.open((t.Weekday()+6)%7) && since < w.End)
+}
+
+func (w Window) open(day time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, d := range w.Days {
+		if d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// Rule restricts the sessions it matches to its windows.
+type Rule struct {
+	// Match returns whether the rule applies to the session, see Users and
+	// Commands.
+	Match func(ssh.Session) bool
+
+	// Windows are the windows matching sessions are allowed in.
+	Windows []Window
+}
+
+// Users matches the sessions of the given users.
+func Users(users ...string) func(ssh.Session) bool {
+	return func(s ssh.Session) bool {
+		for _, u := range users {
+			if s.User() == u {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Commands matches the sessions running the given commands.
+func Commands(cmds ...string) func(ssh.Session) bool {
+	return func(s ssh.Session) bool {
+		if len(s.Command()) == 0 {
+			return false
+		}
+		for _, cmd := range cmds {
+			if s.Command()[0] == cmd {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// OverrideFunc returns whether the token lets the session in outside of its
+// windows, see VerifyOverride.
+type OverrideFunc func(s ssh.Session, token string) bool
+
+// Windows is a middleware restricting sessions to the windows of every rule
+// matching them, before the next handler runs. Sessions outside of them exit
+// 1, unless override is set and accepts the token in their OverrideEnv
+// environment variable. Overrides are logged.
+func Windows(override OverrideFunc, rules ...Rule) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			now := time.Now()
+			for _, r := range rules {
+				if !r.Match(s) || inWindows(r.Windows, now) {
+					continue
+				}
+				if token := overrideToken(s); override != nil && token != "" && override(s, token) {
+					log.Warn("access window overridden", "user", s.User(), "remote-addr", s.RemoteAddr().String())
+					break
+				}
+				wish.Exit(s, 1, "Access is not allowed at this time.")
+				return
+			}
+			sh(s)
+		}
+	}
+}
+
+func inWindows(windows []Window, t time.Time) bool {
+	for _, w := range windows {
+		if w.Contains(t) {
+			return true
+		}
+	}
+	return false
+}
+
+func overrideToken(s ssh.Session) string {
+	for _, kv := range s.Environ() {
+		if strings.HasPrefix(kv, OverrideEnv+"=") {
+			return strings.TrimPrefix(kv, OverrideEnv+"=")
+		}
+	}
+	return ""
+}
+
+// NewOverride returns an override token letting the given user in until the
+// given time, signed with secret, for VerifyOverride.
+func NewOverride(secret []byte, user string, until time.Time) string {
+	expiry := strconv.FormatInt(until.Unix(), 10)
+	return expiry + "." + sign(secret, user, expiry)
+}
+
+// VerifyOverride returns an OverrideFunc accepting the tokens made by
+// NewOverride with the same secret, for the user they were made for, until
+// they expire.
+func VerifyOverride(secret []byte) OverrideFunc {
+	return func(s ssh.Session, token string) bool {
+		expiry, sig, ok := strings.Cut(token, ".")
+		if !ok {
+			return false
+		}
+		until, err := strconv.ParseInt(expiry, 10, 64)
+		if err != nil || time.Now().Unix() >= until {
+			return false
+		}
+		return hmac.Equal([]byte(sig), []byte(sign(secret, s.User(), expiry)))
+	}
+}
+
+func sign(secret []byte, user, expiry string) string {
+	mac := hmac.New(sha256.New, secret)
+	fmt.Fprintf(mac, "%s\x00%s", user, expiry)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
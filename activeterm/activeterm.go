@@ -6,12 +6,18 @@ import (
 
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/capability"
 )
 
 // Middleware will exit 1 connections trying with no active terminals.
+// Subsystem sessions are let through.
 func Middleware() wish.Middleware {
 	return func(sh ssh.Handler) ssh.Handler {
 		return func(s ssh.Session) {
+			if s.Subsystem() != "" {
+				sh(s)
+				return
+			}
 			_, _, active := s.Pty()
 			if !active {
 				fmt.Fprintln(s, "Requires an active PTY")
@@ -22,3 +28,13 @@ func Middleware() wish.Middleware {
 		}
 	}
 }
+
+// Auto returns the middleware declared as providing capability.PTY, for use
+// with the chain package.
+func Auto() capability.Middleware {
+	return capability.Middleware{
+		Name:       "activeterm",
+		Middleware: Middleware(),
+		Provides:   []capability.Capability{capability.PTY},
+	}
+}
@@ -1,6 +1,7 @@
 package activeterm_test
 
 import (
+	"io"
 	"testing"
 
 	"github.com/charmbracelet/ssh"
@@ -19,6 +20,30 @@ func TestMiddleware(t *testing.T) {
 			t.Errorf("invalid output: %q", string(out))
 		}
 	})
+
+	t.Run("subsystem", func(t *testing.T) {
+		sess := testsession.New(t, &ssh.Server{
+			SubsystemHandlers: map[string]ssh.SubsystemHandler{
+				"foo": ssh.SubsystemHandler(activeterm.Middleware()(func(s ssh.Session) {
+					s.Write([]byte("hello"))
+				})),
+			},
+		}, nil)
+		stdout, err := sess.StdoutPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sess.RequestSubsystem("foo"); err != nil {
+			t.Fatal(err)
+		}
+		out, err := io.ReadAll(stdout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != "hello" {
+			t.Errorf("invalid output: %q", string(out))
+		}
+	})
 }
 
 func setup(tb testing.TB) *gossh.Session {
@@ -0,0 +1,198 @@
+// Package admin provides actions operators can trigger on a running server,
+// from Go or with Unix signals: reloading its host keys, authorized keys and
+// configuration, draining it, and dumping its stats.
+package admin
+
+import (
+	"context"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+	"github.com/charmbracelet/wish/stats"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// ReloadHostKeys reads the host keys at the given paths, replacing the server
+// host keys of the same types. New connections use the new keys, while
+// established ones are kept.
+func ReloadHostKeys(srv *ssh.Server, paths ...string) error {
+	signers := make([]gossh.Signer, 0, len(paths))
+	for _, path := range paths {
+		pem, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		signer, err := gossh.ParsePrivateKey(pem)
+		if err != nil {
+			return err
+		}
+		signers = append(signers, signer)
+	}
+	// only replace the keys once they were all read.
+	for _, signer := range signers {
+		srv.AddHostKey(signer)
+	}
+	return nil
+}
+
+// DumpStats writes the summary of the sessions of the given store to w.
+func DumpStats(store stats.Store, w io.Writer) error {
+	sessions, err := store.Sessions()
+	if err != nil {
+		return err
+	}
+	return stats.Summarize(sessions, 10).Write(w)
+}
+
+// Drainer puts a server in drain mode, where new sessions are rejected while
+// the running ones finish, e.g. before restarting it. The zero value is ready
+// to use.
+type Drainer struct {
+	mu       sync.Mutex
+	draining bool
+	active   int
+	idle     chan struct{}
+}
+
+// Middleware tracks the running sessions, and rejects new ones when
+// draining.
+func (d *Drainer) Middleware() wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			d.mu.Lock()
+			if d.draining {
+				d.mu.Unlock()
+				wish.Exit(s, 1, "The server is restarting, please try again later.")
+				return
+			}
+			d.active++
+			d.mu.Unlock()
+			defer d.done()
+			sh(s)
+		}
+	}
+}
+
+func (d *Drainer) done() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.active--
+	if d.active == 0 && d.idle != nil {
+		close(d.idle)
+		d.idle = nil
+	}
+}
+
+// Drain starts rejecting new sessions, and waits for the running ones to
+// finish, or for the context to be done.
+func (d *Drainer) Drain(ctx context.Context) error {
+	d.mu.Lock()
+	d.draining = true
+	if d.active == 0 {
+		d.mu.Unlock()
+		return nil
+	}
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+	idle := d.idle
+	d.mu.Unlock()
+
+	select {
+	case <-idle:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Resume stops rejecting new sessions.
+func (d *Drainer) Resume() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.draining = false
+}
+
+// Draining returns whether new sessions are rejected.
+func (d *Drainer) Draining() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.draining
+}
+
+// Active returns the number of running sessions.
+func (d *Drainer) Active() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.active
+}
+
+// Actions are the actions HandleSignals triggers. Nil actions are skipped.
+type Actions struct {
+	// ReloadHostKeys is triggered by SIGHUP, e.g. calling ReloadHostKeys.
+	ReloadHostKeys func() error
+
+	// ReloadAuthorizedKeys is triggered by SIGHUP, after ReloadHostKeys,
+	// e.g. calling wish.AuthorizedKeys.Reload.
+	ReloadAuthorizedKeys func() error
+
+	// ReloadConfig is triggered by SIGHUP, after ReloadAuthorizedKeys.
+	ReloadConfig func() error
+
+	// DumpStats is triggered by SIGUSR1, e.g. calling DumpStats.
+	DumpStats func() error
+
+	// Drain is triggered by SIGUSR2, e.g. calling Drainer.Drain, and then
+	// shutting the server down.
+	Drain func() error
+}
+
+type action struct {
+	name string
+	fn   func() error
+}
+
+// HandleSignals triggers the given actions when the process receives their
+// signals, until the returned function is called. Errors are logged.
+//
+// Signals are only handled on Unix systems; elsewhere, it does nothing.
+func HandleSignals(a Actions) (stop func()) {
+	actions := signalActions(a)
+	if len(actions) == 0 {
+		return func() {}
+	}
+	ch := make(chan os.Signal, 1)
+	for sig := range actions {
+		signal.Notify(ch, sig)
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-ch:
+				for _, act := range actions[sig] {
+					if act.fn == nil {
+						continue
+					}
+					if err := act.fn(); err != nil {
+						log.Error("admin action failed", "action", act.name, "signal", sig, "error", err)
+					}
+				}
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,194 @@
+package admin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/keygen"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/rpc"
+	"github.com/charmbracelet/wish/stats"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestReloadHostKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "host_ed25519")
+	first, err := keygen.New(path, keygen.WithKeyType(keygen.Ed25519), keygen.WithWrite())
+	requireNoError(t, err)
+	srv := &ssh.Server{Handler: func(ssh.Session) {}}
+	requireNoError(t, ReloadHostKeys(srv, path))
+	addr := testsession.Listen(t, srv)
+
+	connect := func(key gossh.PublicKey) error {
+		c, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+			HostKeyCallback: gossh.FixedHostKey(key),
+		})
+		if err == nil {
+			_ = c.Close()
+		}
+		return err
+	}
+	requireNoError(t, connect(first.PublicKey()))
+	established, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+		HostKeyCallback: gossh.FixedHostKey(first.PublicKey()),
+	})
+	requireNoError(t, err)
+	defer established.Close() // nolint: errcheck
+
+	// rotate the key on disk.
+	second, err := keygen.New("", keygen.WithKeyType(keygen.Ed25519))
+	requireNoError(t, err)
+	requireNoError(t, os.WriteFile(path, second.RawPrivateKey(), 0o600))
+	requireNoError(t, ReloadHostKeys(srv, path))
+	requireNoError(t, connect(second.PublicKey()))
+	if err := connect(first.PublicKey()); err == nil {
+		t.Error("expected the previous key to be replaced")
+	}
+	sess, err := established.NewSession()
+	requireNoError(t, err)
+	requireNoError(t, sess.Run(""))
+
+	if err := ReloadHostKeys(srv, path, path+".missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected os.ErrNotExist, got %v", err)
+	}
+}
+
+func TestDrainer(t *testing.T) {
+	var d Drainer
+	release := make(chan struct{})
+	started := make(chan struct{})
+	srv := &ssh.Server{
+		Handler: d.Middleware()(func(s ssh.Session) {
+			close(started)
+			<-release
+		}),
+	}
+	addr := testsession.Listen(t, srv)
+
+	running, err := testsession.NewClientSession(t, addr, nil)
+	requireNoError(t, err)
+	requireNoError(t, running.Start(""))
+	<-started
+	if d.Active() != 1 {
+		t.Fatalf("expected 1 active session, got %d", d.Active())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := d.Drain(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the drain to time out, got %v", err)
+	}
+	if !d.Draining() {
+		t.Fatal("expected the server to be draining")
+	}
+
+	rejected, err := testsession.NewClientSession(t, addr, nil)
+	requireNoError(t, err)
+	out, err := rejected.CombinedOutput("")
+	if err == nil || !strings.Contains(string(out), "please try again later") {
+		t.Errorf("expected the session to be rejected, got %q: %v", out, err)
+	}
+
+	drained := make(chan error, 1)
+	go func() { drained <- d.Drain(context.Background()) }()
+	close(release)
+	requireNoError(t, <-drained)
+	requireNoError(t, running.Wait())
+
+	d.Resume()
+	if d.Draining() {
+		t.Error("expected the server to accept sessions again")
+	}
+}
+
+func TestDumpStats(t *testing.T) {
+	store := stats.NewMemoryStore(10)
+	requireNoError(t, store.Record(stats.Session{User: "foo", Command: "bar"}))
+	var sb strings.Builder
+	requireNoError(t, DumpStats(store, &sb))
+	if !strings.Contains(sb.String(), "sessions:         1\n") {
+		t.Errorf("unexpected stats: %q", sb.String())
+	}
+}
+
+func requireNoError(tb testing.TB, err error) {
+	tb.Helper()
+	if err != nil {
+		tb.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func TestMaintenance(t *testing.T) {
+	srv := &ssh.Server{
+		Handler: Maintenance()(func(s ssh.Session) {
+			wish.Print(s, "hello")
+		}),
+	}
+	var m wish.Maintenance
+	requireNoError(t, m.Option()(srv))
+	addr := testsession.Listen(t, srv)
+	run := func(user string) (string, error) {
+		sess, err := testsession.NewClientSession(t, addr, &gossh.ClientConfig{User: user})
+		requireNoError(t, err)
+		out, err := sess.CombinedOutput("")
+		return string(out), err
+	}
+
+	m.Set("upgrading the database", wish.Principal{User: "admin"})
+	if out, err := run("foo"); err == nil || !strings.Contains(out, "upgrading the database") {
+		t.Errorf("expected the session to be rejected, got %q: %v", out, err)
+	}
+	if out, err := run("admin"); err != nil || out != "hello" {
+		t.Errorf("expected admins to be let in, got %q: %v", out, err)
+	}
+
+	m.Set("")
+	if out, err := run("foo"); err != nil || out != "hello" {
+		t.Errorf("expected the maintenance to be over, got %q: %v", out, err)
+	}
+}
+
+func TestMaintenanceRoutes(t *testing.T) {
+	var m wish.Maintenance
+	r := rpc.NewRouter()
+	MaintenanceRoutes(r, &m)
+	addr := testsession.Listen(t, &ssh.Server{
+		Handler: rpc.Middleware(r)(func(ssh.Session) {}),
+	})
+	run := func(cmd string) string {
+		sess, err := testsession.NewClientSession(t, addr, nil)
+		requireNoError(t, err)
+		out, err := sess.CombinedOutput(cmd)
+		requireNoError(t, err)
+		return string(out)
+	}
+
+	run(`api maintenance set '{"message": "back at noon", "users": ["admin"]}'`)
+	if msg := m.Message(); msg != "back at noon" {
+		t.Errorf("expected the maintenance to be set, got %q", msg)
+	}
+	if out := run("api maintenance get"); !strings.Contains(out, "back at noon") {
+		t.Errorf("expected the maintenance message, got %q", out)
+	}
+
+	run(`api maintenance clear`)
+	run(`api maintenance schedule '{"message": "moving", "start": "2000-01-01T00:00:00Z"}'`)
+	if msg := m.Message(); msg != "moving" {
+		t.Errorf("expected the scheduled maintenance to be on, got %q", msg)
+	}
+	if n := len(m.Windows()); n != 1 {
+		t.Errorf("expected 1 window, got %d", n)
+	}
+
+	run(`api maintenance clear`)
+	if msg := m.Message(); msg != "" {
+		t.Errorf("expected the maintenance to be over, got %q", msg)
+	}
+}
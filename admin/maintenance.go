@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"errors"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/rpc"
+)
+
+// Maintenance is a middleware rejecting new sessions while the server is in
+// maintenance, with its message, except for the principals allowed in, see
+// wish.Maintenance. It does nothing on servers without one.
+func Maintenance() wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if m := wish.MaintenanceOf(s.Context()); m != nil {
+				if msg, blocked := m.Blocks(s.Context()); blocked {
+					wish.Exit(s, 1, "🚧 "+msg)
+					return
+				}
+			}
+			sh(s)
+		}
+	}
+}
+
+// MaintenanceStatus is the response of the maintenance routes.
+type MaintenanceStatus struct {
+	// Message is the maintenance message, empty if the server isn't in
+	// maintenance.
+	Message string `json:"message,omitempty"`
+
+	// Windows are the scheduled maintenance windows.
+	Windows []wish.Window `json:"windows,omitempty"`
+}
+
+// SetMaintenanceRequest is the request of the "maintenance set" route.
+type SetMaintenanceRequest struct {
+	// Message is the maintenance message. An empty one takes the server out
+	// of maintenance, unless a window is open.
+	Message string `json:"message"`
+
+	// Users are the users allowed in during maintenance.
+	Users []string `json:"users,omitempty"`
+}
+
+// ScheduleMaintenanceRequest is the request of the "maintenance schedule"
+// route.
+type ScheduleMaintenanceRequest struct {
+	Message string    `json:"message"`
+	Start   time.Time `json:"start"`
+	// End is when the maintenance ends. A zero End leaves it open until
+	// cleared.
+	End   time.Time `json:"end,omitempty"`
+	Users []string  `json:"users,omitempty"`
+}
+
+// Validate implements rpc.Validator.
+func (r ScheduleMaintenanceRequest) Validate() error {
+	if !r.End.IsZero() && !r.End.After(r.Start) {
+		return errors.New("end must be after start")
+	}
+	return nil
+}
+
+// MaintenanceRoutes registers routes managing m with the router:
+//
+//	ssh host api maintenance get
+//	ssh host api maintenance set '{"message": "back at noon", "users": ["admin"]}'
+//	ssh host api maintenance schedule '{"start": "2024-01-01T00:00:00Z", "end": "2024-01-01T01:00:00Z"}'
+//	ssh host api maintenance clear
+//
+// Only serve the router to operators, e.g. with accesscontrol.
+func MaintenanceRoutes(r *rpc.Router, m *wish.Maintenance) {
+	status := func() MaintenanceStatus {
+		return MaintenanceStatus{Message: m.Message(), Windows: m.Windows()}
+	}
+	rpc.Handle(r, "maintenance", "get", func(ssh.Session, struct{}) (MaintenanceStatus, error) {
+		return status(), nil
+	})
+	rpc.Handle(r, "maintenance", "set", func(_ ssh.Session, req SetMaintenanceRequest) (MaintenanceStatus, error) {
+		m.Set(req.Message, principals(req.Users)...)
+		return status(), nil
+	})
+	rpc.Handle(r, "maintenance", "schedule", func(_ ssh.Session, req ScheduleMaintenanceRequest) (MaintenanceStatus, error) {
+		m.Schedule(wish.Period{Start: req.Start, End: req.End}, req.Message, principals(req.Users)...)
+		return status(), nil
+	})
+	rpc.Handle(r, "maintenance", "clear", func(ssh.Session, struct{}) (MaintenanceStatus, error) {
+		m.Clear()
+		return status(), nil
+	})
+}
+
+// principals returns the principals of the given users.
+func principals(users []string) []wish.Principal {
+	principals := make([]wish.Principal, 0, len(users))
+	for _, user := range users {
+		principals = append(principals, wish.Principal{User: user})
+	}
+	return principals
+}
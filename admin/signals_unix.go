@@ -0,0 +1,21 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package admin
+
+import (
+	"os"
+	"syscall"
+)
+
+func signalActions(a Actions) map[os.Signal][]action {
+	return map[os.Signal][]action{
+		syscall.SIGHUP: {
+			{"reload host keys", a.ReloadHostKeys},
+			{"reload authorized keys", a.ReloadAuthorizedKeys},
+			{"reload config", a.ReloadConfig},
+		},
+		syscall.SIGUSR1: {{"dump stats", a.DumpStats}},
+		syscall.SIGUSR2: {{"drain", a.Drain}},
+	}
+}
@@ -0,0 +1,47 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package admin
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleSignals(t *testing.T) {
+	triggered := make(chan string, 10)
+	trigger := func(name string) func() error {
+		return func() error {
+			triggered <- name
+			return errors.New("logged")
+		}
+	}
+	stop := HandleSignals(Actions{
+		ReloadHostKeys:       trigger("keys"),
+		ReloadAuthorizedKeys: trigger("authorized keys"),
+		ReloadConfig:         trigger("config"),
+		DumpStats:            trigger("stats"),
+		Drain:                trigger("drain"),
+	})
+	defer stop()
+
+	for sig, expected := range map[syscall.Signal][]string{
+		syscall.SIGHUP:  {"keys", "authorized keys", "config"},
+		syscall.SIGUSR1: {"stats"},
+		syscall.SIGUSR2: {"drain"},
+	} {
+		requireNoError(t, syscall.Kill(syscall.Getpid(), sig))
+		for _, name := range expected {
+			select {
+			case got := <-triggered:
+				if got != name {
+					t.Errorf("%s: expected %q, got %q", sig, name, got)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("%s: expected %q to be triggered", sig, name)
+			}
+		}
+	}
+}
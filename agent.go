@@ -0,0 +1,104 @@
+package wish
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/log"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+var (
+	// ErrAgentUnavailable is returned by ProveKey when the client didn't
+	// forward its agent, e.g. with ssh -A.
+	ErrAgentUnavailable = errors.New("agent forwarding not requested")
+
+	// ErrKeyNotProven is returned by ProveKey when the client's agent didn't
+	// sign the challenge with the key, or the signature is invalid.
+	ErrKeyNotProven = errors.New("key ownership not proven")
+)
+
+// proofNamespace is signed with the challenge, so the signatures can't be
+// mistaken for ones made for something else, like authentication.
+const proofNamespace = "wish-key-proof-v1@charm.sh"
+
+const agentChannelType = "auth-agent@openssh.com"
+
+// ProveKey asks the client's forwarded agent to sign a random challenge with
+// the given key, or the key the user authenticated with if it's nil, and
+// verifies the signature. It confirms the user still controls the private
+// key, e.g. before destructive operations or to link another identity to it.
+//
+// The client must forward its agent, e.g. with ssh -A. Failures are logged as
+// warnings, so they end up in the event log.
+func ProveKey(s ssh.Session, key ssh.PublicKey) error {
+	ctx := s.Context()
+	if key == nil {
+		key = s.PublicKey()
+	}
+	err := proveKey(s, key)
+	if err != nil {
+		log.Warn("could not prove key ownership", "user", ctx.User(), "remote-addr", ctx.RemoteAddr(), "error", err)
+	}
+	return err
+}
+
+func proveKey(s ssh.Session, key ssh.PublicKey) error {
+	if key == nil {
+		return fmt.Errorf("%w: no public key", ErrKeyNotProven)
+	}
+	if !ssh.AgentRequested(s) {
+		return ErrAgentUnavailable
+	}
+	ctx := s.Context()
+	conn, ok := ctx.Value(ssh.ContextKeyConn).(gossh.Conn)
+	if !ok {
+		return ErrAgentUnavailable
+	}
+	ch, reqs, err := conn.OpenChannel(agentChannelType, nil)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrAgentUnavailable, err)
+	}
+	go gossh.DiscardRequests(reqs)
+	defer ch.Close() // nolint: errcheck
+
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	data := gossh.Marshal(struct {
+		Namespace string
+		SessionID string
+		Nonce     []byte
+	}{proofNamespace, ctx.SessionID(), nonce})
+
+	type result struct {
+		sig *gossh.Signature
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		var flags agent.SignatureFlags
+		if key.Type() == gossh.KeyAlgoRSA || key.Type() == gossh.CertAlgoRSAv01 {
+			flags = agent.SignatureFlagRsaSha512
+		}
+		sig, err := agent.NewClient(ch).SignWithFlags(key, data, flags)
+		done <- result{sig, err}
+	}()
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if res.err != nil {
+		return fmt.Errorf("%w: %s", ErrKeyNotProven, res.err)
+	}
+	if err := key.Verify(data, res.sig); err != nil {
+		return fmt.Errorf("%w: %s", ErrKeyNotProven, err)
+	}
+	return nil
+}
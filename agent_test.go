@@ -0,0 +1,69 @@
+package wish
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/charmbracelet/keygen"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestProveKey(t *testing.T) {
+	newKey := func(kt keygen.KeyType) *keygen.SSHKeyPair {
+		k, err := keygen.New("", keygen.WithKeyType(kt))
+		requireNoError(t, err)
+		return k
+	}
+	user, other, rsa := newKey(keygen.Ed25519), newKey(keygen.Ed25519), newKey(keygen.RSA)
+
+	errs := make(chan error, 1)
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			var key ssh.PublicKey
+			if s.RawCommand() == "rsa" {
+				key = rsa.PublicKey()
+			}
+			errs <- ProveKey(s, key)
+		},
+		PublicKeyHandler: func(ssh.Context, ssh.PublicKey) bool { return true },
+	}
+	addr := testsession.Listen(t, srv)
+
+	run := func(cmd string, forward bool, agentKeys ...*keygen.SSHKeyPair) error {
+		t.Helper()
+		keyring := agent.NewKeyring()
+		for _, k := range agentKeys {
+			requireNoError(t, keyring.Add(agent.AddedKey{PrivateKey: k.PrivateKey()}))
+		}
+		client, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+			User:            "testuser",
+			Auth:            []gossh.AuthMethod{gossh.PublicKeys(user.Signer())},
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+		})
+		requireNoError(t, err)
+		defer client.Close() // nolint: errcheck
+		requireNoError(t, agent.ForwardToAgent(client, keyring))
+		sess, err := client.NewSession()
+		requireNoError(t, err)
+		if forward {
+			requireNoError(t, agent.RequestAgentForwarding(sess))
+		}
+		requireNoError(t, sess.Run(cmd))
+		return <-errs
+	}
+
+	requireNoError(t, run("", true, user))
+	requireNoError(t, run("rsa", true, user, rsa))
+	if err := run("", true, other); !errors.Is(err, ErrKeyNotProven) {
+		t.Errorf("expected ErrKeyNotProven, got %v", err)
+	}
+	if err := run("rsa", true, user); !errors.Is(err, ErrKeyNotProven) {
+		t.Errorf("expected ErrKeyNotProven, got %v", err)
+	}
+	if err := run("", false, user); !errors.Is(err, ErrAgentUnavailable) {
+		t.Errorf("expected ErrAgentUnavailable, got %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package wish
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// AuthorizedKeys is an authorized_keys file that can be reloaded while the
+// server runs, e.g. on SIGHUP. Unlike WithAuthorizedKeys, which reads the file
+// on every authentication, the keys are parsed once per reload, and a broken
+// file keeps the previous keys in place. It's safe for concurrent use.
+type AuthorizedKeys struct {
+	path string
+	mu   sync.RWMutex
+	keys []ssh.PublicKey
+}
+
+// NewAuthorizedKeys reads the authorized_keys file at the given path.
+func NewAuthorizedKeys(path string) (*AuthorizedKeys, error) {
+	ak := &AuthorizedKeys{path: path}
+	if err := ak.Reload(); err != nil {
+		return nil, err
+	}
+	return ak, nil
+}
+
+// Reload reads the file again, replacing the authorized keys. On error, the
+// previous keys are kept.
+func (ak *AuthorizedKeys) Reload() error {
+	data, err := os.ReadFile(ak.path)
+	if err != nil {
+		return err
+	}
+	var keys []ssh.PublicKey
+	for i, line := range bytes.Split(data, []byte{'\n'}) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey(line)
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", ak.path, i+1, err)
+		}
+		keys = append(keys, key)
+	}
+
+	ak.mu.Lock()
+	defer ak.mu.Unlock()
+	ak.keys = keys
+	return nil
+}
+
+// Authorize is an ssh.PublicKeyHandler allowing the keys of the file.
+func (ak *AuthorizedKeys) Authorize(_ ssh.Context, key ssh.PublicKey) bool {
+	ak.mu.RLock()
+	defer ak.mu.RUnlock()
+	for _, k := range ak.keys {
+		if ssh.KeysEqual(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// Option returns an ssh.Option allowing the keys of the file.
+func (ak *AuthorizedKeys) Option() ssh.Option {
+	return WithPublicKeyAuth(ak.Authorize)
+}
+
+// PublicKeyAuthorizer is a public key handler that can be swapped while the
+// server runs. Connections already authenticated are kept; the new handler
+// only applies to the next authentications. It's safe for concurrent use.
+type PublicKeyAuthorizer struct {
+	mu sync.RWMutex
+	h  ssh.PublicKeyHandler
+}
+
+// NewPublicKeyAuthorizer returns a PublicKeyAuthorizer using the given
+// handler.
+func NewPublicKeyAuthorizer(h ssh.PublicKeyHandler) *PublicKeyAuthorizer {
+	return &PublicKeyAuthorizer{h: h}
+}
+
+// Set replaces the handler. A nil handler denies all keys.
+func (a *PublicKeyAuthorizer) Set(h ssh.PublicKeyHandler) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.h = h
+}
+
+// Authorize is an ssh.PublicKeyHandler calling the current handler.
+func (a *PublicKeyAuthorizer) Authorize(ctx ssh.Context, key ssh.PublicKey) bool {
+	a.mu.RLock()
+	h := a.h
+	a.mu.RUnlock()
+	return h != nil && h(ctx, key)
+}
+
+// Option returns an ssh.Option using the authorizer for public key
+// authentication.
+func (a *PublicKeyAuthorizer) Option() ssh.Option {
+	return WithPublicKeyAuth(a.Authorize)
+}
@@ -0,0 +1,93 @@
+package wish
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/charmbracelet/keygen"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestAuthorizedKeys(t *testing.T) {
+	if _, err := NewAuthorizedKeys("testdata/invalid_authorized_keys"); err == nil {
+		t.Error("expected an error, got nil")
+	}
+	if _, err := NewAuthorizedKeys("testdata/nope_authorized_keys"); err == nil {
+		t.Error("expected an error, got nil")
+	}
+
+	first, err := keygen.New("", keygen.WithKeyType(keygen.Ed25519))
+	requireNoError(t, err)
+	second, err := keygen.New("", keygen.WithKeyType(keygen.Ed25519))
+	requireNoError(t, err)
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	requireNoError(t, os.WriteFile(path, []byte("# first\n"+first.AuthorizedKey()+"\n"), 0o600))
+	ak, err := NewAuthorizedKeys(path)
+	requireNoError(t, err)
+
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			s.Write([]byte("hello"))
+		},
+	}
+	requireNoError(t, ak.Option()(srv))
+	addr := testsession.Listen(t, srv)
+	connect := func(k *keygen.SSHKeyPair) (*gossh.Client, error) {
+		signer, err := gossh.NewSignerFromKey(k.PrivateKey())
+		requireNoError(t, err)
+		return gossh.Dial("tcp", addr, &gossh.ClientConfig{
+			User:            "testuser",
+			Auth:            []gossh.AuthMethod{gossh.PublicKeys(signer)},
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+		})
+	}
+
+	established, err := connect(first)
+	requireNoError(t, err)
+	defer established.Close() // nolint: errcheck
+	if _, err := connect(second); err == nil {
+		t.Fatal("expected the second key to be denied")
+	}
+
+	requireNoError(t, os.WriteFile(path, []byte(second.AuthorizedKey()+"\n"), 0o600))
+	requireNoError(t, ak.Reload())
+	c, err := connect(second)
+	requireNoError(t, err)
+	_ = c.Close()
+	if _, err := connect(first); err == nil {
+		t.Error("expected the first key to be denied after reloading")
+	}
+
+	// established connections are kept.
+	sess, err := established.NewSession()
+	requireNoError(t, err)
+	out, err := sess.Output("")
+	requireNoError(t, err)
+	requireEqual(t, "hello", string(out))
+
+	// a broken file keeps the previous keys.
+	requireNoError(t, os.WriteFile(path, []byte("not a key\n"), 0o600))
+	if err := ak.Reload(); err == nil {
+		t.Error("expected an error, got nil")
+	}
+	c, err = connect(second)
+	requireNoError(t, err)
+	_ = c.Close()
+}
+
+func TestPublicKeyAuthorizer(t *testing.T) {
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(`ssh-ed25519 AAAAC3NzaC1lZDI1NTE5AAAAIMJlb/qf2B2kMNdBxfpCQqI2ctPcsOkdZGVh5zTRhKtH k3@test`))
+	requireNoError(t, err)
+	a := NewPublicKeyAuthorizer(nil)
+	requireEqual(t, false, a.Authorize(nil, key))
+	a.Set(func(ssh.Context, ssh.PublicKey) bool { return true })
+	requireEqual(t, true, a.Authorize(nil, key))
+
+	ak, err := NewAuthorizedKeys("testdata/authorized_keys")
+	requireNoError(t, err)
+	a.Set(ak.Authorize)
+	requireEqual(t, true, a.Authorize(nil, key))
+}
@@ -0,0 +1,186 @@
+package bubbletea
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+)
+
+// SlowClientMsg is sent to programs when the client can't keep up with their
+// output, e.g. so they render less often or simplify their views, and again
+// once it caught up.
+type SlowClientMsg struct {
+	// Pending is the number of writes waiting to be sent to the client. It's
+	// 0 once the client caught up.
+	Pending int
+}
+
+// WithSlowClient queues the program output, so the program isn't blocked by
+// a slow client, and sends it a SlowClientMsg once threshold writes are
+// pending. Writes block once max writes are pending.
+//
+// This only works with programs writing their output to the session, e.g.
+// created with MakeOptions.
+func WithSlowClient(threshold, max int) Option {
+	return func(c *config) {
+		if threshold <= 0 {
+			return
+		}
+		if max < threshold {
+			max = threshold
+		}
+		c.slowClient = &slowClientConfig{threshold: threshold, max: max}
+	}
+}
+
+type slowClientConfig struct {
+	threshold int
+	max       int
+}
+
+// outputFor returns the writer the program should write its output to.
+func outputFor(s ssh.Session, out io.Writer) io.Writer {
+	ps, ok := programSessionOf(s)
+	if !ok || ps.cfg.slowClient == nil {
+		return out
+	}
+	q := newOutputQueue(out, ps.cfg.slowClient.threshold, ps.cfg.slowClient.max)
+	ps.queue = q
+	return q
+}
+
+// outputQueue writes to the session in its own goroutine, keeping track of
+// the pending writes.
+type outputQueue struct {
+	w         io.Writer
+	threshold int
+	max       int
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  [][]byte
+	slow   bool
+	closed bool
+	err    error
+
+	// notify holds the latest pending count to send to the program.
+	notify chan int
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+func newOutputQueue(w io.Writer, threshold, max int) *outputQueue {
+	q := &outputQueue{
+		w:         w,
+		threshold: threshold,
+		max:       max,
+		notify:    make(chan int, 1),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	go q.drain()
+	return q
+}
+
+// Write implements io.Writer.
+func (q *outputQueue) Write(p []byte) (int, error) {
+	q.mu.Lock()
+	for len(q.queue) >= q.max && !q.closed && q.err == nil {
+		q.cond.Wait()
+	}
+	if q.err != nil {
+		defer q.mu.Unlock()
+		return 0, q.err
+	}
+	if q.closed {
+		// the queue was drained, write directly.
+		q.mu.Unlock()
+		return q.w.Write(p)
+	}
+	defer q.mu.Unlock()
+	q.queue = append(q.queue, append([]byte(nil), p...))
+	if !q.slow && len(q.queue) >= q.threshold {
+		q.slow = true
+		q.notifyLocked(len(q.queue))
+	}
+	q.cond.Broadcast()
+	return len(p), nil
+}
+
+func (q *outputQueue) drain() {
+	defer close(q.done)
+	for {
+		q.mu.Lock()
+		for len(q.queue) == 0 && !q.closed {
+			q.cond.Wait()
+		}
+		if len(q.queue) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		buf := q.queue[0]
+		q.queue = q.queue[1:]
+		q.cond.Broadcast()
+		q.mu.Unlock()
+
+		_, err := q.w.Write(buf)
+
+		q.mu.Lock()
+		if err != nil && q.err == nil {
+			q.err = err
+			q.queue = nil
+			q.cond.Broadcast()
+		}
+		if q.slow && len(q.queue) == 0 {
+			q.slow = false
+			q.notifyLocked(0)
+		}
+		q.mu.Unlock()
+	}
+}
+
+// notifyLocked replaces the pending count to send to the program. It never
+// blocks, as it's only called with the lock held.
+func (q *outputQueue) notifyLocked(pending int) {
+	select {
+	case <-q.notify:
+	default:
+	}
+	q.notify <- pending
+}
+
+// bind sends the program a SlowClientMsg whenever the client falls behind or
+// catches up, until the queue is closed. Messages are sent from their own
+// goroutine, as the program might be blocked writing its output.
+func (q *outputQueue) bind(p interface{ Send(tea.Msg) }) {
+	go func() {
+		for {
+			select {
+			case pending := <-q.notify:
+				p.Send(SlowClientMsg{Pending: pending})
+			case <-q.stop:
+				return
+			}
+		}
+	}()
+}
+
+// close waits for the pending writes to be sent, or ctx to be done. Later
+// writes are written directly.
+func (q *outputQueue) close(ctx context.Context) {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.stop)
+		q.cond.Broadcast()
+	}
+	q.mu.Unlock()
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+	}
+}
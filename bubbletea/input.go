@@ -0,0 +1,343 @@
+package bubbletea
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// inputFilter wraps the input reader of a session's program.
+type inputFilter func(ssh.Session, io.Reader) io.Reader
+
+// inputFor returns the reader the program should read its input from, with
+// the input filters of the middleware applied, and the parker last, so it can
+// interrupt the program's reads.
+//
+// Bubble Tea only sets raw mode on inputs that are *os.File, so when the
+// input is wrapped, raw mode is set here instead.
+func inputFor(s ssh.Session, in io.Reader) io.Reader {
+	ps, ok := programSessionOf(s)
+	if !ok || (len(ps.cfg.inputFilters) == 0 && ps.park == nil) {
+		return in
+	}
+	makeRaw(in)
+	for _, filter := range ps.cfg.inputFilters {
+		in = filter(s, in)
+	}
+	if ps.park != nil {
+		in = ps.park.reader(in)
+	}
+	return in
+}
+
+// WithInputFilter wraps the input of the program with the given filter, e.g.
+// ratelimiter.LimitInput. Filters are applied in order, the last one being
+// the closest to the program.
+func WithInputFilter(filter func(ssh.Session, io.Reader) io.Reader) Option {
+	return func(c *config) {
+		c.inputFilters = append(c.inputFilters, filter)
+	}
+}
+
+// maxSequenceLen is the longest escape sequence the input limits avoid
+// splitting.
+const maxSequenceLen = 32
+
+// WithPasteChunking bounds the amount of input delivered to the program at
+// once, so that pasting megabytes into a TUI doesn't freeze it.
+//
+// Input is delivered in chunks of at most size bytes, without splitting
+// runes or escape sequences, and consecutive chunks of the same burst are
+// delivered at least delay apart, giving the program time to process them.
+func WithPasteChunking(size int, delay time.Duration) Option {
+	return func(c *config) {
+		if size <= 0 {
+			return
+		}
+		c.inputFilters = append(c.inputFilters, func(_ ssh.Session, r io.Reader) io.Reader {
+			return &chunkReader{r: r, size: size, delay: delay}
+		})
+	}
+}
+
+type chunkReader struct {
+	r       io.Reader
+	size    int
+	delay   time.Duration
+	buf     []byte
+	pending []byte
+	err     error
+}
+
+func (c *chunkReader) Read(b []byte) (int, error) {
+	if len(c.pending) > 0 {
+		time.Sleep(c.delay)
+		return c.next(b)
+	}
+	if c.err != nil {
+		return 0, c.err
+	}
+	if len(c.buf) < len(b) {
+		c.buf = make([]byte, len(b))
+	}
+	n, err := c.r.Read(c.buf[:len(b)])
+	c.pending, c.err = c.buf[:n], err
+	return c.next(b)
+}
+
+// next returns the next chunk of the pending input, and the read error once
+// all of it was returned.
+func (c *chunkReader) next(b []byte) (int, error) {
+	size := c.size
+	if size > len(b) {
+		size = len(b)
+	}
+	n := copy(b, c.pending[:chunkLen(c.pending, size)])
+	c.pending = c.pending[n:]
+	if len(c.pending) > 0 {
+		return n, nil
+	}
+	return n, c.err
+}
+
+// chunkLen returns the length of the first chunk of p with at most n bytes,
+// avoiding splitting runes and escape sequences.
+func chunkLen(p []byte, n int) int {
+	if len(p) <= n {
+		return len(p)
+	}
+	i := n
+	for i > 0 && !utf8.RuneStart(p[i]) {
+		i--
+	}
+	from := i - maxSequenceLen
+	if from < 0 {
+		from = 0
+	}
+	if j := bytes.LastIndexByte(p[from:i], '\x1b'); j >= 0 {
+		if j += from; j+sequenceLen(p[j:]) > i {
+			i = j
+		}
+	}
+	if i == 0 {
+		// a single sequence longer than n, give up.
+		return n
+	}
+	return i
+}
+
+// WithKeyRepeatLimit coalesces bursts of repeated keys, which pile up on
+// slow links, by delivering at most n repeats of the same key within the
+// given window. This prevents, for example, a list from scrolling for seconds
+// after the user released the down arrow.
+//
+// Only escape sequences (arrows, function keys, etc) are coalesced, so text
+// input is never altered.
+func WithKeyRepeatLimit(n int, window time.Duration) Option {
+	return func(c *config) {
+		if n <= 0 {
+			return
+		}
+		c.inputFilters = append(c.inputFilters, func(_ ssh.Session, r io.Reader) io.Reader {
+			return &repeatReader{r: r, max: n, window: window}
+		})
+	}
+}
+
+type repeatReader struct {
+	r      io.Reader
+	max    int
+	window time.Duration
+
+	last  string
+	count int
+	since time.Time
+}
+
+func (rr *repeatReader) Read(b []byte) (int, error) {
+	for {
+		n, err := rr.r.Read(b)
+		if n == 0 {
+			return n, err
+		}
+		now := time.Now()
+		out := 0
+		for p := b[:n]; len(p) > 0; {
+			l := sequenceLen(p)
+			seq := p[:l]
+			p = p[l:]
+			if seq[0] == '\x1b' && l > 1 {
+				if string(seq) != rr.last || now.Sub(rr.since) > rr.window {
+					rr.last, rr.count, rr.since = string(seq), 0, now
+				}
+				rr.count++
+				if rr.count > rr.max {
+					continue
+				}
+			} else {
+				rr.last = ""
+			}
+			out += copy(b[out:], seq)
+		}
+		if out > 0 || err != nil {
+			return out, err
+		}
+	}
+}
+
+// sequenceLen returns the length of the first key in p: either an escape
+// sequence or a single rune.
+func sequenceLen(p []byte) int {
+	if p[0] != '\x1b' || len(p) < 2 {
+		_, l := utf8.DecodeRune(p)
+		return l
+	}
+	switch p[1] {
+	case '[':
+		// CSI: parameters and intermediate bytes, followed by a final byte.
+		for i := 2; i < len(p) && i < maxSequenceLen; i++ {
+			if p[i] >= 0x40 && p[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return len(p)
+	case 'O':
+		// SS3: a single final byte.
+		if len(p) >= 3 {
+			return 3
+		}
+		return len(p)
+	default:
+		// alt+key.
+		_, l := utf8.DecodeRune(p[1:])
+		return 1 + l
+	}
+}
+
+// sequenceTimeout is how long sequenceReader waits for the rest of a partial
+// escape sequence, before passing it on as is, e.g. for the escape key.
+var sequenceTimeout = 50 * time.Millisecond
+
+// sequenceReader applies fn to its input, in chunks that don't end with a
+// partial escape sequence, so filters can rewrite or drop whole sequences even
+// when they're split across reads.
+type sequenceReader struct {
+	r    io.Reader
+	done <-chan struct{}
+	fn   func([]byte) []byte
+
+	once    sync.Once
+	reads   chan readResult
+	held    []byte
+	pending []byte
+	err     error
+}
+
+func newSequenceReader(done <-chan struct{}, r io.Reader, fn func([]byte) []byte) *sequenceReader {
+	return &sequenceReader{r: r, done: done, fn: fn, reads: make(chan readResult)}
+}
+
+func (sr *sequenceReader) pump() {
+	for {
+		b := make([]byte, 256)
+		n, err := sr.r.Read(b)
+		select {
+		case sr.reads <- readResult{b[:n], err}:
+		case <-sr.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (sr *sequenceReader) Read(b []byte) (int, error) {
+	sr.once.Do(func() { go sr.pump() })
+	for len(sr.pending) == 0 {
+		if sr.err != nil {
+			return 0, sr.err
+		}
+		if err := sr.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(b, sr.pending)
+	sr.pending = sr.pending[n:]
+	if len(sr.pending) > 0 {
+		return n, nil
+	}
+	return n, sr.err
+}
+
+// fill reads the next input, or passes on the held partial sequence once
+// sequenceTimeout passed.
+func (sr *sequenceReader) fill() error {
+	var timeout <-chan time.Time
+	if len(sr.held) > 0 {
+		timer := time.NewTimer(sequenceTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case res := <-sr.reads:
+		p := append(sr.held, res.b...)
+		sr.held, sr.err = nil, res.err
+		if i := partialSequenceStart(p); i >= 0 && res.err == nil {
+			p, sr.held = p[:i], append([]byte(nil), p[i:]...)
+		}
+		sr.pending = sr.fn(p)
+	case <-timeout:
+		sr.pending, sr.held = sr.fn(sr.held), nil
+	case <-sr.done:
+		return io.EOF
+	}
+	return nil
+}
+
+// partialSequenceStart returns the index of the escape sequence p ends with,
+// if it was cut short, or -1.
+func partialSequenceStart(p []byte) int {
+	from := len(p) - maxSequenceLen
+	if from < 0 {
+		from = 0
+	}
+	i := bytes.LastIndexByte(p[from:], '\x1b')
+	if i < 0 {
+		return -1
+	}
+	i += from
+	if seq := p[i:]; partialSequence(seq) {
+		return i
+	}
+	return -1
+}
+
+// partialSequence returns whether p, which starts with an escape, is an
+// escape sequence that was cut short.
+func partialSequence(p []byte) bool {
+	if len(p) == 1 {
+		return true
+	}
+	switch p[1] {
+	case '[':
+		if len(p) >= 3 && p[2] == 'M' {
+			// X10 mouse events: three bytes following the prefix.
+			return len(p) < 6
+		}
+		for _, c := range p[2:] {
+			if c >= 0x40 && c <= 0x7e {
+				return false
+			}
+		}
+		return true
+	case 'O':
+		return len(p) < 3
+	default:
+		return !utf8.FullRune(p[1:])
+	}
+}
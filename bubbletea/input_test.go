@@ -0,0 +1,111 @@
+package bubbletea
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestChunkLen(t *testing.T) {
+	for name, tc := range map[string]struct {
+		in       string
+		n        int
+		expected int
+	}{
+		"short":             {"hello", 10, 5},
+		"exact":             {"hello", 5, 5},
+		"split":             {"hello world", 5, 5},
+		"rune":              {"héllo", 2, 1},
+		"escape sequence":   {"ab\x1b[1;5A", 5, 2},
+		"long sequence":     {"\x1b[1;2;3;4;5;6A", 4, 4},
+		"complete sequence": {"\x1b[Aabcdefg", 8, 8},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if l := chunkLen([]byte(tc.in), tc.n); l != tc.expected {
+				t.Errorf("expected %d, got %d", tc.expected, l)
+			}
+		})
+	}
+}
+
+func TestChunkReader(t *testing.T) {
+	in := strings.Repeat("é", 100)
+	r := &chunkReader{r: strings.NewReader(in), size: 7}
+	var out bytes.Buffer
+	buf := make([]byte, 256)
+	for {
+		n, err := r.Read(buf)
+		if n > 7 {
+			t.Fatalf("expected chunks of at most 7 bytes, got %d", n)
+		}
+		out.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if out.String() != in {
+		t.Errorf("expected input to be preserved")
+	}
+}
+
+func TestRepeatReader(t *testing.T) {
+	down := "\x1b[B"
+	r := &repeatReader{
+		r:      strings.NewReader(strings.Repeat(down, 10) + "jjjj" + strings.Repeat(down, 2)),
+		max:    3,
+		window: time.Minute,
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := strings.Repeat(down, 3) + "jjjj" + strings.Repeat(down, 2)
+	if string(out) != expected {
+		t.Errorf("expected %q, got %q", expected, string(out))
+	}
+}
+
+func TestKeyTranslator(t *testing.T) {
+	// one byte at a time, so every sequence is split across reads.
+	r := newSequenceReader(make(chan struct{}), iotest.OneByteReader(strings.NewReader("a\x1bOHb\x1bOFc\x1b[A")), keyTranslator(windowsQuirks.keys))
+	bts, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "a\x1b[Hb\x1b[Fc\x1b[A"; string(bts) != expected {
+		t.Errorf("expected %q, got %q", expected, string(bts))
+	}
+}
+
+func TestSequenceReaderTimeout(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close() // nolint: errcheck
+	r := newSequenceReader(make(chan struct{}), pr, func(p []byte) []byte { return p })
+	go func() { _, _ = pw.Write([]byte("\x1b")) }()
+	b := make([]byte, 8)
+	n, err := r.Read(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b[:n]) != "\x1b" {
+		t.Errorf("expected the escape key to be passed on, got %q", b[:n])
+	}
+}
+
+func TestDropMouse(t *testing.T) {
+	// one byte at a time, so every event is split across reads.
+	r := newSequenceReader(make(chan struct{}), iotest.OneByteReader(strings.NewReader("a\x1b[<0;10;5Mb\x1b[M !!c\x1b[<64;1;1m\x1b[A")), dropMouse)
+	bts, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "abc\x1b[A"; string(bts) != expected {
+		t.Errorf("expected %q, got %q", expected, string(bts))
+	}
+}
@@ -0,0 +1,154 @@
+package bubbletea
+
+import (
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// WithProgramLimit limits how many programs a single user may run at the same
+// time. Sessions over the limit are rejected with a friendly message, unless
+// WithTakeover is also used.
+//
+// Users are identified by the given key function, or by their public key
+// fingerprint (falling back to their user name) if it's nil. n <= 0 means no
+// limit.
+func WithProgramLimit(n int, key func(ssh.Session) string) Option {
+	return func(c *config) {
+		if n <= 0 {
+			c.limiter = nil
+			return
+		}
+		if key == nil {
+			key = defaultLimitKey
+		}
+		if c.limiter == nil {
+			c.limiter = &programLimiter{running: map[string][]*limitedProgram{}}
+		}
+		c.limiter.max = n
+		c.limiter.key = key
+	}
+}
+
+// WithTakeover prompts users over the limit set by WithProgramLimit whether
+// they want to take over their oldest running session, which is then closed,
+// instead of rejecting them.
+func WithTakeover() Option {
+	return func(c *config) {
+		c.takeover = true
+	}
+}
+
+func defaultLimitKey(s ssh.Session) string {
+	if pk := s.PublicKey(); pk != nil {
+		return gossh.FingerprintSHA256(pk)
+	}
+	return "user:" + s.User()
+}
+
+type programLimiter struct {
+	mu      sync.Mutex
+	max     int
+	key     func(ssh.Session) string
+	running map[string][]*limitedProgram
+}
+
+type limitedProgram struct {
+	key string
+
+	mu        sync.Mutex
+	p         *tea.Program
+	takenOver bool
+}
+
+// start sets the program running in this slot, killing it right away if the
+// slot was already taken over.
+func (lp *limitedProgram) start(p *tea.Program) {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	lp.p = p
+	if lp.takenOver {
+		p.Kill()
+	}
+}
+
+func (lp *limitedProgram) takeOver() {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	lp.takenOver = true
+	if lp.p != nil {
+		lp.p.Kill()
+	}
+}
+
+func (lp *limitedProgram) wasTakenOver() bool {
+	lp.mu.Lock()
+	defer lp.mu.Unlock()
+	return lp.takenOver
+}
+
+// acquire reserves a program slot for the given session. If the user is over
+// the limit, it either rejects the session, or, if takeover is enabled and
+// the user agrees, takes over their oldest session.
+func (l *programLimiter) acquire(s ssh.Session, takeover bool) (*limitedProgram, bool) {
+	key := l.key(s)
+	slot := &limitedProgram{key: key}
+
+	l.mu.Lock()
+	running := l.running[key]
+	if len(running) < l.max {
+		l.running[key] = append(running, slot)
+		l.mu.Unlock()
+		return slot, true
+	}
+	l.mu.Unlock()
+
+	if !takeover {
+		wish.Exitf(s, 1, "You already have %d sessions running, close one of them and try again.", l.max)
+		return nil, false
+	}
+	wish.Printf(s, "You already have %d sessions running. Take over the oldest one? [y/N] ", l.max)
+	if !confirm(s) {
+		wish.Exit(s, 1, "\r\nNot taking over, bye!")
+		return nil, false
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if running := l.running[key]; len(running) >= l.max && l.max > 0 {
+		running[0].takeOver()
+		l.running[key] = running[1:]
+	}
+	l.running[key] = append(l.running[key], slot)
+	return slot, true
+}
+
+func (l *programLimiter) release(slot *limitedProgram) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	running := l.running[slot.key]
+	for i, lp := range running {
+		if lp == slot {
+			running = append(running[:i:i], running[i+1:]...)
+			break
+		}
+	}
+	if len(running) == 0 {
+		delete(l.running, slot.key)
+		return
+	}
+	l.running[slot.key] = running
+}
+
+// confirm reads the user answer to a yes/no prompt.
+func confirm(s ssh.Session) bool {
+	buf := make([]byte, 64)
+	n, err := promptInput(s).Read(buf)
+	if err != nil || n == 0 {
+		return false
+	}
+	return buf[0] == 'y' || buf[0] == 'Y'
+}
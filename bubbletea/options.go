@@ -0,0 +1,83 @@
+package bubbletea
+
+import (
+	"io"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+)
+
+// Option configures the bubbletea middleware.
+type Option func(*config)
+
+type config struct {
+	downstream   DownstreamMode
+	downstreamIf func(tea.Model) bool
+	inputFilters []inputFilter
+	transcript   func(ssh.Session) io.Writer
+	limiter      *programLimiter
+	takeover     bool
+	park         *parkConfig
+	unlock       ssh.PasswordHandler
+	quirks       bool
+	presets      []Preset
+	slowClient   *slowClientConfig
+	snapshots    *snapshotConfig
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// DownstreamMode defines when the next handler in the middleware chain is
+// called.
+type DownstreamMode int
+
+const (
+	// DownstreamAfter calls the next handler after the program exits.
+	// This is the default.
+	DownstreamAfter DownstreamMode = iota
+
+	// DownstreamSkip never calls the next handler.
+	DownstreamSkip
+
+	// DownstreamConcurrent calls the next handler concurrently with the
+	// program. The middleware returns once both are done.
+	DownstreamConcurrent
+)
+
+// WithDownstream sets when the next handler in the middleware chain is
+// called.
+func WithDownstream(mode DownstreamMode) Option {
+	return func(c *config) {
+		c.downstream = mode
+		c.downstreamIf = nil
+	}
+}
+
+// WithDownstreamIf calls the next handler after the program exits only if fn
+// returns true for the program's final model.
+//
+// This is useful to drop into another middleware once the user is done with
+// the TUI, for example, by checking a field set by the model before it sent
+// tea.Quit.
+func WithDownstreamIf(fn func(tea.Model) bool) Option {
+	return func(c *config) {
+		c.downstream = DownstreamAfter
+		c.downstreamIf = fn
+	}
+}
+
+func (c *config) shouldRunDownstreamAfter(m tea.Model) bool {
+	if c.downstream != DownstreamAfter {
+		return false
+	}
+	if c.downstreamIf != nil {
+		return c.downstreamIf(m)
+	}
+	return true
+}
@@ -0,0 +1,381 @@
+package bubbletea
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// DefaultParkMessage is the placeholder shown to parked sessions when
+// WithIdlePark is used without a message.
+const DefaultParkMessage = "Idle, press any key to resume."
+
+// WithIdlePark parks programs that received no input for the given duration,
+// to save resources on servers with many idle sessions.
+//
+// A parked program stops rendering and processing messages, and the session
+// is shown msg (or DefaultParkMessage if it's empty) instead. The first key
+// the user presses afterwards is discarded, and the program resumes where it
+// left off, repainting the screen.
+//
+// This only works with programs reading their input from the session, e.g.
+// created with MakeOptions.
+func WithIdlePark(after time.Duration, msg string) Option {
+	if msg == "" {
+		msg = DefaultParkMessage
+	}
+	return withPark(&parkConfig{after: after, msg: msg})
+}
+
+// DefaultLockMessage is the message shown to locked sessions when
+// WithIdleLock is used without a message.
+const DefaultLockMessage = "Locked, press any key to unlock."
+
+// DefaultPasswordLockMessage is the prompt shown to locked sessions when
+// WithIdleLock is used without a message, along with WithUnlockPassword.
+const DefaultPasswordLockMessage = "Locked, enter your password to unlock: "
+
+// MaxUnlockAttempts is the number of wrong passwords after which a locked
+// session is disconnected.
+const MaxUnlockAttempts = 3
+
+// WithIdleLock locks programs that received no input for the given duration,
+// so sensitive data doesn't linger on unattended terminals.
+//
+// Like with WithIdlePark, the screen is cleared and the program stops. The
+// session is shown msg (or DefaultLockMessage if it's empty), and the first
+// key the user presses unlocks it. Use WithUnlockPassword to require the
+// user's password instead.
+//
+// This only works with programs reading their input from the session, e.g.
+// created with MakeOptions.
+func WithIdleLock(after time.Duration, msg string) Option {
+	return withPark(&parkConfig{after: after, msg: msg, lock: true})
+}
+
+// WithUnlockPassword makes sessions locked by WithIdleLock only resume once
+// the user types a password auth accepts, e.g. the server's PasswordHandler.
+// They're shown DefaultPasswordLockMessage if WithIdleLock has no message.
+// After MaxUnlockAttempts wrong passwords, the connection is closed.
+func WithUnlockPassword(auth ssh.PasswordHandler) Option {
+	return func(c *config) {
+		c.unlock = auth
+	}
+}
+
+func withPark(park *parkConfig) Option {
+	return func(c *config) {
+		if park.after <= 0 {
+			return
+		}
+		c.park = park
+	}
+}
+
+type parkConfig struct {
+	after time.Duration
+	msg   string
+
+	// lock locks the session, see WithIdleLock.
+	lock bool
+}
+
+// parker tracks the input of a session's program, and parks it once idle.
+//
+// Its reader reads the session input in its own goroutine, so that a pending
+// read can be interrupted when parking: Bubble Tea can't cancel reads from
+// non-file inputs, and would otherwise swallow the key meant to resume it.
+type parker struct {
+	ctx ssh.Context
+	out io.Writer
+	cfg *parkConfig
+	msg string
+
+	// auth, if set, locks the session until the user types a password it
+	// accepts.
+	auth ssh.PasswordHandler
+
+	reads     chan readResult
+	interrupt chan struct{}
+
+	mu      sync.Mutex
+	pending []byte
+	err     error
+	active  bool
+	parked  bool
+	last    time.Time
+}
+
+type readResult struct {
+	b   []byte
+	err error
+}
+
+// startPark sets up parking for the given session, if configured.
+func startPark(ps *programSession) *parker {
+	if ps.cfg.park == nil {
+		return nil
+	}
+	pk := &parker{
+		ctx:       ps.Context(),
+		out:       ps.Session,
+		cfg:       ps.cfg.park,
+		msg:       ps.cfg.park.msg,
+		reads:     make(chan readResult),
+		interrupt: make(chan struct{}, 1),
+		last:      time.Now(),
+	}
+	if pk.cfg.lock {
+		pk.auth = ps.cfg.unlock
+		switch {
+		case pk.msg != "":
+		case pk.auth != nil:
+			pk.msg = DefaultPasswordLockMessage
+		default:
+			pk.msg = DefaultLockMessage
+		}
+	}
+	ps.park = pk
+	return pk
+}
+
+func (pk *parker) reader(r io.Reader) io.Reader {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	if !pk.active {
+		pk.active = true
+		go pk.pump(r)
+	}
+	return pk
+}
+
+func (pk *parker) pump(r io.Reader) {
+	for {
+		b := make([]byte, 256)
+		n, err := r.Read(b)
+		select {
+		case pk.reads <- readResult{b[:n], err}:
+		case <-pk.ctx.Done():
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read implements io.Reader. It returns early with no data if the program is
+// being parked.
+func (pk *parker) Read(b []byte) (int, error) {
+	if pk.buffered() {
+		return pk.next(b)
+	}
+	select {
+	case res := <-pk.reads:
+		pk.mu.Lock()
+		pk.pending, pk.err = res.b, res.err
+		pk.mu.Unlock()
+	case <-pk.interrupt:
+		return 0, nil
+	case <-pk.ctx.Done():
+		return 0, io.EOF
+	}
+	return pk.next(b)
+}
+
+// buffered returns whether there's pending input or a read error.
+func (pk *parker) buffered() bool {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	return len(pk.pending) > 0 || pk.err != nil
+}
+
+// next returns the pending input, and the read error once all of it was
+// returned.
+func (pk *parker) next(b []byte) (int, error) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	n := copy(b, pk.pending)
+	pk.pending = pk.pending[n:]
+	if n > 0 {
+		pk.last = time.Now()
+	}
+	if len(pk.pending) > 0 {
+		return n, nil
+	}
+	return n, pk.err
+}
+
+// discard drops the pending input, returning the read error if any.
+func (pk *parker) discard(res *readResult) error {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	if res != nil {
+		pk.err = res.err
+	}
+	pk.pending = nil
+	return pk.err
+}
+
+// idle returns for how long the program has been idle, and whether it can be
+// parked.
+func (pk *parker) idle() (time.Duration, bool) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	return time.Since(pk.last), pk.active && !pk.parked
+}
+
+func (pk *parker) setParked(parked bool) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	pk.parked = parked
+	pk.last = time.Now()
+}
+
+// watch parks the program whenever it's idle for long enough, until finished
+// is closed.
+func (pk *parker) watch(finished <-chan struct{}, p *tea.Program) {
+	timer := time.NewTimer(pk.cfg.after)
+	defer timer.Stop()
+	for {
+		select {
+		case <-finished:
+			return
+		case <-timer.C:
+			idle, ok := pk.idle()
+			if !ok || idle < pk.cfg.after {
+				timer.Reset(pk.cfg.after - idle)
+				continue
+			}
+			pk.setParked(true)
+			// Run the placeholder as an exec'd command, so the program
+			// releases and restores the terminal from its own event loop.
+			p.Send(tea.Exec(&parkCommand{pk: pk}, nil)())
+			timer.Reset(pk.cfg.after)
+		}
+	}
+}
+
+// parkCommand shows the park message and waits for a key press.
+type parkCommand struct {
+	pk *parker
+}
+
+var _ tea.ExecCommand = &parkCommand{}
+
+// Run implements tea.ExecCommand.
+func (c *parkCommand) Run() error {
+	pk := c.pk
+	defer pk.setParked(false)
+
+	// The program's read loop might still be waiting for input, make it
+	// give up so the key press isn't lost.
+	select {
+	case pk.interrupt <- struct{}{}:
+	default:
+	}
+
+	if pk.auth != nil {
+		_, _ = io.WriteString(pk.out, "\x1b[2J\x1b[H"+pk.msg)
+		return c.unlock()
+	}
+	_, _ = io.WriteString(pk.out, "\x1b[2J\x1b[H"+pk.msg+"\r\n")
+
+	if pk.buffered() {
+		// there's already input waiting, use it to resume.
+		return pk.discard(nil)
+	}
+	defer func() {
+		// drop the interruption if nothing was reading.
+		select {
+		case <-pk.interrupt:
+		default:
+		}
+	}()
+	select {
+	case res := <-pk.reads:
+		return pk.discard(&res)
+	case <-pk.ctx.Done():
+		return pk.ctx.Err()
+	}
+}
+
+// errLocked is returned when too many wrong passwords were typed to unlock a
+// session.
+var errLocked = errors.New("too many unlock attempts")
+
+// unlock reads passwords until one is accepted, echoing their characters as
+// asterisks.
+func (c *parkCommand) unlock() error {
+	pk := c.pk
+	var password []byte
+	var last byte
+	attempts := 0
+	for {
+		var res readResult
+		if pk.buffered() {
+			res = pk.take()
+		} else {
+			select {
+			case res = <-pk.reads:
+			case <-pk.ctx.Done():
+				return pk.ctx.Err()
+			}
+		}
+		for _, b := range res.b {
+			prev := last
+			last = b
+			switch {
+			case b == '\n' && prev == '\r':
+				// a CRLF is a single enter key press.
+			case b == '\r' || b == '\n':
+				if pk.auth(pk.ctx, string(password)) {
+					return pk.discard(&res)
+				}
+				password = password[:0]
+				if attempts++; attempts >= MaxUnlockAttempts {
+					_, _ = io.WriteString(pk.out, "\r\nToo many attempts.\r\n")
+					if conn, ok := pk.ctx.Value(ssh.ContextKeyConn).(gossh.Conn); ok {
+						_ = conn.Close()
+					}
+					return errLocked
+				}
+				_, _ = io.WriteString(pk.out, "\r\nWrong password, try again: ")
+			case b == 0x7f || b == '\b':
+				if len(password) > 0 {
+					password = password[:len(password)-1]
+					_, _ = io.WriteString(pk.out, "\b \b")
+				}
+			case b >= ' ':
+				password = append(password, b)
+				_, _ = io.WriteString(pk.out, "*")
+			}
+		}
+		if res.err != nil {
+			return pk.discard(&res)
+		}
+	}
+}
+
+// take returns the pending input and read error, dropping them.
+func (pk *parker) take() readResult {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	res := readResult{pk.pending, pk.err}
+	pk.pending = nil
+	return res
+}
+
+// SetStdin implements tea.ExecCommand.
+func (*parkCommand) SetStdin(io.Reader) {}
+
+// SetStdout implements tea.ExecCommand.
+func (*parkCommand) SetStdout(io.Writer) {}
+
+// SetStderr implements tea.ExecCommand.
+func (*parkCommand) SetStderr(io.Writer) {}
@@ -0,0 +1,152 @@
+package bubbletea
+
+import (
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/muesli/termenv"
+)
+
+// Preset tunes the middleware for a family of SSH clients.
+type Preset struct {
+	// Name identifies the preset, e.g. "termius".
+	Name string
+
+	// Match reports whether the preset applies to a client, given its SSH
+	// version string and TERM.
+	Match func(version, term string) bool
+
+	// MaxColors is the color profile with the most colors MakeRenderer will
+	// use. The zero value, termenv.TrueColor, doesn't limit it.
+	MaxColors termenv.Profile
+
+	// NoMouse drops mouse events from the program input. Touch screens
+	// usually translate scrolling into a flood of unwanted mouse events.
+	NoMouse bool
+
+	// Width is the window width assumed when the client doesn't report one.
+	Width int
+}
+
+// PresetEnv is the environment variable sessions can set to the name of a
+// preset to ask for it, e.g. ssh -o SetEnv=WISH_PRESET=termius, overriding
+// detection. Setting it to a name no preset has, e.g. "none", applies none.
+const PresetEnv = "WISH_PRESET"
+
+// MobilePresets are presets for popular mobile SSH clients. Clients are
+// detected on a best effort basis, as they don't always identify themselves,
+// so users can pick one with PresetEnv.
+var MobilePresets = []Preset{
+	{
+		Name:      "termius",
+		Match:     versionContains("Termius"),
+		MaxColors: termenv.ANSI256,
+		NoMouse:   true,
+		Width:     40,
+	},
+	{
+		Name:    "blink",
+		Match:   versionContains("Blink"),
+		NoMouse: true,
+		Width:   40,
+	},
+	{
+		Name:      "juicessh",
+		Match:     versionContains("JuiceSSH"),
+		MaxColors: termenv.ANSI256,
+		NoMouse:   true,
+		Width:     40,
+	},
+}
+
+func versionContains(s string) func(string, string) bool {
+	s = strings.ToLower(s)
+	return func(version, _ string) bool {
+		return strings.Contains(strings.ToLower(version), s)
+	}
+}
+
+// WithPresets applies the first of the given presets matching each session's
+// client, e.g. WithPresets(MobilePresets...), unless the session asks for one
+// with PresetEnv.
+func WithPresets(presets ...Preset) Option {
+	return func(c *config) {
+		c.presets = append(c.presets, presets...)
+		c.inputFilters = append(c.inputFilters, func(s ssh.Session, r io.Reader) io.Reader {
+			if preset, ok := PresetFor(s); ok && preset.NoMouse {
+				return newSequenceReader(s.Context().Done(), r, dropMouse)
+			}
+			return r
+		})
+	}
+}
+
+// PresetFor returns the preset applied to the given session, if any. Apps can
+// use it to adapt their layout to the client.
+func PresetFor(s ssh.Session) (Preset, bool) {
+	ps, ok := programSessionOf(s)
+	if !ok {
+		return Preset{}, false
+	}
+	if name, ok := presetEnv(s); ok {
+		for _, preset := range ps.cfg.presets {
+			if preset.Name == name {
+				return preset, true
+			}
+		}
+		return Preset{}, false
+	}
+	pty, _, _ := s.Pty()
+	version := s.Context().ClientVersion()
+	for _, preset := range ps.cfg.presets {
+		if preset.Match != nil && preset.Match(version, pty.Term) {
+			return preset, true
+		}
+	}
+	return Preset{}, false
+}
+
+// presetEnv returns the name of the preset the session asks for with
+// PresetEnv, if any.
+func presetEnv(s ssh.Session) (string, bool) {
+	prefix := PresetEnv + "="
+	for _, env := range s.Environ() {
+		if strings.HasPrefix(env, prefix) {
+			return env[len(prefix):], true
+		}
+	}
+	return "", false
+}
+
+// dropMouse drops the mouse events of the input, for sequenceReader.
+func dropMouse(p []byte) []byte {
+	out := make([]byte, 0, len(p))
+	for len(p) > 0 {
+		l := mouseLen(p)
+		if l == 0 {
+			l = sequenceLen(p)
+			out = append(out, p[:l]...)
+		}
+		p = p[l:]
+	}
+	return out
+}
+
+// mouseLen returns the length of the mouse event at the start of p, or 0 if
+// it doesn't start with one.
+func mouseLen(p []byte) int {
+	switch {
+	case len(p) >= 6 && p[0] == '\x1b' && p[1] == '[' && p[2] == 'M':
+		// X10: three bytes following the prefix.
+		return 6
+	case len(p) >= 3 && p[0] == '\x1b' && p[1] == '[' && p[2] == '<':
+		// SGR: parameters followed by M or m.
+		for i := 3; i < len(p); i++ {
+			if p[i] == 'M' || p[i] == 'm' {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
@@ -0,0 +1,82 @@
+package bubbletea
+
+import (
+	"bytes"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/muesli/termenv"
+)
+
+// WithClientQuirks enables workarounds for the quirks of well known SSH
+// clients, detected from their version string, so apps don't need to special
+// case them:
+//
+//   - Windows OpenSSH: home and end keys sent in application cursor mode are
+//     translated to the sequences Bubble Tea understands, and MakeRenderer
+//     uses at most 256 colors, as true color support depends on the console
+//     hosting it.
+func WithClientQuirks() Option {
+	return func(c *config) {
+		c.quirks = true
+		c.inputFilters = append(c.inputFilters, func(s ssh.Session, r io.Reader) io.Reader {
+			q := quirksFor(s)
+			if len(q.keys) == 0 {
+				return r
+			}
+			return newSequenceReader(s.Context().Done(), r, keyTranslator(q.keys))
+		})
+	}
+}
+
+// quirks are the workarounds needed by a client.
+type quirks struct {
+	// maxColors is the color profile with the most colors the client
+	// reliably supports.
+	maxColors termenv.Profile
+
+	// keys maps the key sequences sent by the client to the ones Bubble Tea
+	// understands.
+	keys map[string]string
+}
+
+var windowsQuirks = quirks{
+	maxColors: termenv.ANSI256,
+	keys: map[string]string{
+		"\x1bOH": "\x1b[H", // home
+		"\x1bOF": "\x1b[F", // end
+	},
+}
+
+// quirksFor returns the workarounds needed by the session's client, if
+// enabled.
+func quirksFor(s ssh.Session) quirks {
+	ps, ok := programSessionOf(s)
+	if !ok || !ps.cfg.quirks {
+		return quirks{}
+	}
+	version := s.Context().ClientVersion()
+	if strings.Contains(version, "OpenSSH_for_Windows") {
+		return windowsQuirks
+	}
+	return quirks{}
+}
+
+// keyTranslator returns a function translating the given key sequences, for
+// sequenceReader.
+func keyTranslator(keys map[string]string) func([]byte) []byte {
+	return func(p []byte) []byte {
+		var out bytes.Buffer
+		for len(p) > 0 {
+			l := sequenceLen(p)
+			if key, ok := keys[string(p[:l])]; ok {
+				out.WriteString(key)
+			} else {
+				out.Write(p[:l])
+			}
+			p = p[l:]
+		}
+		return out.Bytes()
+	}
+}
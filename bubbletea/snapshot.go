@@ -0,0 +1,160 @@
+package bubbletea
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/log"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Snapshotter is implemented by models whose state can survive server
+// restarts, see WithSnapshots.
+type Snapshotter interface {
+	// Snapshot returns the state of the model.
+	Snapshot() ([]byte, error)
+
+	// Restore returns the model with the state of the snapshot.
+	Restore(snapshot []byte) (tea.Model, error)
+}
+
+// SnapshotStore stores the snapshots of models.
+type SnapshotStore interface {
+	// Save stores the snapshot with the given key, replacing any other.
+	Save(key string, snapshot []byte) error
+
+	// Load removes the snapshot with the given key from the store, and
+	// returns it. It returns nil if there's none.
+	Load(key string) ([]byte, error)
+}
+
+// WithSnapshots saves the final model of programs still running when their
+// server shuts down with wish.Shutdowner, if it implements Snapshotter, and
+// restores it in the user's next program, e.g. so games and editors survive
+// restarts. A snapshot is only restored once.
+//
+// Snapshots are stored by the key fn returns for each session, or by
+// SnapshotKey if fn is nil. Programs created with a ProgramHandler must
+// restore their model themselves, with RestoreSnapshot.
+func WithSnapshots(store SnapshotStore, fn func(ssh.Session) string) Option {
+	if fn == nil {
+		fn = SnapshotKey
+	}
+	return func(c *config) {
+		c.snapshots = &snapshotConfig{store: store, key: fn}
+	}
+}
+
+type snapshotConfig struct {
+	store SnapshotStore
+	key   func(ssh.Session) string
+}
+
+// SnapshotKey returns the user name of the session, along with the
+// fingerprint of its public key, if any, so users authenticated with
+// different keys get different snapshots.
+func SnapshotKey(s ssh.Session) string {
+	if pk := s.PublicKey(); pk != nil {
+		return s.User() + " " + gossh.FingerprintSHA256(pk)
+	}
+	return s.User()
+}
+
+// RestoreSnapshot returns m with the state of the user's snapshot, if
+// snapshots are enabled with WithSnapshots, m implements Snapshotter, and
+// there's one. It returns m otherwise, or if the snapshot can't be restored.
+func RestoreSnapshot(s ssh.Session, m tea.Model) tea.Model {
+	ps, ok := programSessionOf(s)
+	if !ok || ps.cfg.snapshots == nil {
+		return m
+	}
+	cfg := ps.cfg
+	sn, ok := m.(Snapshotter)
+	if !ok {
+		return m
+	}
+	key := cfg.snapshots.key(s)
+	snapshot, err := cfg.snapshots.store.Load(key)
+	if err != nil {
+		log.Error("could not load snapshot", "key", key, "error", err)
+		return m
+	}
+	if snapshot == nil {
+		return m
+	}
+	restored, err := sn.Restore(snapshot)
+	if err != nil {
+		log.Error("could not restore snapshot", "key", key, "error", err)
+		return m
+	}
+	return restored
+}
+
+// saveSnapshot saves the snapshot of the final model of the session's
+// program, if it implements Snapshotter.
+func saveSnapshot(s ssh.Session, cfg *snapshotConfig, m tea.Model) {
+	sn, ok := m.(Snapshotter)
+	if !ok {
+		return
+	}
+	key := cfg.key(s)
+	snapshot, err := sn.Snapshot()
+	if err == nil {
+		err = cfg.store.Save(key, snapshot)
+	}
+	if err != nil {
+		log.Error("could not save snapshot", "key", key, "error", err)
+	}
+}
+
+// DirSnapshotStore is a SnapshotStore keeping each snapshot in a file of the
+// directory, which is created if needed. Files are named after the SHA-256
+// hash of their key, so any key fits in a file name.
+type DirSnapshotStore string
+
+var _ SnapshotStore = DirSnapshotStore("")
+
+func (d DirSnapshotStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(string(d), hex.EncodeToString(sum[:]))
+}
+
+// Save implements SnapshotStore.
+func (d DirSnapshotStore) Save(key string, snapshot []byte) error {
+	if err := os.MkdirAll(string(d), 0o700); err != nil {
+		return err
+	}
+	// write to a temporary file first, so a crash doesn't leave a
+	// truncated snapshot behind.
+	f, err := os.CreateTemp(string(d), ".snapshot-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // nolint: errcheck
+	if _, err := f.Write(snapshot); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), d.path(key))
+}
+
+// Load implements SnapshotStore.
+func (d DirSnapshotStore) Load(key string) ([]byte, error) {
+	path := d.path(key)
+	snapshot, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, os.Remove(path)
+}
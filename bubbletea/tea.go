@@ -4,12 +4,14 @@ package bubbletea
 import (
 	"context"
 	"strings"
+	"sync"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
-	"github.com/charmbracelet/log"
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/capability"
+	"github.com/charmbracelet/wish/internal/log"
 	"github.com/muesli/termenv"
 )
 
@@ -39,8 +41,18 @@ type ProgramHandler func(ssh.Session) *tea.Program
 //
 // It also captures window resize events and sends them to the tea.Program
 // as tea.WindowSizeMsgs.
-func Middleware(bth Handler) wish.Middleware {
-	return MiddlewareWithProgramHandler(newDefaultProgramHandler(bth), termenv.Ascii)
+func Middleware(bth Handler, opts ...Option) wish.Middleware {
+	return MiddlewareWithProgramHandler(newDefaultProgramHandler(bth), termenv.Ascii, opts...)
+}
+
+// App returns the middleware declared as requiring capability.PTY, for use
+// with the chain package.
+func App(bth Handler, opts ...Option) capability.Middleware {
+	return capability.Middleware{
+		Name:       "bubbletea",
+		Middleware: Middleware(bth, opts...),
+		Requires:   []capability.Capability{capability.PTY},
+	}
 }
 
 // MiddlewareWithColorProfile allows you to specify the minimum number of colors
@@ -48,8 +60,8 @@ func Middleware(bth Handler) wish.Middleware {
 //
 // If the client's color profile has less colors than p, p will be forced.
 // Use with caution.
-func MiddlewareWithColorProfile(bth Handler, p termenv.Profile) wish.Middleware {
-	return MiddlewareWithProgramHandler(newDefaultProgramHandler(bth), p)
+func MiddlewareWithColorProfile(bth Handler, p termenv.Profile, opts ...Option) wish.Middleware {
+	return MiddlewareWithProgramHandler(newDefaultProgramHandler(bth), p, opts...)
 }
 
 // MiddlewareWithProgramHandler allows you to specify the ProgramHandler to be
@@ -65,53 +77,199 @@ func MiddlewareWithColorProfile(bth Handler, p termenv.Profile) wish.Middleware
 //
 // If the client's color profile has less colors than p, p will be forced.
 // Use with caution.
-func MiddlewareWithProgramHandler(bth ProgramHandler, p termenv.Profile) wish.Middleware {
+//
+// Subsystem sessions are passed to the next handler, without a program.
+func MiddlewareWithProgramHandler(bth ProgramHandler, p termenv.Profile, opts ...Option) wish.Middleware {
+	cfg := newConfig(opts)
 	return func(h ssh.Handler) ssh.Handler {
 		return func(s ssh.Session) {
-			s.Context().SetValue(minColorProfileKey, p)
+			if s.Subsystem() != "" {
+				h(s)
+				return
+			}
+			wish.SetContextValue(s.Context(), MinColorProfileKey, p)
 			_, windowChanges, ok := s.Pty()
 			if !ok {
-				wish.Fatalln(s, "no active terminal, skipping")
+				wish.Exit(s, 1, "no active terminal, skipping")
 				return
 			}
-			p := bth(s)
+			ps := &programSession{Session: s, cfg: cfg}
+			size, _ := InitialWindowSize(ps)
+			initial := ssh.Window{Width: size.Width, Height: size.Height}
+			var slot *limitedProgram
+			if cfg.limiter != nil {
+				var ok bool
+				if slot, ok = cfg.limiter.acquire(s, cfg.takeover); !ok {
+					return
+				}
+				defer cfg.limiter.release(slot)
+			}
+			t := startTranscript(ps)
+			if t != nil {
+				defer t.Close() // nolint: errcheck
+			}
+			pk := startPark(ps)
+			p := bth(ps)
+			oq := ps.queue
 			if p == nil {
+				if oq != nil {
+					oq.close(s.Context())
+				}
 				h(s)
 				return
 			}
-			ctx, cancel := context.WithCancel(s.Context())
+			if oq != nil {
+				oq.bind(p)
+			}
+			if slot != nil {
+				slot.start(p)
+			}
+			var fp program = p
+			if t != nil {
+				fp = t.wrap(p)
+			}
+			var downstream sync.WaitGroup
+			if cfg.downstream == DownstreamConcurrent {
+				downstream.Add(1)
+				go func() {
+					defer downstream.Done()
+					h(s)
+				}()
+			}
+			shutdown := wish.ShuttingDown(s.Context())
+			finished := make(chan struct{})
+			forwarderDone := make(chan struct{})
+			var maintenance func() (string, <-chan struct{})
+			if m := wish.MaintenanceOf(s.Context()); m != nil {
+				maintenance = m.Changed
+			}
+			go func() {
+				defer close(forwarderDone)
+				forward(s.Context(), finished, shutdown, maintenance, fp, initial, windowChanges)
+			}()
+			parkDone := make(chan struct{})
 			go func() {
-				for {
-					select {
-					case <-ctx.Done():
-						p.Quit()
-						return
-					case w := <-windowChanges:
-						p.Send(tea.WindowSizeMsg{Width: w.Width, Height: w.Height})
-					}
+				defer close(parkDone)
+				if pk != nil {
+					pk.watch(finished, p)
 				}
 			}()
-			if _, err := p.Run(); err != nil {
+			m, err := p.Run()
+			if err != nil {
 				log.Error("app exit with error", "error", err)
 			}
+			if cfg.snapshots != nil {
+				select {
+				case <-shutdown:
+					saveSnapshot(s, cfg.snapshots, m)
+				default:
+				}
+			}
+			if oq != nil {
+				// flush the program output before anything else is written.
+				oq.close(s.Context())
+			}
+			// Stop the forwarder and the parker and wait for them to exit,
+			// so nothing is sent to the program after this point.
+			close(finished)
+			<-forwarderDone
+			<-parkDone
 			// p.Kill() will force kill the program if it's still running,
 			// and restore the terminal to its original state in case of a
 			// tui crash
 			p.Kill()
-			cancel()
-			h(s)
+			downstream.Wait()
+			if slot != nil && slot.wasTakenOver() {
+				wish.Exit(s, 1, "This session was taken over by another connection.")
+				return
+			}
+			if cfg.shouldRunDownstreamAfter(m) {
+				h(s)
+			}
 		}
 	}
 }
 
-var minColorProfileKey struct{}
+// ShutdownMsg is sent to programs when their server starts shutting down with
+// wish.Shutdowner, so they can save their state and quit. Programs still
+// running when the shutdown deadline passes are killed.
+type ShutdownMsg struct{}
+
+// MaintenanceMsg is sent to programs when their server goes in or out of
+// maintenance, see wish.Maintenance, and when they start during
+// maintenance. Message is empty when the maintenance is over.
+type MaintenanceMsg struct {
+	Message string
+}
+
+// program is the subset of *tea.Program the forwarder needs.
+type program interface {
+	Send(tea.Msg)
+	Quit()
+}
+
+// forward sends the initial window size, and then every window change, to the
+// program as tea.WindowSizeMsgs until finished is closed. If the session
+// context is done first, the program is asked to quit. A ShutdownMsg is sent
+// when shutdown is closed, and a MaintenanceMsg on maintenance changes, if
+// maintenance isn't nil.
+//
+// It never blocks past finished being closed: a pending Send returns as soon
+// as the program exits, which always happens before finished is closed.
+func forward(ctx context.Context, finished <-chan struct{}, shutdown <-chan struct{}, maintenance func() (string, <-chan struct{}), p program, initial ssh.Window, windowChanges <-chan ssh.Window) {
+	last := tea.WindowSizeMsg{Width: initial.Width, Height: initial.Height}
+	p.Send(last)
+	var maintenanceChanged <-chan struct{}
+	if maintenance != nil {
+		var msg string
+		if msg, maintenanceChanged = maintenance(); msg != "" {
+			p.Send(MaintenanceMsg{Message: msg})
+		}
+	}
+	for {
+		select {
+		case <-finished:
+			return
+		case <-ctx.Done():
+			p.Quit()
+			<-finished
+			return
+		case <-shutdown:
+			shutdown = nil
+			p.Send(ShutdownMsg{})
+		case <-maintenanceChanged:
+			var msg string
+			msg, maintenanceChanged = maintenance()
+			p.Send(MaintenanceMsg{Message: msg})
+		case w, ok := <-windowChanges:
+			if !ok {
+				// the session is over, wait for the program to exit.
+				windowChanges = nil
+				continue
+			}
+			// the initial size is usually also the first window change.
+			if msg := (tea.WindowSizeMsg{Width: w.Width, Height: w.Height}); msg != last {
+				last = msg
+				p.Send(msg)
+			}
+		}
+	}
+}
+
+// MinColorProfileKey is the key of the color profile MakeRenderer forces
+// when the client's has more colors, set by MiddlewareWithProgramHandler.
+var MinColorProfileKey = wish.NewContextKey[termenv.Profile]("bubbletea.min-color-profile")
+
+// RendererKey is the key of the last renderer MakeRenderer returned for the
+// session, so other middlewares can style their output the same way.
+var RendererKey = wish.NewContextKey[*lipgloss.Renderer]("bubbletea.renderer")
 
 var profileNames = [4]string{"TrueColor", "ANSI256", "ANSI", "Ascii"}
 
 // MakeRenderer returns a lipgloss renderer for the current session.
 // This function handle PTYs as well, and should be used to style your application.
 func MakeRenderer(s ssh.Session) *lipgloss.Renderer {
-	cp, ok := s.Context().Value(minColorProfileKey).(termenv.Profile)
+	cp, ok := wish.ContextValue(s.Context(), MinColorProfileKey)
 	if !ok {
 		cp = termenv.Ascii
 	}
@@ -120,11 +278,61 @@ func MakeRenderer(s ssh.Session) *lipgloss.Renderer {
 		wish.Printf(s, "Warning: Client's terminal is %q, forcing %q\r\n", profileNames[r.ColorProfile()], profileNames[cp])
 		r.SetColorProfile(cp)
 	}
+	maxColors := quirksFor(s).maxColors
+	if preset, ok := PresetFor(s); ok && preset.MaxColors > maxColors {
+		maxColors = preset.MaxColors
+	}
+	if r.ColorProfile() < maxColors {
+		r.SetColorProfile(maxColors)
+	}
+	wish.SetContextValue(s.Context(), RendererKey, r)
 	return r
 }
 
+// InitialWindowSize returns the window size the session requested its PTY
+// with, updated by any resizes since. It's useful for handlers that need the
+// window size before the program runs, e.g. to lay out their initial model.
+//
+// The middleware also sends it to the program as its first tea.WindowSizeMsg,
+// so programs don't need to wait for the client to resize.
+//
+// If the client didn't report a width, the width of its preset, if any, is
+// used instead.
+func InitialWindowSize(s ssh.Session) (tea.WindowSizeMsg, bool) {
+	pty, _, ok := s.Pty()
+	if !ok {
+		return tea.WindowSizeMsg{}, false
+	}
+	size := tea.WindowSizeMsg{Width: pty.Window.Width, Height: pty.Window.Height}
+	if preset, ok := PresetFor(s); ok && size.Width == 0 {
+		size.Width = preset.Width
+	}
+	return size, true
+}
+
+// programSession is the session passed to the program handler, carrying the
+// state of the middleware for its program. It's kept on the session, as
+// multiplexed sessions share their context.
+type programSession struct {
+	ssh.Session
+	cfg        *config
+	transcript *transcript
+	park       *parker
+	queue      *outputQueue
+}
+
+// programSessionOf returns the state of the middleware for the given
+// session, if it's the one passed to the program handler.
+func programSessionOf(s ssh.Session) (*programSession, bool) {
+	ps, ok := s.(*programSession)
+	return ps, ok
+}
+
 // MakeOptions returns the tea.WithInput and tea.WithOutput program options
 // taking into account possible Emulated or Allocated PTYs.
+//
+// The session must be the one passed to the handler, for the options of the
+// middleware to apply to the program.
 func MakeOptions(s ssh.Session) []tea.ProgramOption {
 	return makeOpts(s)
 }
@@ -154,6 +362,7 @@ func newDefaultProgramHandler(bth Handler) ProgramHandler {
 		if m == nil {
 			return nil
 		}
+		m = RestoreSnapshot(s, m)
 		return tea.NewProgram(m, append(opts, makeOpts(s)...)...)
 	}
 }
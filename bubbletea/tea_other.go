@@ -4,6 +4,8 @@
 package bubbletea
 
 import (
+	"io"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/ssh"
@@ -12,13 +14,21 @@ import (
 
 func makeOpts(s ssh.Session) []tea.ProgramOption {
 	return []tea.ProgramOption{
-		tea.WithInput(s),
-		tea.WithOutput(s),
+		tea.WithInput(inputFor(s, s)),
+		tea.WithOutput(outputFor(s, s)),
 	}
 }
 
+func makeRaw(io.Reader) {}
+
 func newRenderer(s ssh.Session) *lipgloss.Renderer {
 	pty, _, _ := s.Pty()
 	env := sshEnviron(append(s.Environ(), "TERM="+pty.Term))
 	return lipgloss.NewRenderer(s, termenv.WithEnvironment(env), termenv.WithUnsafe(), termenv.WithColorCache(true))
 }
+
+// promptInput returns the reader to read the user answers to prompts from,
+// before the program starts.
+func promptInput(s ssh.Session) io.Reader {
+	return s
+}
@@ -0,0 +1,1049 @@
+package bubbletea
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+	"github.com/muesli/termenv"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// wish.Cmd can be run with tea.Exec.
+var _ tea.ExecCommand = &wish.Cmd{}
+
+type fakeProgram struct {
+	mu    sync.Mutex
+	msgs  []tea.Msg
+	quits int
+}
+
+func (p *fakeProgram) Send(msg tea.Msg) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.msgs = append(p.msgs, msg)
+}
+
+func (p *fakeProgram) Quit() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.quits++
+}
+
+func TestForward(t *testing.T) {
+	t.Run("window changes", func(t *testing.T) {
+		p := &fakeProgram{}
+		finished := make(chan struct{})
+		windowChanges := make(chan ssh.Window)
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			forward(context.Background(), finished, nil, nil, p, ssh.Window{Width: 10, Height: 20}, windowChanges)
+		}()
+		windowChanges <- ssh.Window{Width: 10, Height: 20}
+		windowChanges <- ssh.Window{Width: 30, Height: 40}
+		close(windowChanges)
+		close(finished)
+		<-done
+
+		expected := []tea.Msg{
+			tea.WindowSizeMsg{Width: 10, Height: 20},
+			tea.WindowSizeMsg{Width: 30, Height: 40},
+		}
+		if len(p.msgs) != len(expected) || p.msgs[0] != expected[0] || p.msgs[1] != expected[1] {
+			t.Errorf("unexpected messages: %v", p.msgs)
+		}
+		if p.quits != 0 {
+			t.Errorf("expected no quits, got %d", p.quits)
+		}
+	})
+
+	t.Run("session done", func(t *testing.T) {
+		p := &fakeProgram{}
+		ctx, cancel := context.WithCancel(context.Background())
+		finished := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			forward(ctx, finished, nil, nil, p, ssh.Window{}, nil)
+		}()
+		cancel()
+		select {
+		case <-done:
+			t.Fatal("forwarder should wait for the program to finish")
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(finished)
+		<-done
+
+		if p.quits != 1 {
+			t.Errorf("expected 1 quit, got %d", p.quits)
+		}
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		p := &fakeProgram{}
+		finished := make(chan struct{})
+		shutdown := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			forward(context.Background(), finished, shutdown, nil, p, ssh.Window{}, nil)
+		}()
+		close(shutdown)
+		time.Sleep(50 * time.Millisecond)
+		close(finished)
+		<-done
+
+		if len(p.msgs) != 2 || p.msgs[1] != (ShutdownMsg{}) {
+			t.Errorf("expected a ShutdownMsg, got %v", p.msgs)
+		}
+	})
+
+	t.Run("maintenance", func(t *testing.T) {
+		p := &fakeProgram{}
+		finished := make(chan struct{})
+		var mu sync.Mutex
+		msg, changed := "upgrading", make(chan struct{})
+		maintenance := func() (string, <-chan struct{}) {
+			mu.Lock()
+			defer mu.Unlock()
+			return msg, changed
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			forward(context.Background(), finished, nil, maintenance, p, ssh.Window{}, nil)
+		}()
+		time.Sleep(50 * time.Millisecond)
+		mu.Lock()
+		msg = ""
+		close(changed)
+		changed = make(chan struct{})
+		mu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		close(finished)
+		<-done
+
+		expected := []tea.Msg{
+			tea.WindowSizeMsg{},
+			MaintenanceMsg{Message: "upgrading"},
+			MaintenanceMsg{},
+		}
+		if len(p.msgs) != len(expected) || p.msgs[1] != expected[1] || p.msgs[2] != expected[2] {
+			t.Errorf("unexpected messages: %v", p.msgs)
+		}
+	})
+}
+
+type quitModel struct{}
+
+func (quitModel) Init() tea.Cmd                         { return tea.Quit }
+func (m quitModel) Update(tea.Msg) (tea.Model, tea.Cmd) { return m, nil }
+func (quitModel) View() string                          { return "" }
+
+func TestMiddlewareNoGoroutineLeak(t *testing.T) {
+	srv := &ssh.Server{
+		Handler: Middleware(func(ssh.Session) (tea.Model, []tea.ProgramOption) {
+			return quitModel{}, nil
+		})(func(ssh.Session) {}),
+	}
+	addr := testsession.Listen(t, srv)
+
+	run := func() {
+		client, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+			User:            "testuser",
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer client.Close() // nolint: errcheck
+		sess, err := client.NewSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sess.RequestPty("xterm", 20, 80, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := sess.Run(""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// warm up so lazily started goroutines are accounted for.
+	run()
+	time.Sleep(100 * time.Millisecond)
+	before := runtime.NumGoroutine()
+
+	const sessions = 10
+	for i := 0; i < sessions; i++ {
+		run()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		after := runtime.NumGoroutine()
+		if after <= before {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines leaked: %d before, %d after", before, after)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestMiddlewareDownstream(t *testing.T) {
+	for name, tc := range map[string]struct {
+		opts   []Option
+		called bool
+	}{
+		"default":    {nil, true},
+		"after":      {[]Option{WithDownstream(DownstreamAfter)}, true},
+		"skip":       {[]Option{WithDownstream(DownstreamSkip)}, false},
+		"concurrent": {[]Option{WithDownstream(DownstreamConcurrent)}, true},
+		"if true": {[]Option{WithDownstreamIf(func(m tea.Model) bool {
+			_, ok := m.(quitModel)
+			return ok
+		})}, true},
+		"if false": {[]Option{WithDownstreamIf(func(tea.Model) bool { return false })}, false},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			var called bool
+			sess := testsession.New(t, &ssh.Server{
+				Handler: Middleware(func(ssh.Session) (tea.Model, []tea.ProgramOption) {
+					return quitModel{}, nil
+				}, tc.opts...)(func(ssh.Session) {
+					mu.Lock()
+					defer mu.Unlock()
+					called = true
+				}),
+			}, nil)
+			if err := sess.RequestPty("xterm", 20, 80, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := sess.Run(""); err != nil {
+				t.Fatal(err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if called != tc.called {
+				t.Errorf("expected downstream called to be %v, got %v", tc.called, called)
+			}
+		})
+	}
+}
+
+type keyQuitModel struct{}
+
+func (keyQuitModel) Init() tea.Cmd { return nil }
+func (m keyQuitModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok && strings.HasSuffix(msg.String(), "q") {
+		return m, tea.Quit
+	}
+	return m, nil
+}
+func (keyQuitModel) View() string { return "" }
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestMiddlewareInputTranscript(t *testing.T) {
+	t.Run("emulated pty", func(t *testing.T) {
+		testInputTranscript(t, false)
+	})
+	t.Run("allocated pty", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip()
+		}
+		testInputTranscript(t, true)
+	})
+}
+
+func testInputTranscript(t *testing.T, allocate bool) {
+	t.Helper()
+	var transcript syncBuffer
+	srv := &ssh.Server{
+		Handler: Middleware(func(ssh.Session) (tea.Model, []tea.ProgramOption) {
+			return keyQuitModel{}, nil
+		}, WithInputTranscript(func(ssh.Session) io.Writer {
+			return &transcript
+		}))(func(ssh.Session) {}),
+	}
+	if allocate {
+		if err := ssh.AllocatePty()(srv); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sess := testsession.New(t, srv, nil)
+	if err := sess.RequestPty("xterm", 24, 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	sess.Stdin = strings.NewReader("hiq")
+	if err := sess.Run(""); err != nil {
+		t.Fatal(err)
+	}
+
+	var input string
+	lines := strings.Split(strings.TrimSpace(transcript.String()), "\n")
+	for _, line := range lines {
+		parts := strings.SplitN(line, " ", 3)
+		if len(parts) != 3 {
+			t.Fatalf("invalid transcript line: %q", line)
+		}
+		switch parts[1] {
+		case "i":
+			s, err := strconv.Unquote(parts[2])
+			if err != nil {
+				t.Fatal(err)
+			}
+			input += s
+		case "r":
+			if parts[2] != "80x24" {
+				t.Errorf("unexpected window size: %q", parts[2])
+			}
+		default:
+			t.Errorf("unexpected event kind: %q", parts[1])
+		}
+	}
+	if input != "hiq" {
+		t.Errorf("expected input %q, got %q", "hiq", input)
+	}
+	if !strings.HasSuffix(lines[0], " r 80x24") {
+		t.Errorf("expected transcript to start with the window size, got %q", lines[0])
+	}
+}
+
+func TestInitialWindowSize(t *testing.T) {
+	var mu sync.Mutex
+	var size tea.WindowSizeMsg
+	var ok bool
+	sess := testsession.New(t, &ssh.Server{
+		Handler: Middleware(func(s ssh.Session) (tea.Model, []tea.ProgramOption) {
+			mu.Lock()
+			defer mu.Unlock()
+			size, ok = InitialWindowSize(s)
+			return quitModel{}, nil
+		})(func(ssh.Session) {}),
+	}, nil)
+	if err := sess.RequestPty("xterm", 24, 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.Run(""); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !ok || size != (tea.WindowSizeMsg{Width: 80, Height: 24}) {
+		t.Errorf("unexpected initial window size: %v %v", size, ok)
+	}
+}
+
+func TestProgramLimitDisabled(t *testing.T) {
+	for _, n := range []int{0, -1} {
+		cfg := newConfig([]Option{WithProgramLimit(1, nil), WithProgramLimit(n, nil)})
+		if cfg.limiter != nil {
+			t.Errorf("expected a limit of %d to disable the limit", n)
+		}
+	}
+}
+
+func TestMiddlewareProgramLimit(t *testing.T) {
+	for name, takeover := range map[string]bool{
+		"reject":   false,
+		"takeover": true,
+	} {
+		takeover := takeover
+		t.Run(name, func(t *testing.T) {
+			opts := []Option{WithProgramLimit(1, func(ssh.Session) string { return "user" })}
+			if takeover {
+				opts = append(opts, WithTakeover())
+			}
+			started := make(chan struct{}, 2)
+			srv := &ssh.Server{
+				Handler: Middleware(func(ssh.Session) (tea.Model, []tea.ProgramOption) {
+					started <- struct{}{}
+					return keyQuitModel{}, nil
+				}, opts...)(func(ssh.Session) {}),
+			}
+			client, err := gossh.Dial("tcp", testsession.Listen(t, srv), &gossh.ClientConfig{
+				User:            "testuser",
+				HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close() // nolint: errcheck
+
+			first, err := client.NewSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := first.RequestPty("xterm", 24, 80, nil); err != nil {
+				t.Fatal(err)
+			}
+			firstIn, err := first.StdinPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var firstOut syncBuffer
+			first.Stdout = &firstOut
+			first.Stderr = &firstOut
+			if err := first.Start(""); err != nil {
+				t.Fatal(err)
+			}
+			<-started
+
+			second, err := client.NewSession()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := second.RequestPty("xterm", 24, 80, nil); err != nil {
+				t.Fatal(err)
+			}
+			secondIn, err := second.StdinPipe()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var secondOut syncBuffer
+			second.Stdout = &secondOut
+			second.Stderr = &secondOut
+			if err := second.Start(""); err != nil {
+				t.Fatal(err)
+			}
+
+			if !takeover {
+				if err := second.Wait(); err == nil {
+					t.Fatal("expected the second session to be rejected")
+				}
+				if !strings.Contains(secondOut.String(), "already have 1 sessions running") {
+					t.Errorf("unexpected output: %q", secondOut.String())
+				}
+				_, _ = firstIn.Write([]byte("q"))
+				if err := first.Wait(); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			_, _ = secondIn.Write([]byte("y"))
+			if err := first.Wait(); err == nil {
+				t.Fatal("expected the first session to be taken over")
+			}
+			if !strings.Contains(firstOut.String(), "taken over") {
+				t.Errorf("unexpected output: %q", firstOut.String())
+			}
+			<-started
+			_, _ = secondIn.Write([]byte("q"))
+			if err := second.Wait(); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+type keyLogModel struct {
+	keys *syncBuffer
+}
+
+func (keyLogModel) Init() tea.Cmd { return nil }
+func (m keyLogModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		_, _ = m.keys.Write([]byte(msg.String()))
+		if strings.HasSuffix(msg.String(), "q") {
+			return m, tea.Quit
+		}
+	}
+	return m, nil
+}
+func (keyLogModel) View() string { return "running" }
+
+func TestMiddlewareIdlePark(t *testing.T) {
+	var keys syncBuffer
+	sess := testsession.New(t, &ssh.Server{
+		Handler: Middleware(func(ssh.Session) (tea.Model, []tea.ProgramOption) {
+			return keyLogModel{&keys}, nil
+		}, WithIdlePark(100*time.Millisecond, "parked!"))(func(ssh.Session) {}),
+	}, nil)
+	if err := sess.RequestPty("xterm", 24, 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	in, err := sess.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out syncBuffer
+	sess.Stdout = &out
+	if err := sess.Start(""); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor := func(s string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(out.String(), s) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %q, got %q", s, out.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	_, _ = in.Write([]byte("a"))
+	waitFor("parked!")
+	// the first key resumes the program, and is not delivered to it.
+	_, _ = in.Write([]byte("b"))
+	time.Sleep(50 * time.Millisecond)
+	_, _ = in.Write([]byte("q"))
+	if err := sess.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if got := keys.String(); got != "aq" {
+		t.Errorf("expected keys %q, got %q", "aq", got)
+	}
+}
+
+func TestMiddlewareIdleLock(t *testing.T) {
+	start := func(t *testing.T, opts ...Option) (*syncBuffer, *syncBuffer, io.Writer, *gossh.Session) {
+		t.Helper()
+		var keys syncBuffer
+		sess := testsession.New(t, &ssh.Server{
+			Handler: Middleware(func(ssh.Session) (tea.Model, []tea.ProgramOption) {
+				return keyLogModel{&keys}, nil
+			}, opts...)(func(ssh.Session) {}),
+		}, nil)
+		if err := sess.RequestPty("xterm", 24, 80, nil); err != nil {
+			t.Fatal(err)
+		}
+		in, err := sess.StdinPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out syncBuffer
+		sess.Stdout = &out
+		if err := sess.Start(""); err != nil {
+			t.Fatal(err)
+		}
+		return &keys, &out, in, sess
+	}
+	waitFor := func(t *testing.T, out *syncBuffer, s string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !strings.Contains(out.String(), s) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %q, got %q", s, out.String())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	password := WithUnlockPassword(func(_ ssh.Context, password string) bool {
+		return password == "secret"
+	})
+
+	t.Run("key press", func(t *testing.T) {
+		keys, out, in, sess := start(t, WithIdleLock(100*time.Millisecond, ""))
+		_, _ = in.Write([]byte("a"))
+		waitFor(t, out, DefaultLockMessage)
+		// the first key unlocks the program, and is not delivered to it.
+		_, _ = in.Write([]byte("b"))
+		time.Sleep(50 * time.Millisecond)
+		_, _ = in.Write([]byte("q"))
+		if err := sess.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		if got := keys.String(); got != "aq" {
+			t.Errorf("expected keys %q, got %q", "aq", got)
+		}
+	})
+
+	t.Run("password", func(t *testing.T) {
+		keys, out, in, sess := start(t, WithIdleLock(100*time.Millisecond, "locked!"), password)
+		_, _ = in.Write([]byte("a"))
+		waitFor(t, out, "locked!")
+		_, _ = in.Write([]byte("wrong\r"))
+		waitFor(t, out, "Wrong password")
+		_, _ = in.Write([]byte("secrex\x7ft\r\n"))
+		time.Sleep(50 * time.Millisecond)
+		_, _ = in.Write([]byte("q"))
+		if err := sess.Wait(); err != nil {
+			t.Fatal(err)
+		}
+		if got := keys.String(); got != "aq" {
+			t.Errorf("expected keys %q, got %q", "aq", got)
+		}
+		if strings.Contains(out.String(), "secret") {
+			t.Error("expected the password not to be echoed")
+		}
+	})
+
+	t.Run("too many attempts", func(t *testing.T) {
+		keys, out, in, sess := start(t, password, WithIdleLock(100*time.Millisecond, "locked!"))
+		_, _ = in.Write([]byte("a"))
+		waitFor(t, out, "locked!")
+		_, _ = in.Write([]byte("1\r2\r3\rq"))
+		if err := sess.Wait(); err == nil {
+			t.Error("expected the connection to be closed")
+		}
+		if !strings.Contains(out.String(), "Too many attempts.") {
+			t.Errorf("expected the session to be told why, got %q", out.String())
+		}
+		if got := keys.String(); got != "a" {
+			t.Errorf("expected keys %q, got %q", "a", got)
+		}
+	})
+}
+
+func TestRendererKey(t *testing.T) {
+	same := make(chan bool, 1)
+	sess := testsession.New(t, &ssh.Server{
+		Handler: Middleware(func(s ssh.Session) (tea.Model, []tea.ProgramOption) {
+			r := MakeRenderer(s)
+			stored, _ := wish.ContextValue(s.Context(), RendererKey)
+			same <- stored == r
+			return quitModel{}, nil
+		})(func(ssh.Session) {}),
+	}, nil)
+	if err := sess.RequestPty("xterm", 24, 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.Run(""); err != nil {
+		t.Fatal(err)
+	}
+	if !<-same {
+		t.Error("expected the renderer to be stored in the context")
+	}
+}
+
+func TestMiddlewareClientQuirks(t *testing.T) {
+	for version, windows := range map[string]bool{
+		"SSH-2.0-PuTTY_Release_0.78":      false,
+		"SSH-2.0-OpenSSH_for_Windows_8.1": true,
+		"SSH-2.0-OpenSSH_9.6":             false,
+	} {
+		version, windows := version, windows
+		t.Run(version, func(t *testing.T) {
+			var keys syncBuffer
+			profile := make(chan termenv.Profile, 1)
+			sess := testsession.New(t, &ssh.Server{
+				Handler: Middleware(func(s ssh.Session) (tea.Model, []tea.ProgramOption) {
+					profile <- MakeRenderer(s).ColorProfile()
+					return keyLogModel{&keys}, nil
+				}, WithClientQuirks())(func(ssh.Session) {}),
+			}, &gossh.ClientConfig{
+				User:          "testuser",
+				ClientVersion: version,
+			})
+			if err := sess.Setenv("COLORTERM", "truecolor"); err != nil {
+				t.Fatal(err)
+			}
+			if err := sess.RequestPty("xterm-256color", 24, 80, nil); err != nil {
+				t.Fatal(err)
+			}
+			sess.Stdin = strings.NewReader("\x1bOHq")
+			if err := sess.Run(""); err != nil {
+				t.Fatal(err)
+			}
+			if got := keys.String(); strings.HasPrefix(got, "home") != windows {
+				t.Errorf("unexpected keys %q", got)
+			}
+			expected := termenv.TrueColor
+			if windows {
+				expected = termenv.ANSI256
+			}
+			if p := <-profile; p != expected {
+				t.Errorf("expected color profile %d, got %d", expected, p)
+			}
+		})
+	}
+}
+
+func TestMiddlewarePresets(t *testing.T) {
+	type result struct {
+		preset  Preset
+		ok      bool
+		size    tea.WindowSizeMsg
+		profile termenv.Profile
+	}
+	for name, tc := range map[string]struct {
+		version, env string
+		presets      []Preset
+		expected     string
+	}{
+		"version":      {"SSH-2.0-Termius_7.0", "", MobilePresets, "termius"},
+		"env":          {"SSH-2.0-OpenSSH_9.6", "blink", MobilePresets, "blink"},
+		"env override": {"SSH-2.0-Termius_7.0", "juicessh", MobilePresets, "juicessh"},
+		"env none":     {"SSH-2.0-Termius_7.0", "none", MobilePresets, ""},
+		"none":         {"SSH-2.0-OpenSSH_9.6", "", MobilePresets, ""},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			expected := tc.expected
+			results := make(chan result, 1)
+			sess := testsession.New(t, &ssh.Server{
+				Handler: Middleware(func(s ssh.Session) (tea.Model, []tea.ProgramOption) {
+					preset, ok := PresetFor(s)
+					size, _ := InitialWindowSize(s)
+					results <- result{preset, ok, size, MakeRenderer(s).ColorProfile()}
+					return quitModel{}, nil
+				}, WithPresets(tc.presets...))(func(ssh.Session) {}),
+			}, &gossh.ClientConfig{
+				User:          "testuser",
+				ClientVersion: tc.version,
+			})
+			if tc.env != "" {
+				if err := sess.Setenv(PresetEnv, tc.env); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := sess.Setenv("COLORTERM", "truecolor"); err != nil {
+				t.Fatal(err)
+			}
+			if err := sess.RequestPty("xterm-256color", 24, 0, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := sess.Run(""); err != nil {
+				t.Fatal(err)
+			}
+			res := <-results
+			if res.preset.Name != expected || res.ok != (expected != "") {
+				t.Fatalf("expected preset %q, got %q", expected, res.preset.Name)
+			}
+			if expected == "" {
+				return
+			}
+			if res.size.Width != res.preset.Width {
+				t.Errorf("expected width %d, got %d", res.preset.Width, res.size.Width)
+			}
+			if res.profile != res.preset.MaxColors {
+				t.Errorf("expected color profile %d, got %d", res.preset.MaxColors, res.profile)
+			}
+		})
+	}
+}
+
+func TestMiddlewareMultiplexedSessions(t *testing.T) {
+	started := make(chan ssh.Session, 1)
+	plain := Middleware(func(s ssh.Session) (tea.Model, []tea.ProgramOption) {
+		started <- s
+		return keyQuitModel{}, nil
+	})(func(ssh.Session) {})
+	mobile := Middleware(func(ssh.Session) (tea.Model, []tea.ProgramOption) {
+		return quitModel{}, nil
+	}, WithPresets(Preset{Name: "any", Match: func(string, string) bool { return true }}))(func(ssh.Session) {})
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			if s.RawCommand() == "mobile" {
+				mobile(s)
+				return
+			}
+			plain(s)
+		},
+	}
+	client, err := gossh.Dial("tcp", testsession.Listen(t, srv), &gossh.ClientConfig{
+		User:            "testuser",
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() // nolint: errcheck
+
+	first, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.RequestPty("xterm", 24, 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := first.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	s := <-started
+
+	// the second session shares the connection, and its context.
+	second, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := second.RequestPty("xterm", 24, 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Run("mobile"); err != nil {
+		t.Fatal(err)
+	}
+	if preset, ok := PresetFor(s); ok {
+		t.Errorf("expected no preset for the first session, got %q", preset.Name)
+	}
+
+	if _, err := io.WriteString(stdin, "q"); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Wait(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// gateWriter blocks writes until it's opened.
+type gateWriter struct {
+	gate chan struct{}
+	buf  syncBuffer
+}
+
+func (g *gateWriter) Write(p []byte) (int, error) {
+	<-g.gate
+	return g.buf.Write(p)
+}
+
+func TestOutputQueue(t *testing.T) {
+	g := &gateWriter{gate: make(chan struct{})}
+	q := newOutputQueue(g, 2, 3)
+	p := &fakeProgram{}
+	q.bind(p)
+
+	msgs := func() []tea.Msg {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return append([]tea.Msg(nil), p.msgs...)
+	}
+	waitForMsgs := func(n int) []tea.Msg {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for len(msgs()) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("expected %d messages, got %v", n, msgs())
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return msgs()
+	}
+
+	// the first write is taken by the drainer, and blocks there.
+	for _, s := range []string{"a", "b", "c"} {
+		if _, err := q.Write([]byte(s)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m := waitForMsgs(1); m[0] != (SlowClientMsg{Pending: 2}) {
+		t.Fatalf("expected the client to be slow, got %v", m)
+	}
+
+	close(g.gate)
+	if m := waitForMsgs(2); m[1] != (SlowClientMsg{Pending: 0}) {
+		t.Fatalf("expected the client to catch up, got %v", m)
+	}
+	q.close(context.Background())
+	if _, err := q.Write([]byte("d")); err != nil {
+		t.Fatal(err)
+	}
+	if s := g.buf.String(); s != "abcd" {
+		t.Errorf("unexpected output %q", s)
+	}
+}
+
+type slowClientModel struct{}
+
+func (slowClientModel) Init() tea.Cmd { return nil }
+func (m slowClientModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	if msg, ok := msg.(SlowClientMsg); ok && msg.Pending == 0 {
+		return m, tea.Quit
+	}
+	return m, nil
+}
+func (slowClientModel) View() string { return "running" }
+
+func TestMiddlewareSlowClient(t *testing.T) {
+	var out syncBuffer
+	sess := testsession.New(t, &ssh.Server{
+		Handler: Middleware(func(s ssh.Session) (tea.Model, []tea.ProgramOption) {
+			return slowClientModel{}, nil
+		}, WithSlowClient(1, 4))(func(ssh.Session) {}),
+	}, nil)
+	sess.Stdout = &out
+	if err := sess.RequestPty("xterm", 20, 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.Run(""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "running") {
+		t.Errorf("expected the program output, got %q", out.String())
+	}
+}
+
+// snapshotModel counts the a's typed, and quits on q or shutdown.
+type snapshotModel struct {
+	n     int
+	typed chan int
+}
+
+var _ Snapshotter = snapshotModel{}
+
+func (snapshotModel) Init() tea.Cmd { return nil }
+func (m snapshotModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case ShutdownMsg:
+		return m, tea.Quit
+	case tea.KeyMsg:
+		for _, r := range msg.Runes {
+			switch r {
+			case 'a':
+				m.n++
+			case 'q':
+				return m, tea.Quit
+			}
+		}
+		m.typed <- m.n
+	}
+	return m, nil
+}
+func (snapshotModel) View() string { return "" }
+
+func (m snapshotModel) Snapshot() ([]byte, error) {
+	return []byte(strconv.Itoa(m.n)), nil
+}
+
+func (m snapshotModel) Restore(snapshot []byte) (tea.Model, error) {
+	n, err := strconv.Atoi(string(snapshot))
+	m.n = n
+	return m, err
+}
+
+func TestDirSnapshotStoreLongKey(t *testing.T) {
+	store := DirSnapshotStore(t.TempDir())
+	// longer than the 255 bytes file names are limited to.
+	key := strings.Repeat("u", 200) + " SHA256:" + strings.Repeat("f", 43)
+	if err := store.Save(key, []byte("state")); err != nil {
+		t.Fatal(err)
+	}
+	snapshot, err := store.Load(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(snapshot) != "state" {
+		t.Errorf("expected the snapshot, got %q", snapshot)
+	}
+}
+
+func TestMiddlewareSnapshots(t *testing.T) {
+	store := DirSnapshotStore(t.TempDir())
+	typed := make(chan int, 10)
+	final := make(chan int, 1)
+	newServer := func() *ssh.Server {
+		return &ssh.Server{
+			Handler: Middleware(func(ssh.Session) (tea.Model, []tea.ProgramOption) {
+				return snapshotModel{typed: typed}, nil
+			}, WithSnapshots(store, nil), WithDownstreamIf(func(m tea.Model) bool {
+				final <- m.(snapshotModel).n
+				return false
+			}))(func(ssh.Session) {}),
+		}
+	}
+
+	// the first server shuts down while the program is running.
+	srv := newServer()
+	var sd wish.Shutdowner
+	if err := sd.Option()(srv); err != nil {
+		t.Fatal(err)
+	}
+	client, err := gossh.Dial("tcp", testsession.Listen(t, srv), &gossh.ClientConfig{
+		User:            "testuser",
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close() // nolint: errcheck
+	sess, err := client.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.RequestPty("xterm", 24, 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	stdin, err := sess.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.Start(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(stdin, "aaa"); err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 3; {
+		select {
+		case n = <-typed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for input")
+		}
+	}
+	shutdown := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		shutdown <- sd.Shutdown(ctx)
+	}()
+	_ = sess.Wait()
+	// clients close their connection once their session is over.
+	_ = client.Close()
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	if n := <-final; n != 3 {
+		t.Fatalf("expected 3 a's, got %d", n)
+	}
+
+	// the next program of the user starts where it left off.
+	sess = testsession.New(t, newServer(), nil)
+	if err := sess.RequestPty("xterm", 24, 80, nil); err != nil {
+		t.Fatal(err)
+	}
+	sess.Stdin = strings.NewReader("aq")
+	if err := sess.Run(""); err != nil {
+		t.Fatal(err)
+	}
+	if n := <-final; n != 4 {
+		t.Errorf("expected the snapshot to be restored, got %d a's", n)
+	}
+
+	// snapshots are only restored once, and not saved on normal exits.
+	entries, err := os.ReadDir(string(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no snapshot left, got %d", len(entries))
+	}
+}
@@ -4,25 +4,39 @@
 package bubbletea
 
 import (
+	"io"
+	"os"
+
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/charmbracelet/ssh"
 	"github.com/muesli/termenv"
+	"golang.org/x/term"
 )
 
 func makeOpts(s ssh.Session) []tea.ProgramOption {
 	pty, _, ok := s.Pty()
 	if !ok || s.EmulatedPty() {
 		return []tea.ProgramOption{
-			tea.WithInput(s),
-			tea.WithOutput(s),
+			tea.WithInput(inputFor(s, s)),
+			tea.WithOutput(outputFor(s, s)),
 		}
 	}
 
 	return []tea.ProgramOption{
-		tea.WithInput(pty.Slave),
-		tea.WithOutput(pty.Slave),
+		tea.WithInput(inputFor(s, pty.Slave)),
+		tea.WithOutput(outputFor(s, pty.Slave)),
+	}
+}
+
+func makeRaw(in io.Reader) {
+	f, ok := in.(*os.File)
+	if !ok || !term.IsTerminal(int(f.Fd())) {
+		return
 	}
+	// the pty is discarded with the session, so there's no need to restore
+	// its previous state.
+	_, _ = term.MakeRaw(int(f.Fd()))
 }
 
 func newRenderer(s ssh.Session) *lipgloss.Renderer {
@@ -33,3 +47,13 @@ func newRenderer(s ssh.Session) *lipgloss.Renderer {
 	}
 	return lipgloss.NewRenderer(pty.Slave, termenv.WithEnvironment(env), termenv.WithColorCache(true))
 }
+
+// promptInput returns the reader to read the user answers to prompts from,
+// before the program starts.
+func promptInput(s ssh.Session) io.Reader {
+	pty, _, ok := s.Pty()
+	if !ok || s.EmulatedPty() || pty.Slave == nil {
+		return s
+	}
+	return pty.Slave
+}
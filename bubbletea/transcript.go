@@ -0,0 +1,133 @@
+package bubbletea
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+)
+
+// WithInputTranscript records the input events of sessions, for UX research
+// or debugging purposes. Only the user input is recorded: key presses, pastes
+// and window resizes, never the program output.
+//
+// fn is called for every session, and should return the writer the
+// transcript is written to, or nil if the session should not be recorded.
+// Since this is keystroke logging, fn should only return a writer if the user
+// consented to it. If the writer is an io.Closer, it's closed once the
+// program exits.
+//
+// Each event is written in its own line, prefixed by the milliseconds
+// elapsed since the program started:
+//
+//	0 r 80x24
+//	1530 i "hello"
+//	2011 i "\x1b[A"
+//
+// Where "r" lines are window resizes, and "i" lines are the raw, Go-quoted,
+// input bytes.
+func WithInputTranscript(fn func(ssh.Session) io.Writer) Option {
+	return func(c *config) {
+		c.transcript = fn
+		c.inputFilters = append(c.inputFilters, func(s ssh.Session, r io.Reader) io.Reader {
+			ps, ok := programSessionOf(s)
+			if !ok || ps.transcript == nil {
+				return r
+			}
+			return &transcriptReader{r: r, t: ps.transcript}
+		})
+	}
+}
+
+type transcript struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+	size  string
+}
+
+// startTranscript starts a transcript for the given session, if configured.
+func startTranscript(ps *programSession) *transcript {
+	if ps.cfg.transcript == nil {
+		return nil
+	}
+	w := ps.cfg.transcript(ps.Session)
+	if w == nil {
+		return nil
+	}
+	t := &transcript{w: w, start: time.Now()}
+	ps.transcript = t
+	if pty, _, ok := ps.Pty(); ok {
+		t.resize(pty.Window.Width, pty.Window.Height)
+	}
+	return t
+}
+
+func (t *transcript) write(kind, data string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.writeLocked(kind, data)
+}
+
+func (t *transcript) writeLocked(kind, data string) {
+	_, _ = fmt.Fprintf(t.w, "%d %s %s\n", time.Since(t.start).Milliseconds(), kind, data)
+}
+
+func (t *transcript) input(b []byte) {
+	t.write("i", strconv.Quote(string(b)))
+}
+
+func (t *transcript) resize(width, height int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	size := fmt.Sprintf("%dx%d", width, height)
+	if size == t.size {
+		return
+	}
+	t.size = size
+	t.writeLocked("r", size)
+}
+
+// wrap returns a program that records the window resizes sent to p.
+func (t *transcript) wrap(p program) program {
+	return &transcriptProgram{program: p, t: t}
+}
+
+// Close closes the underlying writer if it's an io.Closer.
+func (t *transcript) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.w.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+type transcriptProgram struct {
+	program
+	t *transcript
+}
+
+func (p *transcriptProgram) Send(msg tea.Msg) {
+	if w, ok := msg.(tea.WindowSizeMsg); ok {
+		p.t.resize(w.Width, w.Height)
+	}
+	p.program.Send(msg)
+}
+
+type transcriptReader struct {
+	r io.Reader
+	t *transcript
+}
+
+func (r *transcriptReader) Read(b []byte) (int, error) {
+	n, err := r.r.Read(b)
+	if n > 0 {
+		r.t.input(b[:n])
+	}
+	return n, err
+}
@@ -0,0 +1,165 @@
+// Package capability lets middlewares declare the capabilities they provide
+// to the middlewares after them, like an allocated PTY or an authenticated
+// identity, and the ones they require, so chains missing a capability fail at
+// startup rather than in the middle of a session.
+package capability
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+// Capability is something a middleware provides to the ones after it.
+type Capability string
+
+// Well known capabilities.
+const (
+	// PTY means the session has a PTY.
+	PTY Capability = "pty"
+
+	// Identity means the user is authenticated and identified.
+	Identity Capability = "identity"
+
+	// Renderer means a renderer, e.g. a lipgloss.Renderer, is set up for the
+	// session.
+	Renderer Capability = "renderer"
+
+	// TrueColor means the session supports true color output.
+	TrueColor Capability = "color:truecolor"
+)
+
+// ErrMissing is returned when a middleware requires a capability no
+// middleware before it provides.
+var ErrMissing = errors.New("missing capability")
+
+// Middleware is a middleware with its declared capabilities.
+type Middleware struct {
+	// Name identifies the middleware in errors and warnings.
+	Name string
+
+	// Middleware is the middleware itself.
+	Middleware wish.Middleware
+
+	// Provides are the capabilities provided to the middlewares after it,
+	// once it calls the next handler.
+	Provides []Capability
+
+	// Requires are the capabilities the middleware needs the ones before it
+	// to provide.
+	Requires []Capability
+
+	// Deprecated, if set, is why the middleware shouldn't be used anymore,
+	// and what to use instead. It's logged as a warning by Check.
+	Deprecated string
+}
+
+// Check verifies that the capabilities required by each middleware are
+// provided by the ones running before it, and logs a warning for each
+// deprecated middleware.
+//
+// Middlewares are in the same order as for wish.WithMiddleware: the last one
+// runs first.
+func Check(mw ...Middleware) error {
+	provided := map[Capability]bool{}
+	var missing []string
+	for i := len(mw) - 1; i >= 0; i-- {
+		m := mw[i]
+		if m.Deprecated != "" {
+			log.Warn("deprecated middleware", "middleware", m.Name, "reason", m.Deprecated)
+		}
+		for _, c := range m.Requires {
+			if !provided[c] {
+				missing = append(missing, fmt.Sprintf("%s requires %q", m.Name, c))
+			}
+		}
+		for _, c := range m.Provides {
+			provided[c] = true
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrMissing, strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// Compose checks the given middlewares, and returns them ready to be passed
+// to wish.WithMiddleware. At runtime, each one records the capabilities it
+// provides in the session context when calling the next handler, and ends
+// the session if one it requires wasn't provided after all.
+func Compose(mw ...Middleware) ([]wish.Middleware, error) {
+	if err := Check(mw...); err != nil {
+		return nil, err
+	}
+	composed := make([]wish.Middleware, 0, len(mw))
+	for _, m := range mw {
+		composed = append(composed, m.wrap())
+	}
+	return composed, nil
+}
+
+func (m Middleware) wrap() wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		h := m.Middleware(func(s ssh.Session) {
+			Provide(s.Context(), m.Provides...)
+			sh(s)
+		})
+		return func(s ssh.Session) {
+			for _, c := range m.Requires {
+				if !Has(s.Context(), c) {
+					log.Error("missing capability", "middleware", m.Name, "capability", c)
+					wish.Exit(s, 1, "Server misconfigured.")
+					return
+				}
+			}
+			h(s)
+		}
+	}
+}
+
+type setKey struct{}
+
+// set is the capabilities provided so far.
+type set struct {
+	mu   sync.Mutex
+	caps map[Capability]bool
+}
+
+// Provide records the given capabilities as provided in the session context.
+//
+// The ssh library shares the context between the sessions of a connection,
+// so do capabilities.
+func Provide(ctx ssh.Context, caps ...Capability) {
+	if len(caps) == 0 {
+		return
+	}
+	ctx.Lock()
+	st, ok := ctx.Value(setKey{}).(*set)
+	if !ok {
+		st = &set{caps: map[Capability]bool{}}
+		ctx.SetValue(setKey{}, st)
+	}
+	ctx.Unlock()
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, c := range caps {
+		st.caps[c] = true
+	}
+}
+
+// Has returns whether the given capability was provided in the session
+// context.
+func Has(ctx ssh.Context, c Capability) bool {
+	st, ok := ctx.Value(setKey{}).(*set)
+	if !ok {
+		return false
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.caps[c]
+}
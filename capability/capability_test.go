@@ -0,0 +1,92 @@
+package capability
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func passthrough(sh ssh.Handler) ssh.Handler { return sh }
+
+func TestCheck(t *testing.T) {
+	auth := Middleware{Name: "auth", Middleware: passthrough, Provides: []Capability{Identity}}
+	app := Middleware{Name: "app", Middleware: passthrough, Requires: []Capability{Identity, PTY}}
+
+	err := Check(app, auth)
+	if !errors.Is(err, ErrMissing) {
+		t.Fatalf("expected ErrMissing, got %v", err)
+	}
+	if !strings.Contains(err.Error(), `app requires "pty"`) || strings.Contains(err.Error(), "identity") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// auth runs after app.
+	if err := Check(auth, app); err == nil || !strings.Contains(err.Error(), `app requires "identity"`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	pty := Middleware{Name: "pty", Middleware: passthrough, Provides: []Capability{PTY}}
+	if err := Check(app, auth, pty); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestCompose(t *testing.T) {
+	mw, err := Compose(
+		Middleware{
+			Name: "app",
+			Middleware: func(sh ssh.Handler) ssh.Handler {
+				return func(s ssh.Session) {
+					wish.Print(s, "identified: ", Has(s.Context(), Identity))
+					sh(s)
+				}
+			},
+			Requires: []Capability{Identity},
+		},
+		Middleware{
+			Name:       "auth",
+			Middleware: passthrough,
+			Provides:   []Capability{Identity},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := testsession.New(t, &ssh.Server{
+		Handler: chain(mw...),
+	}, nil).Output("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "identified: true" {
+		t.Errorf("unexpected output %q", string(out))
+	}
+}
+
+func TestMissingAtRuntime(t *testing.T) {
+	app := Middleware{Name: "app", Middleware: passthrough, Requires: []Capability{Renderer}}
+	sess := testsession.New(t, &ssh.Server{
+		Handler: chain(app.wrap()),
+	}, nil)
+	var stderr strings.Builder
+	sess.Stderr = &stderr
+	if err := sess.Run(""); err == nil {
+		t.Error("expected an error")
+	}
+	if strings.TrimSpace(stderr.String()) != "Server misconfigured." {
+		t.Errorf("unexpected stderr %q", stderr.String())
+	}
+}
+
+// chain composes the middlewares like wish.WithMiddleware does.
+func chain(mw ...wish.Middleware) ssh.Handler {
+	h := func(ssh.Session) {}
+	for _, m := range mw {
+		h = m(h)
+	}
+	return h
+}
@@ -0,0 +1,145 @@
+// Package chain builds middleware chains in the order they run, resolving
+// the dependencies between middlewares from their declared capabilities.
+//
+//	srv, err := wish.NewServer(
+//		wish.WithAddress(":2222"),
+//		chain.New().
+//			Use(activeterm.Auto()).
+//			Use(bubbletea.App(handler)).
+//			Build(),
+//	)
+//
+// Unlike wish.WithMiddleware, middlewares are given first to last: the first
+// one used runs first.
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/capability"
+)
+
+// ErrCycle is returned when middlewares depend on each other.
+var ErrCycle = errors.New("middleware dependency cycle")
+
+// Builder builds a middleware chain.
+type Builder struct {
+	mw []capability.Middleware
+}
+
+// New returns an empty Builder.
+func New() *Builder {
+	return &Builder{}
+}
+
+// Use adds middlewares to the chain, after the ones already added. Unnamed
+// middlewares are named after their position.
+func (b *Builder) Use(mw ...capability.Middleware) *Builder {
+	for _, m := range mw {
+		if m.Name == "" {
+			m.Name = fmt.Sprintf("#%d", len(b.mw)+1)
+		}
+		b.mw = append(b.mw, m)
+	}
+	return b
+}
+
+// UseFunc adds a middleware without declared capabilities to the chain.
+func (b *Builder) UseFunc(name string, m wish.Middleware) *Builder {
+	return b.Use(capability.Middleware{Name: name, Middleware: m})
+}
+
+// Order returns the middlewares in the order they will run.
+//
+// Middlewares run in the order they were added in, except when one requires
+// a capability provided by middlewares added after it, in which case it runs
+// after all of them.
+func (b *Builder) Order() ([]capability.Middleware, error) {
+	providers := map[capability.Capability][]int{}
+	for i, m := range b.mw {
+		for _, c := range m.Provides {
+			providers[c] = append(providers[c], i)
+		}
+	}
+
+	// after[i] are the middlewares that must run after i, and pending[i] the
+	// number of middlewares i still waits for.
+	after := make([][]int, len(b.mw))
+	pending := make([]int, len(b.mw))
+	var missing []string
+	for i, m := range b.mw {
+		for _, c := range m.Requires {
+			ps := providers[c]
+			if len(ps) == 0 {
+				missing = append(missing, fmt.Sprintf("%s requires %q", m.Name, c))
+			}
+			for _, p := range ps {
+				if p == i {
+					continue
+				}
+				after[p] = append(after[p], i)
+				pending[i]++
+			}
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", capability.ErrMissing, strings.Join(missing, ", "))
+	}
+
+	order := make([]capability.Middleware, 0, len(b.mw))
+	done := make([]bool, len(b.mw))
+	for len(order) < len(b.mw) {
+		next := -1
+		for i := range b.mw {
+			if !done[i] && pending[i] == 0 {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			var names []string
+			for i, m := range b.mw {
+				if !done[i] {
+					names = append(names, m.Name)
+				}
+			}
+			return nil, fmt.Errorf("%w: %s", ErrCycle, strings.Join(names, ", "))
+		}
+		done[next] = true
+		order = append(order, b.mw[next])
+		for _, i := range after[next] {
+			pending[i]--
+		}
+	}
+	return order, nil
+}
+
+// Build returns an option setting the server handler to the chain. It fails
+// when applied if the chain can't be ordered.
+//
+// The middlewares are given their names with wish.Named, so the sessions
+// going through the chain can be traced with wish.TraceOf.
+func (b *Builder) Build() ssh.Option {
+	return func(srv *ssh.Server) error {
+		order, err := b.Order()
+		if err != nil {
+			return err
+		}
+		// wish.WithMiddleware runs the last middleware first.
+		for i, j := 0, len(order)-1; i < j; i, j = i+1, j-1 {
+			order[i], order[j] = order[j], order[i]
+		}
+		mw, err := capability.Compose(order...)
+		if err != nil {
+			return err
+		}
+		for i := range mw {
+			mw[i] = wish.Named(order[i].Name, mw[i])
+		}
+		return wish.WithMiddleware(mw...)(srv)
+	}
+}
@@ -0,0 +1,113 @@
+package chain
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/capability"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func printing(name string) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			wish.Print(s, name, " ")
+			sh(s)
+		}
+	}
+}
+
+func declared(name string, provides, requires []capability.Capability) capability.Middleware {
+	return capability.Middleware{
+		Name:       name,
+		Middleware: printing(name),
+		Provides:   provides,
+		Requires:   requires,
+	}
+}
+
+func names(mw []capability.Middleware) []string {
+	var ns []string
+	for _, m := range mw {
+		ns = append(ns, m.Name)
+	}
+	return ns
+}
+
+func TestOrder(t *testing.T) {
+	identity := []capability.Capability{capability.Identity}
+	pty := []capability.Capability{capability.PTY}
+
+	order, err := New().
+		Use(declared("app", nil, append(pty, identity...))).
+		UseFunc("logging", printing("logging")).
+		Use(declared("auth", identity, nil)).
+		Use(declared("activeterm", pty, nil)).
+		Order()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"logging", "auth", "activeterm", "app"}
+	if got := names(order); len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i, n := range names(order) {
+		if n != expected[i] {
+			t.Errorf("expected %v, got %v", expected, names(order))
+			break
+		}
+	}
+
+	if _, err := New().Use(declared("app", nil, pty)).Order(); !errors.Is(err, capability.ErrMissing) {
+		t.Errorf("expected ErrMissing, got %v", err)
+	}
+
+	_, err = New().
+		Use(declared("a", identity, pty)).
+		Use(declared("b", pty, identity)).
+		Order()
+	if !errors.Is(err, ErrCycle) {
+		t.Errorf("expected ErrCycle, got %v", err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	var trace wish.Trace
+	srv := &ssh.Server{}
+	err := New().
+		Use(declared("app", nil, []capability.Capability{capability.Identity})).
+		Use(capability.Middleware{Middleware: printing("unnamed")}).
+		Use(declared("auth", []capability.Capability{capability.Identity}, nil)).
+		UseFunc("trace", func(sh ssh.Handler) ssh.Handler {
+			return func(s ssh.Session) {
+				trace = wish.TraceOf(s.Context())
+				sh(s)
+			}
+		}).
+		Build()(srv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := testsession.New(t, srv, nil).Output("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "unnamed auth app "; string(out) != expected {
+		t.Errorf("expected %q, got %q", expected, string(out))
+	}
+	var traced []string
+	for _, st := range trace {
+		traced = append(traced, st.Name)
+	}
+	if got, expected := strings.Join(traced, " "), "#2 auth app trace"; got != expected {
+		t.Errorf("expected the session to be traced through %q, got %q", expected, got)
+	}
+
+	err = New().Use(declared("app", nil, []capability.Capability{capability.PTY})).Build()(&ssh.Server{})
+	if !errors.Is(err, capability.ErrMissing) {
+		t.Errorf("expected ErrMissing, got %v", err)
+	}
+}
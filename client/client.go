@@ -0,0 +1,210 @@
+// Package client provides helpers to connect to wish servers
+// programmatically, e.g. from bots, health probes, and integration tests.
+package client
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// DefaultPort is the port used when an address has none.
+const DefaultPort = 22
+
+// ErrInvalidURL is returned when parsing a malformed connection string.
+var ErrInvalidURL = errors.New("invalid ssh url")
+
+// URL returns the ssh://user@host:port connection string for the given user
+// and address.
+func URL(user, addr string) string {
+	u := url.URL{
+		Scheme: "ssh",
+		Host:   withPort(addr),
+	}
+	if user != "" {
+		u.User = url.User(user)
+	}
+	return u.String()
+}
+
+// ParseURL parses a ssh://user@host:port connection string, returning the
+// user (which might be empty) and the address to dial.
+func ParseURL(s string) (user string, addr string, err error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %s", ErrInvalidURL, err)
+	}
+	if u.Scheme != "ssh" || u.Host == "" {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidURL, s)
+	}
+	return u.User.Username(), withPort(u.Host), nil
+}
+
+func withPort(addr string) string {
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return net.JoinHostPort(addr, strconv.Itoa(DefaultPort))
+}
+
+// KnownHostsLine returns the known_hosts line pinning the given host key for
+// the given address, to be handed out to users of a server.
+func KnownHostsLine(addr string, key gossh.PublicKey) string {
+	return knownhosts.Line([]string{knownhosts.Normalize(withPort(addr))}, key)
+}
+
+// Option configures a connection.
+type Option func(*gossh.ClientConfig)
+
+// WithUser sets the user to connect as.
+func WithUser(user string) Option {
+	return func(cfg *gossh.ClientConfig) {
+		cfg.User = user
+	}
+}
+
+// WithSigners authenticates with the given keys.
+func WithSigners(signers ...gossh.Signer) Option {
+	return func(cfg *gossh.ClientConfig) {
+		cfg.Auth = append(cfg.Auth, gossh.PublicKeys(signers...))
+	}
+}
+
+// WithPassword authenticates with the given password.
+func WithPassword(password string) Option {
+	return func(cfg *gossh.ClientConfig) {
+		cfg.Auth = append(cfg.Auth, gossh.Password(password))
+	}
+}
+
+// WithHostKey pins the server host key: connecting to a server presenting
+// another key fails.
+func WithHostKey(key gossh.PublicKey) Option {
+	return func(cfg *gossh.ClientConfig) {
+		cfg.HostKeyCallback = gossh.FixedHostKey(key)
+	}
+}
+
+// WithKnownHosts verifies the server host key against the given known_hosts
+// files.
+func WithKnownHosts(files ...string) Option {
+	return func(cfg *gossh.ClientConfig) {
+		cb, err := knownhosts.New(files...)
+		if err != nil {
+			cfg.HostKeyCallback = func(string, net.Addr, gossh.PublicKey) error {
+				return err
+			}
+			return
+		}
+		cfg.HostKeyCallback = cb
+	}
+}
+
+// WithInsecureIgnoreHostKey accepts any server host key. Only use it in
+// tests, or against servers on trusted networks.
+func WithInsecureIgnoreHostKey() Option {
+	return func(cfg *gossh.ClientConfig) {
+		cfg.HostKeyCallback = gossh.InsecureIgnoreHostKey() // nolint: gosec
+	}
+}
+
+// WithTimeout sets the maximum amount of time to wait for the connection to
+// be established.
+func WithTimeout(d time.Duration) Option {
+	return func(cfg *gossh.ClientConfig) {
+		cfg.Timeout = d
+	}
+}
+
+// ErrNoHostKeyCallback is returned by Dial when the server host key isn't
+// verified by any option.
+var ErrNoHostKeyCallback = errors.New("no host key verification configured")
+
+// Dial connects to the wish server at the given address, which can also be a
+// ssh:// connection string. A user in the connection string is used unless
+// WithUser is given.
+func Dial(addr string, opts ...Option) (*gossh.Client, error) {
+	addr, cfg, err := newConfig(addr, opts)
+	if err != nil {
+		return nil, err
+	}
+	return gossh.Dial("tcp", addr, cfg)
+}
+
+// NewClient establishes a connection to the wish server at the given address
+// over an existing connection, e.g. a WebSocket stream where TCP isn't
+// available, like in browsers. The address is only used to verify the host
+// key, and to get the user from a ssh:// connection string.
+func NewClient(conn net.Conn, addr string, opts ...Option) (*gossh.Client, error) {
+	addr, cfg, err := newConfig(addr, opts)
+	if err != nil {
+		return nil, err
+	}
+	c, chans, reqs, err := gossh.NewClientConn(conn, addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return gossh.NewClient(c, chans, reqs), nil
+}
+
+// newConfig returns the address to connect to, and the client configuration
+// with the given options applied.
+func newConfig(addr string, opts []Option) (string, *gossh.ClientConfig, error) {
+	cfg := &gossh.ClientConfig{}
+	if user, a, err := ParseURL(addr); err == nil {
+		cfg.User, addr = user, a
+	} else {
+		addr = withPort(addr)
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.HostKeyCallback == nil {
+		return "", nil, ErrNoHostKeyCallback
+	}
+	return addr, cfg, nil
+}
+
+// Run runs the given command in a new session, with the given input, and
+// returns its combined output.
+func Run(c *gossh.Client, cmd string, stdin io.Reader) ([]byte, error) {
+	sess, err := c.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Close() // nolint: errcheck
+	var out syncBuffer
+	sess.Stdin = stdin
+	sess.Stdout = &out
+	sess.Stderr = &out
+	err = sess.Run(cmd)
+	return out.Bytes(), err
+}
+
+// syncBuffer is a bytes.Buffer safe for concurrent writes, as the session
+// copies stdout and stderr in different goroutines.
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.b.Bytes()
+}
@@ -0,0 +1,121 @@
+package client
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/keygen"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestURL(t *testing.T) {
+	for addr, expected := range map[string]string{
+		"localhost":      "ssh://foo@localhost:22",
+		"localhost:2222": "ssh://foo@localhost:2222",
+		"[::1]:2222":     "ssh://foo@[::1]:2222",
+	} {
+		if u := URL("foo", addr); u != expected {
+			t.Errorf("expected %q, got %q", expected, u)
+		}
+	}
+	if u := URL("", "localhost:2222"); u != "ssh://localhost:2222" {
+		t.Errorf("unexpected url without user: %q", u)
+	}
+}
+
+func TestParseURL(t *testing.T) {
+	user, addr, err := ParseURL("ssh://foo@localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user != "foo" || addr != "localhost:22" {
+		t.Errorf("unexpected user %q and address %q", user, addr)
+	}
+	for _, s := range []string{"https://localhost", "ssh://", "localhost:22"} {
+		if _, _, err := ParseURL(s); !errors.Is(err, ErrInvalidURL) {
+			t.Errorf("expected %q to be invalid, got %v", s, err)
+		}
+	}
+}
+
+func TestKnownHostsLine(t *testing.T) {
+	key := newSigner(t).PublicKey()
+	line := KnownHostsLine("localhost:2222", key)
+	if !strings.HasPrefix(line, "[localhost]:2222 ssh-ed25519 ") {
+		t.Errorf("unexpected known hosts line: %q", line)
+	}
+	if line := KnownHostsLine("localhost", key); !strings.HasPrefix(line, "localhost ssh-ed25519 ") {
+		t.Errorf("unexpected known hosts line: %q", line)
+	}
+}
+
+func TestDial(t *testing.T) {
+	hostKey := newSigner(t)
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			wish.Printf(s, "hello %s, running %q", s.User(), s.RawCommand())
+		},
+	}
+	srv.AddHostKey(hostKey)
+	addr := testsession.Listen(t, srv)
+
+	t.Run("pinned", func(t *testing.T) {
+		c, err := Dial(URL("foo", addr), WithHostKey(hostKey.PublicKey()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close() // nolint: errcheck
+		out, err := Run(c, "echo hi", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := `hello foo, running "echo hi"`; string(out) != expected {
+			t.Errorf("expected %q, got %q", expected, string(out))
+		}
+	})
+
+	t.Run("wrong host key", func(t *testing.T) {
+		if _, err := Dial(addr, WithHostKey(newSigner(t).PublicKey())); err == nil {
+			t.Fatal("expected an error")
+		}
+	})
+
+	t.Run("existing connection", func(t *testing.T) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, err := NewClient(conn, URL("bar", addr), WithHostKey(hostKey.PublicKey()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close() // nolint: errcheck
+		out, err := Run(c, "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := `hello bar, running ""`; string(out) != expected {
+			t.Errorf("expected %q, got %q", expected, string(out))
+		}
+	})
+
+	t.Run("no host key verification", func(t *testing.T) {
+		if _, err := Dial(addr); !errors.Is(err, ErrNoHostKeyCallback) {
+			t.Fatalf("expected ErrNoHostKeyCallback, got %v", err)
+		}
+	})
+}
+
+func newSigner(tb testing.TB) gossh.Signer {
+	tb.Helper()
+	k, err := keygen.New("", keygen.WithKeyType(keygen.Ed25519))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return k.Signer()
+}
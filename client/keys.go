@@ -0,0 +1,93 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/charmbracelet/keygen"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// LoadKey loads the key pair at the given path, creating an ed25519 one if it
+// doesn't exist. The public key is stored next to it, with a .pub extension.
+func LoadKey(path string) (*keygen.KeyPair, error) {
+	return keygen.New(path, keygen.WithKeyType(keygen.Ed25519), keygen.WithWrite())
+}
+
+// RotateKey replaces the key pair at the given path with a new one, moving
+// the previous one to path.old. It returns both, so the new public key can be
+// registered with servers authenticating with the previous one.
+func RotateKey(path string) (next, prev *keygen.KeyPair, err error) {
+	if _, err := os.Stat(path); err != nil {
+		return nil, nil, err
+	}
+	old := path + ".old"
+	for _, ext := range []string{"", ".pub"} {
+		if err := os.Rename(path+ext, old+ext); err != nil {
+			return nil, nil, err
+		}
+	}
+	prev, err = keygen.New(old)
+	if err == nil {
+		next, err = LoadKey(path)
+	}
+	if err != nil {
+		// put the previous key back in place.
+		for _, ext := range []string{"", ".pub"} {
+			_ = os.Rename(old+ext, path+ext)
+		}
+		return nil, nil, err
+	}
+	return next, prev, nil
+}
+
+// knownHostsMu serializes writes to known_hosts files.
+var knownHostsMu sync.Mutex
+
+// PinHostKey adds a known_hosts line for the given host key at the given
+// address to the file, creating it if needed, unless the host is already
+// known. If it's known with another key, it returns the *knownhosts.KeyError.
+func PinHostKey(file, addr string, key gossh.PublicKey) error {
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+
+	addr = withPort(addr)
+	if _, err := os.Stat(file); err == nil {
+		cb, err := knownhosts.New(file)
+		if err != nil {
+			return err
+		}
+		// the address takes precedence over the remote address.
+		err = cb(addr, &net.TCPAddr{IP: net.IPv4zero}, key)
+		var keyErr *knownhosts.KeyError
+		if !errors.As(err, &keyErr) || len(keyErr.Want) > 0 {
+			return err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(f, KnownHostsLine(addr, key)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WithTrustOnFirstUse verifies the server host key against the given
+// known_hosts file, pinning it the first time the server is connected to.
+func WithTrustOnFirstUse(file string) Option {
+	return func(cfg *gossh.ClientConfig) {
+		cfg.HostKeyCallback = func(hostname string, _ net.Addr, key gossh.PublicKey) error {
+			return PinHostKey(file, hostname, key)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestRotateKey(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if _, _, err := RotateKey(path); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist, got %v", err)
+	}
+
+	first, err := LoadKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := LoadKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ssh.KeysEqual(first.PublicKey(), again.PublicKey()) {
+		t.Fatal("expected the key to be loaded, not created again")
+	}
+
+	next, prev, err := RotateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ssh.KeysEqual(prev.PublicKey(), first.PublicKey()) {
+		t.Error("expected the previous key to be returned")
+	}
+	if ssh.KeysEqual(next.PublicKey(), first.PublicKey()) {
+		t.Error("expected a new key")
+	}
+	loaded, err := LoadKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ssh.KeysEqual(loaded.PublicKey(), next.PublicKey()) {
+		t.Error("expected the new key to be stored")
+	}
+	for _, f := range []string{path + ".pub", path + ".old", path + ".old.pub"} {
+		if _, err := os.Stat(f); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestTrustOnFirstUse(t *testing.T) {
+	hostKey := newSigner(t)
+	srv := &ssh.Server{Handler: func(ssh.Session) {}}
+	srv.AddHostKey(hostKey)
+	addr := testsession.Listen(t, srv)
+	file := filepath.Join(t.TempDir(), "known_hosts")
+
+	for i := 0; i < 2; i++ {
+		c, err := Dial(addr, WithTrustOnFirstUse(file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = c.Close()
+	}
+	bts, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := KnownHostsLine(addr, hostKey.PublicKey()) + "\n"; string(bts) != expected {
+		t.Errorf("expected %q, got %q", expected, string(bts))
+	}
+
+	// the server key changed.
+	err = PinHostKey(file, addr, newSigner(t).PublicKey())
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		t.Errorf("expected a key error, got %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+// Package clientinfo parses the capabilities and version cooperating clients
+// report in the WISH_CLIENT environment variable, so apps can adapt to them
+// better than from TERM alone.
+//
+// The variable holds semicolon separated key=value pairs, e.g.:
+//
+//	WISH_CLIENT="v=1;app=mycli/1.2.3;colors=truecolor;unicode=1;hyperlinks=1;graphics=kitty,sixel"
+//
+// The keys are:
+//
+//   - v: the version of the format, which must be 1. Values with another
+//     version are ignored.
+//   - app: the name of the client app, optionally followed by a slash and
+//     its version.
+//   - colors: the number of colors the terminal supports: 2, 16, 256 or
+//     truecolor.
+//   - unicode: 1 if the terminal can render unicode, 0 if it can't.
+//   - hyperlinks: 1 if the terminal supports OSC 8 hyperlinks, 0 if it
+//     doesn't.
+//   - graphics: the comma separated image protocols the terminal supports,
+//     e.g. kitty, sixel or iterm.
+//
+// Keys are lowercase, and unknown keys are kept in Info.Extra. Neither keys
+// nor values can contain semicolons.
+//
+// OpenSSH clients can send it with, for instance:
+//
+//	ssh -o SetEnv="WISH_CLIENT=v=1;colors=256" host
+//
+// Go clients can use Setenv.
+package clientinfo
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// EnvVar is the environment variable clients report their info in.
+const EnvVar = "WISH_CLIENT"
+
+// Version is the version of the format.
+const Version = 1
+
+// TrueColor is the number of colors of terminals supporting 24-bit colors.
+const TrueColor = 1 << 24
+
+// ErrVersion is returned parsing info of an unsupported version.
+var ErrVersion = errors.New("clientinfo: unsupported version")
+
+// Feature is a capability the client may or may not have reported.
+type Feature int
+
+// Features.
+const (
+	Unknown Feature = iota
+	Supported
+	Unsupported
+)
+
+// Info is what the client reported about itself. Zero values mean the client
+// didn't report it.
+type Info struct {
+	App        string
+	AppVersion string
+	Colors     int
+	Unicode    Feature
+	Hyperlinks Feature
+	Graphics   []string
+	Extra      map[string]string
+}
+
+// Parse parses the value of the WISH_CLIENT variable.
+func Parse(s string) (Info, error) {
+	var info Info
+	var version bool
+	for _, field := range strings.Split(s, ";") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(field, "=")
+		if !ok {
+			return Info{}, fmt.Errorf("clientinfo: invalid field %q", field)
+		}
+		var err error
+		switch k {
+		case "v":
+			if v != strconv.Itoa(Version) {
+				return Info{}, ErrVersion
+			}
+			version = true
+		case "app":
+			info.App, info.AppVersion, _ = strings.Cut(v, "/")
+		case "colors":
+			info.Colors, err = parseColors(v)
+		case "unicode":
+			info.Unicode, err = parseFeature(v)
+		case "hyperlinks":
+			info.Hyperlinks, err = parseFeature(v)
+		case "graphics":
+			info.Graphics = strings.Split(v, ",")
+		default:
+			if info.Extra == nil {
+				info.Extra = map[string]string{}
+			}
+			info.Extra[k] = v
+		}
+		if err != nil {
+			return Info{}, fmt.Errorf("clientinfo: invalid %s: %w", k, err)
+		}
+	}
+	if !version {
+		return Info{}, ErrVersion
+	}
+	return info, nil
+}
+
+func parseColors(v string) (int, error) {
+	if v == "truecolor" {
+		return TrueColor, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 2, 16, 256, TrueColor:
+		return n, nil
+	default:
+		return 0, fmt.Errorf("unsupported number of colors: %d", n)
+	}
+}
+
+func parseFeature(v string) (Feature, error) {
+	switch v {
+	case "1":
+		return Supported, nil
+	case "0":
+		return Unsupported, nil
+	default:
+		return Unknown, fmt.Errorf("expected 0 or 1, got %q", v)
+	}
+}
+
+// String returns the info in the WISH_CLIENT format.
+func (i Info) String() string {
+	fields := []string{"v=" + strconv.Itoa(Version)}
+	if i.App != "" {
+		app := i.App
+		if i.AppVersion != "" {
+			app += "/" + i.AppVersion
+		}
+		fields = append(fields, "app="+app)
+	}
+	switch i.Colors {
+	case 0:
+	case TrueColor:
+		fields = append(fields, "colors=truecolor")
+	default:
+		fields = append(fields, "colors="+strconv.Itoa(i.Colors))
+	}
+	for _, f := range []struct {
+		key     string
+		feature Feature
+	}{{"unicode", i.Unicode}, {"hyperlinks", i.Hyperlinks}} {
+		switch f.feature {
+		case Supported:
+			fields = append(fields, f.key+"=1")
+		case Unsupported:
+			fields = append(fields, f.key+"=0")
+		}
+	}
+	if len(i.Graphics) > 0 {
+		fields = append(fields, "graphics="+strings.Join(i.Graphics, ","))
+	}
+	keys := make([]string, 0, len(i.Extra))
+	for k := range i.Extra {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fields = append(fields, k+"="+i.Extra[k])
+	}
+	return strings.Join(fields, ";")
+}
+
+// Setenv sets the info in the environment of a client session. It must be
+// called before the session starts.
+func Setenv(sess *gossh.Session, info Info) error {
+	return sess.Setenv(EnvVar, info.String())
+}
+
+type infoKey struct{}
+
+// Middleware parses the info the client reported, if any, into the session
+// context, where it's available with FromContext. Invalid info is ignored.
+func Middleware() wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if info, ok := lookup(s.Environ()); ok {
+				s.Context().SetValue(infoKey{}, info)
+			}
+			sh(s)
+		}
+	}
+}
+
+func lookup(env []string) (Info, bool) {
+	for _, kv := range env {
+		if strings.HasPrefix(kv, EnvVar+"=") {
+			info, err := Parse(strings.TrimPrefix(kv, EnvVar+"="))
+			return info, err == nil
+		}
+	}
+	return Info{}, false
+}
+
+// FromContext returns the info the client reported, as parsed by the
+// middleware.
+func FromContext(ctx ssh.Context) (Info, bool) {
+	info, ok := ctx.Value(infoKey{}).(Info)
+	return info, ok
+}
@@ -0,0 +1,63 @@
+package clientinfo
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestParse(t *testing.T) {
+	info, err := Parse("v=1; app=mycli/1.2.3;colors=truecolor;unicode=1;hyperlinks=0;graphics=kitty,sixel;x-theme=dark")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := Info{
+		App:        "mycli",
+		AppVersion: "1.2.3",
+		Colors:     TrueColor,
+		Unicode:    Supported,
+		Hyperlinks: Unsupported,
+		Graphics:   []string{"kitty", "sixel"},
+		Extra:      map[string]string{"x-theme": "dark"},
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("expected %+v, got %+v", expected, info)
+	}
+
+	again, err := Parse(info.String())
+	if err != nil || !reflect.DeepEqual(again, expected) {
+		t.Errorf("expected %q to round trip, got %+v: %v", info.String(), again, err)
+	}
+
+	for _, s := range []string{"", "app=foo", "v=2;app=foo"} {
+		if _, err := Parse(s); !errors.Is(err, ErrVersion) {
+			t.Errorf("%q: expected ErrVersion, got %v", s, err)
+		}
+	}
+	for _, s := range []string{"v=1;colors=12", "v=1;unicode=yes", "v=1;app"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	srv := &ssh.Server{
+		Handler: Middleware()(func(s ssh.Session) {
+			info, ok := FromContext(s.Context())
+			if !ok || info.App != "mycli" || info.Colors != 256 {
+				_ = s.Exit(1)
+			}
+		}),
+	}
+	sess := testsession.New(t, srv, nil)
+	if err := Setenv(sess, Info{App: "mycli", Colors: 256}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := sess.Run(""); err != nil {
+		t.Errorf("expected the info to be parsed, got %v", err)
+	}
+}
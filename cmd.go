@@ -2,15 +2,29 @@ package wish
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"os/exec"
+	"time"
 
-	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/ssh"
 )
 
 // CommandContext is like Command but includes a context.
 //
+// The command is sent SIGTERM when the context is done, e.g. once a timeout
+// set with context.WithTimeout elapses, or when the session's connection is
+// closed, so a disconnected client doesn't leave it running, and killed if
+// it's still running a couple of seconds later:
+//
+//	ctx, cancel := context.WithTimeout(s.Context(), time.Minute)
+//	defer cancel()
+//	err := wish.CommandContext(ctx, s, "make", "test").Run()
+//
+// If it's killed because the context is done, Run returns an error wrapping
+// the context's, e.g. context.DeadlineExceeded.
+//
 // If the current session does not have a PTY, it sets them to the session
 // itself.
 //
@@ -18,8 +32,16 @@ import (
 // server in conjunction with the AllocatePty option is not recommended,
 // as once the command finishes, the PTY will be killed too.
 func CommandContext(ctx context.Context, s ssh.Session, name string, args ...string) *Cmd {
-	cmd := exec.CommandContext(ctx, name, args...)
-	return &Cmd{s, cmd}
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		select {
+		case <-s.Context().Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	cmd := exec.Command(name, args...)
+	return &Cmd{sess: s, cmd: cmd, ctx: ctx, cancel: cancel}
 }
 
 // Command sets stdin, stdout, and stderr to the current session's PTY.
@@ -27,6 +49,13 @@ func CommandContext(ctx context.Context, s ssh.Session, name string, args ...str
 // If the current session does not have a PTY, it sets them to the session
 // itself.
 //
+// The signals sent by the client, e.g. with ssh -O, are forwarded to the
+// command while it runs. On Unix, the command gets a process group of its own,
+// so its children, e.g. the other commands of a pipeline, get them too. With
+// a PTY, it's also a session leader with the PTY as its controlling terminal,
+// so ^C interrupts it as usual, and it gets SIGWINCH as the PTY is resized to
+// follow the client's window.
+//
 // This will use the session's context as the context for exec.Command.
 //
 // Note that due to the way Windows conpty works, using this on a Windows
@@ -38,8 +67,10 @@ func Command(s ssh.Session, name string, args ...string) *Cmd {
 
 // Cmd wraps a *exec.Cmd and a ssh.Pty so a command can be properly run.
 type Cmd struct {
-	sess ssh.Session
-	cmd  *exec.Cmd
+	sess   ssh.Session
+	cmd    *exec.Cmd
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 // SetDir set the underlying exec.Cmd env.
@@ -59,15 +90,159 @@ func (c *Cmd) SetDir(dir string) {
 
 // Run runs the program and waits for it to finish.
 func (c *Cmd) Run() error {
+	defer c.cancel()
+	var err error
 	ppty, winCh, ok := c.sess.Pty()
-	if !ok {
-		c.cmd.Stdin, c.cmd.Stdout, c.cmd.Stderr = c.sess, c.sess, c.sess
-		return c.cmd.Run()
+	if ok {
+		err = c.doRun(ppty, winCh)
+	} else {
+		err = c.runNoPty()
+	}
+	return c.result(err)
+}
+
+// runNoPty runs the program with the session as its stdin, stdout and stderr.
+//
+// The session is copied to the program's stdin without waiting for it, as the
+// copy only stops once the client sends something or closes it, which would
+// keep Run from returning after a killed program exited.
+func (c *Cmd) runNoPty() error {
+	c.cmd.Stdout, c.cmd.Stderr = c.sess, c.sess
+	stdin, err := c.cmd.StdinPipe()
+	if err != nil {
+		return err
 	}
-	return c.doRun(ppty, winCh)
+	setProcessGroup(c.cmd, false)
+	if err := c.cmd.Start(); err != nil {
+		return err
+	}
+	go func() {
+		_, _ = io.Copy(stdin, c.sess)
+		_ = stdin.Close()
+	}()
+	return c.wait()
+}
+
+// killDelay is how long a command has to exit after being sent SIGTERM
+// because its context is done, before it's killed.
+const killDelay = 2 * time.Second
+
+// wait waits for the started command to exit, forwarding it the client's
+// signals, and terminating it once the context is done.
+func (c *Cmd) wait() error {
+	return waitAll(c.sess, []*Cmd{c})[0]
 }
 
-var _ tea.ExecCommand = &Cmd{}
+// waitAll waits for the started commands to exit, forwarding them the
+// client's signals, and terminating each one once its context is done. It
+// returns their errors.
+func waitAll(s ssh.Session, cmds []*Cmd) []error {
+	sigs := make(chan ssh.Signal, 1)
+	s.Signals(sigs)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				for _, c := range cmds {
+					signalProcess(c.cmd, sig)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	for _, c := range cmds {
+		go c.terminate(done)
+	}
+	errs := make([]error, len(cmds))
+	for i, c := range cmds {
+		errs[i] = c.cmd.Wait()
+	}
+	close(done)
+
+	// the session sends signals while holding its lock, so keep draining
+	// them until it stops.
+	unset := make(chan struct{})
+	go func() {
+		s.Signals(nil)
+		close(unset)
+	}()
+	for {
+		select {
+		case <-sigs:
+		case <-unset:
+			return errs
+		}
+	}
+}
+
+// terminate sends SIGTERM to the started command once its context is done,
+// and kills it if it's still running after killDelay, unless done is closed
+// first.
+func (c *Cmd) terminate(done <-chan struct{}) {
+	select {
+	case <-c.ctx.Done():
+	case <-done:
+		return
+	}
+	signalProcess(c.cmd, ssh.SIGTERM)
+	t := time.NewTimer(killDelay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		signalProcess(c.cmd, ssh.SIGKILL)
+	case <-done:
+	}
+}
+
+// result returns the error of running the command, wrapping the context's
+// error if it's done.
+func (c *Cmd) result(err error) error {
+	if err != nil && c.ctx.Err() != nil {
+		return fmt.Errorf("%w: %s", c.ctx.Err(), err)
+	}
+	return err
+}
+
+// RunAndExit runs the program, waits for it to finish, and exits the session
+// with its exit status, see ExitStatus, so the client sees the program's
+// rather than always 0 or 1. It returns the error of Run.
+func (c *Cmd) RunAndExit() error {
+	err := c.Run()
+	_ = c.sess.Exit(ExitStatus(err))
+	return err
+}
+
+// ExitStatus returns the exit status matching an error returned by Cmd.Run:
+// zero if it's nil, the program's exit code if it exited with one, 128 plus
+// the signal number if it was killed by a signal on Unix, as shells do, and 1
+// otherwise, e.g. if it couldn't be started. For errors returned by Pipeline,
+// it's the status of the last command that failed, as with bash's pipefail.
+func ExitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	var perr *PipelineError
+	if errors.As(err, &perr) {
+		for i := len(perr.Errs) - 1; i >= 0; i-- {
+			if perr.Errs[i] != nil {
+				return ExitStatus(perr.Errs[i])
+			}
+		}
+		return 0
+	}
+	var eerr *exec.ExitError
+	if errors.As(err, &eerr) {
+		if sig, ok := exitSignal(eerr); ok {
+			return 128 + sig
+		}
+		if code := eerr.ExitCode(); code > 0 {
+			return code
+		}
+	}
+	return 1
+}
 
 // SetStderr conforms with tea.ExecCommand.
 func (*Cmd) SetStderr(io.Writer) {}
@@ -0,0 +1,34 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !netbsd && !openbsd && !solaris && !windows
+// +build !linux,!darwin,!freebsd,!dragonfly,!netbsd,!openbsd,!solaris,!windows
+
+package wish
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// doRun returns ssh.ErrUnsupported, as there are no PTYs on this platform.
+func (c *Cmd) doRun(ppty ssh.Pty, _ <-chan ssh.Window) error {
+	return ppty.Start(c.cmd)
+}
+
+func setProcessGroup(*exec.Cmd, bool) {}
+
+// signalProcess kills the command on the signals that would terminate it, as
+// processes can't be sent other signals on this platform.
+func signalProcess(cmd *exec.Cmd, sig ssh.Signal) {
+	switch sig {
+	case ssh.SIGINT, ssh.SIGKILL, ssh.SIGTERM, ssh.SIGHUP, ssh.SIGQUIT:
+		if cmd.Process != nil {
+			_ = cmd.Process.Kill()
+		}
+	}
+}
+
+func exitSignal(*exec.ExitError) (int, bool) { return 0, false }
+
+// ptyFile returns nil, as commands can't use PTYs directly on this platform.
+func ptyFile(ssh.Pty) *os.File { return nil }
@@ -2,6 +2,9 @@ package wish
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"io"
 	"runtime"
 	"strings"
 	"testing"
@@ -9,6 +12,7 @@ import (
 
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 func TestCommandNoPty(t *testing.T) {
@@ -101,6 +105,173 @@ func TestCommandPtyError(t *testing.T) {
 	}
 }
 
+func TestCommandContextTimeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	for name, pty := range map[string]bool{"pty": true, "no pty": false} {
+		pty := pty
+		t.Run(name, func(t *testing.T) {
+			errs := make(chan error, 1)
+			srv := &ssh.Server{
+				Handler: func(s ssh.Session) {
+					ctx, cancel := context.WithTimeout(s.Context(), 100*time.Millisecond)
+					defer cancel()
+					errs <- CommandContext(ctx, s, "sleep", "10").Run()
+				},
+			}
+			if err := ssh.AllocatePty()(srv); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			sess := testsession.New(t, srv, nil)
+			if pty {
+				if err := sess.RequestPty("xterm", 500, 200, nil); err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+			}
+			// the client never closes stdin.
+			stdin, w := io.Pipe()
+			defer w.Close() // nolint: errcheck
+			sess.Stdin = stdin
+			if err := sess.Start(""); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			select {
+			case err := <-errs:
+				if !errors.Is(err, context.DeadlineExceeded) {
+					t.Errorf("expected context.DeadlineExceeded, got %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("command was not killed")
+			}
+		})
+	}
+}
+
+func TestCommandContextDisconnect(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	started := make(chan struct{})
+	errs := make(chan error, 1)
+	addr := testsession.Listen(t, &ssh.Server{
+		Handler: func(s ssh.Session) {
+			close(started)
+			errs <- CommandContext(context.Background(), s, "sleep", "10").Run()
+		},
+	})
+	client := dialRetry(t, addr)
+	sess, err := client.NewSession()
+	requireNoError(t, err)
+	requireNoError(t, sess.Start(""))
+	<-started
+	time.Sleep(100 * time.Millisecond)
+	_ = client.Close()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was not killed")
+	}
+}
+
+func TestCommandSignals(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	errs := make(chan error, 1)
+	sess := testsession.New(t, &ssh.Server{
+		Handler: func(s ssh.Session) {
+			// sleep would keep the output open if it didn't get the signal.
+			errs <- Command(s, "sh", "-c", "sleep 10; echo nope").Run()
+		},
+	}, nil)
+	requireNoError(t, sess.Start(""))
+	requireNoError(t, sess.Signal(gossh.SIGTERM))
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("expected an error, got nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("signal was not forwarded")
+	}
+}
+
+func TestCommandPtyInterrupt(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	started := make(chan struct{})
+	errs := make(chan error, 1)
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			close(started)
+			errs <- Command(s, "sleep", "10").Run()
+		},
+	}
+	requireNoError(t, ssh.AllocatePty()(srv))
+	sess := testsession.New(t, srv, nil)
+	requireNoError(t, sess.RequestPty("xterm", 500, 200, nil))
+	stdin, err := sess.StdinPipe()
+	requireNoError(t, err)
+	requireNoError(t, sess.Start(""))
+	<-started
+	time.Sleep(200 * time.Millisecond)
+	_, err = stdin.Write([]byte{0x03})
+	requireNoError(t, err)
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Error("expected an error, got nil")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("^C did not interrupt the command")
+	}
+}
+
+func TestCommandRunAndExit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	for script, expect := range map[string]int{
+		"exit 0":        0,
+		"exit 3":        3,
+		"kill -TERM $$": 128 + 15,
+	} {
+		script, expect := script, expect
+		t.Run(script, func(t *testing.T) {
+			sess := testsession.New(t, &ssh.Server{
+				Handler: func(s ssh.Session) {
+					_ = Command(s, "sh", "-c", script).RunAndExit()
+				},
+			}, nil)
+			err := sess.Run("")
+			status := 0
+			var eerr *gossh.ExitError
+			if errors.As(err, &eerr) {
+				status = eerr.ExitStatus()
+			} else if err != nil {
+				t.Fatalf("expected an exit error, got %v", err)
+			}
+			if status != expect {
+				t.Errorf("expected exit status %d, got %d", expect, status)
+			}
+		})
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	if status := ExitStatus(nil); status != 0 {
+		t.Errorf("expected 0, got %d", status)
+	}
+	if status := ExitStatus(errors.New("nope")); status != 1 {
+		t.Errorf("expected 1, got %d", status)
+	}
+}
+
 func runEcho(s ssh.Session, str string) {
 	cmd := Command(s, "echo", str)
 	if runtime.GOOS == "windows" {
@@ -3,11 +3,70 @@
 
 package wish
 
-import "github.com/charmbracelet/ssh"
+import (
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/charmbracelet/ssh"
+)
 
 func (c *Cmd) doRun(ppty ssh.Pty, _ <-chan ssh.Window) error {
+	setProcessGroup(c.cmd, true)
 	if err := ppty.Start(c.cmd); err != nil {
 		return err
 	}
-	return c.cmd.Wait()
+	return c.wait()
+}
+
+// setProcessGroup makes the command lead a process group of its own, and with
+// a PTY, a session with the PTY, its stdin, as the controlling terminal.
+func setProcessGroup(cmd *exec.Cmd, pty bool) {
+	if pty {
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true, Ctty: 0}
+		return
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+var signals = map[ssh.Signal]syscall.Signal{
+	ssh.SIGABRT: syscall.SIGABRT,
+	ssh.SIGALRM: syscall.SIGALRM,
+	ssh.SIGFPE:  syscall.SIGFPE,
+	ssh.SIGHUP:  syscall.SIGHUP,
+	ssh.SIGILL:  syscall.SIGILL,
+	ssh.SIGINT:  syscall.SIGINT,
+	ssh.SIGKILL: syscall.SIGKILL,
+	ssh.SIGPIPE: syscall.SIGPIPE,
+	ssh.SIGQUIT: syscall.SIGQUIT,
+	ssh.SIGSEGV: syscall.SIGSEGV,
+	ssh.SIGTERM: syscall.SIGTERM,
+	ssh.SIGUSR1: syscall.SIGUSR1,
+	ssh.SIGUSR2: syscall.SIGUSR2,
+}
+
+// signalProcess sends the signal to the process group of the command.
+func signalProcess(cmd *exec.Cmd, sig ssh.Signal) {
+	s, ok := signals[sig]
+	if !ok || cmd.Process == nil {
+		return
+	}
+	if err := syscall.Kill(-cmd.Process.Pid, s); err != nil {
+		_ = cmd.Process.Signal(s)
+	}
+}
+
+// exitSignal returns the number of the signal that killed the program, if
+// one did.
+func exitSignal(err *exec.ExitError) (int, bool) {
+	ws, ok := err.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return 0, false
+	}
+	return int(ws.Signal()), true
+}
+
+// ptyFile returns the file of the PTY, for commands to use.
+func ptyFile(ppty ssh.Pty) *os.File {
+	return ppty.Slave
 }
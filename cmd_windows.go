@@ -5,6 +5,8 @@ package wish
 
 import (
 	"fmt"
+	"os"
+	"os/exec"
 	"time"
 
 	"github.com/charmbracelet/ssh"
@@ -17,13 +19,34 @@ func (c *Cmd) doRun(ppty ssh.Pty, _ <-chan ssh.Window) error {
 
 	start := time.Now()
 	for c.cmd.ProcessState == nil {
+		if c.ctx.Err() != nil {
+			_ = c.cmd.Process.Kill()
+		}
 		if time.Since(start) > time.Second*10 {
 			return fmt.Errorf("could not start process")
 		}
 		time.Sleep(100 * time.Millisecond)
 	}
 	if !c.cmd.ProcessState.Success() {
-		return fmt.Errorf("process failed: exit %d", c.cmd.ProcessState.ExitCode())
+		return &exec.ExitError{ProcessState: c.cmd.ProcessState}
 	}
 	return nil
 }
+
+func setProcessGroup(*exec.Cmd, bool) {}
+
+// signalProcess kills the command on the signals that would terminate it, as
+// processes can't be sent other signals on this platform.
+func signalProcess(cmd *exec.Cmd, sig ssh.Signal) {
+	switch sig {
+	case ssh.SIGINT, ssh.SIGKILL, ssh.SIGTERM, ssh.SIGHUP, ssh.SIGQUIT:
+		if cmd.Process != nil {
+			_ = cmd.Process.Kill()
+		}
+	}
+}
+
+func exitSignal(*exec.ExitError) (int, bool) { return 0, false }
+
+// ptyFile returns nil, as commands can't use PTYs directly on this platform.
+func ptyFile(ssh.Pty) *os.File { return nil }
@@ -0,0 +1,66 @@
+// Package collab provides shared documents for collaborative apps, e.g.
+// editors where several sessions edit the same text at once.
+//
+// Documents are kept by room in a Hub. Each session edits them as its own
+// site, and subscribes its program to them, to get an UpdateMsg after every
+// change:
+//
+//	doc := hub.Doc("notes")
+//	doc.Subscribe(s.Context(), p)
+//	doc.Insert(collab.Site(s), 0, "hello")
+package collab
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// Site returns the site of the session, i.e. its session ID.
+func Site(s ssh.Session) string {
+	return s.Context().SessionID()
+}
+
+// Hub keeps the documents of rooms.
+type Hub struct {
+	mu   sync.Mutex
+	docs map[string]*Doc
+}
+
+// NewHub returns a hub without rooms.
+func NewHub() *Hub {
+	return &Hub{docs: map[string]*Doc{}}
+}
+
+// Doc returns the document of the room, creating it if needed.
+func (h *Hub) Doc(room string) *Doc {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	doc, ok := h.docs[room]
+	if !ok {
+		doc = NewDoc(room)
+		h.docs[room] = doc
+	}
+	return doc
+}
+
+// Rooms returns the names of the rooms, sorted.
+func (h *Hub) Rooms() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	rooms := make([]string, 0, len(h.docs))
+	for room := range h.docs {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// Remove removes the room. Its document keeps working for the sessions that
+// have it, but the next call to Doc returns a new one.
+func (h *Hub) Remove(room string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.docs, room)
+}
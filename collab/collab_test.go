@@ -0,0 +1,209 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+func requireText(tb testing.TB, d *Doc, expected string) {
+	tb.Helper()
+	if got := d.Text(); got != expected {
+		tb.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestDoc(t *testing.T) {
+	d := NewDoc("notes")
+	if _, err := d.Insert("a", 0, "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Insert("a", 5, " world"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Insert("b", 100, "!"); err != nil {
+		t.Fatal(err)
+	}
+	requireText(t, d, "hello world!")
+	if _, err := d.Delete("b", 0, 6); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Insert("b", 0, "héllo "); err != nil {
+		t.Fatal(err)
+	}
+	requireText(t, d, "héllo world!")
+	if n := d.Len(); n != 12 {
+		t.Errorf("expected 12 runes, got %d", n)
+	}
+	if _, err := d.Insert("", 0, "x"); !errors.Is(err, ErrInvalidSite) {
+		t.Errorf("expected an invalid site error, got %v", err)
+	}
+}
+
+func TestDocConcurrentInserts(t *testing.T) {
+	a, b := NewDoc("notes"), NewDoc("notes")
+	base, _ := a.Insert("a", 0, "ac")
+	requireNoError(t, b.Apply("a", base...))
+
+	// both insert at the same place before seeing each other's change.
+	fromA, _ := a.Insert("a", 1, "b")
+	fromB, _ := b.Insert("b", 1, "B")
+	requireNoError(t, a.Apply("b", fromB...))
+	requireNoError(t, b.Apply("a", fromA...))
+	if a.Text() != b.Text() {
+		t.Errorf("expected the replicas to converge, got %q and %q", a.Text(), b.Text())
+	}
+	if got := a.Text(); got != "aBbc" && got != "abBc" {
+		t.Errorf("unexpected text: %q", got)
+	}
+
+	// applying ops again changes nothing.
+	requireNoError(t, a.Apply("b", fromB...))
+	requireNoError(t, a.Apply("a", a.Ops()...))
+	requireText(t, a, b.Text())
+}
+
+func TestDocConvergence(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1)) // nolint: gosec
+	sites := []string{"a", "b", "c"}
+	docs := make([]*Doc, len(sites))
+	for i := range docs {
+		docs[i] = NewDoc("notes")
+	}
+	var log [][]Op
+	for round := 0; round < 50; round++ {
+		i := rnd.Intn(len(docs))
+		d := docs[i]
+		var ops []Op
+		if n := d.Len(); n > 0 && rnd.Intn(3) == 0 {
+			ops, _ = d.Delete(sites[i], rnd.Intn(n), 1+rnd.Intn(3))
+		} else {
+			ops, _ = d.Insert(sites[i], rnd.Intn(n+1), strings.Repeat(string(rune('a'+round%26)), 1+rnd.Intn(3)))
+		}
+		log = append(log, ops)
+	}
+
+	// every replica gets every change, in a different order.
+	for i, d := range docs {
+		order := rnd.Perm(len(log))
+		for _, j := range order {
+			requireNoError(t, d.Apply(sites[i], log[j]...))
+		}
+	}
+	for _, d := range docs[1:] {
+		requireText(t, d, docs[0].Text())
+	}
+	if len(docs[0].pending) != 0 {
+		t.Errorf("expected no pending ops, got %d", len(docs[0].pending))
+	}
+
+	// a new replica syncs from the ops of the document.
+	d := NewDoc("notes")
+	requireNoError(t, d.Apply("a", docs[0].Ops()...))
+	requireText(t, d, docs[0].Text())
+}
+
+func TestDocApplyInvalid(t *testing.T) {
+	d := NewDoc("notes")
+	ops, _ := NewDoc("notes").Insert("a", 0, "hi")
+	if err := d.Apply("a", append(ops, Op{Kind: Insert, Char: 'x'})...); !errors.Is(err, ErrInvalidOp) {
+		t.Errorf("expected an invalid op error, got %v", err)
+	}
+	requireText(t, d, "")
+}
+
+func TestDocAnchor(t *testing.T) {
+	d := NewDoc("notes")
+	_, _ = d.Insert("a", 0, "world")
+	cursor := d.Anchor(2)
+	_, _ = d.Insert("b", 0, "hello ")
+	if pos := d.Pos(cursor); pos != 8 {
+		t.Errorf("expected the cursor to move to 8, got %d", pos)
+	}
+	_, _ = d.Delete("b", 6, 2)
+	if pos := d.Pos(cursor); pos != 6 {
+		t.Errorf("expected the cursor to stay after the deleted text, got %d", pos)
+	}
+	if pos := d.Pos(ID{}); pos != 0 {
+		t.Errorf("expected the start, got %d", pos)
+	}
+}
+
+type sender chan tea.Msg
+
+func (s sender) Send(msg tea.Msg) { s <- msg }
+
+func receive(tb testing.TB, s sender) UpdateMsg {
+	tb.Helper()
+	select {
+	case msg := <-s:
+		return msg.(UpdateMsg)
+	case <-time.After(time.Second):
+		tb.Fatal("timed out waiting for an update")
+	}
+	return UpdateMsg{}
+}
+
+func TestDocSubscribe(t *testing.T) {
+	d := NewDoc("notes")
+	_, _ = d.Insert("a", 0, "hi")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := make(sender)
+	d.Subscribe(ctx, s)
+	if msg := receive(t, s); msg.Room != "notes" || msg.Text != "hi" {
+		t.Errorf("expected the current text first, got %+v", msg)
+	}
+
+	_, _ = d.Insert("b", 2, "!")
+	_, _ = d.Delete("a", 0, 1)
+	if msg := receive(t, s); msg.Site != "b" || msg.Text != "hi!" || len(msg.Ops) != 1 {
+		t.Errorf("unexpected update: %+v", msg)
+	}
+	if msg := receive(t, s); msg.Site != "a" || msg.Text != "i!" || msg.Ops[0].Kind != Delete {
+		t.Errorf("unexpected update: %+v", msg)
+	}
+
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for d.Subscribers() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the subscriber to be removed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_, _ = d.Insert("b", 0, "x")
+	select {
+	case msg := <-s:
+		t.Errorf("expected no update after unsubscribing, got %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestHub(t *testing.T) {
+	h := NewHub()
+	a := h.Doc("a")
+	if h.Doc("a") != a {
+		t.Error("expected the same document for the same room")
+	}
+	_ = h.Doc("b")
+	if rooms := strings.Join(h.Rooms(), ","); rooms != "a,b" {
+		t.Errorf("unexpected rooms: %q", rooms)
+	}
+	h.Remove("a")
+	if h.Doc("a") == a {
+		t.Error("expected a new document once the room is removed")
+	}
+}
+
+func requireNoError(tb testing.TB, err error) {
+	tb.Helper()
+	if err != nil {
+		tb.Fatalf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,398 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/wish/internal/relay"
+)
+
+// ID identifies a character of a document: Seq is the Lamport clock of the
+// document when it was inserted, and Site who inserted it. The zero ID is the
+// start of the document.
+type ID struct {
+	Seq  uint64
+	Site string
+}
+
+// IsZero returns whether the ID is the start of the document.
+func (id ID) IsZero() bool {
+	return id == ID{}
+}
+
+// less orders concurrent inserts at the same place: the greater ID comes
+// first.
+func (id ID) less(other ID) bool {
+	if id.Seq != other.Seq {
+		return id.Seq < other.Seq
+	}
+	return id.Site < other.Site
+}
+
+// OpKind is the kind of an Op.
+type OpKind int
+
+const (
+	// Insert inserts a character.
+	Insert OpKind = iota
+
+	// Delete deletes a character.
+	Delete
+)
+
+// Op is an edit of a document. Ops can be applied in any order to other
+// replicas of the document, any number of times, with the same result.
+type Op struct {
+	Kind OpKind
+
+	// ID is the ID of the inserted or deleted character.
+	ID ID
+
+	// After is the ID of the character the character is inserted after.
+	After ID
+
+	// Char is the inserted character.
+	Char rune
+}
+
+// UpdateMsg is sent to the subscribers of a document after every change.
+type UpdateMsg struct {
+	// Room is the name of the document.
+	Room string
+
+	// Site is who made the change.
+	Site string
+
+	// Ops are the ops of the change.
+	Ops []Op
+
+	// Text is the text of the document after the change.
+	Text string
+}
+
+// Sender is what subscribers send UpdateMsgs to, e.g. a *tea.Program.
+type Sender interface {
+	Send(tea.Msg)
+}
+
+var (
+	// ErrInvalidSite is returned when editing a document without a site.
+	ErrInvalidSite = errors.New("collab: invalid site")
+
+	// ErrInvalidOp is returned when applying ops without an ID, or of an
+	// unknown kind.
+	ErrInvalidOp = errors.New("collab: invalid op")
+)
+
+type elem struct {
+	id      ID
+	char    rune
+	deleted bool
+}
+
+// Doc is a text document several sessions edit at once. It's a replicated
+// growable array: a sequence CRDT, so the ops of a change can also be
+// applied to replicas of the document, e.g. on other servers, with Apply.
+//
+// Positions are in runes. Finding them is linear in the size of the
+// document, including deleted characters.
+type Doc struct {
+	name string
+
+	mu      sync.Mutex
+	elems   []elem
+	clock   uint64
+	pending []Op
+	subs    map[*relay.Relay]struct{}
+}
+
+// NewDoc returns an empty document with the given name.
+func NewDoc(name string) *Doc {
+	return &Doc{name: name, subs: map[*relay.Relay]struct{}{}}
+}
+
+// Name returns the name of the document.
+func (d *Doc) Name() string {
+	return d.name
+}
+
+// Text returns the text of the document.
+func (d *Doc) Text() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.text()
+}
+
+func (d *Doc) text() string {
+	runes := make([]rune, 0, len(d.elems))
+	for _, e := range d.elems {
+		if !e.deleted {
+			runes = append(runes, e.char)
+		}
+	}
+	return string(runes)
+}
+
+// Len returns the length of the text in runes.
+func (d *Doc) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := 0
+	for _, e := range d.elems {
+		if !e.deleted {
+			n++
+		}
+	}
+	return n
+}
+
+// Insert inserts the text at the given position as the site, which should
+// be unique to the session, e.g. its ID. Positions out of the text are
+// clamped to it.
+func (d *Doc) Insert(site string, pos int, text string) ([]Op, error) {
+	if site == "" {
+		return nil, ErrInvalidSite
+	}
+	d.mu.Lock()
+	after := d.anchor(pos)
+	ops := make([]Op, 0, len(text))
+	for _, r := range text {
+		d.clock++
+		op := Op{Kind: Insert, ID: ID{Seq: d.clock, Site: site}, After: after, Char: r}
+		d.integrate(op)
+		ops = append(ops, op)
+		after = op.ID
+	}
+	d.publish(site, ops)
+	return ops, nil
+}
+
+// Delete deletes n runes from the given position as the site.
+func (d *Doc) Delete(site string, pos, n int) ([]Op, error) {
+	if site == "" {
+		return nil, ErrInvalidSite
+	}
+	d.mu.Lock()
+	var ops []Op
+	for i := range d.elems {
+		if len(ops) == n {
+			break
+		}
+		if d.elems[i].deleted {
+			continue
+		}
+		if pos > 0 {
+			pos--
+			continue
+		}
+		d.elems[i].deleted = true
+		ops = append(ops, Op{Kind: Delete, ID: d.elems[i].id})
+	}
+	d.publish(site, ops)
+	return ops, nil
+}
+
+// Apply applies ops made on a replica of the document by the site. Ops
+// depending on characters the document doesn't have yet are kept until they
+// arrive. Nothing is applied if any op is invalid.
+func (d *Doc) Apply(site string, ops ...Op) error {
+	for _, op := range ops {
+		if op.ID.IsZero() || op.ID.Site == "" || (op.Kind != Insert && op.Kind != Delete) {
+			return ErrInvalidOp
+		}
+	}
+	d.mu.Lock()
+	applied := make([]Op, 0, len(ops))
+	for _, op := range ops {
+		if d.integrate(op) {
+			applied = append(applied, op)
+		} else {
+			d.pending = append(d.pending, op)
+		}
+	}
+	if len(applied) > 0 {
+		applied = append(applied, d.retry()...)
+	}
+	d.publish(site, applied)
+	return nil
+}
+
+// Ops returns the ops recreating the document, e.g. to sync a new replica.
+func (d *Doc) Ops() []Op {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	ops := make([]Op, 0, len(d.elems))
+	var after ID
+	for _, e := range d.elems {
+		ops = append(ops, Op{Kind: Insert, ID: e.id, After: after, Char: e.char})
+		after = e.id
+	}
+	for _, e := range d.elems {
+		if e.deleted {
+			ops = append(ops, Op{Kind: Delete, ID: e.id})
+		}
+	}
+	return append(ops, d.pending...)
+}
+
+// Anchor returns the ID of the character before the position, or the zero ID
+// at the start, to keep track of the position, e.g. of a cursor, across
+// changes. See Pos.
+func (d *Doc) Anchor(pos int) ID {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.anchor(pos)
+}
+
+func (d *Doc) anchor(pos int) ID {
+	var id ID
+	for _, e := range d.elems {
+		if pos <= 0 {
+			break
+		}
+		if !e.deleted {
+			id = e.id
+			pos--
+		}
+	}
+	return id
+}
+
+// Pos returns the position after the character with the given ID, i.e. the
+// position of an anchor. Deleted characters are still known, so the position
+// is the one they would have.
+func (d *Doc) Pos(anchor ID) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if anchor.IsZero() {
+		return 0
+	}
+	pos := 0
+	for _, e := range d.elems {
+		if !e.deleted {
+			pos++
+		}
+		if e.id == anchor {
+			return pos
+		}
+	}
+	return pos
+}
+
+func (d *Doc) index(id ID) int {
+	for i, e := range d.elems {
+		if e.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// integrate applies the op, and returns false if it depends on a character
+// the document doesn't have.
+func (d *Doc) integrate(op Op) bool {
+	switch op.Kind {
+	case Insert:
+		if d.index(op.ID) >= 0 {
+			return true
+		}
+		i := -1
+		if !op.After.IsZero() {
+			if i = d.index(op.After); i < 0 {
+				return false
+			}
+		}
+		// concurrent inserts at the same place, and what was inserted
+		// after them, go first if their ID is greater.
+		j := i + 1
+		for j < len(d.elems) && op.ID.less(d.elems[j].id) {
+			j++
+		}
+		d.elems = append(d.elems, elem{})
+		copy(d.elems[j+1:], d.elems[j:])
+		d.elems[j] = elem{id: op.ID, char: op.Char}
+		if op.ID.Seq > d.clock {
+			d.clock = op.ID.Seq
+		}
+	case Delete:
+		i := d.index(op.ID)
+		if i < 0 {
+			return false
+		}
+		d.elems[i].deleted = true
+	}
+	return true
+}
+
+// retry applies the pending ops that can be, until none can.
+func (d *Doc) retry() []Op {
+	var applied []Op
+	for progress := true; progress; {
+		progress = false
+		pending := d.pending[:0]
+		for _, op := range d.pending {
+			if d.integrate(op) {
+				applied = append(applied, op)
+				progress = true
+			} else {
+				pending = append(pending, op)
+			}
+		}
+		d.pending = pending
+	}
+	return applied
+}
+
+// publish sends an UpdateMsg to the subscribers if there are ops, and
+// unlocks the document.
+func (d *Doc) publish(site string, ops []Op) {
+	defer d.mu.Unlock()
+	if len(ops) == 0 {
+		return
+	}
+	msg := UpdateMsg{Room: d.name, Site: site, Ops: ops, Text: d.text()}
+	for sub := range d.subs {
+		sub.Push(msg)
+	}
+}
+
+// Subscribe sends an UpdateMsg with the current text, and then one after
+// every change, to s until the context is done or the returned function is
+// called, e.g. with the context of the session of a program:
+//
+//	doc.Subscribe(s.Context(), p)
+//
+// Messages are sent in order, without blocking the changes. Subscribers
+// falling over a thousand messages behind are unsubscribed.
+func (d *Doc) Subscribe(ctx context.Context, s Sender) func() {
+	sub := relay.New(s)
+	d.mu.Lock()
+	d.subs[sub] = struct{}{}
+	sub.Push(UpdateMsg{Room: d.name, Text: d.text()})
+	d.mu.Unlock()
+
+	unsubscribe := func() {
+		d.mu.Lock()
+		delete(d.subs, sub)
+		d.mu.Unlock()
+		sub.Close()
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-sub.Done():
+			// the subscriber fell too far behind.
+		}
+		unsubscribe()
+	}()
+	return unsubscribe
+}
+
+// Subscribers returns the number of subscribers of the document.
+func (d *Doc) Subscribers() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.subs)
+}
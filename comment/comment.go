@@ -5,12 +5,15 @@ import (
 	"github.com/charmbracelet/wish"
 )
 
-// Middleware prints a comment at the end of the session.
+// Middleware prints a comment at the end of the session, unless it's a
+// subsystem session.
 func Middleware(comment string) wish.Middleware {
 	return func(sh ssh.Handler) ssh.Handler {
 		return func(s ssh.Session) {
 			sh(s)
-			wish.Println(s, comment)
+			if s.Subsystem() == "" {
+				wish.Println(s, comment)
+			}
 		}
 	}
 }
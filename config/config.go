@@ -0,0 +1,150 @@
+// Package config loads servers from declarative YAML configs, so small
+// deployments can be tweaked without code changes.
+//
+// A config looks like:
+//
+//	address: ":23234"
+//	host_keys:
+//	  - .ssh/id_ed25519
+//	authorized_keys: .ssh/authorized_keys
+//	idle_timeout: 10m
+//	max_timeout: 1h
+//	banner: "Welcome!\n"
+//	middleware:
+//	  logging: true
+//	  activeterm: true
+//	  accesscontrol: [git-upload-pack, git-receive-pack]
+//
+// Host keys are generated if they don't exist.
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/accesscontrol"
+	"github.com/charmbracelet/wish/activeterm"
+	"github.com/charmbracelet/wish/logging"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the declarative config of a server.
+type Config struct {
+	// Address is the address to listen on.
+	Address string `yaml:"address"`
+
+	// Version is the server version sent to clients.
+	Version string `yaml:"version"`
+
+	// HostKeys are the paths of the host keys, generated if they don't
+	// exist.
+	HostKeys []string `yaml:"host_keys"`
+
+	// AuthorizedKeys is the path of an authorized_keys file allowlisting
+	// users.
+	AuthorizedKeys string `yaml:"authorized_keys"`
+
+	// IdleTimeout and MaxTimeout are the connection timeouts, e.g. "10m".
+	IdleTimeout time.Duration `yaml:"idle_timeout"`
+	MaxTimeout  time.Duration `yaml:"max_timeout"`
+
+	// Banner is shown to clients before they authenticate.
+	Banner string `yaml:"banner"`
+
+	// Middleware enables built-in middlewares.
+	Middleware Middleware `yaml:"middleware"`
+}
+
+// Middleware enables built-in middlewares.
+type Middleware struct {
+	// Logging enables the logging middleware.
+	Logging bool `yaml:"logging"`
+
+	// ActiveTerm enables the activeterm middleware.
+	ActiveTerm bool `yaml:"activeterm"`
+
+	// AccessControl enables the accesscontrol middleware, allowing the
+	// given commands only. Omit it to allow every command.
+	AccessControl []string `yaml:"accesscontrol"`
+}
+
+// Parse parses a YAML config. Unknown fields are rejected, to catch typos.
+func Parse(data []byte) (*Config, error) {
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// Load reads and parses the YAML config at path.
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Options returns the ssh.Options of the config, without its middlewares.
+func (c *Config) Options() []ssh.Option {
+	var opts []ssh.Option
+	if c.Address != "" {
+		opts = append(opts, wish.WithAddress(c.Address))
+	}
+	if c.Version != "" {
+		opts = append(opts, wish.WithVersion(c.Version))
+	}
+	for _, path := range c.HostKeys {
+		opts = append(opts, wish.WithHostKeyPath(path))
+	}
+	if c.AuthorizedKeys != "" {
+		opts = append(opts, wish.WithAuthorizedKeys(c.AuthorizedKeys))
+	}
+	if c.IdleTimeout > 0 {
+		opts = append(opts, wish.WithIdleTimeout(c.IdleTimeout))
+	}
+	if c.MaxTimeout > 0 {
+		opts = append(opts, wish.WithMaxTimeout(c.MaxTimeout))
+	}
+	if c.Banner != "" {
+		opts = append(opts, wish.WithBanner(c.Banner))
+	}
+	return opts
+}
+
+// Middlewares returns the built-in middlewares enabled by the config, in the
+// order they should be passed to wish.WithMiddleware, after the app's ones:
+// logging runs first, then accesscontrol and activeterm.
+func (c *Config) Middlewares() []wish.Middleware {
+	var mw []wish.Middleware
+	if c.Middleware.ActiveTerm {
+		mw = append(mw, activeterm.Middleware())
+	}
+	if c.Middleware.AccessControl != nil {
+		mw = append(mw, accesscontrol.Middleware(c.Middleware.AccessControl...))
+	}
+	if c.Middleware.Logging {
+		mw = append(mw, logging.Middleware())
+	}
+	return mw
+}
+
+// NewServer returns a new server configured from the YAML config at path,
+// running the given middlewares after the built-in ones it enables. Extra
+// options are applied after the config ones.
+func NewServer(path string, mw []wish.Middleware, opts ...ssh.Option) (*ssh.Server, error) {
+	cfg, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	all := append(append([]wish.Middleware(nil), mw...), cfg.Middlewares()...)
+	opts = append(append(cfg.Options(), wish.WithMiddleware(all...)), opts...)
+	return wish.NewServer(opts...)
+}
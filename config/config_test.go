@@ -0,0 +1,80 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestNewServer(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "wish.yml")
+	requireNoError(t, os.WriteFile(path, []byte(`
+address: ":23234"
+host_keys:
+  - `+filepath.Join(dir, "id_ed25519")+`
+idle_timeout: 10m
+banner: "hi\n"
+middleware:
+  logging: true
+  accesscontrol: [greet]
+`), 0o600))
+
+	srv, err := NewServer(path, []wish.Middleware{
+		func(ssh.Handler) ssh.Handler {
+			return func(s ssh.Session) {
+				wish.Print(s, "hello")
+			}
+		},
+	})
+	requireNoError(t, err)
+	if srv.Addr != ":23234" || srv.IdleTimeout != 10*time.Minute || srv.Banner != "hi\n" {
+		t.Errorf("unexpected server config: %q %s %q", srv.Addr, srv.IdleTimeout, srv.Banner)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "id_ed25519")); err != nil {
+		t.Errorf("expected the host key to be generated: %v", err)
+	}
+
+	addr := testsession.Listen(t, srv)
+	sess, err := testsession.NewClientSession(t, addr, nil)
+	requireNoError(t, err)
+	out, err := sess.Output("greet")
+	requireNoError(t, err)
+	if string(out) != "hello" {
+		t.Errorf("expected hello, got %q", out)
+	}
+
+	sess, err = testsession.NewClientSession(t, addr, nil)
+	requireNoError(t, err)
+	out, _ = sess.Output("rm")
+	if !strings.Contains(string(out), "Command is not allowed: rm") {
+		t.Errorf("expected the command to be denied, got %q", out)
+	}
+}
+
+func TestParse(t *testing.T) {
+	if _, err := Parse([]byte("adress: :22\n")); err == nil {
+		t.Error("expected unknown fields to be rejected")
+	}
+	if _, err := Parse([]byte("idle_timeout: forever\n")); err == nil {
+		t.Error("expected invalid durations to be rejected")
+	}
+	cfg, err := Parse([]byte("middleware:\n  accesscontrol: []\n"))
+	requireNoError(t, err)
+	if cfg.Middleware.AccessControl == nil || len(cfg.Middlewares()) != 1 {
+		t.Error("expected an empty accesscontrol list to deny every command")
+	}
+}
+
+func requireNoError(tb testing.TB, err error) {
+	tb.Helper()
+	if err != nil {
+		tb.Fatalf("expected no error, got %v", err)
+	}
+}
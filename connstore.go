@@ -0,0 +1,121 @@
+package wish
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// ConnStore is metadata about a connection, shared by all its sessions and
+// channels, e.g. the role and claims of the user, stashed once by an auth
+// handler. It's safe for concurrent use.
+type ConnStore struct {
+	mu     sync.RWMutex
+	roles  map[string]struct{}
+	claims map[string]string
+	values map[string]interface{}
+}
+
+type connStoreKey struct{}
+
+// ConnStoreOf returns the store of the connection with the given context,
+// creating it if needed. Auth handlers, middlewares, and channel and request
+// handlers all get the connection context, so they share it.
+//
+// Auth handlers can be called several times per connection, e.g. once per
+// key the client offers, so they should only store metadata about the user
+// once they accept them.
+func ConnStoreOf(ctx ssh.Context) *ConnStore {
+	ctx.Lock()
+	defer ctx.Unlock()
+	st, ok := ctx.Value(connStoreKey{}).(*ConnStore)
+	if !ok {
+		st = &ConnStore{
+			roles:  map[string]struct{}{},
+			claims: map[string]string{},
+			values: map[string]interface{}{},
+		}
+		ctx.SetValue(connStoreKey{}, st)
+	}
+	return st
+}
+
+// AddRoles gives the user the given roles.
+func (st *ConnStore) AddRoles(roles ...string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	for _, r := range roles {
+		st.roles[r] = struct{}{}
+	}
+}
+
+// HasRole returns whether the user has the given role.
+func (st *ConnStore) HasRole(role string) bool {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	_, ok := st.roles[role]
+	return ok
+}
+
+// Roles returns the roles of the user, sorted.
+func (st *ConnStore) Roles() []string {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	roles := make([]string, 0, len(st.roles))
+	for r := range st.roles {
+		roles = append(roles, r)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+// SetClaim sets a claim about the user, e.g. from a token they authenticated
+// with.
+func (st *ConnStore) SetClaim(name, value string) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.claims[name] = value
+}
+
+// Claim returns a claim about the user, and whether it was set.
+func (st *ConnStore) Claim(name string) (string, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	v, ok := st.claims[name]
+	return v, ok
+}
+
+// Claims returns a copy of the claims about the user.
+func (st *ConnStore) Claims() map[string]string {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	claims := make(map[string]string, len(st.claims))
+	for k, v := range st.claims {
+		claims[k] = v
+	}
+	return claims
+}
+
+// Set sets any other value, see ConnValue to read it back with its type.
+func (st *ConnStore) Set(key string, v interface{}) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.values[key] = v
+}
+
+// Get returns a value set with Set, and whether it was set.
+func (st *ConnStore) Get(key string) (interface{}, bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	v, ok := st.values[key]
+	return v, ok
+}
+
+// ConnValue returns a value of the connection store with the given context,
+// and whether it was set with the type T.
+func ConnValue[T any](ctx ssh.Context, key string) (T, bool) {
+	v, _ := ConnStoreOf(ctx).Get(key)
+	t, ok := v.(T)
+	return t, ok
+}
@@ -0,0 +1,68 @@
+package wish
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestConnStore(t *testing.T) {
+	var auths int
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			st := ConnStoreOf(s.Context())
+			if s.RawCommand() == "promote" {
+				st.AddRoles("admin")
+			}
+			team, _ := st.Claim("team")
+			n, _ := ConnValue[int](s.Context(), "auths")
+			if _, ok := ConnValue[string](s.Context(), "auths"); ok {
+				Fatal(s, "expected the value to have another type")
+				return
+			}
+			Printf(s, "%s %s %d", strings.Join(st.Roles(), ","), team, n)
+		},
+		PasswordHandler: func(ctx ssh.Context, password string) bool {
+			if password != "secret" {
+				return false
+			}
+			auths++
+			st := ConnStoreOf(ctx)
+			st.AddRoles("user", "dev")
+			st.SetClaim("team", "infra")
+			st.Set("auths", auths)
+			return true
+		},
+	}
+	addr := testsession.Listen(t, srv)
+	connect := func() *gossh.Client {
+		t.Helper()
+		client, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+			User:            "testuser",
+			Auth:            []gossh.AuthMethod{gossh.Password("secret")},
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+		})
+		requireNoError(t, err)
+		t.Cleanup(func() { _ = client.Close() })
+		return client
+	}
+	run := func(client *gossh.Client, cmd string) string {
+		t.Helper()
+		sess, err := client.NewSession()
+		requireNoError(t, err)
+		out, err := sess.Output(cmd)
+		requireNoError(t, err)
+		return string(out)
+	}
+
+	first := connect()
+	requireEqual(t, "dev,user infra 1", run(first, ""))
+	// sessions of a connection share its store.
+	requireEqual(t, "admin,dev,user infra 1", run(first, "promote"))
+	requireEqual(t, "admin,dev,user infra 1", run(first, ""))
+	// other connections don't.
+	requireEqual(t, "dev,user infra 2", run(connect(), ""))
+}
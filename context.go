@@ -0,0 +1,108 @@
+package wish
+
+import (
+	"net"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// ContextKey is a key for values of type T stored in session contexts. Unlike
+// untyped keys, two keys never collide, and values are read back with their
+// type:
+//
+//	var RepoKey = wish.NewContextKey[*Repo]("repo")
+//
+//	wish.SetContextValue(s.Context(), RepoKey, repo)
+//	repo, ok := wish.ContextValue(s.Context(), RepoKey)
+type ContextKey[T any] struct {
+	name string
+}
+
+// NewContextKey returns a new key for values of type T. The name is only used
+// for debugging.
+func NewContextKey[T any](name string) *ContextKey[T] {
+	return &ContextKey[T]{name: name}
+}
+
+// String returns the name of the key.
+func (k *ContextKey[T]) String() string {
+	return "wish context key " + k.name
+}
+
+// SetContextValue sets the value of the key in the context. Values are shared
+// by all the sessions of a connection.
+func SetContextValue[T any](ctx ssh.Context, key *ContextKey[T], v T) {
+	ctx.SetValue(key, v)
+}
+
+// ContextValue returns the value of the key in the context, and whether it was
+// set.
+func ContextValue[T any](ctx ssh.Context, key *ContextKey[T]) (T, bool) {
+	v, ok := ctx.Value(key).(T)
+	return v, ok
+}
+
+// SessionWithValue returns the session with the value of the key set in its
+// context only, rather than in the context shared by all the sessions of its
+// connection, e.g. for state middlewares keep per session, which would be
+// overwritten by the other sessions of clients multiplexing them over a
+// connection. Handlers are given the returned session:
+//
+//	sh(wish.SessionWithValue(s, VariantKey, variant))
+//
+// Values set on its context afterwards are still shared by the connection.
+func SessionWithValue[T any](s ssh.Session, key *ContextKey[T], v T) ssh.Session {
+	return &valueSession{
+		Session: s,
+		ctx:     &valueContext{Context: s.Context(), key: key, value: v},
+	}
+}
+
+// valueSession is a session with its own context.
+type valueSession struct {
+	ssh.Session
+	ctx ssh.Context
+}
+
+// Context implements ssh.Session.
+func (s *valueSession) Context() ssh.Context {
+	return s.ctx
+}
+
+// valueContext is a session context with a value of its own.
+type valueContext struct {
+	ssh.Context
+	key, value interface{}
+}
+
+// Value implements context.Context.
+func (ctx *valueContext) Value(key interface{}) interface{} {
+	if key == ctx.key {
+		return ctx.value
+	}
+	return ctx.Context.Value(key)
+}
+
+// UserMetadataKey is the key of metadata about the user, e.g. set by an
+// authentication handler looking them up, for the next handlers to read.
+var UserMetadataKey = NewContextKey[map[string]string]("user-metadata")
+
+// setConnValue sets the value in the context of every connection to the
+// server, through the server's ConnCallback, so handlers find state kept by
+// options there. The last value set for a key wins.
+//
+// The ConnCallback is chained, like other options do: setting it directly
+// after the options are applied drops the value. Telnet and serial sessions
+// skip connection callbacks, so they don't have it.
+func setConnValue(s *ssh.Server, key, value interface{}) {
+	next := s.ConnCallback
+	s.ConnCallback = func(ctx ssh.Context, conn net.Conn) net.Conn {
+		if next != nil {
+			if conn = next(ctx, conn); conn == nil {
+				return nil
+			}
+		}
+		ctx.SetValue(key, value)
+		return conn
+	}
+}
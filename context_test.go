@@ -0,0 +1,86 @@
+package wish
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestContextValue(t *testing.T) {
+	first := NewContextKey[string]("name")
+	second := NewContextKey[string]("name")
+	count := NewContextKey[int]("count")
+	requireEqual(t, "wish context key name", first.String())
+
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			ctx := s.Context()
+			if _, ok := ContextValue(ctx, first); ok {
+				Fatal(s, "expected the value not to be set")
+				return
+			}
+			SetContextValue(ctx, first, "first")
+			SetContextValue(ctx, count, 2)
+			SetContextValue(ctx, UserMetadataKey, map[string]string{"team": "infra"})
+			if _, ok := ContextValue(ctx, second); ok {
+				Fatal(s, "expected keys with the same name not to collide")
+				return
+			}
+			v, _ := ContextValue(ctx, first)
+			n, _ := ContextValue(ctx, count)
+			md, _ := ContextValue(ctx, UserMetadataKey)
+			Printf(s, "%s %d %s", v, n, md["team"])
+		},
+	}
+	out, err := testsession.New(t, srv, nil).Output("")
+	requireNoError(t, err)
+	requireEqual(t, "first 2 infra", string(out))
+}
+
+func TestSessionWithValue(t *testing.T) {
+	key := NewContextKey[int]("session")
+	shared := NewContextKey[string]("shared")
+	var sessions atomic.Int64
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			n := int(sessions.Add(1))
+			conn := s.Context()
+			s = SessionWithValue(s, key, n)
+			if _, ok := ContextValue(conn, key); ok {
+				Fatal(s, "expected the value not to be set on the connection")
+				return
+			}
+			SetContextValue(s.Context(), shared, "shared")
+			v, _ := ContextValue(s.Context(), key)
+			sv, _ := ContextValue(s.Context(), shared)
+			Printf(s, "%d %s %s", v, sv, s.Context().User())
+		},
+	}
+	c := dial(t, testsession.Listen(t, srv))
+	for i := 1; i <= 2; i++ {
+		sess, err := c.NewSession()
+		requireNoError(t, err)
+		out, err := sess.Output("")
+		requireNoError(t, err)
+		requireEqual(t, fmt.Sprintf("%d shared testuser", i), string(out))
+	}
+}
+
+func TestSetConnValue(t *testing.T) {
+	type key struct{}
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			Print(s, s.Context().Value(key{}))
+		},
+	}
+	setConnValue(srv, key{}, "first")
+	setConnValue(srv, key{}, "last")
+	// callbacks set afterwards don't drop the value.
+	srv.SessionRequestCallback = func(ssh.Session, string) bool { return true }
+	out, err := testsession.New(t, srv, nil).Output("")
+	requireNoError(t, err)
+	requireEqual(t, "last", string(out))
+}
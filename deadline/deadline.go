@@ -0,0 +1,183 @@
+// Package deadline provides writers enforcing deadlines on session output, so
+// a stalled client can't block the goroutines writing to it, e.g. while they
+// hold application locks.
+package deadline
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+// ErrTimeout is returned by writes to a stalled client.
+var ErrTimeout = errors.New("write timed out")
+
+// Option configures a Writer.
+type Option func(*Writer)
+
+// WithDrop drops writes while the client is stalled, instead of failing right
+// away, giving up once it has been stalled for longer than maxStall. The
+// client misses the dropped output, which is fine for apps repainting their
+// whole screen regularly.
+func WithDrop(maxStall time.Duration) Option {
+	return func(w *Writer) {
+		w.drop = true
+		w.maxStall = maxStall
+	}
+}
+
+// WithOnStall calls fn once the writer gives up on the client, e.g. to
+// disconnect it.
+func WithOnStall(fn func()) Option {
+	return func(w *Writer) {
+		w.onStall = fn
+	}
+}
+
+// Writer writes to an underlying writer, giving up on writes that aren't done
+// within a timeout. The client is then considered stalled: the pending write
+// keeps going in the background, and later writes fail with ErrTimeout, or
+// are dropped with WithDrop.
+//
+// Writes are serialized, and it's safe for concurrent use.
+type Writer struct {
+	w        io.Writer
+	timeout  time.Duration
+	drop     bool
+	maxStall time.Duration
+	onStall  func()
+
+	mu      sync.Mutex
+	pending chan struct{}
+	stalled time.Time
+	dropped int
+	err     error
+}
+
+var _ io.Writer = &Writer{}
+
+// NewWriter returns a Writer writing to w with the given timeout.
+func NewWriter(w io.Writer, timeout time.Duration, opts ...Option) *Writer {
+	dw := &Writer{w: w, timeout: timeout}
+	for _, opt := range opts {
+		opt(dw)
+	}
+	return dw
+}
+
+// Write implements io.Writer.
+func (w *Writer) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return 0, w.err
+	}
+	if w.pending != nil {
+		select {
+		case <-w.pending:
+			// the client caught up.
+			w.pending = nil
+		default:
+			if time.Since(w.stalled) >= w.maxStall {
+				return 0, w.fail()
+			}
+			w.dropped++
+			return len(p), nil
+		}
+	}
+
+	type result struct {
+		n   int
+		err error
+	}
+	// the write might outlive this call, and p can't be retained.
+	buf := append([]byte(nil), p...)
+	res := make(chan result, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		n, err := w.w.Write(buf)
+		res <- result{n, err}
+	}()
+
+	start := time.Now()
+	timer := time.NewTimer(w.timeout)
+	defer timer.Stop()
+	select {
+	case r := <-res:
+		return r.n, r.err
+	case <-timer.C:
+		if !w.drop {
+			return 0, w.fail()
+		}
+		// the write will complete in the background, if ever.
+		w.pending, w.stalled = done, start
+		return len(p), nil
+	}
+}
+
+// Dropped returns the number of writes dropped so far.
+func (w *Writer) Dropped() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.dropped
+}
+
+// Stalled returns whether the client is stalled.
+func (w *Writer) Stalled() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return true
+	}
+	if w.pending == nil {
+		return false
+	}
+	select {
+	case <-w.pending:
+		return false
+	default:
+		return true
+	}
+}
+
+// fail gives up on the client.
+func (w *Writer) fail() error {
+	w.err = ErrTimeout
+	if w.onStall != nil {
+		w.onStall()
+	}
+	return w.err
+}
+
+// Middleware enforces a deadline on writes to the sessions' stdout, closing
+// the sessions of stalled clients. See Writer.
+//
+// Programs writing to a PTY aren't covered, as the PTY output is copied to
+// the session by the SSH server itself.
+func Middleware(timeout time.Duration, opts ...Option) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			opts := append(opts[:len(opts):len(opts)], WithOnStall(func() {
+				log.Warn("closing session of stalled client", "user", s.User(), "remote-addr", s.RemoteAddr().String())
+				_ = s.Close()
+			}))
+			sh(&session{Session: s, w: NewWriter(s, timeout, opts...)})
+		}
+	}
+}
+
+// session writes to its stdout through a Writer.
+type session struct {
+	ssh.Session
+	w *Writer
+}
+
+func (s *session) Write(p []byte) (int, error) {
+	return s.w.Write(p)
+}
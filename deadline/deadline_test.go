@@ -0,0 +1,127 @@
+package deadline
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+// gateWriter blocks writes until it's opened.
+type gateWriter struct {
+	gate chan struct{}
+	once sync.Once
+	mu   sync.Mutex
+	buf  bytes.Buffer
+}
+
+func newGateWriter() *gateWriter {
+	return &gateWriter{gate: make(chan struct{})}
+}
+
+func (g *gateWriter) Write(p []byte) (int, error) {
+	<-g.gate
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.buf.Write(p)
+}
+
+func (g *gateWriter) open() {
+	g.once.Do(func() { close(g.gate) })
+}
+
+func (g *gateWriter) String() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.buf.String()
+}
+
+func TestWriter(t *testing.T) {
+	t.Run("fast client", func(t *testing.T) {
+		g := newGateWriter()
+		g.open()
+		w := NewWriter(g, time.Second)
+		if _, err := w.Write([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if g.String() != "hello" || w.Stalled() {
+			t.Fatalf("unexpected output %q", g.String())
+		}
+	})
+
+	t.Run("stalled client", func(t *testing.T) {
+		g := newGateWriter()
+		defer g.open()
+		var stalls atomic.Int32
+		w := NewWriter(g, 10*time.Millisecond, WithOnStall(func() { stalls.Add(1) }))
+		if _, err := w.Write([]byte("hello")); !errors.Is(err, ErrTimeout) {
+			t.Fatalf("expected ErrTimeout, got %v", err)
+		}
+		if _, err := w.Write([]byte("again")); !errors.Is(err, ErrTimeout) {
+			t.Fatalf("expected ErrTimeout, got %v", err)
+		}
+		if n := stalls.Load(); n != 1 {
+			t.Errorf("expected one stall, got %d", n)
+		}
+		if !w.Stalled() {
+			t.Error("expected the writer to be stalled")
+		}
+	})
+
+	t.Run("drop while stalled", func(t *testing.T) {
+		g := newGateWriter()
+		w := NewWriter(g, 10*time.Millisecond, WithDrop(time.Minute))
+		for _, s := range []string{"frame1", "frame2", "frame3"} {
+			if n, err := w.Write([]byte(s)); err != nil || n != len(s) {
+				t.Fatalf("expected the write to be dropped, got %d, %v", n, err)
+			}
+		}
+		if w.Dropped() != 2 {
+			t.Errorf("expected 2 dropped writes, got %d", w.Dropped())
+		}
+		g.open()
+		for w.Stalled() {
+			time.Sleep(time.Millisecond)
+		}
+		if _, err := w.Write([]byte("frame4")); err != nil {
+			t.Fatal(err)
+		}
+		if g.String() != "frame1frame4" {
+			t.Errorf("unexpected output %q", g.String())
+		}
+	})
+
+	t.Run("stalled for too long", func(t *testing.T) {
+		g := newGateWriter()
+		defer g.open()
+		w := NewWriter(g, 10*time.Millisecond, WithDrop(20*time.Millisecond))
+		if _, err := w.Write([]byte("frame1")); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if _, err := w.Write([]byte("frame2")); !errors.Is(err, ErrTimeout) {
+			t.Fatalf("expected ErrTimeout, got %v", err)
+		}
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	srv := &ssh.Server{
+		Handler: Middleware(time.Second)(func(s ssh.Session) {
+			wish.Print(s, "hello")
+		}),
+	}
+	out, err := testsession.New(t, srv, nil).Output("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "hello" {
+		t.Errorf("unexpected output %q", out)
+	}
+}
@@ -8,7 +8,8 @@ import (
 )
 
 // MiddlewareWithFormat returns a middleware that logs the elapsed time of the
-// session. It accepts a format string to print the elapsed time.
+// session. It accepts a format string to print the elapsed time. Nothing is
+// printed to subsystem sessions.
 //
 // In order to provide an accurate elapsed time for the entire session,
 // this must be called as the last middleware in the chain.
@@ -17,7 +18,9 @@ func MiddlewareWithFormat(format string) wish.Middleware {
 		return func(s ssh.Session) {
 			now := time.Now()
 			sh(s)
-			wish.Printf(s, format, time.Since(now))
+			if s.Subsystem() == "" {
+				wish.Printf(s, format, time.Since(now))
+			}
 		}
 	}
 }
@@ -0,0 +1,80 @@
+package wish
+
+import (
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+type elevationKey struct{}
+
+// elevation is the elevated privileges of a connection.
+type elevation struct {
+	mu    sync.Mutex
+	until time.Time
+}
+
+func elevationFor(ctx ssh.Context) *elevation {
+	ctx.Lock()
+	defer ctx.Unlock()
+	e, ok := ctx.Value(elevationKey{}).(*elevation)
+	if !ok {
+		e = &elevation{}
+		ctx.SetValue(elevationKey{}, e)
+	}
+	return e
+}
+
+// Elevate elevates the privileges of the user for ttl, like sudo does, once
+// they authenticated again with Reauthenticate. Users whose privileges are
+// still elevated aren't asked again.
+//
+// Privileges are elevated for the whole connection, so all its sessions
+// share them. Check them with Elevated, e.g. before admin actions, or with the
+// accesscontrol package's RequireElevation middleware.
+func Elevate(s ssh.Session, reason string, ttl time.Duration) error {
+	if Elevated(s.Context()) {
+		return nil
+	}
+	if err := Reauthenticate(s, reason); err != nil {
+		return err
+	}
+	e := elevationFor(s.Context())
+	e.mu.Lock()
+	e.until = time.Now().Add(ttl)
+	e.mu.Unlock()
+	log.Debug("privileges elevated", "user", s.User(), "remote-addr", s.RemoteAddr(), "reason", reason, "ttl", ttl)
+	return nil
+}
+
+// Elevated returns whether the privileges of the connection with the given
+// context are elevated.
+func Elevated(ctx ssh.Context) bool {
+	return time.Now().Before(ElevatedUntil(ctx))
+}
+
+// ElevatedUntil returns when the elevated privileges of the connection with
+// the given context expire, or the zero time if they were never elevated.
+func ElevatedUntil(ctx ssh.Context) time.Time {
+	e, ok := ctx.Value(elevationKey{}).(*elevation)
+	if !ok {
+		return time.Time{}
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.until
+}
+
+// DropElevation drops the elevated privileges of the connection with the given
+// context, before they expire, like sudo -k.
+func DropElevation(ctx ssh.Context) {
+	e, ok := ctx.Value(elevationKey{}).(*elevation)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.until = time.Time{}
+}
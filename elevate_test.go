@@ -0,0 +1,70 @@
+package wish
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestElevate(t *testing.T) {
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			switch s.RawCommand() {
+			case "sudo":
+				if err := Elevate(s, "Admin mode.", 200*time.Millisecond); err != nil {
+					Print(s, err)
+					return
+				}
+			case "drop":
+				DropElevation(s.Context())
+			}
+			if Elevated(s.Context()) {
+				Print(s, "elevated")
+			} else {
+				Print(s, "regular")
+			}
+		},
+		PasswordHandler: func(_ ssh.Context, password string) bool {
+			return password == "secret"
+		},
+	}
+	addr := testsession.Listen(t, srv)
+	client, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+		User:            "testuser",
+		Auth:            []gossh.AuthMethod{gossh.Password("secret")},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+	})
+	requireNoError(t, err)
+	defer client.Close() // nolint: errcheck
+
+	run := func(cmd, stdin string) string {
+		t.Helper()
+		sess, err := client.NewSession()
+		requireNoError(t, err)
+		requireNoError(t, sess.RequestPty("xterm", 24, 80, nil))
+		sess.Stdin = strings.NewReader(stdin)
+		out, err := sess.Output(cmd)
+		requireNoError(t, err)
+		return string(out)
+	}
+
+	requireEqual(t, "regular", run("", ""))
+	if out := run("sudo", "wrong\r"); !strings.HasSuffix(out, ErrReauthFailed.Error()) {
+		t.Errorf("expected the elevation to fail, got %q", out)
+	}
+	if out := run("sudo", "secret\r"); !strings.Contains(out, "Admin mode.") || !strings.HasSuffix(out, "elevated") {
+		t.Errorf("expected the privileges to be elevated, got %q", out)
+	}
+	// other sessions of the connection share them, without being asked again.
+	requireEqual(t, "elevated", run("", ""))
+	requireEqual(t, "elevated", run("sudo", ""))
+	requireEqual(t, "regular", run("drop", ""))
+
+	run("sudo", "secret\r")
+	time.Sleep(250 * time.Millisecond)
+	requireEqual(t, "regular", run("", ""))
+}
@@ -0,0 +1,175 @@
+// Package eventlog keeps the last server events in memory, and lets the app
+// owners read them through the `logs` command, so debugging a deployment
+// doesn't require shell access to its host.
+package eventlog
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+// Event is a server event.
+type Event struct {
+	Time    time.Time
+	Level   string
+	Message string
+
+	// KeyVals are the key value pairs of the event, formatted.
+	KeyVals []string
+}
+
+// String formats the event as a log line, without a trailing newline.
+func (e Event) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s %s", e.Time.Format(time.RFC3339), strings.ToUpper(e.Level), e.Message)
+	for _, kv := range e.KeyVals {
+		sb.WriteString(" ")
+		sb.WriteString(kv)
+	}
+	return sb.String()
+}
+
+// Buffer is a ring buffer of the last events. It's safe for concurrent use.
+type Buffer struct {
+	mu     sync.Mutex
+	events []Event
+	next   int
+	full   bool
+	subs   map[chan Event]struct{}
+}
+
+// New returns a Buffer keeping the last size events.
+func New(size int) *Buffer {
+	if size <= 0 {
+		size = 1
+	}
+	return &Buffer{
+		events: make([]Event, size),
+		subs:   map[chan Event]struct{}{},
+	}
+}
+
+// Capture adds the warnings and errors logged by wish and its middlewares to
+// the buffer, until the returned function is called. Only one buffer can
+// capture them at a time.
+func (b *Buffer) Capture() (stop func()) {
+	log.SetHook(b.Log)
+	return func() {
+		log.SetHook(nil)
+	}
+}
+
+// Log adds an event with the given level, message and key value pairs to
+// the buffer, e.g. for middlewares to report their own events.
+func (b *Buffer) Log(level string, msg interface{}, keyvals ...interface{}) {
+	e := Event{
+		Time:    time.Now(),
+		Level:   level,
+		Message: fmt.Sprint(msg),
+	}
+	for i := 0; i < len(keyvals); i += 2 {
+		var val interface{} = "MISSING"
+		if i+1 < len(keyvals) {
+			val = keyvals[i+1]
+		}
+		e.KeyVals = append(e.KeyVals, fmt.Sprintf("%v=%v", keyvals[i], val))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.events[b.next] = e
+	b.next = (b.next + 1) % len(b.events)
+	b.full = b.full || b.next == 0
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+			// the subscriber is too slow, drop the event.
+		}
+	}
+}
+
+// Events returns the events in the buffer, oldest first.
+func (b *Buffer) Events() []Event {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.eventsLocked()
+}
+
+func (b *Buffer) eventsLocked() []Event {
+	if !b.full {
+		return append([]Event(nil), b.events[:b.next]...)
+	}
+	return append(append([]Event(nil), b.events[b.next:]...), b.events[:b.next]...)
+}
+
+// follow returns the events in the buffer, and a channel receiving the next
+// ones until cancel is called.
+func (b *Buffer) follow() (events []Event, ch <-chan Event, cancel func()) {
+	c := make(chan Event, 64)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[c] = struct{}{}
+	return b.eventsLocked(), c, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, c)
+	}
+}
+
+// Middleware prints the events of the buffer to the sessions authenticated
+// with one of the owners public keys running the `logs` command, instead of
+// calling the next handler. With `logs --follow`, new events are printed
+// until the session ends.
+func Middleware(b *Buffer, owners ...ssh.PublicKey) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			cmd := s.Command()
+			if len(cmd) == 0 || cmd[0] != "logs" || !isOwner(s, owners) {
+				sh(s)
+				return
+			}
+			follow := len(cmd) == 2 && (cmd[1] == "--follow" || cmd[1] == "-f")
+			if len(cmd) > 1 && !follow {
+				wish.Exit(s, 1, "usage: logs [--follow]")
+				return
+			}
+
+			events, ch, cancel := b.follow()
+			defer cancel()
+			for _, e := range events {
+				wish.Println(s, e)
+			}
+			if !follow {
+				return
+			}
+			for {
+				select {
+				case <-s.Context().Done():
+					return
+				case e := <-ch:
+					wish.Println(s, e)
+				}
+			}
+		}
+	}
+}
+
+func isOwner(s ssh.Session, owners []ssh.PublicKey) bool {
+	pk := s.PublicKey()
+	if pk == nil {
+		return false
+	}
+	for _, owner := range owners {
+		if ssh.KeysEqual(pk, owner) {
+			return true
+		}
+	}
+	return false
+}
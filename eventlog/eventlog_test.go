@@ -0,0 +1,116 @@
+package eventlog
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestBuffer(t *testing.T) {
+	b := New(3)
+	for _, msg := range []string{"a", "b", "c", "d"} {
+		b.Log("info", msg, "key", 1, "odd")
+	}
+	events := b.Events()
+	if len(events) != 3 || events[0].Message != "b" || events[2].Message != "d" {
+		t.Fatalf("unexpected events: %v", events)
+	}
+	if s := events[0].String(); !strings.HasSuffix(s, " INFO b key=1 odd=MISSING") {
+		t.Errorf("unexpected event line %q", s)
+	}
+
+	stop := b.Capture()
+	log.Error("could not do something", "error", "oops")
+	stop()
+	log.Error("not captured")
+	events = b.Events()
+	if e := events[len(events)-1]; e.Level != "error" || e.Message != "could not do something" {
+		t.Errorf("expected the error to be captured, got %v", events)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := New(10)
+	b.Log("warn", "first")
+	srv := &ssh.Server{
+		Handler: Middleware(b, signer.PublicKey())(func(s ssh.Session) {
+			wish.Print(s, "app")
+		}),
+		PublicKeyHandler: func(ssh.Context, ssh.PublicKey) bool { return true },
+		PasswordHandler:  func(ssh.Context, string) bool { return true },
+	}
+	addr := testsession.Listen(t, srv)
+	owner := &gossh.ClientConfig{
+		User: "owner",
+		Auth: []gossh.AuthMethod{gossh.PublicKeys(signer)},
+	}
+
+	t.Run("not owner", func(t *testing.T) {
+		sess, err := testsession.NewClientSession(t, addr, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := sess.Output("logs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != "app" {
+			t.Errorf("expected the app, got %q", out)
+		}
+	})
+
+	t.Run("logs", func(t *testing.T) {
+		sess, err := testsession.NewClientSession(t, addr, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := sess.Output("logs")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasSuffix(string(out), " WARN first\n") {
+			t.Errorf("unexpected output %q", out)
+		}
+	})
+
+	t.Run("follow", func(t *testing.T) {
+		sess, err := testsession.NewClientSession(t, addr, owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdout, err := sess.StdoutPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sess.Start("logs --follow"); err != nil {
+			t.Fatal(err)
+		}
+		r := bufio.NewReader(stdout)
+		line, err := r.ReadString('\n')
+		if err != nil || !strings.HasSuffix(line, " WARN first\n") {
+			t.Fatalf("unexpected line %q: %v", line, err)
+		}
+		b.Log("error", "second")
+		line, err = r.ReadString('\n')
+		if err != nil || !strings.HasSuffix(line, " ERROR second\n") {
+			t.Fatalf("unexpected line %q: %v", line, err)
+		}
+		_ = sess.Close()
+	})
+}
@@ -65,7 +65,7 @@ func main() {
 func teaHandler(s ssh.Session) (tea.Model, []tea.ProgramOption) {
 	pty, _, active := s.Pty()
 	if !active {
-		wish.Fatalln(s, "no active terminal, skipping")
+		wish.Exit(s, 1, "no active terminal, skipping")
 		return nil, nil
 	}
 	renderer := bm.MakeRenderer(s)
@@ -74,7 +74,7 @@ func myCustomBubbleteaMiddleware() wish.Middleware {
 	teaHandler := func(s ssh.Session) *tea.Program {
 		pty, _, active := s.Pty()
 		if !active {
-			wish.Fatalln(s, "no active terminal, skipping")
+			wish.Exit(s, 1, "no active terminal, skipping")
 			return nil
 		}
 		m := model{
@@ -21,6 +21,8 @@ const (
 )
 
 // example usage: ssh -N -R 23236:localhost:23235 -p 23234 localhost
+// or, to reach a local service through the server:
+// ssh -N -L 23237:localhost:23235 -p 23234 localhost
 func main() {
 	forwardHandler := &ssh.ForwardedTCPHandler{}
 	s, err := wish.NewServer(
@@ -37,6 +39,11 @@ func main() {
 			}
 			return nil
 		},
+		wish.WithLocalForwarding(func(_ ssh.Context, dhost string, dport uint32) bool {
+			allowed := dhost == "localhost"
+			log.Info("local port forwarding", "host", dhost, "port", dport, "allowed", allowed)
+			return allowed
+		}),
 		wish.WithMiddleware(
 			func(h ssh.Handler) ssh.Handler {
 				return func(s ssh.Session) {
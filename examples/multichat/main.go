@@ -79,7 +79,7 @@ func (a *app) Start() {
 
 func (a *app) ProgramHandler(s ssh.Session) *tea.Program {
 	if _, _, active := s.Pty(); !active {
-		wish.Fatalln(s, "terminal is not active")
+		wish.Exit(s, 1, "terminal is not active")
 	}
 
 	model := initialModel()
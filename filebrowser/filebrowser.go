@@ -0,0 +1,273 @@
+// Package filebrowser provides a Bubble Tea component to browse a directory
+// tree from a wish session.
+package filebrowser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/locale"
+)
+
+// ErrOutsideRoot is returned when a path resolves outside of the browsed
+// root, e.g. through a symlink.
+var ErrOutsideRoot = errors.New("path is outside of the root")
+
+// Resolver returns the root directory a session can browse, e.g. a directory
+// per user.
+type Resolver func(s ssh.Session, root string) string
+
+// UserRoot is a Resolver confining each user to a directory named after them
+// within the root.
+func UserRoot(s ssh.Session, root string) string {
+	return filepath.Join(root, filepath.Base(filepath.Clean("/"+s.User())))
+}
+
+// Option configures a Model.
+type Option func(*Model)
+
+// WithResolver sets the Resolver used to find the session's root.
+func WithResolver(r Resolver) Option {
+	return func(m *Model) {
+		m.root = r(m.s, m.root)
+	}
+}
+
+// WithHidden shows hidden files, which are omitted by default.
+func WithHidden() Option {
+	return func(m *Model) {
+		m.hidden = true
+	}
+}
+
+// SelectedMsg is sent when the user picks a file, e.g. to download it.
+type SelectedMsg struct {
+	// Path is the path of the file, relative to the root.
+	Path string
+}
+
+// Entry is a directory entry.
+type Entry struct {
+	Name  string
+	IsDir bool
+}
+
+// Model is a Bubble Tea component browsing the files within a root
+// directory. Directories are listed first, and names are sorted with the
+// session's locale.
+type Model struct {
+	s      ssh.Session
+	root   string
+	hidden bool
+
+	dir     string
+	entries []Entry
+	cursor  int
+	offset  int
+	height  int
+	err     error
+}
+
+var _ tea.Model = Model{}
+
+// New returns a Model browsing root for the given session.
+func New(s ssh.Session, root string, opts ...Option) Model {
+	m := Model{s: s, root: filepath.Clean(root)}
+	for _, opt := range opts {
+		opt(&m)
+	}
+	m.load(".")
+	return m
+}
+
+// Root returns the directory being browsed.
+func (m Model) Root() string { return m.root }
+
+// Dir returns the current directory, relative to the root.
+func (m Model) Dir() string { return m.dir }
+
+// Entries returns the entries of the current directory.
+func (m Model) Entries() []Entry { return m.entries }
+
+// Err returns the error of the last navigation, if any. It's cleared on the
+// next key press.
+func (m Model) Err() error { return m.err }
+
+// Highlighted returns the entry under the cursor and its path, relative to
+// the root.
+func (m Model) Highlighted() (Entry, string, bool) {
+	if m.cursor >= len(m.entries) {
+		return Entry{}, "", false
+	}
+	e := m.entries[m.cursor]
+	return e, filepath.Join(m.dir, e.Name), true
+}
+
+// resolve returns the absolute path of a path relative to the root, making
+// sure it doesn't escape it.
+func (m Model) resolve(rel string) (string, error) {
+	root, err := filepath.EvalSymlinks(m.root)
+	if err != nil {
+		return "", err
+	}
+	path, err := filepath.EvalSymlinks(filepath.Join(root, filepath.Clean("/"+rel)))
+	if err != nil {
+		return "", err
+	}
+	if r, err := filepath.Rel(root, path); err != nil || r == ".." || strings.HasPrefix(r, ".."+string(filepath.Separator)) {
+		return "", ErrOutsideRoot
+	}
+	return path, nil
+}
+
+// load reads the given directory, relative to the root.
+func (m *Model) load(rel string) {
+	rel = filepath.Clean("/" + rel)[1:]
+	if rel == "" {
+		rel = "."
+	}
+	path, err := m.resolve(rel)
+	if err != nil {
+		m.err = err
+		return
+	}
+	des, err := os.ReadDir(path)
+	if err != nil {
+		m.err = err
+		return
+	}
+
+	var dirs, files []string
+	isDir := map[string]bool{}
+	for _, de := range des {
+		name := de.Name()
+		if !m.hidden && strings.HasPrefix(name, ".") {
+			continue
+		}
+		dir := de.IsDir()
+		if de.Type()&os.ModeSymlink != 0 {
+			if fi, err := os.Stat(filepath.Join(path, name)); err == nil {
+				dir = fi.IsDir()
+			}
+		}
+		if dir {
+			dirs = append(dirs, name)
+		} else {
+			files = append(files, name)
+		}
+		isDir[name] = dir
+	}
+	locale.Sort(m.s, dirs)
+	locale.Sort(m.s, files)
+
+	m.entries = m.entries[:0:0]
+	for _, name := range append(dirs, files...) {
+		m.entries = append(m.entries, Entry{Name: name, IsDir: isDir[name]})
+	}
+	m.dir, m.cursor, m.offset, m.err = rel, 0, 0, nil
+}
+
+// Init implements tea.Model.
+func (m Model) Init() tea.Cmd { return nil }
+
+// Update implements tea.Model.
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		m.err = nil
+		switch msg.String() {
+		case "up", "k":
+			if m.cursor > 0 {
+				m.cursor--
+			}
+		case "down", "j":
+			if m.cursor < len(m.entries)-1 {
+				m.cursor++
+			}
+		case "left", "h", "backspace":
+			if m.dir != "." {
+				prev := filepath.Base(m.dir)
+				m.load(filepath.Dir(m.dir))
+				for i, e := range m.entries {
+					if e.Name == prev {
+						m.cursor = i
+					}
+				}
+			}
+		case "enter", "right", "l":
+			e, path, ok := m.Highlighted()
+			if !ok {
+				break
+			}
+			if e.IsDir {
+				m.load(path)
+				break
+			}
+			return m, func() tea.Msg { return SelectedMsg{Path: path} }
+		}
+	}
+	m.scroll()
+	return m, nil
+}
+
+// scroll keeps the cursor visible.
+func (m *Model) scroll() {
+	rows := m.rows()
+	if rows <= 0 {
+		return
+	}
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+rows {
+		m.offset = m.cursor - rows + 1
+	}
+}
+
+// rows returns the number of entries shown, or 0 if there's no limit.
+func (m Model) rows() int {
+	if m.height == 0 {
+		return 0
+	}
+	// the header, and the error if any, take a line each.
+	rows := m.height - 1
+	if m.err != nil {
+		rows--
+	}
+	if rows > 0 {
+		return rows
+	}
+	return 1
+}
+
+// View implements tea.Model.
+func (m Model) View() string {
+	var b strings.Builder
+	b.WriteString("/" + strings.TrimPrefix(filepath.ToSlash(m.dir), "."))
+	entries := m.entries[m.offset:]
+	if rows := m.rows(); rows > 0 && len(entries) > rows {
+		entries = entries[:rows]
+	}
+	for i, e := range entries {
+		b.WriteString("\n")
+		if m.offset+i == m.cursor {
+			b.WriteString("> ")
+		} else {
+			b.WriteString("  ")
+		}
+		b.WriteString(e.Name)
+		if e.IsDir {
+			b.WriteString("/")
+		}
+	}
+	if m.err != nil {
+		b.WriteString("\n" + m.err.Error())
+	}
+	return b.String()
+}
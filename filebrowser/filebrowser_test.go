@@ -0,0 +1,95 @@
+package filebrowser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestModel(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"alice/docs/notes", "bob"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"alice/b.txt", "alice/a.txt", "alice/.hidden", "alice/docs/c.txt", "bob/secret"} {
+		if err := os.WriteFile(filepath.Join(root, file), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(root, "bob"), filepath.Join(root, "alice", "escape")); err != nil {
+		t.Skip("symlinks not supported:", err)
+	}
+
+	models := make(chan Model, 1)
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			models <- New(s, root, WithResolver(UserRoot))
+		},
+	}
+	sess := testsession.New(t, srv, &gossh.ClientConfig{
+		User:            "alice",
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+	})
+	if err := sess.Run(""); err != nil {
+		t.Fatal(err)
+	}
+	m := <-models
+
+	key := func(m Model, k string) (Model, tea.Cmd) {
+		t.Helper()
+		var msg tea.KeyMsg
+		switch k {
+		case "enter":
+			msg = tea.KeyMsg{Type: tea.KeyEnter}
+		case "backspace":
+			msg = tea.KeyMsg{Type: tea.KeyBackspace}
+		default:
+			msg = tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(k)}
+		}
+		mm, cmd := m.Update(msg)
+		return mm.(Model), cmd
+	}
+
+	if expected := "/\n> docs/\n  escape/\n  a.txt\n  b.txt"; m.View() != expected {
+		t.Fatalf("expected %q, got %q", expected, m.View())
+	}
+
+	m, _ = key(m, "enter")
+	if m.Dir() != "docs" || !strings.Contains(m.View(), "notes/") {
+		t.Fatalf("expected to be in docs, got %q", m.View())
+	}
+	m, _ = key(m, "backspace")
+	if m.Dir() != "." {
+		t.Fatalf("expected to be back at the root, got %q", m.Dir())
+	}
+
+	m, _ = key(m, "j")
+	m, _ = key(m, "enter")
+	if !errors.Is(m.Err(), ErrOutsideRoot) {
+		t.Fatalf("expected ErrOutsideRoot, got %v", m.Err())
+	}
+
+	m, _ = key(m, "j")
+	m, cmd := key(m, "enter")
+	if cmd == nil {
+		t.Fatal("expected a command selecting the file")
+	}
+	if msg, ok := cmd().(SelectedMsg); !ok || msg.Path != "a.txt" {
+		t.Fatalf("expected a.txt to be selected, got %#v", cmd())
+	}
+
+	m, _ = key(m, "k")
+	mm, _ := m.Update(tea.WindowSizeMsg{Height: 2})
+	if v := mm.View(); v != "/\n> escape/" {
+		t.Fatalf("expected the list to scroll, got %q", v)
+	}
+}
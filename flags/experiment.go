@@ -0,0 +1,134 @@
+package flags
+
+import (
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+)
+
+// Variant is one of the arms of an Experiment.
+type Variant struct {
+	// Name identifies the variant, e.g. "control".
+	Name string
+
+	// Weight is the relative share of subjects assigned to this variant.
+	Weight int
+}
+
+// Experiment is an A/B experiment with weighted variants.
+type Experiment struct {
+	// Name identifies the experiment. It's also used to salt the bucketing,
+	// so different experiments get independent assignments.
+	Name string
+
+	// Variants are the possible arms of the experiment.
+	Variants []Variant
+}
+
+// Assign deterministically assigns the given subject to one of the
+// experiment variants. It returns an empty string if the experiment has no
+// variants with a positive weight.
+func (e Experiment) Assign(sub Subject) string {
+	var total int
+	for _, v := range e.Variants {
+		if v.Weight > 0 {
+			total += v.Weight
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+	b := Bucket(e.Name, sub.ID(), total)
+	for _, v := range e.Variants {
+		if v.Weight <= 0 {
+			continue
+		}
+		if b < v.Weight {
+			return v.Name
+		}
+		b -= v.Weight
+	}
+	return "" // unreachable
+}
+
+// Exposure is emitted the first time a session reads its variant of an
+// experiment.
+type Exposure struct {
+	Experiment string
+	Variant    string
+	Subject    Subject
+	Time       time.Time
+}
+
+// ExposureFunc is called with every Exposure. It can be used to forward
+// exposures to a metrics or audit system.
+type ExposureFunc func(Exposure)
+
+type assignments struct {
+	mu       sync.Mutex
+	sub      Subject
+	variants map[string]string
+	exposed  map[string]bool
+	fn       ExposureFunc
+}
+
+// experimentsKey is the key of the assignments of a session in its context.
+var experimentsKey = wish.NewContextKey[*assignments]("experiments")
+
+// Experiments assigns every session to a variant of each of the given
+// experiments, and stores the assignments in the session context, where they
+// can be read with VariantOf. They're kept per session, so sessions
+// multiplexed over a connection are exposed separately.
+//
+// The given ExposureFunc, if not nil, is called the first time each
+// experiment variant is read in a session.
+func Experiments(fn ExposureFunc, exps ...Experiment) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			a := &assignments{
+				sub:      SubjectFromSession(s),
+				variants: make(map[string]string, len(exps)),
+				exposed:  map[string]bool{},
+				fn:       fn,
+			}
+			for _, e := range exps {
+				// sessions of experiments without variants to assign
+				// aren't part of them, so they're never exposed.
+				if v := e.Assign(a.sub); v != "" {
+					a.variants[e.Name] = v
+				}
+			}
+			sh(wish.SessionWithValue(s, experimentsKey, a))
+		}
+	}
+}
+
+// VariantOf returns the variant of the named experiment the session the
+// context belongs to was assigned to, emitting an Exposure the first time it
+// is called. It returns an empty string if the session is not part of the
+// experiment.
+func VariantOf(ctx ssh.Context, experiment string) string {
+	a, ok := wish.ContextValue(ctx, experimentsKey)
+	if !ok {
+		return ""
+	}
+	a.mu.Lock()
+	v, ok := a.variants[experiment]
+	first := ok && !a.exposed[experiment]
+	if first {
+		a.exposed[experiment] = true
+	}
+	a.mu.Unlock()
+
+	if first && a.fn != nil {
+		a.fn(Exposure{
+			Experiment: experiment,
+			Variant:    v,
+			Subject:    a.sub,
+			Time:       time.Now(),
+		})
+	}
+	return v
+}
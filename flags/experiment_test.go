@@ -0,0 +1,130 @@
+package flags
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestExperimentAssign(t *testing.T) {
+	exp := Experiment{
+		Name: "colors",
+		Variants: []Variant{
+			{Name: "control", Weight: 1},
+			{Name: "disabled", Weight: 0},
+			{Name: "pink", Weight: 3},
+		},
+	}
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		sub := Subject{User: fmt.Sprint(i)}
+		v := exp.Assign(sub)
+		if v != exp.Assign(sub) {
+			t.Fatal("expected assignment to be deterministic")
+		}
+		counts[v]++
+	}
+	if counts["disabled"] != 0 {
+		t.Errorf("expected no subjects in a zero weight variant, got %d", counts["disabled"])
+	}
+	if counts["control"] < 150 || counts["control"] > 350 {
+		t.Errorf("expected about 250 subjects in control, got %d", counts["control"])
+	}
+	if counts["control"]+counts["pink"] != 1000 {
+		t.Errorf("expected all subjects to be assigned, got %v", counts)
+	}
+
+	if v := (Experiment{Name: "empty"}).Assign(Subject{}); v != "" {
+		t.Errorf("expected no variant, got %q", v)
+	}
+}
+
+func TestExperiments(t *testing.T) {
+	var mu sync.Mutex
+	var exposures []Exposure
+	sess := testsession.New(t, &ssh.Server{
+		Handler: Experiments(func(e Exposure) {
+			mu.Lock()
+			defer mu.Unlock()
+			exposures = append(exposures, e)
+		}, Experiment{
+			Name:     "colors",
+			Variants: []Variant{{Name: "pink", Weight: 1}},
+		}, Experiment{
+			Name:     "paused",
+			Variants: []Variant{{Name: "on", Weight: 0}},
+		})(func(s ssh.Session) {
+			fmt.Fprintf(
+				s, "%s %s %q %q",
+				VariantOf(s.Context(), "colors"),
+				VariantOf(s.Context(), "colors"),
+				VariantOf(s.Context(), "unknown"),
+				VariantOf(s.Context(), "paused"),
+			)
+		}),
+	}, nil)
+	out, err := sess.Output("")
+	requireNoError(t, err)
+	if string(out) != `pink pink "" ""` {
+		t.Errorf("unexpected output: %q", string(out))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(exposures) != 1 {
+		t.Fatalf("expected 1 exposure, got %d", len(exposures))
+	}
+	if e := exposures[0]; e.Experiment != "colors" || e.Variant != "pink" || e.Subject.User != "testuser" {
+		t.Errorf("unexpected exposure: %+v", e)
+	}
+}
+
+func TestExperimentsMultiplexed(t *testing.T) {
+	var exposures atomic.Int64
+	started := make(chan struct{}, 1)
+	second := make(chan struct{})
+	srv := &ssh.Server{
+		Handler: Experiments(func(Exposure) {
+			exposures.Add(1)
+		}, Experiment{
+			Name:     "colors",
+			Variants: []Variant{{Name: "pink", Weight: 1}},
+		})(func(s ssh.Session) {
+			if s.RawCommand() == "first" {
+				started <- struct{}{}
+				// the second session's assignments don't replace ours.
+				<-second
+			}
+			fmt.Fprint(s, VariantOf(s.Context(), "colors"))
+		}),
+	}
+	c, err := gossh.Dial("tcp", testsession.Listen(t, srv), &gossh.ClientConfig{
+		User:            "testuser",
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+	})
+	requireNoError(t, err)
+	defer c.Close() // nolint: errcheck
+
+	first, err := c.NewSession()
+	requireNoError(t, err)
+	done := make(chan error, 1)
+	go func() {
+		_, err := first.Output("first")
+		done <- err
+	}()
+	<-started
+	sess, err := c.NewSession()
+	requireNoError(t, err)
+	_, err = sess.Output("second")
+	requireNoError(t, err)
+	close(second)
+	requireNoError(t, <-done)
+	if n := exposures.Load(); n != 2 {
+		t.Errorf("expected each session to be exposed, got %d exposures", n)
+	}
+}
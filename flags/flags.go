@@ -0,0 +1,149 @@
+// Package flags provides a middleware that evaluates feature flags for every
+// session, so new features can be progressively rolled out to a subset of
+// users.
+package flags
+
+import (
+	"context"
+	"hash/fnv"
+	"net"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Flags is a set of evaluated feature flags.
+type Flags map[string]bool
+
+// Subject is who the flags are being evaluated for.
+type Subject struct {
+	// User is the user name the session authenticated with.
+	User string
+
+	// PublicKey is the public key used to authenticate, if any.
+	PublicKey ssh.PublicKey
+
+	// RemoteAddr is the remote address of the session. Providers may use it
+	// to resolve the country the user is connecting from.
+	RemoteAddr net.Addr
+}
+
+// ID returns a stable identifier for the subject: the SHA256 fingerprint of
+// its public key, or its user name if it didn't authenticate with a key.
+func (s Subject) ID() string {
+	if s.PublicKey != nil {
+		return gossh.FingerprintSHA256(s.PublicKey)
+	}
+	return "user:" + s.User
+}
+
+// Provider implementations evaluate the flags for a given subject.
+type Provider interface {
+	Evaluate(ctx context.Context, sub Subject) (Flags, error)
+}
+
+// ProviderFunc is an adapter to allow the use of ordinary functions as
+// a Provider.
+type ProviderFunc func(ctx context.Context, sub Subject) (Flags, error)
+
+// Evaluate calls fn(ctx, sub).
+func (fn ProviderFunc) Evaluate(ctx context.Context, sub Subject) (Flags, error) {
+	return fn(ctx, sub)
+}
+
+// Static returns a Provider that evaluates to the same flags for everyone.
+func Static(flags Flags) Provider {
+	return ProviderFunc(func(context.Context, Subject) (Flags, error) {
+		return flags, nil
+	})
+}
+
+// Rollout returns a Provider that enables the named flag for the given
+// percentage of subjects.
+//
+// Subjects are bucketed deterministically by their ID, so a given user keeps
+// the same value across sessions, and raising the percentage only ever adds
+// users to the rollout.
+func Rollout(name string, percent int) Provider {
+	return ProviderFunc(func(_ context.Context, sub Subject) (Flags, error) {
+		return Flags{name: Bucket(name, sub.ID(), 100) < percent}, nil
+	})
+}
+
+// Combine returns a Provider that evaluates all the given providers in order,
+// later ones overriding the flags set by earlier ones.
+func Combine(providers ...Provider) Provider {
+	return ProviderFunc(func(ctx context.Context, sub Subject) (Flags, error) {
+		result := Flags{}
+		for _, p := range providers {
+			flags, err := p.Evaluate(ctx, sub)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range flags {
+				result[k] = v
+			}
+		}
+		return result, nil
+	})
+}
+
+// Bucket deterministically assigns the given id to one of n buckets, salted
+// by name.
+func Bucket(name, id string, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write([]byte(id))
+	return int(h.Sum32() % uint32(n))
+}
+
+// flagsKey is the key of the flags of a session in its context.
+var flagsKey = wish.NewContextKey[Flags]("flags")
+
+// Middleware evaluates the flags for each session using the given provider
+// and stores them in the session context, where they can be read with
+// FromContext and Enabled. They're kept per session, so sessions multiplexed
+// over a connection each have their own.
+//
+// If the provider fails, the error is logged and the session continues with
+// no flags enabled.
+func Middleware(p Provider) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			flags, err := p.Evaluate(s.Context(), SubjectFromSession(s))
+			if err != nil {
+				log.Error("could not evaluate flags", "error", err)
+				flags = Flags{}
+			}
+			sh(wish.SessionWithValue(s, flagsKey, flags))
+		}
+	}
+}
+
+// SubjectFromSession returns the Subject for the given session.
+func SubjectFromSession(s ssh.Session) Subject {
+	return Subject{
+		User:       s.User(),
+		PublicKey:  s.PublicKey(),
+		RemoteAddr: s.RemoteAddr(),
+	}
+}
+
+// FromContext returns the flags evaluated for the session the context belongs
+// to. It returns nil if the Middleware was not used.
+func FromContext(ctx ssh.Context) Flags {
+	flags, _ := wish.ContextValue(ctx, flagsKey)
+	return flags
+}
+
+// Enabled reports whether the named flag is enabled for the session the
+// context belongs to.
+func Enabled(ctx ssh.Context, name string) bool {
+	return FromContext(ctx)[name]
+}
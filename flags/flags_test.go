@@ -0,0 +1,140 @@
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestMiddleware(t *testing.T) {
+	t.Run("static", func(t *testing.T) {
+		out, err := setup(t, Static(Flags{"new-ui": true})).Output("")
+		requireNoError(t, err)
+		if string(out) != "new-ui=true other=false" {
+			t.Errorf("unexpected output: %q", string(out))
+		}
+	})
+
+	t.Run("provider error", func(t *testing.T) {
+		out, err := setup(t, ProviderFunc(func(context.Context, Subject) (Flags, error) {
+			return nil, errors.New("nope")
+		})).Output("")
+		requireNoError(t, err)
+		if string(out) != "new-ui=false other=false" {
+			t.Errorf("unexpected output: %q", string(out))
+		}
+	})
+
+	t.Run("combine", func(t *testing.T) {
+		out, err := setup(t, Combine(
+			Static(Flags{"new-ui": true, "other": true}),
+			Static(Flags{"new-ui": false}),
+		)).Output("")
+		requireNoError(t, err)
+		if string(out) != "new-ui=false other=true" {
+			t.Errorf("unexpected output: %q", string(out))
+		}
+	})
+}
+
+func TestMiddlewareMultiplexed(t *testing.T) {
+	var sessions atomic.Int64
+	second := make(chan struct{})
+	srv := &ssh.Server{
+		Handler: Middleware(ProviderFunc(func(context.Context, Subject) (Flags, error) {
+			return Flags{"first": sessions.Add(1) == 1}, nil
+		}))(func(s ssh.Session) {
+			if s.RawCommand() == "first" {
+				// the second session's flags don't replace ours.
+				<-second
+			}
+			fmt.Fprintf(s, "first=%v", Enabled(s.Context(), "first"))
+		}),
+	}
+	c, err := gossh.Dial("tcp", testsession.Listen(t, srv), &gossh.ClientConfig{
+		User:            "testuser",
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+	})
+	requireNoError(t, err)
+	defer c.Close() // nolint: errcheck
+
+	first, err := c.NewSession()
+	requireNoError(t, err)
+	out := make(chan []byte, 1)
+	go func() {
+		bts, _ := first.Output("first")
+		out <- bts
+	}()
+	for sessions.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	sess, err := c.NewSession()
+	requireNoError(t, err)
+	bts, err := sess.Output("second")
+	requireNoError(t, err)
+	close(second)
+	if string(bts) != "first=false" {
+		t.Errorf("unexpected output for the second session: %q", string(bts))
+	}
+	if bts := <-out; string(bts) != "first=true" {
+		t.Errorf("unexpected output for the first session: %q", string(bts))
+	}
+}
+
+func TestRollout(t *testing.T) {
+	for _, tc := range []struct {
+		percent int
+		min     int
+		max     int
+	}{
+		{0, 0, 0},
+		{100, 1000, 1000},
+		{50, 400, 600},
+	} {
+		p := Rollout("new-ui", tc.percent)
+		var enabled int
+		for i := 0; i < 1000; i++ {
+			flags, err := p.Evaluate(context.Background(), Subject{User: fmt.Sprint(i)})
+			requireNoError(t, err)
+			if flags["new-ui"] {
+				enabled++
+			}
+		}
+		if enabled < tc.min || enabled > tc.max {
+			t.Errorf("%d%%: expected between %d and %d enabled, got %d", tc.percent, tc.min, tc.max, enabled)
+		}
+	}
+}
+
+func TestBucket(t *testing.T) {
+	if Bucket("a", "id", 10) != Bucket("a", "id", 10) {
+		t.Error("expected bucketing to be deterministic")
+	}
+	if b := Bucket("a", "id", 0); b != 0 {
+		t.Errorf("expected 0, got %d", b)
+	}
+}
+
+func setup(tb testing.TB, p Provider) *gossh.Session {
+	tb.Helper()
+	return testsession.New(tb, &ssh.Server{
+		Handler: Middleware(p)(func(s ssh.Session) {
+			fmt.Fprintf(s, "new-ui=%v other=%v", Enabled(s.Context(), "new-ui"), Enabled(s.Context(), "other"))
+		}),
+	}, nil)
+}
+
+func requireNoError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err.Error())
+	}
+}
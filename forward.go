@@ -0,0 +1,31 @@
+package wish
+
+import (
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+// WithLocalForwarding returns an ssh.Option accepting local port forwarding,
+// i.e. ssh -L, to the destinations policy allows, e.g. to expose internal
+// services to some users:
+//
+//	wish.WithLocalForwarding(func(ctx ssh.Context, dhost string, dport uint32) bool {
+//		return ctx.User() == "admin" && dhost == "localhost" && dport == 5432
+//	})
+//
+// policy is called for every forwarded connection, before the server
+// connects to the destination, with the host as the client sent it. Nothing
+// is forwarded if it's nil.
+func WithLocalForwarding(policy func(ctx ssh.Context, dhost string, dport uint32) bool) ssh.Option {
+	return func(s *ssh.Server) error {
+		s.LocalPortForwardingCallback = func(ctx ssh.Context, dhost string, dport uint32) bool {
+			allowed := policy != nil && policy(ctx, dhost, dport)
+			log.Debug("local port forwarding", "user", ctx.User(), "remote-addr", ctx.RemoteAddr(),
+				"host", dhost, "port", dport, "allowed", allowed)
+			return allowed
+		}
+		initChannelHandlers(s)
+		s.ChannelHandlers["direct-tcpip"] = ssh.DirectTCPIPHandler
+		return nil
+	}
+}
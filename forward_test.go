@@ -0,0 +1,74 @@
+package wish
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestWithLocalForwarding(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	requireNoError(t, err)
+	t.Cleanup(func() { _ = ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close() // nolint: errcheck
+				_, _ = io.Copy(conn, conn)
+			}()
+		}
+	}()
+	dest := ln.Addr().(*net.TCPAddr)
+
+	srv := &ssh.Server{Handler: func(ssh.Session) {}}
+	requireNoError(t, WithLocalForwarding(func(ctx ssh.Context, dhost string, dport uint32) bool {
+		return ctx.User() == "testuser" && dhost == "127.0.0.1" && dport == uint32(dest.Port)
+	})(srv))
+	addr := testsession.Listen(t, srv)
+
+	t.Run("allowed", func(t *testing.T) {
+		conn, err := dial(t, addr).Dial("tcp", dest.String())
+		requireNoError(t, err)
+		defer conn.Close() // nolint: errcheck
+		_, err = conn.Write([]byte("ping"))
+		requireNoError(t, err)
+		buf := make([]byte, 4)
+		_, err = io.ReadFull(conn, buf)
+		requireNoError(t, err)
+		requireEqual(t, "ping", string(buf))
+	})
+
+	t.Run("other destination", func(t *testing.T) {
+		if _, err := dial(t, addr).Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(dest.Port+1))); err == nil {
+			t.Error("expected the forwarding to be denied")
+		}
+	})
+
+	t.Run("other user", func(t *testing.T) {
+		c, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+			User:            "other",
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+		})
+		requireNoError(t, err)
+		defer c.Close() // nolint: errcheck
+		if _, err := c.Dial("tcp", dest.String()); err == nil {
+			t.Error("expected the forwarding to be denied")
+		}
+	})
+
+	t.Run("sessions", func(t *testing.T) {
+		// the default channel handlers are kept.
+		sess, err := dial(t, addr).NewSession()
+		requireNoError(t, err)
+		requireNoError(t, sess.Run(""))
+	})
+}
@@ -1,16 +1,18 @@
 package git
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
-	"github.com/charmbracelet/log"
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
 )
@@ -64,7 +66,8 @@ type Hooks interface {
 // checked for access on a per repo basis for a ssh.Session public key.
 // Hooks.Push and Hooks.Fetch will be called on successful completion of
 // their commands.
-func Middleware(repoDir string, gh Hooks) wish.Middleware {
+func Middleware(repoDir string, gh Hooks, opts ...Option) wish.Middleware {
+	cfg := newConfig(opts)
 	return func(sh ssh.Handler) ssh.Handler {
 		return func(s ssh.Session) {
 			cmd := s.Command()
@@ -79,14 +82,23 @@ func Middleware(repoDir string, gh Hooks) wish.Middleware {
 				}
 				pk := s.PublicKey()
 				access := gh.AuthRepo(repo, pk)
+				protocol, ok := cfg.protocol(s)
+				if !ok && gc == "git-upload-pack" {
+					Fatal(s, ErrProtocolV2Required)
+					return
+				}
+				g := &gitCmd{s: s, cfg: cfg, protocol: protocol, access: access}
 				switch gc {
 				case "git-receive-pack":
 					switch access {
 					case ReadWriteAccess, AdminAccess:
-						err := gitPack(s, gc, repoDir, repo)
-						if err != nil {
+						err := g.pack(gc, repoDir, repo)
+						switch {
+						case errors.Is(err, ErrPushRejected):
+							rejectPush(s, err, g.sideband)
+						case err != nil:
 							Fatal(s, ErrSystemMalfunction)
-						} else {
+						default:
 							gh.Push(repo, pk)
 						}
 					default:
@@ -96,7 +108,7 @@ func Middleware(repoDir string, gh Hooks) wish.Middleware {
 				case "git-upload-archive", "git-upload-pack":
 					switch access {
 					case ReadOnlyAccess, ReadWriteAccess, AdminAccess:
-						err := gitPack(s, gc, repoDir, repo)
+						err := g.pack(gc, repoDir, repo)
 						switch err {
 						case ErrInvalidRepo:
 							Fatal(s, ErrInvalidRepo)
@@ -117,11 +129,28 @@ func Middleware(repoDir string, gh Hooks) wish.Middleware {
 	}
 }
 
-func gitPack(s ssh.Session, gitCmd string, repoDir string, repo string) error {
+// gitCmd runs git commands for a session.
+type gitCmd struct {
+	s        ssh.Session
+	cfg      *config
+	protocol string
+	access   AccessLevel
+	sideband bool
+
+	// extraConfig is configuration for the current command only.
+	extraConfig []string
+}
+
+func (g *gitCmd) pack(gitCmd string, repoDir string, repo string) error {
 	cmd := strings.TrimPrefix(gitCmd, "git-")
 	rp := filepath.Join(repoDir, repo)
 	switch gitCmd {
 	case "git-upload-archive", "git-upload-pack":
+		if g.cfg.mirror != nil {
+			if err := g.cfg.mirror.sync(repoDir, repo); err != nil {
+				return err
+			}
+		}
 		exists, err := fileExists(rp)
 		if !exists {
 			return ErrInvalidRepo
@@ -129,22 +158,49 @@ func gitPack(s ssh.Session, gitCmd string, repoDir string, repo string) error {
 		if err != nil {
 			return err
 		}
-		return runGit(s, "", cmd, rp)
+		return g.run("", cmd, rp)
 	case "git-receive-pack":
-		err := EnsureRepo(repoDir, repo)
+		err := ensureRepo(repoDir, repo, g.cfg.objectFormat)
 		if err != nil {
 			return err
 		}
-		err = runGit(s, "", cmd, rp)
+		hooks := g.cfg.preReceive
+		if g.cfg.branchRules != nil {
+			if rules := g.cfg.branchRules(repo); len(rules) > 0 {
+				bp, err := newBranchProtection(rules, rp, g.cfg.gitConfig)
+				if err != nil {
+					return err
+				}
+				defer bp.close()
+				hooks = append(hooks[:len(hooks):len(hooks)], bp.check)
+				g.extraConfig = []string{"core.hooksPath=" + bp.hooksDir}
+			}
+		}
+		var in io.Reader = g.s
+		var rr *receiveReader
+		if len(hooks) > 0 {
+			rr = &receiveReader{
+				r:     bufio.NewReader(g.s),
+				push:  Push{Repo: repo, PublicKey: g.s.PublicKey(), Access: g.access},
+				hooks: hooks,
+			}
+			in = rr
+		}
+		err = g.runWithInput(in, "", cmd, rp)
+		g.extraConfig = nil
+		if rr != nil && rr.rejected != nil {
+			g.sideband = rr.sideband
+			return rr.rejected
+		}
 		if err != nil {
 			return err
 		}
-		err = ensureDefaultBranch(s, rp)
+		err = g.ensureDefaultBranch(rp)
 		if err != nil {
 			return err
 		}
 		// Needed for git dumb http server
-		return runGit(s, rp, "update-server-info")
+		return g.run(rp, "update-server-info")
 	default:
 		return fmt.Errorf("unknown git command: %s", gitCmd)
 	}
@@ -176,6 +232,12 @@ func Fatal(s ssh.Session, v ...interface{}) {
 // If path does not exist, it'll be created.
 // If the path is not a git repo, it will be git init-ed as a bare repository.
 func EnsureRepo(dir, repo string) error {
+	return ensureRepo(dir, repo, "")
+}
+
+// ensureRepo is like EnsureRepo, creating the repo with the given object
+// format if it's not empty.
+func ensureRepo(dir, repo, objectFormat string) error {
 	exists, err := fileExists(dir)
 	if err != nil {
 		return err
@@ -192,6 +254,10 @@ func EnsureRepo(dir, repo string) error {
 		return err
 	}
 	if !exists {
+		if objectFormat != "" {
+			// go-git can't create sha256 repos.
+			return exec.Command("git", "init", "--bare", "--object-format="+objectFormat, rp).Run() // nolint: gosec
+		}
 		_, err := git.PlainInit(rp, true)
 		if err != nil {
 			return err
@@ -200,18 +266,30 @@ func EnsureRepo(dir, repo string) error {
 	return nil
 }
 
-func runGit(s ssh.Session, dir string, args ...string) error {
-	usi := exec.CommandContext(s.Context(), "git", args...)
+func (g *gitCmd) run(dir string, args ...string) error {
+	return g.runWithInput(g.s, dir, args...)
+}
+
+func (g *gitCmd) runWithInput(in io.Reader, dir string, args ...string) error {
+	var allArgs []string
+	for _, c := range append(g.cfg.gitConfig[:len(g.cfg.gitConfig):len(g.cfg.gitConfig)], g.extraConfig...) {
+		allArgs = append(allArgs, "-c", c)
+	}
+	allArgs = append(allArgs, args...)
+	usi := exec.CommandContext(g.s.Context(), "git", allArgs...)
 	usi.Dir = dir
-	usi.Stdout = s
-	usi.Stdin = s
+	usi.Stdout = g.s
+	usi.Stdin = in
+	if g.protocol != "" {
+		usi.Env = append(os.Environ(), "GIT_PROTOCOL="+g.protocol)
+	}
 	if err := usi.Run(); err != nil {
 		return err
 	}
 	return nil
 }
 
-func ensureDefaultBranch(s ssh.Session, repoPath string) error {
+func (g *gitCmd) ensureDefaultBranch(repoPath string) error {
 	r, err := git.PlainOpen(repoPath)
 	if err != nil {
 		return err
@@ -228,7 +306,7 @@ func ensureDefaultBranch(s ssh.Session, repoPath string) error {
 	// Rename the default branch to the first branch available
 	_, err = r.Head()
 	if err == plumbing.ErrReferenceNotFound {
-		err = runGit(s, repoPath, "branch", "-M", fb.Name().Short())
+		err = g.run(repoPath, "branch", "-M", fb.Name().Short())
 		if err != nil {
 			return err
 		}
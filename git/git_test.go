@@ -1,13 +1,17 @@
 package git
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/charmbracelet/keygen"
 	"github.com/charmbracelet/ssh"
@@ -142,6 +146,293 @@ func TestGitMiddleware(t *testing.T) {
 	})
 }
 
+func TestGitMiddlewareOptions(t *testing.T) {
+	pubkey, pkPath := createKeyPair(t)
+	hkPath := filepath.Join(t.TempDir(), "id_ed25519")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	requireNoError(t, err)
+	remote := "ssh://" + l.Addr().String()
+
+	repoDir := t.TempDir()
+	hooks := &testHooks{
+		access: []accessDetails{
+			{pubkey, "repo1", AdminAccess},
+		},
+	}
+	srv, err := wish.NewServer(
+		wish.WithHostKeyPath(hkPath),
+		wish.WithMiddleware(Middleware(
+			repoDir,
+			hooks,
+			WithProtocolV2(true),
+			WithAllowFilter(),
+			WithObjectFormat("sha256"),
+		)),
+		wish.WithPublicKeyAuth(func(ctx ssh.Context, key ssh.PublicKey) bool {
+			return true
+		}),
+	)
+	requireNoError(t, err)
+	go func() { srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	t.Run("push sha256 repo", func(t *testing.T) {
+		cwd := t.TempDir()
+		requireNoError(t, runGitHelper(t, pkPath, cwd, "init", "-b", "main", "--object-format=sha256"))
+		requireNoError(t, runGitHelper(t, pkPath, cwd, "remote", "add", "origin", remote+"/repo1"))
+		requireNoError(t, runGitHelper(t, pkPath, cwd, "commit", "--allow-empty", "-m", "initial commit"))
+		requireNoError(t, runGitHelper(t, pkPath, cwd, "push", "origin", "main"))
+		requireHasAction(t, hooks.pushes, pubkey, "repo1")
+
+		out, err := exec.Command("git", "-C", filepath.Join(repoDir, "repo1"), "rev-parse", "--show-object-format").Output()
+		requireNoError(t, err)
+		if format := strings.TrimSpace(string(out)); format != "sha256" {
+			t.Fatalf("expected sha256 repo, got %q", format)
+		}
+	})
+
+	t.Run("partial clone with protocol v2", func(t *testing.T) {
+		cwd := t.TempDir()
+		requireNoError(t, runGitHelper(t, pkPath, cwd, "-c", "protocol.version=2", "clone", "--filter=blob:none", remote+"/repo1"))
+		requireHasAction(t, hooks.fetches, pubkey, "repo1")
+	})
+
+	t.Run("clone with protocol v0", func(t *testing.T) {
+		cwd := t.TempDir()
+		requireError(t, runGitHelper(t, pkPath, cwd, "-c", "protocol.version=0", "clone", remote+"/repo1"))
+	})
+}
+
+func TestGitMiddlewareMirror(t *testing.T) {
+	pubkey, pkPath := createKeyPair(t)
+	hkPath := filepath.Join(t.TempDir(), "id_ed25519")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	requireNoError(t, err)
+	remote := "ssh://" + l.Addr().String()
+
+	upstream := t.TempDir()
+	work := t.TempDir()
+	requireNoError(t, runGitHelper(t, pkPath, upstream, "init", "--bare", "-b", "main", "repo1.git"))
+	requireNoError(t, runGitHelper(t, pkPath, work, "init", "-b", "main"))
+	requireNoError(t, runGitHelper(t, pkPath, work, "remote", "add", "origin", filepath.Join(upstream, "repo1.git")))
+	requireNoError(t, runGitHelper(t, pkPath, work, "commit", "--allow-empty", "-m", "first"))
+	requireNoError(t, runGitHelper(t, pkPath, work, "push", "origin", "main"))
+
+	repoDir := t.TempDir()
+	hooks := &testHooks{
+		access: []accessDetails{
+			{pubkey, "repo1.git", ReadOnlyAccess},
+			{pubkey, "repo2.git", ReadOnlyAccess},
+		},
+	}
+	srv, err := wish.NewServer(
+		wish.WithHostKeyPath(hkPath),
+		wish.WithMiddleware(Middleware(repoDir, hooks, WithMirror(upstream, 0))),
+		wish.WithPublicKeyAuth(func(ctx ssh.Context, key ssh.PublicKey) bool {
+			return true
+		}),
+	)
+	requireNoError(t, err)
+	go func() { srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	t.Run("mirror on first fetch", func(t *testing.T) {
+		cwd := t.TempDir()
+		requireNoError(t, runGitHelper(t, pkPath, cwd, "clone", remote+"/repo1.git", "."))
+		requireNoError(t, runGitHelper(t, pkPath, cwd, "rev-parse", "--verify", "HEAD"))
+		requireHasAction(t, hooks.fetches, pubkey, "repo1.git")
+	})
+
+	t.Run("refresh stale mirror", func(t *testing.T) {
+		requireNoError(t, runGitHelper(t, pkPath, work, "commit", "--allow-empty", "-m", "second"))
+		requireNoError(t, runGitHelper(t, pkPath, work, "push", "origin", "main"))
+		cwd := t.TempDir()
+		requireNoError(t, runGitHelper(t, pkPath, cwd, "clone", remote+"/repo1.git", "."))
+		out, err := exec.Command("git", "-C", cwd, "log", "-1", "--format=%s").Output()
+		requireNoError(t, err)
+		if msg := strings.TrimSpace(string(out)); msg != "second" {
+			t.Fatalf("expected the mirror to be refreshed, got %q", msg)
+		}
+	})
+
+	t.Run("unknown upstream repo", func(t *testing.T) {
+		cwd := t.TempDir()
+		requireError(t, runGitHelper(t, pkPath, cwd, "clone", remote+"/repo2.git"))
+	})
+}
+
+func TestGitMiddlewarePreReceive(t *testing.T) {
+	pubkey, pkPath := createKeyPair(t)
+	hkPath := filepath.Join(t.TempDir(), "id_ed25519")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	requireNoError(t, err)
+	remote := "ssh://" + l.Addr().String()
+
+	var mu sync.Mutex
+	var pushes []Push
+	record := func(p Push) error {
+		mu.Lock()
+		defer mu.Unlock()
+		pushes = append(pushes, p)
+		for _, o := range p.Options {
+			if o == "reject" {
+				return errors.New("rejected by option")
+			}
+		}
+		return nil
+	}
+	protected := func(ref string) bool { return ref == "refs/heads/main" }
+	keyring := func(Push) []ssh.PublicKey { return []ssh.PublicKey{pubkey} }
+
+	hooks := &testHooks{
+		access: []accessDetails{
+			{pubkey, "repo1", ReadWriteAccess},
+		},
+	}
+	srv, err := wish.NewServer(
+		wish.WithHostKeyPath(hkPath),
+		wish.WithMiddleware(Middleware(
+			t.TempDir(),
+			hooks,
+			WithPreReceive(record),
+			WithPreReceive(RequireSignedPushes(protected, keyring)),
+			WithPushCertificates("secret"),
+		)),
+		wish.WithPublicKeyAuth(func(ctx ssh.Context, key ssh.PublicKey) bool {
+			return true
+		}),
+	)
+	requireNoError(t, err)
+	go func() { srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	cwd := t.TempDir()
+	requireNoError(t, runGitHelper(t, pkPath, cwd, "init", "-b", "main"))
+	requireNoError(t, runGitHelper(t, pkPath, cwd, "remote", "add", "origin", remote+"/repo1"))
+	requireNoError(t, runGitHelper(t, pkPath, cwd, "commit", "--allow-empty", "-m", "initial commit"))
+
+	t.Run("push options", func(t *testing.T) {
+		requireNoError(t, runGitHelper(t, pkPath, cwd, "push", "-o", "ci.skip", "origin", "main:feature"))
+		mu.Lock()
+		defer mu.Unlock()
+		last := pushes[len(pushes)-1]
+		if len(last.Options) != 1 || last.Options[0] != "ci.skip" {
+			t.Fatalf("expected push options, got %q", last.Options)
+		}
+		if len(last.Updates) != 1 || last.Updates[0].Ref != "refs/heads/feature" || !last.Updates[0].IsCreate() {
+			t.Fatalf("unexpected updates %+v", last.Updates)
+		}
+	})
+
+	t.Run("rejected push", func(t *testing.T) {
+		requireError(t, runGitHelper(t, pkPath, cwd, "push", "-o", "reject", "origin", "main:other"))
+		requireError(t, runGitHelper(t, pkPath, cwd, "ls-remote", "--exit-code", "origin", "other"))
+	})
+
+	t.Run("unsigned push to protected ref", func(t *testing.T) {
+		requireError(t, runGitHelper(t, pkPath, cwd, "push", "origin", "main"))
+	})
+
+	t.Run("signed push to protected ref", func(t *testing.T) {
+		requireNoError(t, runGitHelper(t, pkPath, cwd,
+			"-c", "gpg.format=ssh",
+			"-c", "user.signingKey="+pkPath,
+			"push", "--signed", "origin", "main",
+		))
+		mu.Lock()
+		defer mu.Unlock()
+		if cert := pushes[len(pushes)-1].Certificate; cert == nil || cert.Nonce == "" {
+			t.Fatalf("expected a push certificate with a nonce, got %+v", cert)
+		}
+	})
+}
+
+func TestGitMiddlewareBranchProtection(t *testing.T) {
+	pubkey, pkPath := createKeyPair(t)
+	hkPath := filepath.Join(t.TempDir(), "id_ed25519")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	requireNoError(t, err)
+	remote := "ssh://" + l.Addr().String()
+
+	hooks := &testHooks{
+		access: []accessDetails{
+			{pubkey, "repo1", ReadWriteAccess},
+		},
+	}
+	repoDir := t.TempDir()
+	rules := func(repo string) []BranchRule {
+		return []BranchRule{
+			{Pattern: "main"},
+			{Pattern: "release/*", Access: AdminAccess},
+			{Pattern: "feature/*", AllowForcePush: true, AllowDelete: true},
+		}
+	}
+	srv, err := wish.NewServer(
+		wish.WithHostKeyPath(hkPath),
+		wish.WithMiddleware(Middleware(repoDir, hooks, WithBranchProtection(rules))),
+		wish.WithPublicKeyAuth(func(ctx ssh.Context, key ssh.PublicKey) bool {
+			return true
+		}),
+	)
+	requireNoError(t, err)
+	go func() { srv.Serve(l) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	cwd := t.TempDir()
+	requireNoError(t, runGitHelper(t, pkPath, cwd, "init", "-b", "main"))
+	requireNoError(t, runGitHelper(t, pkPath, cwd, "remote", "add", "origin", remote+"/repo1"))
+	requireNoError(t, runGitHelper(t, pkPath, cwd, "commit", "--allow-empty", "-m", "first"))
+	requireNoError(t, runGitHelper(t, pkPath, cwd, "push", "origin", "main"))
+	requireNoError(t, runGitHelper(t, pkPath, cwd, "push", "origin", "main:feature/a"))
+	requireNoError(t, runGitHelper(t, pkPath, cwd, "commit", "--allow-empty", "-m", "second"))
+
+	t.Run("fast-forward protected branch", func(t *testing.T) {
+		requireNoError(t, runGitHelper(t, pkPath, cwd, "push", "origin", "main"))
+	})
+
+	t.Run("force push protected branch", func(t *testing.T) {
+		requireNoError(t, runGitHelper(t, pkPath, cwd, "commit", "--amend", "--allow-empty", "-m", "amended"))
+		requireError(t, runGitHelper(t, pkPath, cwd, "push", "--force", "origin", "main"))
+	})
+
+	t.Run("force push unprotected branch", func(t *testing.T) {
+		requireNoError(t, runGitHelper(t, pkPath, cwd, "push", "--force", "origin", "main:feature/a"))
+	})
+
+	t.Run("delete protected branch", func(t *testing.T) {
+		requireError(t, runGitHelper(t, pkPath, cwd, "push", "origin", ":main"))
+	})
+
+	t.Run("delete unprotected branch", func(t *testing.T) {
+		requireNoError(t, runGitHelper(t, pkPath, cwd, "push", "origin", ":feature/a"))
+	})
+
+	t.Run("push branch requiring admin access", func(t *testing.T) {
+		requireError(t, runGitHelper(t, pkPath, cwd, "push", "origin", "main:release/1"))
+	})
+
+	t.Run("repo hooks", func(t *testing.T) {
+		repoHooks := filepath.Join(repoDir, "repo1", "hooks")
+		marker := filepath.Join(t.TempDir(), "post-receive")
+		requireNoError(t, os.MkdirAll(repoHooks, 0o755))
+		requireNoError(t, os.WriteFile(filepath.Join(repoHooks, "pre-receive"), []byte("#!/bin/sh\n! grep -q refs/heads/blocked\n"), 0o700)) // nolint: gosec
+		requireNoError(t, os.WriteFile(filepath.Join(repoHooks, "post-receive"), []byte("#!/bin/sh\ntouch "+marker+"\n"), 0o700))            // nolint: gosec
+
+		requireError(t, runGitHelper(t, pkPath, cwd, "push", "origin", "main:blocked"))
+		if _, err := os.Stat(marker); err == nil {
+			t.Fatal("expected the post-receive hook not to run for a rejected push")
+		}
+		requireNoError(t, runGitHelper(t, pkPath, cwd, "push", "origin", "main:feature/b"))
+		if _, err := os.Stat(marker); err != nil {
+			t.Errorf("expected the post-receive hook to run: %v", err)
+		}
+	})
+}
+
 func runGitHelper(t *testing.T, pk, cwd string, args ...string) error {
 	t.Helper()
 
@@ -165,6 +456,39 @@ func runGitHelper(t *testing.T, pk, cwd string, args ...string) error {
 	return err
 }
 
+func TestValidMirrorRepo(t *testing.T) {
+	for repo, valid := range map[string]bool{
+		"wish.git":                  true,
+		"charmbracelet/wish.git":    true,
+		"charm_bracelet/wi-sh.v2":   true,
+		"..":                        false,
+		"../wish.git":               false,
+		"a/./b":                     false,
+		"-u/wish.git":               false,
+		"wish.git?ref=x":            false,
+		"user@evil.example/x.git":   false,
+		"charmbracelet/wish.git#x":  false,
+		"charmbracelet//wish.git":   false,
+		"charmbracelet/wish%2F.git": false,
+	} {
+		if got := validMirrorRepo(repo); got != valid {
+			t.Errorf("validMirrorRepo(%q): expected %v, got %v", repo, valid, got)
+		}
+	}
+}
+
+func TestMirrorForgetsStaleRepos(t *testing.T) {
+	m := &mirror{ttl: time.Minute, synced: map[string]time.Time{}}
+	m.synced["old.git"] = time.Now().Add(-time.Hour)
+	m.touch("new.git")
+	if _, ok := m.synced["old.git"]; ok {
+		t.Error("expected the stale repo to be forgotten")
+	}
+	if m.stale("new.git") {
+		t.Error("expected the synced repo not to be stale")
+	}
+}
+
 func requireNoError(t *testing.T, err error) {
 	t.Helper()
 
@@ -0,0 +1,127 @@
+package git
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/wish/internal/log"
+	"golang.org/x/sync/singleflight"
+)
+
+// WithMirror turns the middleware into a read-through cache of upstream, e.g.
+// "https://github.com".
+//
+// Fetching a repo that doesn't exist locally first mirrors it from upstream,
+// e.g. "charmbracelet/wish.git" from "https://github.com/charmbracelet/wish.git".
+// Mirrored repos are then served locally, and refreshed from upstream on
+// fetches once older than ttl. If a refresh fails, the cached repo is served.
+//
+// Access is still checked with Hooks.AuthRepo before anything is mirrored.
+func WithMirror(upstream string, ttl time.Duration) Option {
+	return func(c *config) {
+		c.mirror = &mirror{
+			upstream: strings.TrimSuffix(upstream, "/"),
+			ttl:      ttl,
+			synced:   map[string]time.Time{},
+		}
+	}
+}
+
+type mirror struct {
+	upstream string
+	ttl      time.Duration
+	group    singleflight.Group
+
+	mu     sync.Mutex
+	synced map[string]time.Time
+	pruned time.Time
+}
+
+// validMirrorRepo returns whether the repo name is safe to build an upstream
+// URL from: path segments of letters, digits, dots, dashes and underscores,
+// without "." and ".." ones, which would change the URL's meaning.
+func validMirrorRepo(repo string) bool {
+	for _, seg := range strings.Split(repo, "/") {
+		if seg == "" || seg == "." || seg == ".." || strings.HasPrefix(seg, "-") {
+			return false
+		}
+		for _, r := range seg {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			case r == '.', r == '-', r == '_':
+			default:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// sync mirrors the repo from upstream if it doesn't exist yet, or refreshes
+// it if it's a mirror older than the ttl. Concurrent fetches of the same repo
+// share the same sync.
+func (m *mirror) sync(repoDir, repo string) error {
+	if !validMirrorRepo(repo) {
+		return ErrInvalidRepo
+	}
+	_, err, _ := m.group.Do(repo, func() (interface{}, error) {
+		rp := filepath.Join(repoDir, repo)
+		exists, err := fileExists(rp)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			url := m.upstream + "/" + repo
+			if out, err := exec.Command("git", "clone", "--mirror", "--", url, rp).CombinedOutput(); err != nil { // nolint: gosec
+				log.Error("could not mirror repo", "repo", repo, "upstream", url, "error", err, "output", string(out))
+				return nil, ErrInvalidRepo
+			}
+			m.touch(repo)
+			return nil, nil
+		}
+		if !m.stale(repo) || !isMirror(rp) {
+			return nil, nil
+		}
+		if out, err := exec.Command("git", "-C", rp, "remote", "update", "--prune").CombinedOutput(); err != nil { // nolint: gosec
+			// serve the cached repo.
+			log.Error("could not refresh mirror", "repo", repo, "error", err, "output", string(out))
+			return nil, nil
+		}
+		m.touch(repo)
+		return nil, nil
+	})
+	return err
+}
+
+func (m *mirror) stale(repo string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	synced, ok := m.synced[repo]
+	return !ok || time.Since(synced) >= m.ttl
+}
+
+// touch records that the repo was just synced. Repos synced longer than the
+// ttl ago are forgotten, at most once per ttl, as they're stale anyway.
+func (m *mirror) touch(repo string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if now.Sub(m.pruned) >= m.ttl {
+		for r, synced := range m.synced {
+			if now.Sub(synced) >= m.ttl {
+				delete(m.synced, r)
+			}
+		}
+		m.pruned = now
+	}
+	m.synced[repo] = now
+}
+
+// isMirror returns whether the repo was created with `git clone --mirror`.
+func isMirror(rp string) bool {
+	out, err := exec.Command("git", "-C", rp, "config", "--get", "remote.origin.mirror").Output()
+	return err == nil && strings.TrimSpace(string(out)) == "true"
+}
@@ -0,0 +1,104 @@
+package git
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// ErrProtocolV2Required represents an attempt to use an older version of the
+// git protocol when version 2 is required.
+var ErrProtocolV2Required = errors.New("git protocol version 2 is required")
+
+// Option configures the git middleware.
+type Option func(*config)
+
+type config struct {
+	protocolV2   bool
+	requireV2    bool
+	gitConfig    []string
+	objectFormat string
+	mirror       *mirror
+	preReceive   []func(Push) error
+	branchRules  func(repo string) []BranchRule
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// WithProtocolV2 lets clients use version 2 of the git protocol, by passing
+// the GIT_PROTOCOL environment variable they send to git.
+//
+// If required is true, clients that don't request version 2 are rejected
+// when fetching. Pushes are always allowed, as git only implements them over
+// older versions.
+func WithProtocolV2(required bool) Option {
+	return func(c *config) {
+		c.protocolV2 = true
+		c.requireV2 = required
+	}
+}
+
+// WithGitConfig sets a configuration value for the git commands run by the
+// middleware, as with `git -c key=value`, instead of having to set it in
+// every repo.
+func WithGitConfig(key, value string) Option {
+	return func(c *config) {
+		c.gitConfig = append(c.gitConfig, key+"="+value)
+	}
+}
+
+// WithAllowFilter allows partial clones, e.g. `git clone --filter=blob:none`,
+// by setting uploadpack.allowFilter.
+func WithAllowFilter() Option {
+	return WithGitConfig("uploadpack.allowFilter", "true")
+}
+
+// WithAllowAnySHA1InWant allows clients to fetch any object, reachable or
+// not, by setting uploadpack.allowAnySHA1InWant.
+func WithAllowAnySHA1InWant() Option {
+	return WithGitConfig("uploadpack.allowAnySHA1InWant", "true")
+}
+
+// WithObjectFormat sets the object format, "sha1" or "sha256", of the repos
+// created by pushes.
+func WithObjectFormat(format string) Option {
+	return func(c *config) {
+		c.objectFormat = format
+	}
+}
+
+// protocol returns the value of the GIT_PROTOCOL environment variable to pass
+// to git, and whether the session is allowed to proceed.
+func (c *config) protocol(s ssh.Session) (string, bool) {
+	if !c.protocolV2 {
+		return "", true
+	}
+	var protocol string
+	for _, env := range s.Environ() {
+		if strings.HasPrefix(env, "GIT_PROTOCOL=") {
+			protocol = strings.TrimPrefix(env, "GIT_PROTOCOL=")
+		}
+	}
+	if c.requireV2 && !hasVersion2(protocol) {
+		return "", false
+	}
+	return protocol, true
+}
+
+// hasVersion2 returns whether the GIT_PROTOCOL value requests version 2. It's
+// a colon separated list of key=value parameters.
+func hasVersion2(protocol string) bool {
+	for _, param := range strings.Split(protocol, ":") {
+		if param == "version=2" {
+			return true
+		}
+	}
+	return false
+}
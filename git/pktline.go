@@ -0,0 +1,41 @@
+package git
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// errInvalidPktLine is returned when the client sends malformed pkt-lines.
+var errInvalidPktLine = errors.New("invalid pkt-line")
+
+// maxPktLen is the maximum length of a pkt-line, including its header.
+const maxPktLen = 65520
+
+// readPktLine reads a pkt-line, returning its raw bytes, including the
+// length header, and its payload. The payload of flush packets is nil.
+func readPktLine(r *bufio.Reader) (raw []byte, payload []byte, err error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, nil, err
+	}
+	n, err := strconv.ParseUint(string(header), 16, 16)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %q", errInvalidPktLine, header)
+	}
+	if n < 4 {
+		// flush, delim or response end packets.
+		return header, nil, nil
+	}
+	if n > maxPktLen {
+		return nil, nil, fmt.Errorf("%w: too long", errInvalidPktLine)
+	}
+	raw = make([]byte, n)
+	copy(raw, header)
+	if _, err := io.ReadFull(r, raw[4:]); err != nil {
+		return nil, nil, err
+	}
+	return raw, raw[4:], nil
+}
@@ -0,0 +1,172 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrProtectedRef is returned when a push breaks a branch protection rule.
+var ErrProtectedRef = errors.New("protected ref")
+
+// BranchRule protects the refs matching a pattern.
+type BranchRule struct {
+	// Pattern is matched against ref names with path.Match. Patterns not
+	// starting with "refs/" match branches, e.g. "main" or "release/*".
+	Pattern string
+
+	// AllowForcePush allows non fast-forward updates of matching refs.
+	AllowForcePush bool
+
+	// AllowDelete allows deleting matching refs.
+	AllowDelete bool
+
+	// Access is the access level required to update matching refs, e.g.
+	// AdminAccess. The zero value doesn't restrict pushes any further.
+	Access AccessLevel
+}
+
+// Match returns whether the rule applies to the given ref.
+func (r BranchRule) Match(ref string) bool {
+	pattern := r.Pattern
+	if !strings.HasPrefix(pattern, "refs/") {
+		pattern = "refs/heads/" + pattern
+	}
+	ok, _ := path.Match(pattern, ref)
+	return ok
+}
+
+// WithBranchProtection enforces the branch protection rules rules returns for
+// each repo, e.g. a method of the Hooks implementation looking them up in
+// storage. All the rules matching a ref apply.
+//
+// Force pushes are detected by a pre-receive git hook, run through
+// core.hooksPath. It chains to the repo's own hooks, so they still run.
+func WithBranchProtection(rules func(repo string) []BranchRule) Option {
+	return func(c *config) {
+		c.branchRules = rules
+	}
+}
+
+// forcePushHook rejects non fast-forward updates of the refs listed in the
+// fast-forward-only file next to it, and then runs the repo's own pre-receive
+// hook, if any, from the directory in the hooks-path file. Git runs it once it
+// received the pushed objects, which aren't available to the middleware
+// beforehand.
+const forcePushHook = `#!/bin/sh
+dir="$(dirname "$0")"
+cat >"$dir/updates"
+status=0
+while read -r old new ref; do
+	grep -qxF "$ref" "$dir/fast-forward-only" 2>/dev/null || continue
+	case "$old" in *[!0]*) ;; *) continue ;; esac
+	case "$new" in *[!0]*) ;; *) continue ;; esac
+	if ! git merge-base --is-ancestor "$old" "$new"; then
+		echo "$ref: force pushes are not allowed" >&2
+		status=1
+	fi
+done <"$dir/updates"
+[ $status -eq 0 ] || exit $status
+hook="$(cat "$dir/hooks-path")/pre-receive"
+[ -x "$hook" ] || exit 0
+exec "$hook" <"$dir/updates"
+`
+
+// chainHook runs the repo's own hook of the same name, from the directory in
+// the hooks-path file next to it.
+const chainHook = `#!/bin/sh
+exec "$(cat "$(dirname "$0")/hooks-path")/$(basename "$0")" "$@"
+`
+
+// receiveHooks are the hooks git runs when receiving a push, besides
+// pre-receive.
+var receiveHooks = []string{"update", "post-receive", "post-update", "reference-transaction", "proc-receive", "push-to-checkout"}
+
+// branchProtection enforces branch protection rules on a push.
+type branchProtection struct {
+	rules    []BranchRule
+	hooksDir string
+}
+
+// newBranchProtection sets up the hooks directory enforcing rules on a push
+// to the repo at rp, chaining to its own hooks, to be removed with close.
+// config is the configuration git runs with.
+func newBranchProtection(rules []BranchRule, rp string, config []string) (*branchProtection, error) {
+	repoHooks, err := hooksPath(rp, config)
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp("", "wish-hooks-")
+	if err != nil {
+		return nil, err
+	}
+	bp := &branchProtection{rules: rules, hooksDir: dir}
+	files := map[string]string{
+		"hooks-path":  repoHooks,
+		"pre-receive": forcePushHook,
+	}
+	for _, name := range receiveHooks {
+		// only chain to existing hooks, as some change how git behaves
+		// just by existing.
+		if fi, err := os.Stat(filepath.Join(repoHooks, name)); err == nil && !fi.IsDir() && fi.Mode()&0o111 != 0 {
+			files[name] = chainHook
+		}
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o700); err != nil { // nolint: gosec
+			bp.close()
+			return nil, err
+		}
+	}
+	return bp, nil
+}
+
+// hooksPath returns the absolute path of the hooks directory of the repo at
+// rp, as configured with core.hooksPath, or its default one.
+func hooksPath(rp string, config []string) (string, error) {
+	var args []string
+	for _, c := range config {
+		args = append(args, "-c", c)
+	}
+	args = append(args, "-C", rp, "rev-parse", "--git-path", "hooks")
+	out, err := exec.Command("git", args...).Output() // nolint: gosec
+	if err != nil {
+		return "", fmt.Errorf("could not find the hooks of %s: %w", rp, err)
+	}
+	p := strings.TrimSuffix(string(out), "\n")
+	if !filepath.IsAbs(p) {
+		p = filepath.Join(rp, p)
+	}
+	return filepath.Abs(p)
+}
+
+// check is a pre-receive hook rejecting pushes breaking the rules. It lists
+// the refs that can't be force pushed for the git hook to check.
+func (bp *branchProtection) check(p Push) error {
+	var fastForwardOnly strings.Builder
+	for _, u := range p.Updates {
+		for _, r := range bp.rules {
+			if !r.Match(u.Ref) {
+				continue
+			}
+			if p.Access < r.Access {
+				return fmt.Errorf("%w: %s: %s", ErrProtectedRef, u.Ref, ErrNotAuthed)
+			}
+			if u.IsDelete() && !r.AllowDelete {
+				return fmt.Errorf("%w: %s can't be deleted", ErrProtectedRef, u.Ref)
+			}
+			if !r.AllowForcePush {
+				fastForwardOnly.WriteString(u.Ref + "\n")
+			}
+		}
+	}
+	return os.WriteFile(filepath.Join(bp.hooksDir, "fast-forward-only"), []byte(fastForwardOnly.String()), 0o600)
+}
+
+func (bp *branchProtection) close() {
+	_ = os.RemoveAll(bp.hooksDir)
+}
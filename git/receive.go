@@ -0,0 +1,277 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+)
+
+// ErrPushRejected is returned when a push is rejected by a pre-receive hook.
+var ErrPushRejected = errors.New("push rejected")
+
+// ErrUnsignedPush is returned when an unsigned push updates a protected ref.
+var ErrUnsignedPush = errors.New("pushes to protected refs must be signed")
+
+// RefUpdate is a ref update requested by a push.
+type RefUpdate struct {
+	Ref string
+	Old string
+	New string
+}
+
+// IsCreate returns whether the update creates the ref.
+func (u RefUpdate) IsCreate() bool {
+	return isZeroID(u.Old)
+}
+
+// IsDelete returns whether the update deletes the ref.
+func (u RefUpdate) IsDelete() bool {
+	return isZeroID(u.New)
+}
+
+// isZeroID returns whether id is the SHA-1 or SHA-256 object ID used for
+// missing refs in ref updates.
+func isZeroID(id string) bool {
+	return (len(id) == 40 || len(id) == 64) && strings.Trim(id, "0") == ""
+}
+
+// PushCertificate is the certificate sent with signed pushes, e.g.
+// `git push --signed`.
+type PushCertificate struct {
+	Pusher string
+	Pushee string
+	Nonce  string
+
+	// Payload is the signed part of the certificate.
+	Payload []byte
+
+	// Signature is the armored signature of the payload.
+	Signature []byte
+}
+
+// Push is a push as received from the client, before it's applied.
+type Push struct {
+	Repo      string
+	PublicKey ssh.PublicKey
+	Access    AccessLevel
+	Updates   []RefUpdate
+
+	// Options are the push options sent by the client, e.g.
+	// `git push -o ci.skip`.
+	Options []string
+
+	// Certificate is the certificate of signed pushes, or nil. If present,
+	// Updates are the ones listed in the certificate.
+	Certificate *PushCertificate
+}
+
+// WithPreReceive calls fn with every push before it's applied. If fn returns
+// an error, the push is rejected with it. This also lets clients send push
+// options.
+func WithPreReceive(fn func(Push) error) Option {
+	return func(c *config) {
+		c.preReceive = append(c.preReceive, fn)
+		c.gitConfig = append(c.gitConfig, "receive.advertisePushOptions=true")
+	}
+}
+
+// WithPushCertificates lets clients sign their pushes, with
+// `git push --signed`, seed being the secret used by git to generate the
+// certificate nonces. See receive.certNonceSeed in git-config(1).
+func WithPushCertificates(seed string) Option {
+	return WithGitConfig("receive.certNonceSeed", seed)
+}
+
+// receiveReader reads the ref updates of a push from r, calling the
+// pre-receive hooks before handing them, and the rest of the stream, to git.
+type receiveReader struct {
+	r     *bufio.Reader
+	push  Push
+	hooks []func(Push) error
+
+	parsed   bool
+	pending  []byte
+	err      error
+	rejected error
+
+	// sideband is whether the client asked for messages to be multiplexed
+	// in a side band.
+	sideband bool
+}
+
+func (rr *receiveReader) Read(b []byte) (int, error) {
+	if !rr.parsed {
+		rr.parsed = true
+		rr.pending, rr.err = rr.parse()
+		if rr.err == nil && len(rr.push.Updates) > 0 {
+			for _, hook := range rr.hooks {
+				if err := hook(rr.push); err != nil {
+					rr.rejected = fmt.Errorf("%w: %s", ErrPushRejected, err)
+					rr.err = rr.rejected
+					break
+				}
+			}
+		}
+		if rr.err != nil {
+			// don't let git see any of the push.
+			rr.pending = nil
+		}
+	}
+	if len(rr.pending) > 0 {
+		n := copy(b, rr.pending)
+		rr.pending = rr.pending[n:]
+		return n, nil
+	}
+	if rr.err != nil {
+		return 0, rr.err
+	}
+	return rr.r.Read(b)
+}
+
+// parse reads the update requests of the push, and the push options,
+// returning the raw bytes read.
+func (rr *receiveReader) parse() ([]byte, error) {
+	var raw bytes.Buffer
+	next := func() ([]byte, error) {
+		r, payload, err := readPktLine(rr.r)
+		raw.Write(r)
+		return payload, err
+	}
+
+	var caps []string
+	first := true
+	for {
+		line, err := next()
+		if err != nil {
+			return nil, err
+		}
+		if line == nil {
+			break
+		}
+		text := strings.TrimSuffix(string(line), "\n")
+		if strings.HasPrefix(text, "shallow ") {
+			continue
+		}
+		if first {
+			first = false
+			if i := strings.IndexByte(text, 0); i >= 0 {
+				caps = strings.Fields(text[i+1:])
+				text = text[:i]
+			}
+			if text == "push-cert" {
+				if err := rr.parseCertificate(next); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		}
+		if u, ok := parseRefUpdate(text); ok {
+			rr.push.Updates = append(rr.push.Updates, u)
+		}
+	}
+	if first {
+		// nothing to push.
+		return raw.Bytes(), nil
+	}
+
+	for _, c := range caps {
+		if c == "side-band" || c == "side-band-64k" {
+			rr.sideband = true
+		}
+	}
+	for _, c := range caps {
+		if c != "push-options" {
+			continue
+		}
+		for {
+			line, err := next()
+			if err != nil {
+				return nil, err
+			}
+			if line == nil {
+				break
+			}
+			rr.push.Options = append(rr.push.Options, strings.TrimSuffix(string(line), "\n"))
+		}
+	}
+	return raw.Bytes(), nil
+}
+
+func (rr *receiveReader) parseCertificate(next func() ([]byte, error)) error {
+	cert := &PushCertificate{}
+	var payload, sig bytes.Buffer
+	inSig, inHeader := false, true
+	for {
+		line, err := next()
+		if err != nil {
+			return err
+		}
+		if line == nil {
+			return errInvalidPktLine
+		}
+		text := strings.TrimSuffix(string(line), "\n")
+		if text == "push-cert-end" {
+			break
+		}
+		if strings.HasPrefix(text, "-----BEGIN ") {
+			inSig = true
+		}
+		if inSig {
+			sig.Write(line)
+			continue
+		}
+		payload.Write(line)
+		switch {
+		case text == "":
+			inHeader = false
+		case inHeader:
+			key, value, _ := strings.Cut(text, " ")
+			switch key {
+			case "pusher":
+				cert.Pusher = value
+			case "pushee":
+				cert.Pushee = value
+			case "nonce":
+				cert.Nonce = value
+			case "push-option":
+				rr.push.Options = append(rr.push.Options, value)
+			}
+		default:
+			if u, ok := parseRefUpdate(text); ok {
+				rr.push.Updates = append(rr.push.Updates, u)
+			}
+		}
+	}
+	cert.Payload, cert.Signature = payload.Bytes(), sig.Bytes()
+	rr.push.Certificate = cert
+	return nil
+}
+
+func parseRefUpdate(line string) (RefUpdate, bool) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return RefUpdate{}, false
+	}
+	return RefUpdate{Old: fields[0], New: fields[1], Ref: fields[2]}, true
+}
+
+var _ io.Reader = &receiveReader{}
+
+// rejectPush reports a push rejected by a pre-receive hook to the client. The
+// error is sent in the error side band if the client asked for one, as it
+// then expects every message there.
+func rejectPush(s ssh.Session, err error, sideband bool) {
+	if !sideband {
+		Fatal(s, err)
+		return
+	}
+	msg := "\x03" + err.Error() + "\n"
+	_, _ = wish.WriteString(s, fmt.Sprintf("%04x%s", len(msg)+4, msg))
+	s.Exit(1) // nolint: errcheck
+}
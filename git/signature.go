@@ -0,0 +1,129 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// ErrInvalidSignature is returned when a push certificate isn't signed by any
+// of the expected keys.
+var ErrInvalidSignature = errors.New("invalid push certificate signature")
+
+// RequireSignedPushes returns a pre-receive hook, to be used with
+// WithPreReceive, rejecting pushes updating refs for which protected returns
+// true unless their certificate is signed by one of the keys keyring returns
+// for the push. Use it along with WithPushCertificates.
+//
+// Only SSH signatures are supported, i.e. clients must set gpg.format=ssh.
+// The certificate nonce isn't verified.
+func RequireSignedPushes(protected func(ref string) bool, keyring func(Push) []ssh.PublicKey) func(Push) error {
+	return func(p Push) error {
+		for _, u := range p.Updates {
+			if !protected(u.Ref) {
+				continue
+			}
+			if p.Certificate == nil {
+				return ErrUnsignedPush
+			}
+			return VerifyCertificate(p.Certificate, keyring(p)...)
+		}
+		return nil
+	}
+}
+
+// sshSigMagic is the preamble of SSH signatures, see PROTOCOL.sshsig in the
+// OpenSSH sources.
+const sshSigMagic = "SSHSIG"
+
+// VerifyCertificate verifies the push certificate is signed by one of the
+// given keys. Only SSH signatures are supported.
+func VerifyCertificate(cert *PushCertificate, keys ...ssh.PublicKey) error {
+	blob, err := unarmor(cert.Signature)
+	if err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(blob, []byte(sshSigMagic)) {
+		return fmt.Errorf("%w: not a ssh signature", ErrInvalidSignature)
+	}
+	var sig struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := gossh.Unmarshal(blob[len(sshSigMagic):], &sig); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+	if sig.Version != 1 || sig.Namespace != "git" {
+		return fmt.Errorf("%w: unsupported version or namespace", ErrInvalidSignature)
+	}
+	pk, err := gossh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+	trusted := false
+	for _, k := range keys {
+		if ssh.KeysEqual(pk, k) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return fmt.Errorf("%w: untrusted key", ErrInvalidSignature)
+	}
+
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return fmt.Errorf("%w: unsupported hash algorithm %q", ErrInvalidSignature, sig.HashAlgorithm)
+	}
+	_, _ = h.Write(cert.Payload)
+	signed := append([]byte(sshSigMagic), gossh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{sig.Namespace, sig.Reserved, sig.HashAlgorithm, h.Sum(nil)})...)
+
+	var s gossh.Signature
+	if err := gossh.Unmarshal(sig.Signature, &s); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+	if err := pk.Verify(signed, &s); err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+	return nil
+}
+
+// unarmor decodes an armored SSH signature.
+func unarmor(armored []byte) ([]byte, error) {
+	const (
+		begin = "-----BEGIN SSH SIGNATURE-----"
+		end   = "-----END SSH SIGNATURE-----"
+	)
+	s := bytes.TrimSpace(armored)
+	if !bytes.HasPrefix(s, []byte(begin)) || !bytes.HasSuffix(s, []byte(end)) {
+		return nil, fmt.Errorf("%w: not a ssh signature", ErrInvalidSignature)
+	}
+	s = bytes.Join(bytes.Fields(s[len(begin):len(s)-len(end)]), nil)
+	blob := make([]byte, base64.StdEncoding.DecodedLen(len(s)))
+	n, err := base64.StdEncoding.Decode(blob, s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSignature, err)
+	}
+	return blob[:n], nil
+}
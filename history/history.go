@@ -0,0 +1,146 @@
+// Package history provides a middleware that records the commands users run
+// across sessions, and shows it to them through the `history` command.
+package history
+
+import (
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Command is the command users run to see their history, e.g.
+// `ssh host history`. Running `ssh host history clear` deletes it.
+const Command = "history"
+
+// Entry is a command run by a user.
+type Entry struct {
+	Command string
+	Time    time.Time
+}
+
+// Store implementations persist the history of users.
+type Store interface {
+	// Add appends an entry to the history of the given user.
+	Add(id string, entry Entry) error
+
+	// History returns the history of the given user, oldest first.
+	History(id string) ([]Entry, error)
+
+	// Clear deletes the history of the given user.
+	Clear(id string) error
+}
+
+// NewMemoryStore returns a Store that keeps the last max entries of each
+// user in memory.
+func NewMemoryStore(max int) Store {
+	if max <= 0 {
+		max = 1
+	}
+	return &memoryStore{max: max, entries: map[string][]Entry{}}
+}
+
+type memoryStore struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string][]Entry
+}
+
+func (m *memoryStore) Add(id string, entry Entry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entries := append(m.entries[id], entry)
+	if n := len(entries) - m.max; n > 0 {
+		entries = append([]Entry(nil), entries[n:]...)
+	}
+	m.entries[id] = entries
+	return nil
+}
+
+func (m *memoryStore) History(id string) ([]Entry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Entry(nil), m.entries[id]...), nil
+}
+
+func (m *memoryStore) Clear(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.entries, id)
+	return nil
+}
+
+// Middleware records the commands run by the users for which consent returns
+// true into store, and handles the history command. A nil consent records
+// every user.
+//
+// Users are identified by their public key fingerprint, falling back to their
+// user name. Interactive sessions, without a command, aren't recorded.
+func Middleware(store Store, consent func(ssh.Session) bool) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			id := UserID(s)
+			cmd := s.Command()
+			if len(cmd) > 0 && cmd[0] == Command {
+				handle(s, store, id, cmd[1:])
+				return
+			}
+			if len(cmd) > 0 && (consent == nil || consent(s)) {
+				if err := store.Add(id, Entry{Command: s.RawCommand(), Time: time.Now()}); err != nil {
+					log.Error("could not record command", "error", err)
+				}
+			}
+			sh(s)
+		}
+	}
+}
+
+func handle(s ssh.Session, store Store, id string, args []string) {
+	switch {
+	case len(args) == 0:
+		entries, err := store.History(id)
+		if err != nil {
+			log.Error("could not get history", "error", err)
+			wish.Exit(s, 1, "could not get history")
+			return
+		}
+		for i, e := range entries {
+			wish.Printf(s, "%5d  %s  %s\n", i+1, e.Time.UTC().Format(time.RFC3339), e.Command)
+		}
+	case len(args) == 1 && args[0] == "clear":
+		if err := store.Clear(id); err != nil {
+			log.Error("could not clear history", "error", err)
+			wish.Exit(s, 1, "could not clear history")
+			return
+		}
+		wish.Println(s, "history cleared")
+	default:
+		wish.Exitf(s, 1, "usage: %s [clear]", Command)
+	}
+}
+
+// Commands returns the commands in the history of the session's user, most
+// recent last, e.g. to implement up-arrow history in a prompt.
+func Commands(store Store, s ssh.Session) ([]string, error) {
+	entries, err := store.History(UserID(s))
+	if err != nil {
+		return nil, err
+	}
+	cmds := make([]string, 0, len(entries))
+	for _, e := range entries {
+		cmds = append(cmds, e.Command)
+	}
+	return cmds, nil
+}
+
+// UserID identifies the user of a session in the store: their public key
+// fingerprint, falling back to "user:" followed by their user name.
+func UserID(s ssh.Session) string {
+	if pk := s.PublicKey(); pk != nil {
+		return gossh.FingerprintSHA256(pk)
+	}
+	return "user:" + s.User()
+}
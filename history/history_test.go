@@ -0,0 +1,73 @@
+package history
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestMiddleware(t *testing.T) {
+	store := NewMemoryStore(2)
+	var cmds []string
+	addr := testsession.Listen(t, &ssh.Server{
+		Handler: Middleware(store, func(s ssh.Session) bool {
+			return s.User() != "private"
+		})(func(s ssh.Session) {
+			var err error
+			cmds, err = Commands(store, s)
+			requireNoError(t, err)
+		}),
+	})
+
+	run := func(cmd string) string {
+		t.Helper()
+		sess, err := testsession.NewClientSession(t, addr, nil)
+		requireNoError(t, err)
+		out, err := sess.CombinedOutput(cmd)
+		requireNoError(t, err)
+		return string(out)
+	}
+
+	run("foo")
+	run("bar 1")
+	run("baz")
+	if strings.Join(cmds, ",") != "bar 1,baz" {
+		t.Errorf("unexpected commands: %v", cmds)
+	}
+
+	out := run(Command)
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 2 || !strings.HasSuffix(lines[0], "  bar 1") || !strings.HasSuffix(lines[1], "  baz") {
+		t.Errorf("unexpected history: %q", out)
+	}
+
+	run(Command + " clear")
+	if out := run(Command); out != "" {
+		t.Errorf("expected empty history, got %q", out)
+	}
+}
+
+func TestMiddlewareConsent(t *testing.T) {
+	store := NewMemoryStore(10)
+	sess := testsession.New(t, &ssh.Server{
+		Handler: Middleware(store, func(ssh.Session) bool {
+			return false
+		})(func(ssh.Session) {}),
+	}, nil)
+	requireNoError(t, sess.Run("foo"))
+	entries, err := store.History("user:testuser")
+	requireNoError(t, err)
+	if len(entries) != 0 {
+		t.Errorf("expected no entries, got %v", entries)
+	}
+}
+
+func requireNoError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err.Error())
+	}
+}
@@ -0,0 +1,100 @@
+package wish
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// SessionEnd describes how a session ended.
+type SessionEnd struct {
+	// Start is when the session started.
+	Start time.Time
+
+	// Duration is how long the session lasted.
+	Duration time.Duration
+
+	// ExitStatus is the exit status sent to the client, 0 if the handler
+	// returned without calling Exit.
+	ExitStatus int
+
+	// Err is non-nil if the handler panicked, or the client disconnected
+	// before it returned.
+	Err error
+}
+
+// errNoHandler is returned by WithSessionHooks when there's no handler to
+// run the hooks around yet.
+var errNoHandler = errors.New("session hooks must be set after the handler, e.g. after WithMiddleware")
+
+type sessionHooks struct {
+	onStart func(ssh.Session)
+	onEnd   func(ssh.Session, SessionEnd)
+}
+
+// WithSessionHooks returns an ssh.Option calling onStart before each session
+// goes through the server's handler, and onEnd once it went through, e.g. for
+// audit logs or metrics. Either can be nil.
+//
+// It wraps the handler set so far, so it must come after WithMiddleware to run
+// around the whole middleware chain. It fails if no handler is set yet.
+func WithSessionHooks(onStart func(ssh.Session), onEnd func(ssh.Session, SessionEnd)) ssh.Option {
+	return func(s *ssh.Server) error {
+		if s.Handler == nil {
+			return errNoHandler
+		}
+		h := &sessionHooks{onStart: onStart, onEnd: onEnd}
+		s.Handler = h.wrap(s.Handler)
+		return nil
+	}
+}
+
+func (h *sessionHooks) wrap(sh ssh.Handler) ssh.Handler {
+	return func(s ssh.Session) {
+		hs := &hookedSession{Session: s}
+		end := SessionEnd{Start: time.Now()}
+		if h.onStart != nil {
+			h.onStart(s)
+		}
+		defer func() {
+			r := recover()
+			end.Duration = time.Since(end.Start)
+			end.ExitStatus = hs.status()
+			if r != nil {
+				end.Err = fmt.Errorf("panic: %v", r)
+			} else {
+				end.Err = s.Context().Err()
+			}
+			if h.onEnd != nil {
+				h.onEnd(s, end)
+			}
+			if r != nil {
+				panic(r)
+			}
+		}()
+		sh(hs)
+	}
+}
+
+// hookedSession records the exit status of a session.
+type hookedSession struct {
+	ssh.Session
+	mu       sync.Mutex
+	exitCode int
+}
+
+func (s *hookedSession) Exit(code int) error {
+	s.mu.Lock()
+	s.exitCode = code
+	s.mu.Unlock()
+	return s.Session.Exit(code)
+}
+
+func (s *hookedSession) status() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.exitCode
+}
@@ -0,0 +1,85 @@
+package wish
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestWithSessionHooks(t *testing.T) {
+	var mu sync.Mutex
+	var events []string
+	var ends []SessionEnd
+	record := func(event string) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}
+	onStart := func(s ssh.Session) { record("start " + s.RawCommand()) }
+	onEnd := func(s ssh.Session, end SessionEnd) {
+		record("end " + s.RawCommand())
+		mu.Lock()
+		defer mu.Unlock()
+		ends = append(ends, end)
+	}
+	mw := func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			record("middleware")
+			switch s.RawCommand() {
+			case "fail":
+				Fatalln(s, "failed")
+			default:
+				sh(s)
+			}
+		}
+	}
+
+	srv := &ssh.Server{}
+	if err := WithSessionHooks(onStart, onEnd)(srv); !errors.Is(err, errNoHandler) {
+		t.Fatalf("expected errNoHandler, got %v", err)
+	}
+	requireNoError(t, WithMiddleware(mw)(srv))
+	requireNoError(t, WithSessionHooks(onStart, onEnd)(srv))
+	addr := testsession.Listen(t, srv)
+	for _, cmd := range []string{"ok", "fail"} {
+		sess, err := testsession.NewClientSession(t, addr, nil)
+		requireNoError(t, err)
+		_ = sess.Run(cmd)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	requireEqual(t, "start ok, middleware, end ok, start fail, middleware, end fail", strings.Join(events, ", "))
+	requireEqual(t, 2, len(ends))
+	requireEqual(t, 0, ends[0].ExitStatus)
+	requireEqual(t, 1, ends[1].ExitStatus)
+	if ends[0].Err != nil || ends[0].Duration <= 0 || ends[0].Start.IsZero() {
+		t.Errorf("unexpected end %+v", ends[0])
+	}
+}
+
+func TestWithSessionHooksMultiplexed(t *testing.T) {
+	var mu sync.Mutex
+	starts := 0
+	srv := &ssh.Server{}
+	requireNoError(t, WithMiddleware()(srv))
+	requireNoError(t, WithSessionHooks(func(ssh.Session) {
+		mu.Lock()
+		defer mu.Unlock()
+		starts++
+	}, nil)(srv))
+	client := dial(t, testsession.Listen(t, srv))
+	for i := 0; i < 3; i++ {
+		sess, err := client.NewSession()
+		requireNoError(t, err)
+		requireNoError(t, sess.Run(""))
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	requireEqual(t, 3, starts)
+}
@@ -0,0 +1,56 @@
+// Package hostkeys lets users fetch the host keys of a server in the
+// known_hosts format, like ssh-keyscan does, to ease their distribution, and
+// rotates them without locking clients out.
+package hostkeys
+
+import (
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/client"
+)
+
+// User is the user name clients connect with to get the host keys.
+const User = "keys"
+
+// KnownHosts returns a known_hosts line for each host key of the server,
+// for the given address users connect to.
+func KnownHosts(srv *ssh.Server, addr string) []string {
+	lines := make([]string, 0, len(srv.HostSigners))
+	for _, signer := range srv.HostSigners {
+		lines = append(lines, client.KnownHostsLine(addr, signer.PublicKey()))
+	}
+	return lines
+}
+
+// Middleware prints the known_hosts lines of the server, instead of calling
+// the next handler, to clients connecting as User:
+//
+//	ssh -p 2222 keys@example.com >> ~/.ssh/known_hosts
+//
+// The lines are for the given address, which should be the public one users
+// connect to. If empty, the address the client connected to is used.
+//
+// The server still needs to let User authenticate, e.g. with a
+// KeyboardInteractiveHandler.
+func Middleware(addr string) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if s.User() != User {
+				sh(s)
+				return
+			}
+			srv, ok := s.Context().Value(ssh.ContextKeyServer).(*ssh.Server)
+			if !ok {
+				wish.Exit(s, 1, "could not get host keys")
+				return
+			}
+			a := addr
+			if a == "" {
+				a = s.LocalAddr().String()
+			}
+			wish.Println(s, strings.Join(KnownHosts(srv, a), "\n"))
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package hostkeys
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/keygen"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+func TestMiddleware(t *testing.T) {
+	var signers []gossh.Signer
+	for _, kt := range []keygen.KeyType{keygen.Ed25519, keygen.ECDSA} {
+		k, err := keygen.New("", keygen.WithKeyType(kt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		signers = append(signers, k.Signer())
+	}
+
+	newServer := func(addr string) *ssh.Server {
+		srv := &ssh.Server{
+			Handler: Middleware(addr)(func(s ssh.Session) {
+				wish.Print(s, "app")
+			}),
+			PasswordHandler: func(ssh.Context, string) bool { return true },
+		}
+		for _, signer := range signers {
+			srv.AddHostKey(signer)
+		}
+		return srv
+	}
+	run := func(t *testing.T, addr, user string) string {
+		t.Helper()
+		sess, err := testsession.NewClientSession(t, addr, &gossh.ClientConfig{
+			User: user,
+			Auth: []gossh.AuthMethod{gossh.Password("")},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		out, err := sess.Output("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(out)
+	}
+
+	t.Run("other users", func(t *testing.T) {
+		addr := testsession.Listen(t, newServer(""))
+		if out := run(t, addr, "foo"); out != "app" {
+			t.Errorf("expected %q, got %q", "app", out)
+		}
+	})
+
+	t.Run("public address", func(t *testing.T) {
+		addr := testsession.Listen(t, newServer("example.com:2222"))
+		out := run(t, addr, User)
+		lines := strings.Split(strings.TrimSpace(out), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("expected 2 lines, got %q", out)
+		}
+		for _, line := range lines {
+			if !strings.HasPrefix(line, "[example.com]:2222 ") {
+				t.Errorf("unexpected line %q", line)
+			}
+		}
+	})
+
+	t.Run("known hosts", func(t *testing.T) {
+		addr := testsession.Listen(t, newServer(""))
+		path := filepath.Join(t.TempDir(), "known_hosts")
+		if err := os.WriteFile(path, []byte(run(t, addr, User)), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cb, err := knownhosts.New(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tcpAddr, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, signer := range signers {
+			if err := cb(addr, tcpAddr, signer.PublicKey()); err != nil {
+				t.Errorf("expected host key to be known: %v", err)
+			}
+		}
+	})
+}
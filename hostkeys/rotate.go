@@ -0,0 +1,243 @@
+package hostkeys
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// OpenSSH host key rotation requests, see the PROTOCOL file of OpenSSH.
+const (
+	announceRequest = "hostkeys-00@openssh.com"
+	proveRequest    = "hostkeys-prove-00@openssh.com"
+)
+
+// ErrNotInstalled is returned when rotating the keys of a Rotator whose
+// Option wasn't applied to a server.
+var ErrNotInstalled = errors.New("rotator option not applied to a server")
+
+// Rotator rotates the host keys of a server without locking clients out.
+//
+// A new key is first announced to clients for a grace window, while the key
+// it replaces, the one of the same type, is still presented. OpenSSH clients
+// with UpdateHostKeys enabled, the default, add the announced keys to their
+// known_hosts. Once the window is over, the new key is presented instead.
+//
+// The server must use both Option and Middleware, the keys being announced
+// once per connection, when its first session starts.
+type Rotator struct {
+	mu      sync.Mutex
+	srv     *ssh.Server
+	pending []pendingKey
+}
+
+type pendingKey struct {
+	signer gossh.Signer
+	at     time.Time
+}
+
+// NewRotator returns a Rotator. Its Option must be applied to the server.
+func NewRotator() *Rotator {
+	return &Rotator{}
+}
+
+// Option returns an ssh.Option presenting the rotated keys once their grace
+// window is over, and proving the ownership of the announced keys to clients.
+func (r *Rotator) Option() ssh.Option {
+	return func(s *ssh.Server) error {
+		r.mu.Lock()
+		r.srv = s
+		r.mu.Unlock()
+
+		next := s.ConnCallback
+		s.ConnCallback = func(ctx ssh.Context, conn net.Conn) net.Conn {
+			// the host keys are picked during the handshake, which
+			// happens right after.
+			r.promote(time.Now())
+			if next != nil {
+				return next(ctx, conn)
+			}
+			return conn
+		}
+
+		if s.RequestHandlers == nil {
+			s.RequestHandlers = map[string]ssh.RequestHandler{}
+			for k, v := range ssh.DefaultRequestHandlers {
+				s.RequestHandlers[k] = v
+			}
+		}
+		s.RequestHandlers[proveRequest] = func(ctx ssh.Context, _ *ssh.Server, req *gossh.Request) (bool, []byte) {
+			payload, err := r.prove(ctx, req.Payload)
+			if err != nil {
+				log.Debug("could not prove host keys", "error", err)
+				return false, nil
+			}
+			return true, payload
+		}
+		return nil
+	}
+}
+
+type announcedKey struct{}
+
+// Middleware announces the host keys of the server, including the ones being
+// rotated in, to clients.
+func (r *Rotator) Middleware() wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			ctx := s.Context()
+			ctx.Lock()
+			announced, _ := ctx.Value(announcedKey{}).(bool)
+			ctx.SetValue(announcedKey{}, true)
+			ctx.Unlock()
+			if conn, ok := ctx.Value(ssh.ContextKeyConn).(gossh.Conn); ok && !announced {
+				var payload []byte
+				for _, key := range r.Keys() {
+					payload = appendString(payload, key.Marshal())
+				}
+				if _, _, err := conn.SendRequest(announceRequest, false, payload); err != nil {
+					log.Debug("could not announce host keys", "error", err)
+				}
+			}
+			sh(s)
+		}
+	}
+}
+
+// Rotate announces the given key, and presents it instead of the key of the
+// same type once the grace window is over. A grace window of zero or less
+// presents it right away.
+func (r *Rotator) Rotate(signer gossh.Signer, grace time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.srv == nil {
+		return ErrNotInstalled
+	}
+	if grace <= 0 {
+		r.srv.AddHostKey(signer)
+		return nil
+	}
+	// a key of the same type replaces one still pending.
+	pending := r.pending[:0]
+	for _, p := range r.pending {
+		if p.signer.PublicKey().Type() != signer.PublicKey().Type() {
+			pending = append(pending, p)
+		}
+	}
+	r.pending = append(pending, pendingKey{signer, time.Now().Add(grace)})
+	return nil
+}
+
+// Keys returns the keys announced to clients: the ones presented, followed by
+// the ones being rotated in.
+func (r *Rotator) Keys() []gossh.PublicKey {
+	var keys []gossh.PublicKey
+	for _, signer := range r.signers() {
+		keys = append(keys, signer.PublicKey())
+	}
+	return keys
+}
+
+func (r *Rotator) signers() []gossh.Signer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var signers []gossh.Signer
+	if r.srv != nil {
+		for _, signer := range r.srv.HostSigners {
+			signers = append(signers, signer)
+		}
+	}
+	for _, p := range r.pending {
+		signers = append(signers, p.signer)
+	}
+	return signers
+}
+
+func (r *Rotator) promote(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pending := r.pending[:0]
+	for _, p := range r.pending {
+		if now.Before(p.at) {
+			pending = append(pending, p)
+			continue
+		}
+		log.Debug("presenting rotated host key", "type", p.signer.PublicKey().Type(), "fingerprint", gossh.FingerprintSHA256(p.signer.PublicKey()))
+		r.srv.AddHostKey(p.signer)
+	}
+	r.pending = pending
+}
+
+// prove signs the session ID with each of the requested keys.
+func (r *Rotator) prove(ctx ssh.Context, payload []byte) ([]byte, error) {
+	sessionID, err := hex.DecodeString(ctx.SessionID())
+	if err != nil {
+		return nil, err
+	}
+	signers := r.signers()
+	var reply []byte
+	for len(payload) > 0 {
+		var blob []byte
+		blob, payload, err = readString(payload)
+		if err != nil {
+			return nil, err
+		}
+		signer := find(signers, blob)
+		if signer == nil {
+			return nil, errors.New("unknown host key")
+		}
+		var data []byte
+		data = appendString(data, []byte(proveRequest))
+		data = appendString(data, sessionID)
+		data = appendString(data, blob)
+		sig, err := sign(signer, data)
+		if err != nil {
+			return nil, err
+		}
+		reply = appendString(reply, gossh.Marshal(sig))
+	}
+	return reply, nil
+}
+
+func find(signers []gossh.Signer, blob []byte) gossh.Signer {
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), blob) {
+			return signer
+		}
+	}
+	return nil
+}
+
+// sign signs the data, using SHA-512 for RSA keys like OpenSSH does.
+func sign(signer gossh.Signer, data []byte) (*gossh.Signature, error) {
+	if as, ok := signer.(gossh.AlgorithmSigner); ok && signer.PublicKey().Type() == gossh.KeyAlgoRSA {
+		return as.SignWithAlgorithm(rand.Reader, data, gossh.KeyAlgoRSASHA512)
+	}
+	return signer.Sign(rand.Reader, data)
+}
+
+func appendString(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(s)))
+	return append(b, s...)
+}
+
+func readString(b []byte) (s, rest []byte, err error) {
+	if len(b) < 4 {
+		return nil, nil, errors.New("short string")
+	}
+	n := binary.BigEndian.Uint32(b)
+	if uint32(len(b)-4) < n {
+		return nil, nil, errors.New("short string")
+	}
+	return b[4 : 4+n], b[4+n:], nil
+}
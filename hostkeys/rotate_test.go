@@ -0,0 +1,137 @@
+package hostkeys
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/keygen"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestRotator(t *testing.T) {
+	newSigner := func(kt keygen.KeyType) gossh.Signer {
+		k, err := keygen.New("", keygen.WithKeyType(kt))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k.Signer()
+	}
+	old, rotated, rsa := newSigner(keygen.Ed25519), newSigner(keygen.Ed25519), newSigner(keygen.RSA)
+
+	r := NewRotator()
+	if err := r.Rotate(rotated, time.Hour); err != ErrNotInstalled {
+		t.Errorf("expected ErrNotInstalled, got %v", err)
+	}
+	srv := &ssh.Server{
+		Handler: r.Middleware()(func(s ssh.Session) {
+			wish.Print(s, "app")
+		}),
+	}
+	srv.AddHostKey(old)
+	if err := r.Option()(srv); err != nil {
+		t.Fatal(err)
+	}
+	addr := testsession.Listen(t, srv)
+
+	if err := r.Rotate(rsa, 0); err != nil {
+		t.Fatal(err)
+	}
+	const grace = 500 * time.Millisecond
+	if err := r.Rotate(rotated, grace); err != nil {
+		t.Fatal(err)
+	}
+	rotatedAt := time.Now()
+
+	connect := func(hostKey gossh.PublicKey) (gossh.Conn, <-chan *gossh.Request, *gossh.Client) {
+		t.Helper()
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c, chans, reqs, err := gossh.NewClientConn(conn, addr, &gossh.ClientConfig{
+			HostKeyCallback:   gossh.FixedHostKey(hostKey),
+			HostKeyAlgorithms: []string{hostKey.Type()},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		client := gossh.NewClient(c, chans, nil)
+		t.Cleanup(func() { _ = client.Close() })
+		return c, reqs, client
+	}
+
+	// the previous key is still presented during the grace window, and the
+	// rotated one is announced.
+	c, reqs, client := connect(old.PublicKey())
+	for i := 0; i < 2; i++ {
+		sess, err := client.NewSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out, err := sess.Output(""); err != nil || string(out) != "app" {
+			t.Fatalf("expected %q, got %q, %v", "app", out, err)
+		}
+	}
+	select {
+	case req := <-reqs:
+		if req.Type != announceRequest {
+			t.Fatalf("expected %s, got %s", announceRequest, req.Type)
+		}
+		var expected []byte
+		for _, signer := range []gossh.Signer{old, rsa, rotated} {
+			expected = appendString(expected, signer.PublicKey().Marshal())
+		}
+		if !bytes.Equal(req.Payload, expected) {
+			t.Errorf("expected the presented and rotated keys to be announced")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the host keys to be announced")
+	}
+	select {
+	case req := <-reqs:
+		t.Errorf("expected the host keys to be announced once, got %s", req.Type)
+	default:
+	}
+
+	// the client asks the server to prove it owns the announced keys.
+	for _, signer := range []gossh.Signer{rotated, rsa} {
+		ok, reply, err := c.SendRequest(proveRequest, true, appendString(nil, signer.PublicKey().Marshal()))
+		if err != nil || !ok {
+			t.Fatalf("expected the proof to succeed, got %v", err)
+		}
+		blob, _, err := readString(reply)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sig gossh.Signature
+		if err := gossh.Unmarshal(blob, &sig); err != nil {
+			t.Fatal(err)
+		}
+		var data []byte
+		data = appendString(data, []byte(proveRequest))
+		data = appendString(data, c.SessionID())
+		data = appendString(data, signer.PublicKey().Marshal())
+		if err := signer.PublicKey().Verify(data, &sig); err != nil {
+			t.Errorf("expected a valid proof for %s: %v", signer.PublicKey().Type(), err)
+		}
+	}
+	unknown := newSigner(keygen.Ed25519)
+	if ok, _, _ := c.SendRequest(proveRequest, true, appendString(nil, unknown.PublicKey().Marshal())); ok {
+		t.Error("expected the proof of an unknown key to fail")
+	}
+
+	// keys without a grace window are presented right away.
+	connect(rsa.PublicKey())
+
+	time.Sleep(time.Until(rotatedAt.Add(grace)))
+	connect(rotated.PublicKey())
+	keys := r.Keys()
+	if len(keys) != 2 || !bytes.Equal(keys[0].Marshal(), rotated.PublicKey().Marshal()) {
+		t.Errorf("expected the rotated key to replace the previous one, got %d keys", len(keys))
+	}
+}
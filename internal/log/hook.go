@@ -0,0 +1,24 @@
+package log
+
+import "sync/atomic"
+
+// Hook receives the warnings and errors logged.
+type Hook func(level string, msg interface{}, keyvals ...interface{})
+
+var hook atomic.Pointer[Hook]
+
+// SetHook sets the hook receiving the warnings and errors logged, replacing
+// the previous one. A nil hook removes it.
+func SetHook(h Hook) {
+	if h == nil {
+		hook.Store(nil)
+		return
+	}
+	hook.Store(&h)
+}
+
+func notify(level string, msg interface{}, keyvals []interface{}) {
+	if h := hook.Load(); h != nil {
+		(*h)(level, msg, keyvals...)
+	}
+}
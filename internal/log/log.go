@@ -0,0 +1,39 @@
+//go:build !nocharmlog
+// +build !nocharmlog
+
+// Package log is the logger used by wish and its middlewares.
+//
+// It forwards to the default github.com/charmbracelet/log logger, unless
+// built with the nocharmlog tag, in which case it logs through the standard
+// library log package instead, so core-only builds don't link charmbracelet/log
+// and lipgloss.
+package log
+
+import (
+	stdlog "log"
+
+	"github.com/charmbracelet/log"
+)
+
+// Debug logs a debug message with the given key value pairs.
+func Debug(msg interface{}, keyvals ...interface{}) {
+	log.Debug(msg, keyvals...)
+}
+
+// Warn logs a warning message with the given key value pairs.
+func Warn(msg interface{}, keyvals ...interface{}) {
+	notify("warn", msg, keyvals)
+	log.Warn(msg, keyvals...)
+}
+
+// Error logs an error message with the given key value pairs.
+func Error(msg interface{}, keyvals ...interface{}) {
+	notify("error", msg, keyvals)
+	log.Error(msg, keyvals...)
+}
+
+// StandardLog returns a standard library logger writing to the default
+// logger.
+func StandardLog() *stdlog.Logger {
+	return log.StandardLog()
+}
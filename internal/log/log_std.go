@@ -0,0 +1,50 @@
+//go:build nocharmlog
+// +build nocharmlog
+
+// Package log is the logger used by wish and its middlewares.
+//
+// It forwards to the default github.com/charmbracelet/log logger, unless
+// built with the nocharmlog tag, in which case it logs through the standard
+// library log package instead, so core-only builds don't link charmbracelet/log
+// and lipgloss.
+package log
+
+import (
+	"fmt"
+	stdlog "log"
+	"strings"
+)
+
+// Debug discards the message, matching the default level of
+// charmbracelet/log.
+func Debug(interface{}, ...interface{}) {}
+
+// Warn logs a warning message with the given key value pairs.
+func Warn(msg interface{}, keyvals ...interface{}) {
+	notify("warn", msg, keyvals)
+	output("WARN", msg, keyvals)
+}
+
+// Error logs an error message with the given key value pairs.
+func Error(msg interface{}, keyvals ...interface{}) {
+	notify("error", msg, keyvals)
+	output("ERROR", msg, keyvals)
+}
+
+// StandardLog returns the standard library default logger.
+func StandardLog() *stdlog.Logger {
+	return stdlog.Default()
+}
+
+func output(level string, msg interface{}, keyvals []interface{}) {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %v", level, msg)
+	for i := 0; i < len(keyvals); i += 2 {
+		var val interface{} = "MISSING"
+		if i+1 < len(keyvals) {
+			val = keyvals[i+1]
+		}
+		fmt.Fprintf(&sb, " %v=%v", keyvals[i], val)
+	}
+	_ = stdlog.Output(3, sb.String())
+}
@@ -0,0 +1,60 @@
+// Package netaddr groups client addresses for per-source limits.
+package netaddr
+
+import (
+	"net"
+	"net/netip"
+)
+
+// DefaultIPv6PrefixLen is the prefix IPv6 addresses are grouped by. A single
+// IPv6 host is usually assigned a whole /64, so limiting per address would be
+// trivial to get around.
+const DefaultIPv6PrefixLen = 64
+
+// IP returns the IP of addr, with IPv4-mapped IPv6 addresses unmapped.
+func IP(addr net.Addr) (netip.Addr, bool) {
+	if a, ok := addr.(*net.TCPAddr); ok {
+		ip, ok := netip.AddrFromSlice(a.IP)
+		return ip.Unmap(), ok
+	}
+	host := addr.String()
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return ip.Unmap(), true
+}
+
+// Key returns the key identifying the source of addr: its IP for IPv4, and
+// its prefix of the given length for IPv6. Addresses that aren't IPs are
+// returned as they are.
+func Key(addr net.Addr, v6PrefixLen int) string {
+	ip, ok := IP(addr)
+	if !ok {
+		return addr.String()
+	}
+	return key(ip, v6PrefixLen)
+}
+
+// HostKey is like Key, for a host with no port.
+func HostKey(host string, v6PrefixLen int) string {
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	return key(ip.Unmap(), v6PrefixLen)
+}
+
+func key(ip netip.Addr, v6PrefixLen int) string {
+	if !ip.Is6() || v6PrefixLen <= 0 || v6PrefixLen >= 128 {
+		return ip.WithZone("").String()
+	}
+	prefix, err := ip.WithZone("").Prefix(v6PrefixLen)
+	if err != nil {
+		return ip.String()
+	}
+	return prefix.String()
+}
@@ -0,0 +1,27 @@
+package netaddr
+
+import (
+	"net"
+	"testing"
+)
+
+func TestKey(t *testing.T) {
+	for addr, expected := range map[net.Addr]string{
+		&net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 22}:            "192.0.2.1",
+		&net.TCPAddr{IP: net.ParseIP("::ffff:192.0.2.1"), Port: 22}:     "192.0.2.1",
+		&net.TCPAddr{IP: net.ParseIP("2001:db8:1:2:3:4:5:6"), Port: 22}: "2001:db8:1:2::/64",
+		&net.TCPAddr{IP: net.ParseIP("2001:db8:1:2:ff::1"), Port: 22}:   "2001:db8:1:2::/64",
+		&net.UnixAddr{Name: "/tmp/wish.sock", Net: "unix"}:              "/tmp/wish.sock",
+		&net.UDPAddr{IP: net.ParseIP("2001:db8:1:3::1"), Port: 22}:      "2001:db8:1:3::/64",
+	} {
+		if got := Key(addr, DefaultIPv6PrefixLen); got != expected {
+			t.Errorf("%s: expected %q, got %q", addr, expected, got)
+		}
+	}
+	if got := Key(&net.TCPAddr{IP: net.ParseIP("2001:db8::1")}, 128); got != "2001:db8::1" {
+		t.Errorf("expected no grouping, got %q", got)
+	}
+	if got := HostKey("2001:db8::1", 48); got != "2001:db8::/48" {
+		t.Errorf("expected a /48, got %q", got)
+	}
+}
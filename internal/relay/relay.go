@@ -0,0 +1,112 @@
+// Package relay sends messages to programs in order, without blocking the
+// senders on programs that are busy.
+package relay
+
+import (
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// MaxQueue is the most messages a relay queues. Senders that fall further
+// behind are cut off: their relay is closed, dropping the messages.
+const MaxQueue = 1024
+
+// Sender is what a relay sends messages to, e.g. a *tea.Program.
+type Sender interface {
+	Send(tea.Msg)
+}
+
+// Relay queues messages, and sends them to its Sender in its own goroutine,
+// until closed.
+type Relay struct {
+	s    Sender
+	wake chan struct{}
+	done chan struct{}
+	once sync.Once
+
+	mu     sync.Mutex
+	queue  []tea.Msg
+	finish bool
+}
+
+// New returns a relay sending messages to s.
+func New(s Sender) *Relay {
+	r := &Relay{s: s, wake: make(chan struct{}, 1), done: make(chan struct{})}
+	go r.run()
+	return r
+}
+
+// Push queues the message. It closes the relay if MaxQueue messages are
+// already queued, and does nothing once it's closed.
+func (r *Relay) Push(msg tea.Msg) {
+	select {
+	case <-r.done:
+		return
+	default:
+	}
+	r.mu.Lock()
+	if len(r.queue) >= MaxQueue {
+		r.mu.Unlock()
+		r.Close()
+		return
+	}
+	r.queue = append(r.queue, msg)
+	r.mu.Unlock()
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the relay, dropping the messages not sent yet.
+func (r *Relay) Close() {
+	r.once.Do(func() {
+		close(r.done)
+		r.mu.Lock()
+		r.queue = nil
+		r.mu.Unlock()
+	})
+}
+
+// Finish closes the relay once the messages queued so far are sent.
+func (r *Relay) Finish() {
+	r.mu.Lock()
+	r.finish = true
+	r.mu.Unlock()
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Done returns a channel closed once the relay is closed.
+func (r *Relay) Done() <-chan struct{} {
+	return r.done
+}
+
+func (r *Relay) run() {
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-r.wake:
+		}
+		r.mu.Lock()
+		queue, finish := r.queue, r.finish
+		r.queue = nil
+		r.mu.Unlock()
+		for _, msg := range queue {
+			select {
+			case <-r.done:
+				return
+			default:
+			}
+			r.s.Send(msg)
+		}
+		if finish {
+			r.Close()
+			return
+		}
+	}
+}
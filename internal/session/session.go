@@ -0,0 +1,440 @@
+// Package session implements ssh.Session for front-ends that aren't SSH, e.g.
+// telnet, so they can feed the same handler chain as the SSH server.
+//
+// Sessions always have an emulated PTY, like SSH sessions on servers that
+// don't allocate real ones.
+package session
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Config describes a session.
+type Config struct {
+	// Server is the server whose handler serves the session. It's set in
+	// the context, as for SSH sessions.
+	Server *ssh.Server
+
+	// User is the name of the user.
+	User string
+
+	// ClientVersion identifies the front-end, e.g. "telnet".
+	ClientVersion string
+
+	// Term and Window describe the terminal of the client.
+	Term   string
+	Window ssh.Window
+
+	// Environ is the environment of the session.
+	Environ []string
+
+	// LocalAddr and RemoteAddr are the addresses of the connection.
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+
+	// Close closes the connection of the session.
+	Close func() error
+}
+
+// Session is a session fed by a front-end. What the client types is given to
+// it with Input, and what the handler writes is written to the output it was
+// created with.
+type Session struct {
+	cfg    Config
+	ctx    *sshContext
+	cancel context.CancelFunc
+	out    io.Writer
+	in     *input
+	winch  chan ssh.Window
+
+	mu      sync.Mutex
+	win     ssh.Window
+	sigs    chan<- ssh.Signal
+	sigBuf  []ssh.Signal
+	breaks  chan<- bool
+	closed  bool
+	status  int
+	closeFn sync.Once
+}
+
+var _ ssh.Session = (*Session)(nil)
+
+// maxSigBuf is how many signals are buffered while no channel is registered
+// with Signals, as in SSH sessions.
+const maxSigBuf = 128
+
+// New returns a session with the given output, whose context is derived from
+// ctx.
+func New(ctx context.Context, out io.Writer, cfg Config) *Session {
+	sctx, cancel := newContext(ctx, cfg)
+	s := &Session{
+		cfg:    cfg,
+		ctx:    sctx,
+		cancel: cancel,
+		out:    ssh.NewPtyWriter(out),
+		in:     newInput(),
+		winch:  make(chan ssh.Window, 1),
+		win:    cfg.Window,
+	}
+	s.winch <- cfg.Window
+	return s
+}
+
+// Run runs the server's handler, and closes the session once it returns. It
+// returns the exit status of the session.
+//
+// The server's SessionRequestCallback is called first, as for SSH shells, and
+// the session exits 1 if it's rejected.
+func (s *Session) Run() int {
+	h := s.cfg.Server.Handler
+	if h == nil {
+		h = ssh.DefaultHandler
+	}
+	if cb := s.cfg.Server.SessionRequestCallback; cb != nil && !cb(s, "shell") {
+		_ = s.Exit(1)
+	} else {
+		h(s)
+	}
+	_ = s.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
+
+// Input gives the session what the client typed. It returns false if the
+// session is closed, e.g. because its handler returned, and didn't take it.
+func (s *Session) Input(p []byte) bool {
+	return s.in.write(p)
+}
+
+// Unread returns what the client typed that the handler didn't read before
+// the session was closed, e.g. so front-ends running sessions one after
+// another can give it to the next one.
+func (s *Session) Unread() []byte {
+	return s.in.unread()
+}
+
+// CloseInput tells the session the client won't type anything else, e.g.
+// because it disconnected, with io.EOF or the error that occurred.
+func (s *Session) CloseInput(err error) {
+	s.in.close(err)
+}
+
+// Resize tells the session the window of the client changed.
+func (s *Session) Resize(win ssh.Window) {
+	s.mu.Lock()
+	s.win = win
+	s.mu.Unlock()
+	// only the latest size matters.
+	for {
+		select {
+		case s.winch <- win:
+			return
+		default:
+		}
+		select {
+		case <-s.winch:
+		default:
+		}
+	}
+}
+
+// Signal sends a signal from the client, e.g. when it interrupts the process.
+func (s *Session) Signal(sig ssh.Signal) {
+	s.mu.Lock()
+	c := s.sigs
+	if c == nil && len(s.sigBuf) < maxSigBuf {
+		s.sigBuf = append(s.sigBuf, sig)
+	}
+	s.mu.Unlock()
+	if c != nil {
+		select {
+		case c <- sig:
+		case <-s.ctx.Done():
+		}
+	}
+}
+
+// SendBreak sends a break from the client. It's dropped if no channel is
+// registered with Break.
+func (s *Session) SendBreak() {
+	s.mu.Lock()
+	c := s.breaks
+	s.mu.Unlock()
+	if c != nil {
+		select {
+		case c <- true:
+		case <-s.ctx.Done():
+		}
+	}
+}
+
+// Read implements gossh.Channel.
+func (s *Session) Read(p []byte) (int, error) {
+	return s.in.Read(p)
+}
+
+// Write implements gossh.Channel.
+func (s *Session) Write(p []byte) (int, error) {
+	return s.out.Write(p)
+}
+
+// Close implements gossh.Channel. It closes the connection, and cancels the
+// context.
+func (s *Session) Close() error {
+	var err error
+	s.closeFn.Do(func() {
+		s.mu.Lock()
+		s.closed = true
+		s.mu.Unlock()
+		if s.cfg.Close != nil {
+			err = s.cfg.Close()
+		}
+		s.in.close(io.EOF)
+		s.cancel()
+	})
+	return err
+}
+
+// CloseWrite implements gossh.Channel.
+func (s *Session) CloseWrite() error {
+	return nil
+}
+
+// SendRequest implements gossh.Channel. Front-ends don't have requests.
+func (s *Session) SendRequest(string, bool, []byte) (bool, error) {
+	return false, nil
+}
+
+// Stderr implements gossh.Channel. It's the same as the output, as terminals
+// don't tell them apart.
+func (s *Session) Stderr() io.ReadWriter {
+	return s
+}
+
+// User implements ssh.Session.
+func (s *Session) User() string { return s.cfg.User }
+
+// RemoteAddr implements ssh.Session.
+func (s *Session) RemoteAddr() net.Addr { return s.cfg.RemoteAddr }
+
+// LocalAddr implements ssh.Session.
+func (s *Session) LocalAddr() net.Addr { return s.cfg.LocalAddr }
+
+// Environ implements ssh.Session.
+func (s *Session) Environ() []string {
+	return append([]string(nil), s.cfg.Environ...)
+}
+
+// Exit implements ssh.Session.
+func (s *Session) Exit(code int) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return errors.New("session closed")
+	}
+	s.status = code
+	s.mu.Unlock()
+	return s.Close()
+}
+
+// Command implements ssh.Session. Front-ends don't have commands.
+func (s *Session) Command() []string { return nil }
+
+// RawCommand implements ssh.Session.
+func (s *Session) RawCommand() string { return "" }
+
+// Subsystem implements ssh.Session.
+func (s *Session) Subsystem() string { return "" }
+
+// PublicKey implements ssh.Session. Users of front-ends have no keys.
+func (s *Session) PublicKey() ssh.PublicKey { return nil }
+
+// Context implements ssh.Session.
+func (s *Session) Context() ssh.Context { return s.ctx }
+
+// Permissions implements ssh.Session.
+func (s *Session) Permissions() ssh.Permissions { return *s.ctx.Permissions() }
+
+// EmulatedPty implements ssh.Session.
+func (s *Session) EmulatedPty() bool { return true }
+
+// Pty implements ssh.Session.
+func (s *Session) Pty() (ssh.Pty, <-chan ssh.Window, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return ssh.Pty{Term: s.cfg.Term, Window: s.win}, s.winch, true
+}
+
+// Signals implements ssh.Session.
+func (s *Session) Signals(c chan<- ssh.Signal) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sigs = c
+	if c == nil || len(s.sigBuf) == 0 {
+		return
+	}
+	buf := s.sigBuf
+	s.sigBuf = nil
+	go func() {
+		for _, sig := range buf {
+			select {
+			case c <- sig:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Break implements ssh.Session.
+func (s *Session) Break(c chan<- bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.breaks = c
+}
+
+// input buffers what the client typed until the handler reads it, so the
+// front-end keeps reading its connection, e.g. to notice window changes and
+// disconnections, when the handler doesn't.
+type input struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  bytes.Buffer
+	err  error
+}
+
+func newInput() *input {
+	in := &input{}
+	in.cond = sync.NewCond(&in.mu)
+	return in
+}
+
+func (in *input) write(p []byte) bool {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.err != nil {
+		return false
+	}
+	in.buf.Write(p)
+	in.cond.Broadcast()
+	return true
+}
+
+func (in *input) unread() []byte {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	p := append([]byte(nil), in.buf.Bytes()...)
+	in.buf.Reset()
+	return p
+}
+
+func (in *input) close(err error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if in.err == nil {
+		in.err = err
+		in.cond.Broadcast()
+	}
+}
+
+func (in *input) Read(p []byte) (int, error) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for in.buf.Len() == 0 && in.err == nil {
+		in.cond.Wait()
+	}
+	if in.buf.Len() > 0 {
+		return in.buf.Read(p)
+	}
+	return 0, in.err
+}
+
+// sshContext implements ssh.Context, with the values SSH sessions have.
+type sshContext struct {
+	context.Context
+	sync.Mutex
+
+	valuesMu sync.Mutex
+	values   map[interface{}]interface{}
+}
+
+var _ ssh.Context = (*sshContext)(nil)
+
+func newContext(parent context.Context, cfg Config) (*sshContext, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	id := make([]byte, 32)
+	_, _ = rand.Read(id)
+	return &sshContext{
+		Context: ctx,
+		values: map[interface{}]interface{}{
+			ssh.ContextKeyUser:          cfg.User,
+			ssh.ContextKeySessionID:     hex.EncodeToString(id),
+			ssh.ContextKeyClientVersion: cfg.ClientVersion,
+			ssh.ContextKeyLocalAddr:     cfg.LocalAddr,
+			ssh.ContextKeyRemoteAddr:    cfg.RemoteAddr,
+			ssh.ContextKeyServer:        cfg.Server,
+			ssh.ContextKeyPermissions:   &ssh.Permissions{Permissions: &gossh.Permissions{}},
+		},
+	}, cancel
+}
+
+func (ctx *sshContext) Value(key interface{}) interface{} {
+	ctx.valuesMu.Lock()
+	defer ctx.valuesMu.Unlock()
+	if v, ok := ctx.values[key]; ok {
+		return v
+	}
+	return ctx.Context.Value(key)
+}
+
+func (ctx *sshContext) SetValue(key, value interface{}) {
+	ctx.valuesMu.Lock()
+	defer ctx.valuesMu.Unlock()
+	ctx.values[key] = value
+}
+
+func (ctx *sshContext) User() string {
+	v, _ := ctx.Value(ssh.ContextKeyUser).(string)
+	return v
+}
+
+func (ctx *sshContext) SessionID() string {
+	v, _ := ctx.Value(ssh.ContextKeySessionID).(string)
+	return v
+}
+
+func (ctx *sshContext) ClientVersion() string {
+	v, _ := ctx.Value(ssh.ContextKeyClientVersion).(string)
+	return v
+}
+
+func (ctx *sshContext) ServerVersion() string {
+	v, _ := ctx.Value(ssh.ContextKeyServerVersion).(string)
+	return v
+}
+
+func (ctx *sshContext) RemoteAddr() net.Addr {
+	v, _ := ctx.Value(ssh.ContextKeyRemoteAddr).(net.Addr)
+	return v
+}
+
+func (ctx *sshContext) LocalAddr() net.Addr {
+	v, _ := ctx.Value(ssh.ContextKeyLocalAddr).(net.Addr)
+	return v
+}
+
+func (ctx *sshContext) Permissions() *ssh.Permissions {
+	v, _ := ctx.Value(ssh.ContextKeyPermissions).(*ssh.Permissions)
+	return v
+}
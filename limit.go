@@ -0,0 +1,151 @@
+package wish
+
+import (
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/log"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// DefaultLimitMessage is shown to sessions rejected by LimitSessions when no
+// message is set with WithLimitMessage.
+const DefaultLimitMessage = "Too many sessions, please close one and try again."
+
+// ByUser is a LimitSessions key function limiting the sessions of each user
+// name.
+func ByUser(s ssh.Session) string {
+	return "user:" + s.User()
+}
+
+// ByFingerprint is a LimitSessions key function limiting the sessions of each
+// public key, falling back to the user name for users authenticated
+// otherwise.
+func ByFingerprint(s ssh.Session) string {
+	if pk := s.PublicKey(); pk != nil {
+		return gossh.FingerprintSHA256(pk)
+	}
+	return ByUser(s)
+}
+
+// LimitOption configures LimitSessions.
+type LimitOption func(*sessionLimiter)
+
+// WithLimitMessage sets the message shown to rejected sessions.
+func WithLimitMessage(msg string) LimitOption {
+	return func(l *sessionLimiter) {
+		l.msg = msg
+	}
+}
+
+// WithLimitQueue makes sessions over the limit wait up to timeout for another
+// session with the same key to end, instead of being rejected right away.
+// They're told they're waiting.
+func WithLimitQueue(timeout time.Duration) LimitOption {
+	return func(l *sessionLimiter) {
+		l.queue = timeout
+	}
+}
+
+type sessionLimiter struct {
+	max   int
+	key   func(ssh.Session) string
+	msg   string
+	queue time.Duration
+
+	mu    sync.Mutex
+	slots map[string]*slots
+}
+
+// slots are the slots of a key. refs counts the sessions holding or waiting
+// for one, so they're dropped once unused.
+type slots struct {
+	sem  chan struct{}
+	refs int
+}
+
+// LimitSessions returns a middleware limiting how many sessions with the same
+// key, e.g. ByUser or ByFingerprint, can run at the same time, across all
+// connections. Sessions over the limit are rejected with DefaultLimitMessage,
+// or the one set with WithLimitMessage, unless WithLimitQueue is used.
+//
+// Unlike WithMaxSessions, which limits the channels of a connection, it also
+// catches users opening many connections. A max of zero or less doesn't limit
+// sessions. The key function defaults to ByFingerprint.
+func LimitSessions(max int, key func(ssh.Session) string, opts ...LimitOption) Middleware {
+	if max <= 0 {
+		return func(sh ssh.Handler) ssh.Handler { return sh }
+	}
+	if key == nil {
+		key = ByFingerprint
+	}
+	l := &sessionLimiter{
+		max:   max,
+		key:   key,
+		msg:   DefaultLimitMessage,
+		slots: map[string]*slots{},
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			k := l.key(s)
+			sl := l.acquire(k)
+			defer l.release(k, sl)
+			if !l.wait(s, sl) {
+				log.Debug("too many sessions", "key", k, "remote-addr", s.RemoteAddr())
+				Exit(s, 1, l.msg)
+				return
+			}
+			defer func() { <-sl.sem }()
+			sh(s)
+		}
+	}
+}
+
+func (l *sessionLimiter) acquire(key string) *slots {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sl, ok := l.slots[key]
+	if !ok {
+		sl = &slots{sem: make(chan struct{}, l.max)}
+		l.slots[key] = sl
+	}
+	sl.refs++
+	return sl
+}
+
+func (l *sessionLimiter) release(key string, sl *slots) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	sl.refs--
+	if sl.refs == 0 {
+		delete(l.slots, key)
+	}
+}
+
+// wait takes a slot, waiting for one if queueing, and returns whether it got
+// one.
+func (l *sessionLimiter) wait(s ssh.Session, sl *slots) bool {
+	select {
+	case sl.sem <- struct{}{}:
+		return true
+	default:
+	}
+	if l.queue <= 0 {
+		return false
+	}
+	Println(s, "Waiting for one of your other sessions to end…")
+	t := time.NewTimer(l.queue)
+	defer t.Stop()
+	select {
+	case sl.sem <- struct{}{}:
+		return true
+	case <-t.C:
+		return false
+	case <-s.Context().Done():
+		return false
+	}
+}
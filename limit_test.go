@@ -0,0 +1,101 @@
+package wish
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestLimitSessions(t *testing.T) {
+	setup := func(opts ...LimitOption) (string, chan struct{}, chan string) {
+		started := make(chan string, 10)
+		release := make(chan struct{})
+		srv := &ssh.Server{
+			Handler: LimitSessions(1, ByUser, opts...)(func(s ssh.Session) {
+				started <- s.User()
+				<-release
+				Print(s, "done")
+			}),
+		}
+		return testsession.Listen(t, srv), release, started
+	}
+	start := func(addr, user string) (*gossh.Session, *strings.Builder, *strings.Builder) {
+		t.Helper()
+		sess, err := testsession.NewClientSession(t, addr, &gossh.ClientConfig{User: user})
+		requireNoError(t, err)
+		var stdout, stderr strings.Builder
+		sess.Stdout, sess.Stderr = &stdout, &stderr
+		requireNoError(t, sess.Start(""))
+		return sess, &stdout, &stderr
+	}
+	waitStarted := func(started chan string, user string) {
+		t.Helper()
+		select {
+		case got := <-started:
+			requireEqual(t, user, got)
+		case <-time.After(time.Second):
+			t.Fatalf("expected a session of %s to start", user)
+		}
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		addr, release, started := setup(WithLimitMessage("nope"))
+		first, _, _ := start(addr, "foo")
+		waitStarted(started, "foo")
+
+		second, _, stderr := start(addr, "foo")
+		if err := second.Wait(); err == nil {
+			t.Error("expected the session over the limit to fail")
+		}
+		requireEqual(t, "nope\n", stderr.String())
+
+		// other users have their own limit.
+		other, _, _ := start(addr, "bar")
+		waitStarted(started, "bar")
+
+		close(release)
+		requireNoError(t, first.Wait())
+		requireNoError(t, other.Wait())
+
+		// slots are freed once sessions end.
+		third, stdout, _ := start(addr, "foo")
+		waitStarted(started, "foo")
+		requireNoError(t, third.Wait())
+		requireEqual(t, "done", stdout.String())
+	})
+
+	t.Run("queue", func(t *testing.T) {
+		addr, release, started := setup(WithLimitQueue(5 * time.Second))
+		first, _, _ := start(addr, "foo")
+		waitStarted(started, "foo")
+		second, stdout, _ := start(addr, "foo")
+		select {
+		case <-started:
+			t.Fatal("expected the second session to wait")
+		case <-time.After(100 * time.Millisecond):
+		}
+		close(release)
+		requireNoError(t, first.Wait())
+		waitStarted(started, "foo")
+		requireNoError(t, second.Wait())
+		if !strings.HasPrefix(stdout.String(), "Waiting") || !strings.HasSuffix(stdout.String(), "done") {
+			t.Errorf("expected the session to be told it waits, got %q", stdout.String())
+		}
+	})
+
+	t.Run("queue timeout", func(t *testing.T) {
+		addr, release, started := setup(WithLimitQueue(100 * time.Millisecond))
+		defer close(release)
+		start(addr, "foo")
+		waitStarted(started, "foo")
+		second, _, stderr := start(addr, "foo")
+		if err := second.Wait(); err == nil {
+			t.Error("expected the session to give up waiting")
+		}
+		requireEqual(t, DefaultLimitMessage+"\n", stderr.String())
+	})
+}
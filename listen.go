@@ -0,0 +1,112 @@
+package wish
+
+import (
+	"errors"
+	"net"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// ListenerError is the error of a listener failing to listen or serve.
+type ListenerError struct {
+	Addr string
+	Err  error
+}
+
+// Error implements error.
+func (e *ListenerError) Error() string {
+	return "listen " + e.Addr + ": " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *ListenerError) Unwrap() error {
+	return e.Err
+}
+
+// ListenAndServe listens on the given addresses, e.g. ":22" and ":2222", and
+// serves the server on all of them, sharing its middlewares and host keys. If
+// none is given, it listens on the server's address.
+//
+// It returns when a listener fails, with a *ListenerError telling which,
+// after closing the server. If the server is closed, ssh.ErrServerClosed is
+// returned.
+func ListenAndServe(srv *ssh.Server, addrs ...string) error {
+	if len(addrs) == 0 {
+		addr := srv.Addr
+		if addr == "" {
+			addr = ":22"
+		}
+		addrs = []string{addr}
+	}
+	binds := make([]bind, 0, len(addrs))
+	for _, addr := range addrs {
+		binds = append(binds, bind{"tcp", addr})
+	}
+	return serve(srv, binds, nil)
+}
+
+// Serve is like ListenAndServe, serving the server on the given listeners
+// instead of binding its own addresses, e.g. with systemd socket activation.
+// See SystemdListeners.
+func Serve(srv *ssh.Server, listeners ...net.Listener) error {
+	return serve(srv, nil, listeners)
+}
+
+// bind is an address to listen on.
+type bind struct {
+	network, addr string
+}
+
+// serve listens on the given addresses, and serves the server on them and
+// on the given listeners.
+func serve(srv *ssh.Server, binds []bind, listeners []net.Listener) error {
+	if len(binds) == 0 && len(listeners) == 0 {
+		return errors.New("no address to listen on")
+	}
+	listeners = append([]net.Listener(nil), listeners...)
+	for _, b := range binds {
+		ln, err := net.Listen(b.network, b.addr)
+		if err != nil {
+			for _, ln := range listeners {
+				_ = ln.Close()
+			}
+			return &ListenerError{Addr: b.addr, Err: err}
+		}
+		listeners = append(listeners, ln)
+	}
+
+	if srv.Handler == nil {
+		// set before serving concurrently.
+		srv.Handler = ssh.DefaultHandler
+	}
+	return serveAll(srv, listeners)
+}
+
+// serveAll serves the server on all the listeners. It returns once they all
+// stopped, with the error of the first one to, closing the server if it's not
+// because it was closed.
+func serveAll(srv *ssh.Server, listeners []net.Listener) error {
+	errs := make(chan error, len(listeners))
+	for _, ln := range listeners {
+		go func(ln net.Listener) {
+			err := srv.Serve(ln)
+			if !errors.Is(err, ssh.ErrServerClosed) {
+				err = &ListenerError{Addr: ln.Addr().String(), Err: err}
+			}
+			errs <- err
+		}(ln)
+	}
+	err := <-errs
+	if !errors.Is(err, ssh.ErrServerClosed) {
+		_ = srv.Close()
+		// listeners whose Serve hasn't started yet aren't tracked by the
+		// server, so it can't close them.
+		for _, ln := range listeners {
+			_ = ln.Close()
+		}
+	}
+	for i := 1; i < len(listeners); i++ {
+		<-errs
+	}
+	return err
+}
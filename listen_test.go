@@ -0,0 +1,87 @@
+package wish
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestListenAndServeAddresses(t *testing.T) {
+	addrs := []string{freeAddr(t, "tcp", "127.0.0.1:0"), freeAddr(t, "tcp", "127.0.0.1:0")}
+	srv := &ssh.Server{Handler: func(ssh.Session) {}}
+	done := make(chan error, 1)
+	go func() { done <- ListenAndServe(srv, addrs...) }()
+
+	for _, addr := range addrs {
+		sess, err := dialRetry(t, addr).NewSession()
+		requireNoError(t, err)
+		requireNoError(t, sess.Run(""))
+	}
+
+	requireNoError(t, srv.Close())
+	if err := <-done; !errors.Is(err, ssh.ErrServerClosed) {
+		t.Errorf("expected ssh.ErrServerClosed, got %v", err)
+	}
+}
+
+func TestListenAndServeError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	requireNoError(t, err)
+	defer ln.Close() // nolint: errcheck
+
+	taken := ln.Addr().String()
+	err = ListenAndServe(&ssh.Server{}, freeAddr(t, "tcp", "127.0.0.1:0"), taken)
+	var lerr *ListenerError
+	if !errors.As(err, &lerr) || lerr.Addr != taken {
+		t.Errorf("expected a listener error for %s, got %v", taken, err)
+	}
+}
+
+// dialRetry connects to addr, retrying until the server listens on it.
+func dialRetry(tb testing.TB, addr string) *gossh.Client {
+	tb.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		c, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+			User:            "testuser",
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+		})
+		if err == nil {
+			tb.Cleanup(func() { _ = c.Close() })
+			return c
+		}
+		if time.Now().After(deadline) {
+			tb.Fatalf("could not connect to %s: %v", addr, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// failingListener fails accepting connections.
+type failingListener struct {
+	net.Listener
+}
+
+func (l failingListener) Accept() (net.Conn, error) {
+	return nil, errors.New("boom")
+}
+
+func TestServeListenerError(t *testing.T) {
+	var listeners []net.Listener
+	for i := 0; i < 3; i++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		requireNoError(t, err)
+		defer ln.Close() // nolint: errcheck
+		listeners = append(listeners, ln)
+	}
+	listeners[0] = failingListener{listeners[0]}
+	err := Serve(&ssh.Server{}, listeners...)
+	var lerr *ListenerError
+	if !errors.As(err, &lerr) || lerr.Addr != listeners[0].Addr().String() {
+		t.Errorf("expected a listener error for %s, got %v", listeners[0].Addr(), err)
+	}
+}
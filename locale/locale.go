@@ -0,0 +1,69 @@
+// Package locale provides helpers to adapt to the locale of a session's
+// client, as sent in its environment, e.g. to sort directory listings the way
+// users expect in file browsers.
+package locale
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+// Collation returns the language used to sort text for the given session,
+// from the first of LC_ALL, LC_COLLATE and LANG set by the client. It's
+// language.Und if none is set, or for the C and POSIX locales.
+func Collation(s ssh.Session) language.Tag {
+	return parse(s.Environ(), "LC_ALL", "LC_COLLATE", "LANG")
+}
+
+// parse returns the language of the first of the given variables set in env.
+func parse(env []string, keys ...string) language.Tag {
+	vars := map[string]string{}
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars[k] = v
+		}
+	}
+	for _, k := range keys {
+		if v := vars[k]; v != "" {
+			return Parse(v)
+		}
+	}
+	return language.Und
+}
+
+// Parse returns the language of a POSIX locale name, e.g. "de_DE.UTF-8".
+// It's language.Und for the C and POSIX locales, and invalid names.
+func Parse(name string) language.Tag {
+	if i := strings.IndexAny(name, ".@"); i >= 0 {
+		name = name[:i]
+	}
+	if name == "" || name == "C" || name == "POSIX" {
+		return language.Und
+	}
+	tag, err := language.Parse(strings.ReplaceAll(name, "_", "-"))
+	if err != nil {
+		return language.Und
+	}
+	return tag
+}
+
+// Collator returns a collator for the session's locale. Collators aren't safe
+// for concurrent use.
+func Collator(s ssh.Session, opts ...collate.Option) *collate.Collator {
+	return collate.New(Collation(s), opts...)
+}
+
+// Sort sorts names in place using the session's locale. Names are sorted by
+// byte order if the client didn't set one.
+func Sort(s ssh.Session, names []string) {
+	tag := Collation(s)
+	if tag == language.Und {
+		sort.Strings(names)
+		return
+	}
+	collate.New(tag).SortStrings(names)
+}
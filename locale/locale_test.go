@@ -0,0 +1,61 @@
+package locale
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	"golang.org/x/text/language"
+)
+
+func TestParse(t *testing.T) {
+	for name, expected := range map[string]language.Tag{
+		"de_DE.UTF-8":     language.MustParse("de-DE"),
+		"sv_SE":           language.MustParse("sv-SE"),
+		"fr_FR.UTF-8@eur": language.MustParse("fr-FR"),
+		"C":               language.Und,
+		"C.UTF-8":         language.Und,
+		"POSIX":           language.Und,
+		"":                language.Und,
+		"not a locale":    language.Und,
+	} {
+		if tag := Parse(name); tag != expected {
+			t.Errorf("%q: expected %s, got %s", name, expected, tag)
+		}
+	}
+}
+
+func TestSort(t *testing.T) {
+	for _, tc := range []struct {
+		env      []string
+		expected string
+	}{
+		{nil, "apple zebra äpple"},
+		{[]string{"LANG=de_DE.UTF-8"}, "apple äpple zebra"},
+		{[]string{"LANG=de_DE.UTF-8", "LC_COLLATE=sv_SE.UTF-8"}, "apple zebra äpple"},
+		{[]string{"LC_ALL=C", "LANG=de_DE.UTF-8"}, "apple zebra äpple"},
+	} {
+		var sorted string
+		srv := &ssh.Server{
+			Handler: func(s ssh.Session) {
+				names := []string{"zebra", "äpple", "apple"}
+				Sort(s, names)
+				sorted = strings.Join(names, " ")
+			},
+		}
+		sess := testsession.New(t, srv, nil)
+		for _, kv := range tc.env {
+			k, v, _ := strings.Cut(kv, "=")
+			if err := sess.Setenv(k, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := sess.Run(""); err != nil {
+			t.Fatal(err)
+		}
+		if sorted != tc.expected {
+			t.Errorf("%q: expected %q, got %q", tc.env, tc.expected, sorted)
+		}
+	}
+}
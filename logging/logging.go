@@ -3,9 +3,10 @@ package logging
 import (
 	"time"
 
-	"github.com/charmbracelet/log"
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+	"github.com/charmbracelet/wish/rdns"
 )
 
 // Middleware provides basic connection logging. Connects are logged with the
@@ -27,16 +28,23 @@ type Logger interface {
 // remote address, invoked command, TERM setting, window dimensions and if the
 // auth was public key based. Disconnect will log the remote address and
 // connection duration.
+//
+// If the rdns middleware runs before it, the hostname of the client is logged
+// after its address, in parentheses.
 func MiddlewareWithLogger(logger Logger) wish.Middleware {
 	return func(sh ssh.Handler) ssh.Handler {
 		return func(s ssh.Session) {
 			ct := time.Now()
 			hpk := s.PublicKey() != nil
 			pty, _, _ := s.Pty()
+			remote := s.RemoteAddr().String()
+			if host, ok := rdns.Hostname(s.Context()); ok {
+				remote += " (" + host + ")"
+			}
 			logger.Printf(
 				"%s connect %s %v %v %s %v %v",
 				s.User(),
-				s.RemoteAddr().String(),
+				remote,
 				hpk,
 				s.Command(),
 				pty.Term,
@@ -46,7 +54,7 @@ func MiddlewareWithLogger(logger Logger) wish.Middleware {
 			sh(s)
 			logger.Printf(
 				"%s disconnect %s\n",
-				s.RemoteAddr().String(),
+				remote,
 				time.Since(ct),
 			)
 		}
@@ -1,12 +1,16 @@
 package logging_test
 
 import (
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish/logging"
 	"github.com/charmbracelet/wish/testsession"
 	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/time/rate"
 )
 
 func TestMiddleware(t *testing.T) {
@@ -17,6 +21,44 @@ func TestMiddleware(t *testing.T) {
 	})
 }
 
+func TestSampledLogger(t *testing.T) {
+	var out lines
+	l := logging.NewSampledLogger(&out, rate.Every(200*time.Millisecond), 2)
+	for i := 0; i < 10; i++ {
+		l.Printf("line %d", i)
+	}
+	if got := out.get(); len(got) != 2 || got[0] != "line 0" || got[1] != "line 1" {
+		t.Fatalf("expected the first 2 lines only, got %q", got)
+	}
+	if n := l.Dropped(); n != 8 {
+		t.Errorf("expected 8 dropped lines, got %d", n)
+	}
+
+	time.Sleep(250 * time.Millisecond)
+	l.Printf("after")
+	got := out.get()
+	if len(got) != 4 || got[2] != "dropped 8 log lines" || got[3] != "after" {
+		t.Errorf("expected a summary of the dropped lines, got %q", got)
+	}
+}
+
+type lines struct {
+	mu sync.Mutex
+	l  []string
+}
+
+func (l *lines) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.l = append(l.l, fmt.Sprintf(format, v...))
+}
+
+func (l *lines) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.l...)
+}
+
 func setup(tb testing.TB) *gossh.Session {
 	tb.Helper()
 	return testsession.New(tb, &ssh.Server{
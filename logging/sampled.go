@@ -0,0 +1,48 @@
+package logging
+
+import (
+	"sync/atomic"
+
+	"golang.org/x/time/rate"
+)
+
+// SampledLogger is a Logger protecting another one from floods of lines, e.g.
+// from a client opening sessions in a hot loop.
+//
+// Lines are let through up to rate r, with bursts of at most burst lines.
+// Past that, lines are dropped and counted, and the number of lines dropped
+// is logged before the next line let through.
+type SampledLogger struct {
+	logger  Logger
+	limiter *rate.Limiter
+	pending atomic.Int64
+	dropped atomic.Int64
+}
+
+var _ Logger = &SampledLogger{}
+
+// NewSampledLogger returns a SampledLogger writing to the given logger.
+func NewSampledLogger(logger Logger, r rate.Limit, burst int) *SampledLogger {
+	return &SampledLogger{
+		logger:  logger,
+		limiter: rate.NewLimiter(r, burst),
+	}
+}
+
+// Printf implements Logger.
+func (l *SampledLogger) Printf(format string, v ...interface{}) {
+	if !l.limiter.Allow() {
+		l.pending.Add(1)
+		l.dropped.Add(1)
+		return
+	}
+	if n := l.pending.Swap(0); n > 0 {
+		l.logger.Printf("dropped %d log lines", n)
+	}
+	l.logger.Printf(format, v...)
+}
+
+// Dropped returns the total number of lines dropped so far.
+func (l *SampledLogger) Dropped() int64 {
+	return l.dropped.Load()
+}
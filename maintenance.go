@@ -0,0 +1,263 @@
+package wish
+
+import (
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// Principal identifies users allowed in during maintenance. Empty fields
+// match anything, so set at least one.
+type Principal struct {
+	User      string
+	PublicKey ssh.PublicKey
+}
+
+func (p Principal) matches(ctx ssh.Context) bool {
+	if p.User == "" && p.PublicKey == nil {
+		return false
+	}
+	if p.User != "" && p.User != ctx.User() {
+		return false
+	}
+	if p.PublicKey != nil {
+		pk, _ := ctx.Value(ssh.ContextKeyPublicKey).(ssh.PublicKey)
+		if pk == nil || !ssh.KeysEqual(pk, p.PublicKey) {
+			return false
+		}
+	}
+	return true
+}
+
+// Window is a window of time maintenance can be scheduled in, e.g. a Period,
+// or a recurring accesscontrol.Window.
+type Window interface {
+	// Contains returns whether the window is open at the given time.
+	Contains(t time.Time) bool
+}
+
+// Period is a one-off window of time. A zero End leaves it open until the
+// maintenance is cleared.
+type Period struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Contains implements Window.
+func (p Period) Contains(t time.Time) bool {
+	return !t.Before(p.Start) && (p.End.IsZero() || t.Before(p.End))
+}
+
+// over returns whether the period ended before the given time.
+func (p Period) over(t time.Time) bool {
+	return !p.End.IsZero() && !t.Before(p.End)
+}
+
+// defaultMaintenanceMessage is the message of windows scheduled without one.
+const defaultMaintenanceMessage = "The server is under maintenance, please try again later."
+
+// windowPoll is how often windows are checked for opening or closing, while
+// sessions wait for maintenance changes.
+var windowPoll = time.Second
+
+// Maintenance is the maintenance mode of a server, where new sessions are
+// rejected with a message, except for the principals allowed in. It's either
+// set right away, or scheduled in windows. The zero value isn't in
+// maintenance, and is ready to use:
+//
+//	var m wish.Maintenance
+//	srv, err := wish.NewServer(
+//		m.Option(),
+//		wish.WithMiddleware(admin.Maintenance()),
+//	)
+//	// later, e.g. from an admin command:
+//	m.Set("Upgrading the database, back in 5 minutes.", wish.Principal{User: "admin"})
+//
+// New sessions are rejected by the admin package's maintenance middleware,
+// and active ones notified through Changed, e.g. the bubbletea middleware
+// sends a MaintenanceMsg to its programs. The scp and sftp packages use it to
+// only reject writes, see their WithMaintenance options.
+type Maintenance struct {
+	mu      sync.Mutex
+	msg     string
+	allow   []Principal
+	windows []scheduledWindow
+	changed chan struct{}
+	last    string
+	timer   *time.Timer
+}
+
+// scheduledWindow is a window maintenance is scheduled in.
+type scheduledWindow struct {
+	Window
+	msg   string
+	allow []Principal
+}
+
+// maintenanceKey is the key of the Maintenance of the server in the contexts
+// of its connections.
+type maintenanceKey struct{}
+
+// Option returns an ssh.Option making the maintenance mode available to the
+// sessions of the server, through MaintenanceOf.
+//
+// It's set in the context of each connection by the server's ConnCallback,
+// which it chains: set ConnCallback before applying it, not after, or
+// sessions won't find the maintenance mode. Telnet and serial sessions don't
+// run connection callbacks, so they don't either.
+func (m *Maintenance) Option() ssh.Option {
+	return func(s *ssh.Server) error {
+		setConnValue(s, maintenanceKey{}, m)
+		return nil
+	}
+}
+
+// MaintenanceOf returns the Maintenance of the server of the given session
+// context, or nil if it has none.
+func MaintenanceOf(ctx ssh.Context) *Maintenance {
+	m, _ := ctx.Value(maintenanceKey{}).(*Maintenance)
+	return m
+}
+
+// Set puts the server in maintenance mode with the given message, or takes it
+// out of it if the message is empty. Only the given principals are let in
+// during maintenance. Scheduled windows are kept.
+func (m *Maintenance) Set(msg string, allow ...Principal) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.msg = msg
+	m.allow = append([]Principal(nil), allow...)
+	m.notifyLocked()
+}
+
+// Schedule puts the server in maintenance mode with the given message
+// whenever the window is open, e.g. Period{Start: time.Now()} to begin right
+// away, until cleared. Only the given principals are let in. Maintenance set
+// with Set takes precedence.
+func (m *Maintenance) Schedule(w Window, msg string, allow ...Principal) {
+	if msg == "" {
+		msg = defaultMaintenanceMessage
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.windows = append(m.windows, scheduledWindow{Window: w, msg: msg, allow: append([]Principal(nil), allow...)})
+	m.notifyLocked()
+}
+
+// Clear takes the server out of maintenance mode, and removes the scheduled
+// windows.
+func (m *Maintenance) Clear() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.msg, m.allow, m.windows = "", nil, nil
+	m.notifyLocked()
+}
+
+// Windows returns the scheduled windows, without the periods that are over.
+func (m *Maintenance) Windows() []Window {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.pruneLocked(time.Now())
+	windows := make([]Window, 0, len(m.windows))
+	for _, w := range m.windows {
+		windows = append(windows, w.Window)
+	}
+	return windows
+}
+
+// Message returns the maintenance message, empty if the server isn't in
+// maintenance.
+func (m *Maintenance) Message() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg, _ := m.activeLocked(time.Now())
+	return msg
+}
+
+// Changed returns the maintenance message, empty if the server isn't in
+// maintenance, and a channel closed when it changes, including when windows
+// open or close.
+func (m *Maintenance) Changed() (msg string, changed <-chan struct{}) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.changed == nil {
+		m.changed = make(chan struct{})
+	}
+	m.last, _ = m.activeLocked(time.Now())
+	if len(m.windows) > 0 && m.timer == nil {
+		m.timer = time.AfterFunc(windowPoll, m.poll)
+	}
+	return m.last, m.changed
+}
+
+// poll notifies the sessions waiting for changes when windows open or close.
+func (m *Maintenance) poll() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.timer = nil
+	if m.changed == nil {
+		// no one is waiting.
+		return
+	}
+	now := time.Now()
+	m.pruneLocked(now)
+	if msg, _ := m.activeLocked(now); msg != m.last {
+		m.notifyLocked()
+		return
+	}
+	if len(m.windows) > 0 {
+		m.timer = time.AfterFunc(windowPoll, m.poll)
+	}
+}
+
+// Blocks returns the maintenance message if the server is in maintenance, and
+// the user of the given session context isn't allowed in.
+func (m *Maintenance) Blocks(ctx ssh.Context) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg, allow := m.activeLocked(time.Now())
+	if msg == "" {
+		return "", false
+	}
+	for _, p := range allow {
+		if p.matches(ctx) {
+			return "", false
+		}
+	}
+	return msg, true
+}
+
+// activeLocked returns the message and principals of the maintenance at the
+// given time, if any. m.mu must be held.
+func (m *Maintenance) activeLocked(t time.Time) (string, []Principal) {
+	if m.msg != "" {
+		return m.msg, m.allow
+	}
+	for _, w := range m.windows {
+		if w.Contains(t) {
+			return w.msg, w.allow
+		}
+	}
+	return "", nil
+}
+
+// pruneLocked removes the periods that are over. m.mu must be held.
+func (m *Maintenance) pruneLocked(t time.Time) {
+	windows := m.windows[:0]
+	for _, w := range m.windows {
+		if p, ok := w.Window.(Period); ok && p.over(t) {
+			continue
+		}
+		windows = append(windows, w)
+	}
+	m.windows = windows
+}
+
+// notifyLocked notifies the sessions waiting for changes. m.mu must be held.
+func (m *Maintenance) notifyLocked() {
+	if m.changed != nil {
+		close(m.changed)
+		m.changed = nil
+	}
+}
@@ -0,0 +1,41 @@
+package wish
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceSchedule(t *testing.T) {
+	defer func(poll time.Duration) { windowPoll = poll }(windowPoll)
+	windowPoll = 10 * time.Millisecond
+
+	var m Maintenance
+	start := time.Now().Add(50 * time.Millisecond)
+	m.Schedule(Period{Start: start, End: start.Add(50 * time.Millisecond)}, "")
+	msg, changed := m.Changed()
+	if msg != "" {
+		t.Fatalf("expected no maintenance yet, got %q", msg)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("expected to be notified when the window opens")
+	}
+	msg, changed = m.Changed()
+	if msg != defaultMaintenanceMessage {
+		t.Fatalf("expected the default message, got %q", msg)
+	}
+
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("expected to be notified when the window closes")
+	}
+	if msg := m.Message(); msg != "" {
+		t.Errorf("expected the maintenance to be over, got %q", msg)
+	}
+	if n := len(m.Windows()); n != 0 {
+		t.Errorf("expected the window to be removed, got %d", n)
+	}
+}
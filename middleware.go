@@ -0,0 +1,82 @@
+package wish
+
+import (
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// Chain composes the given middlewares into one, in the same order as
+// WithMiddleware: the last one is executed first.
+func Chain(mw ...Middleware) Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		for _, m := range mw {
+			sh = m(sh)
+		}
+		return sh
+	}
+}
+
+// Parallel returns a middleware running the given middlewares concurrently,
+// calling the next handler once all of them called theirs. This cuts the time
+// to first frame when several independent middlewares do slow lookups, e.g.
+// fetching the user from a store, or evaluating flags.
+//
+// Parallel is meant for middlewares enriching the session context: the next
+// handler is given the original session, not the ones the middlewares pass
+// on. It isn't called if any of the middlewares doesn't call theirs, e.g. to
+// reject the session. What the middlewares do after their next handler
+// returns also runs concurrently, and panics are propagated to the session
+// goroutine, so they can be recovered as usual.
+func Parallel(mw ...Middleware) Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			var (
+				wg      sync.WaitGroup
+				reached = make(chan bool, len(mw))
+				release = make(chan struct{})
+
+				mu       sync.Mutex
+				panicked interface{}
+			)
+			for _, m := range mw {
+				m := m
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					var once sync.Once
+					report := func(ok bool) {
+						once.Do(func() { reached <- ok })
+					}
+					defer func() {
+						if r := recover(); r != nil {
+							mu.Lock()
+							panicked = r
+							mu.Unlock()
+						}
+						report(false)
+					}()
+					m(func(ssh.Session) {
+						report(true)
+						<-release
+					})(s)
+				}()
+			}
+
+			ok := true
+			for range mw {
+				if !<-reached {
+					ok = false
+				}
+			}
+			if ok {
+				sh(s)
+			}
+			close(release)
+			wg.Wait()
+			if panicked != nil {
+				panic(panicked)
+			}
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package wish
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+type testKey string
+
+func slowSetter(key testKey, after *atomic.Int32) Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			time.Sleep(100 * time.Millisecond)
+			s.Context().SetValue(key, true)
+			sh(s)
+			after.Add(1)
+		}
+	}
+}
+
+func TestParallel(t *testing.T) {
+	t.Run("all call next", func(t *testing.T) {
+		var after atomic.Int32
+		var got []string
+		mw := Parallel(
+			slowSetter("a", &after),
+			slowSetter("b", &after),
+			Chain(slowSetter("c", &after), slowSetter("d", &after)),
+		)
+		var elapsed time.Duration
+		srv := &ssh.Server{
+			Handler: func(s ssh.Session) {
+				start := time.Now()
+				mw(func(s ssh.Session) {
+					elapsed = time.Since(start)
+					for _, k := range []testKey{"a", "b", "c", "d"} {
+						if s.Context().Value(k) == true {
+							got = append(got, string(k))
+						}
+					}
+				})(s)
+			},
+		}
+		if err := testsession.New(t, srv, nil).Run(""); err != nil {
+			t.Fatal(err)
+		}
+		// c and d run one after the other, the rest concurrently.
+		if elapsed > 350*time.Millisecond {
+			t.Errorf("expected middlewares to run concurrently, took %s", elapsed)
+		}
+		if strings.Join(got, "") != "abcd" {
+			t.Errorf("expected all context values to be set, got %q", got)
+		}
+		if n := after.Load(); n != 4 {
+			t.Errorf("expected all middlewares to finish, got %d", n)
+		}
+	})
+
+	t.Run("one rejects", func(t *testing.T) {
+		var after atomic.Int32
+		called := false
+		reject := func(ssh.Handler) ssh.Handler {
+			return func(s ssh.Session) {
+				Fatalln(s, "rejected")
+			}
+		}
+		done := make(chan struct{})
+		srv := &ssh.Server{
+			Handler: func(s ssh.Session) {
+				defer close(done)
+				Parallel(slowSetter("a", &after), reject)(func(ssh.Session) {
+					called = true
+				})(s)
+			},
+		}
+		if err := testsession.New(t, srv, nil).Run(""); err == nil {
+			t.Fatal("expected an error")
+		}
+		<-done
+		if called {
+			t.Error("expected the handler not to be called")
+		}
+		if n := after.Load(); n != 1 {
+			t.Errorf("expected the other middleware to finish, got %d", n)
+		}
+	})
+
+	t.Run("panic", func(t *testing.T) {
+		recovered := make(chan interface{}, 1)
+		boom := func(ssh.Handler) ssh.Handler {
+			return func(ssh.Session) {
+				panic("boom")
+			}
+		}
+		srv := &ssh.Server{
+			Handler: func(s ssh.Session) {
+				defer func() { recovered <- recover() }()
+				Parallel(boom)(func(ssh.Session) {})(s)
+			},
+		}
+		_ = testsession.New(t, srv, nil).Run("")
+		if r := <-recovered; r != "boom" {
+			t.Errorf("expected the panic to be propagated, got %v", r)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+// Package motd provides a message of the day feed, shown to users in the
+// server banner or inside Bubble Tea apps.
+package motd
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+)
+
+// Item is a message of the day.
+type Item struct {
+	Text    string
+	Expires time.Time
+}
+
+// Expired returns whether the item expired at the given time. Items without
+// an expiry never expire.
+func (i Item) Expired(t time.Time) bool {
+	return !i.Expires.IsZero() && !t.Before(i.Expires)
+}
+
+// Feed is a list of messages of the day. It's safe for concurrent use, so
+// operators can push items while it's being shown.
+type Feed struct {
+	mu    sync.Mutex
+	items []Item
+}
+
+// Push adds a message to the feed, expiring after ttl. A ttl of zero never
+// expires.
+func (f *Feed) Push(text string, ttl time.Duration) {
+	item := Item{Text: text}
+	if ttl > 0 {
+		item.Expires = time.Now().Add(ttl)
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items = append(f.items, item)
+}
+
+// Clear removes all the messages.
+func (f *Feed) Clear() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items = nil
+}
+
+// Items returns the messages that didn't expire yet, oldest first.
+func (f *Feed) Items() []Item {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := time.Now()
+	items := f.items[:0]
+	for _, item := range f.items {
+		if !item.Expired(now) {
+			items = append(items, item)
+		}
+	}
+	f.items = items
+	return append([]Item(nil), items...)
+}
+
+// String returns the messages, one per line.
+func (f *Feed) String() string {
+	var sb strings.Builder
+	for _, item := range f.Items() {
+		sb.WriteString(item.Text)
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// Banner implements ssh.BannerHandler, so the feed can be shown in the server
+// banner with wish.WithBannerHandler(feed.Banner).
+func (f *Feed) Banner(ssh.Context) string {
+	return f.String()
+}
+
+// Model is a Bubble Tea component showing the feed.
+type Model struct {
+	Feed *Feed
+
+	// Prefix is written before each message.
+	Prefix string
+}
+
+var _ tea.Model = Model{}
+
+// Init implements tea.Model.
+func (m Model) Init() tea.Cmd { return nil }
+
+// Update implements tea.Model.
+func (m Model) Update(tea.Msg) (tea.Model, tea.Cmd) { return m, nil }
+
+// View implements tea.Model.
+func (m Model) View() string {
+	items := m.Feed.Items()
+	lines := make([]string, 0, len(items))
+	for _, item := range items {
+		lines = append(lines, m.Prefix+item.Text)
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,60 @@
+package motd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestFeed(t *testing.T) {
+	var feed Feed
+	feed.Push("forever", 0)
+	feed.Push("soon", time.Nanosecond)
+	feed.Push("later", time.Hour)
+	time.Sleep(time.Millisecond)
+
+	if s := feed.String(); s != "forever\nlater\n" {
+		t.Errorf("unexpected feed: %q", s)
+	}
+	if v := (Model{Feed: &feed, Prefix: "* "}).View(); v != "* forever\n* later" {
+		t.Errorf("unexpected view: %q", v)
+	}
+	feed.Clear()
+	if s := feed.String(); s != "" {
+		t.Errorf("expected empty feed, got %q", s)
+	}
+}
+
+func TestBanner(t *testing.T) {
+	var feed Feed
+	feed.Push("maintenance tonight", time.Hour)
+	srv := &ssh.Server{
+		Handler: func(ssh.Session) {},
+	}
+	requireNoError(t, wish.WithBannerHandler(feed.Banner)(srv))
+
+	var banner string
+	sess := testsession.New(t, srv, &gossh.ClientConfig{
+		User: "testuser",
+		BannerCallback: func(message string) error {
+			banner = message
+			return nil
+		},
+	})
+	requireNoError(t, sess.Run(""))
+	if banner != "maintenance tonight\n" {
+		t.Errorf("unexpected banner: %q", banner)
+	}
+}
+
+func requireNoError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err.Error())
+	}
+}
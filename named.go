@@ -0,0 +1,173 @@
+package wish
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// Step is a named middleware a session went through.
+type Step struct {
+	// Name is the name the middleware was given with Named.
+	Name string
+
+	// Start is when the session entered the middleware.
+	Start time.Time
+
+	// Own is the time spent in the middleware before it called the next
+	// handler, or until it returned if it didn't.
+	Own time.Duration
+
+	// Total is the time spent in the middleware, including the next
+	// handlers, or zero if it didn't return yet.
+	Total time.Duration
+
+	// Passed is whether the middleware called the next handler.
+	Passed bool
+
+	// Returned is whether the middleware returned.
+	Returned bool
+}
+
+// Trace is the named middlewares a session went through, in the order they
+// ran.
+type Trace []Step
+
+// String returns the trace on one line, e.g. for logging. Middlewares that
+// didn't call the next handler are marked with a ✗.
+func (t Trace) String() string {
+	parts := make([]string, 0, len(t))
+	for _, st := range t {
+		part := fmt.Sprintf("%s (%s)", st.Name, st.Own)
+		if st.Returned && !st.Passed {
+			part += " ✗"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " → ")
+}
+
+// Stopped returns the middleware that returned without calling the next
+// handler, i.e. that swallowed the session, if any.
+func (t Trace) Stopped() (Step, bool) {
+	for _, st := range t {
+		if st.Returned && !st.Passed {
+			return st, true
+		}
+	}
+	return Step{}, false
+}
+
+type traceKey struct{}
+
+// trace is the trace of the sessions of a connection.
+type trace struct {
+	mu    sync.Mutex
+	steps []Step
+	// open is the index of the last step of each named middleware.
+	open map[*named]int
+}
+
+// named identifies a middleware given a name.
+type named struct {
+	name string
+}
+
+// TraceOf returns the trace of the session with the given context: the
+// middlewares given a name with Named it went through so far, with their
+// timings.
+//
+// The trace is kept in the connection context, and starts over when a session
+// enters the first named middleware once the previous one left them all, so
+// clients running concurrent sessions over a connection see them mixed.
+func TraceOf(ctx ssh.Context) Trace {
+	tr, ok := ctx.Value(traceKey{}).(*trace)
+	if !ok {
+		return nil
+	}
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return append(Trace(nil), tr.steps...)
+}
+
+func traceFor(ctx ssh.Context) *trace {
+	ctx.Lock()
+	defer ctx.Unlock()
+	tr, ok := ctx.Value(traceKey{}).(*trace)
+	if !ok {
+		tr = &trace{open: map[*named]int{}}
+		ctx.SetValue(traceKey{}, tr)
+	}
+	return tr
+}
+
+// enter adds a step, starting over if all the previous ones returned.
+func (tr *trace) enter(n *named) int {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	done := true
+	for _, st := range tr.steps {
+		done = done && st.Returned
+	}
+	if done {
+		tr.steps = tr.steps[:0]
+	}
+	tr.steps = append(tr.steps, Step{Name: n.name, Start: time.Now()})
+	tr.open[n] = len(tr.steps) - 1
+	return tr.open[n]
+}
+
+func (tr *trace) update(i int, fn func(*Step)) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if i >= 0 && i < len(tr.steps) {
+		fn(&tr.steps[i])
+	}
+}
+
+func (tr *trace) last(n *named) int {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	if i, ok := tr.open[n]; ok {
+		return i
+	}
+	return -1
+}
+
+// Named gives a name to the middleware, so the sessions going through it can
+// be traced with TraceOf, e.g. to find out which middleware swallowed a
+// session:
+//
+//	wish.WithMiddleware(
+//		wish.Named("app", bm.Middleware(handler)),
+//		wish.Named("accesscontrol", accesscontrol.Middleware()),
+//		wish.Named("logging", logging.Middleware()),
+//	)
+func Named(name string, mw Middleware) Middleware {
+	n := &named{name: name}
+	return func(sh ssh.Handler) ssh.Handler {
+		h := mw(func(s ssh.Session) {
+			tr := traceFor(s.Context())
+			tr.update(tr.last(n), func(st *Step) {
+				st.Passed = true
+				st.Own = time.Since(st.Start)
+			})
+			sh(s)
+		})
+		return func(s ssh.Session) {
+			tr := traceFor(s.Context())
+			i := tr.enter(n)
+			defer tr.update(i, func(st *Step) {
+				st.Returned = true
+				st.Total = time.Since(st.Start)
+				if !st.Passed {
+					st.Own = st.Total
+				}
+			})
+			h(s)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package wish
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestNamed(t *testing.T) {
+	pass := func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			time.Sleep(10 * time.Millisecond)
+			sh(s)
+		}
+	}
+	swallow := func(ssh.Handler) ssh.Handler {
+		return func(ssh.Session) {}
+	}
+	traces := make(chan Trace, 2)
+	srv := &ssh.Server{}
+	requireNoError(t, WithMiddleware(
+		func(ssh.Handler) ssh.Handler {
+			return func(s ssh.Session) {
+				Print(s, "app")
+			}
+		},
+		Named("gate", func(sh ssh.Handler) ssh.Handler {
+			gated := swallow(sh)
+			return func(s ssh.Session) {
+				if s.RawCommand() == "blocked" {
+					gated(s)
+					return
+				}
+				sh(s)
+			}
+		}),
+		Named("slow", pass),
+		func(sh ssh.Handler) ssh.Handler {
+			return func(s ssh.Session) {
+				sh(s)
+				traces <- TraceOf(s.Context())
+			}
+		},
+	)(srv))
+	addr := testsession.Listen(t, srv)
+
+	for _, cmd := range []string{"", "blocked"} {
+		sess, err := testsession.NewClientSession(t, addr, nil)
+		requireNoError(t, err)
+		requireNoError(t, sess.Run(cmd))
+	}
+
+	trace := <-traces
+	requireEqual(t, 2, len(trace))
+	requireEqual(t, "slow", trace[0].Name)
+	requireEqual(t, "gate", trace[1].Name)
+	for _, st := range trace {
+		if !st.Passed || !st.Returned || st.Total < st.Own {
+			t.Errorf("unexpected step %+v", st)
+		}
+	}
+	if trace[0].Own < 10*time.Millisecond {
+		t.Errorf("expected the slow middleware to take 10ms, took %s", trace[0].Own)
+	}
+	if _, ok := trace.Stopped(); ok {
+		t.Error("expected the session not to be stopped")
+	}
+
+	trace = <-traces
+	st, ok := trace.Stopped()
+	if !ok || st.Name != "gate" {
+		t.Errorf("expected the session to be stopped by the gate, got %s", trace)
+	}
+	if s := trace.String(); !strings.HasPrefix(s, "slow (") || !strings.HasSuffix(s, " ✗") {
+		t.Errorf("unexpected trace %q", s)
+	}
+}
@@ -0,0 +1,78 @@
+package wish
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/log"
+	"github.com/charmbracelet/wish/internal/netaddr"
+)
+
+// WithAllowedNetworks returns an ssh.Option that only accepts connections
+// from the given networks, in CIDR notation, e.g. "10.0.0.0/8" or
+// "2001:db8::/32". Other connections are closed right away.
+//
+// IPv4 and IPv6 are allowed separately: connections from a family no network
+// is given for are all rejected. Use "0.0.0.0/0" or "::/0" to allow a whole
+// family. IPv4-mapped IPv6 addresses, as seen on dual-stack listeners, are
+// matched as IPv4.
+func WithAllowedNetworks(cidrs ...string) ssh.Option {
+	return func(s *ssh.Server) error {
+		prefixes := make([]netip.Prefix, 0, len(cidrs))
+		for _, cidr := range cidrs {
+			p, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return fmt.Errorf("allowed networks: %w", err)
+			}
+			prefixes = append(prefixes, p.Masked())
+		}
+		next := s.ConnCallback
+		s.ConnCallback = func(ctx ssh.Context, conn net.Conn) net.Conn {
+			if !allowed(prefixes, conn.RemoteAddr()) {
+				log.Debug("rejecting connection from a network that isn't allowed", "remote-addr", conn.RemoteAddr())
+				return nil
+			}
+			if next != nil {
+				return next(ctx, conn)
+			}
+			return conn
+		}
+		return nil
+	}
+}
+
+func allowed(prefixes []netip.Prefix, addr net.Addr) bool {
+	ip, ok := netaddr.IP(addr)
+	if !ok {
+		return false
+	}
+	for _, p := range prefixes {
+		if p.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ListenAndServeDualStack listens on the given IPv4 and IPv6 addresses with
+// separate sockets, and serves the server on both. Either address can be
+// empty to skip its family.
+//
+// Unlike listening on ":22", which on most systems accepts IPv4 connections
+// as IPv4-mapped IPv6 addresses, each family gets its own socket, so they
+// can be bound to different interfaces and firewalled separately.
+//
+// It returns when either listener fails, with a *ListenerError, or the
+// server is closed, in which case ssh.ErrServerClosed is returned.
+func ListenAndServeDualStack(srv *ssh.Server, v4Addr, v6Addr string) error {
+	var binds []bind
+	if v4Addr != "" {
+		binds = append(binds, bind{"tcp4", v4Addr})
+	}
+	if v6Addr != "" {
+		binds = append(binds, bind{"tcp6", v6Addr})
+	}
+	return serve(srv, binds, nil)
+}
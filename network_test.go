@@ -0,0 +1,61 @@
+package wish
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestWithAllowedNetworks(t *testing.T) {
+	newServer := func(cidrs ...string) *ssh.Server {
+		srv := &ssh.Server{Handler: func(ssh.Session) {}}
+		requireNoError(t, WithAllowedNetworks(cidrs...)(srv))
+		return srv
+	}
+
+	sess := testsession.New(t, newServer("127.0.0.0/8"), nil)
+	requireNoError(t, sess.Run(""))
+
+	addr := testsession.Listen(t, newServer("10.0.0.0/8", "::/0"))
+	if _, err := testsession.NewClientSession(t, addr, nil); err == nil {
+		t.Error("expected the connection to be rejected")
+	}
+
+	if err := WithAllowedNetworks("10.0.0.0")(&ssh.Server{}); err == nil {
+		t.Error("expected an invalid network to fail")
+	}
+}
+
+func TestListenAndServeDualStack(t *testing.T) {
+	v4 := freeAddr(t, "tcp4", "127.0.0.1:0")
+	v6 := freeAddr(t, "tcp6", "[::1]:0")
+	srv := &ssh.Server{Handler: func(ssh.Session) {}}
+	done := make(chan error, 1)
+	go func() { done <- ListenAndServeDualStack(srv, v4, v6) }()
+
+	for _, addr := range []string{v4, v6} {
+		sess, err := dialRetry(t, addr).NewSession()
+		requireNoError(t, err)
+		requireNoError(t, sess.Run(""))
+	}
+
+	requireNoError(t, srv.Close())
+	if err := <-done; !errors.Is(err, ssh.ErrServerClosed) {
+		t.Errorf("expected ssh.ErrServerClosed, got %v", err)
+	}
+}
+
+// freeAddr returns an address with a free port, skipping the test if the
+// network isn't available.
+func freeAddr(tb testing.TB, network, addr string) string {
+	tb.Helper()
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		tb.Skipf("%s not available: %v", network, err)
+	}
+	defer ln.Close() // nolint: errcheck
+	return ln.Addr().String()
+}
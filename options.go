@@ -7,11 +7,12 @@ import (
 	"io"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/charmbracelet/keygen"
-	"github.com/charmbracelet/log"
 	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/log"
 	gossh "golang.org/x/crypto/ssh"
 )
 
@@ -53,21 +54,40 @@ func WithBannerHandler(h ssh.BannerHandler) ssh.Option {
 // Server.Handler.
 //
 // Notice that middlewares are composed from first to last, which means the last one is executed first.
+//
+// The middlewares are also applied to the subsystems set with
+// WithChainedSubsystem, but not to those set with WithSubsystem.
 func WithMiddleware(mw ...Middleware) ssh.Option {
 	return func(s *ssh.Server) error {
-		h := func(s ssh.Session) {}
-		for _, m := range mw {
-			h = m(h)
+		chain := func(h ssh.Handler) ssh.Handler {
+			for _, m := range mw {
+				h = m(h)
+			}
+			return h
 		}
-		s.Handler = h
+		s.Handler = chain(func(s ssh.Session) {})
+		setConnValue(s, middlewareKey{}, &middlewareChain{chain: chain})
 		return nil
 	}
 }
 
 // WithHostKeyFile returns an ssh.Option that sets the path to the private.
 func WithHostKeyPath(path string) ssh.Option {
+	return WithAutoHostKey(path, keygen.Ed25519)
+}
+
+// WithAutoHostKey returns an ssh.Option that adds the host key at the given
+// path, generating one of the given type, e.g. keygen.Ed25519, keygen.ECDSA or
+// keygen.RSA, if it's missing.
+//
+// The server presents one host key per type, so use it once per type to serve
+// several host keys, letting clients pick the one they know:
+//
+//	wish.WithAutoHostKey(".ssh/id_ed25519", keygen.Ed25519),
+//	wish.WithAutoHostKey(".ssh/id_ecdsa", keygen.ECDSA),
+func WithAutoHostKey(path string, kt keygen.KeyType) ssh.Option {
 	if _, err := os.Stat(path); os.IsNotExist(err) {
-		_, err := keygen.New(path, keygen.WithKeyType(keygen.Ed25519), keygen.WithWrite())
+		_, err := keygen.New(path, keygen.WithKeyType(kt), keygen.WithWrite())
 		if err != nil {
 			return func(*ssh.Server) error {
 				return err
@@ -201,7 +221,7 @@ func WithMaxTimeout(d time.Duration) ssh.Option {
 }
 
 // WithSubsystem returns an ssh.Option that sets the subsystem
-// handler for a given protocol.
+// handler for a given protocol, e.g. "netconf".
 func WithSubsystem(key string, h ssh.SubsystemHandler) ssh.Option {
 	return func(s *ssh.Server) error {
 		if s.SubsystemHandlers == nil {
@@ -211,3 +231,49 @@ func WithSubsystem(key string, h ssh.SubsystemHandler) ssh.Option {
 		return nil
 	}
 }
+
+// WithChainedSubsystem is like WithSubsystem, but its sessions go through the
+// middlewares set with WithMiddleware, whether it's used before or after,
+// with the handler at the end of the chain instead of the session handler.
+// Middlewares can tell them apart with ssh.Session.Subsystem, e.g. to not
+// write to them, as that would corrupt the protocol.
+//
+// The chain is found through the connection's context, which WithMiddleware
+// sets in the server's ConnCallback: set ConnCallback before applying the
+// options, not after, or the handler runs without the middlewares.
+func WithChainedSubsystem(key string, h ssh.SubsystemHandler) ssh.Option {
+	return WithSubsystem(key, chainSubsystem(h))
+}
+
+// middlewareKey is the key of the middleware chain of the server in the
+// contexts of its connections, see WithMiddleware.
+type middlewareKey struct{}
+
+// middlewareChain is the middleware chain set with WithMiddleware.
+type middlewareChain struct {
+	chain func(ssh.Handler) ssh.Handler
+}
+
+// chainSubsystem returns a subsystem handler running h at the end of the
+// middleware chain of the session's server, if it has one. The chain is kept
+// in the connection context, so it's found whether WithMiddleware is used
+// before or after WithChainedSubsystem.
+func chainSubsystem(h ssh.SubsystemHandler) ssh.SubsystemHandler {
+	var mu sync.Mutex
+	var chained *middlewareChain
+	var handler ssh.Handler
+	return func(s ssh.Session) {
+		mc, ok := s.Context().Value(middlewareKey{}).(*middlewareChain)
+		if !ok {
+			h(s)
+			return
+		}
+		mu.Lock()
+		if mc != chained {
+			chained, handler = mc, mc.chain(ssh.Handler(h))
+		}
+		sh := handler
+		mu.Unlock()
+		sh(s)
+	}
+}
@@ -3,11 +3,14 @@ package wish
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/charmbracelet/keygen"
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish/testsession"
 	gossh "golang.org/x/crypto/ssh"
@@ -76,6 +79,22 @@ func TestWithMaxTimeout(t *testing.T) {
 	requireEqual(t, time.Second, s.MaxTimeout)
 }
 
+func TestWithAutoHostKey(t *testing.T) {
+	dir := t.TempDir()
+	srv := &ssh.Server{}
+	for _, kt := range []keygen.KeyType{keygen.Ed25519, keygen.ECDSA, keygen.RSA} {
+		requireNoError(t, WithAutoHostKey(filepath.Join(dir, "host_"+string(kt)), kt)(srv))
+	}
+	// existing keys are reused.
+	requireNoError(t, WithAutoHostKey(filepath.Join(dir, "host_"+string(keygen.RSA)), keygen.Ed25519)(srv))
+
+	var types []string
+	for _, signer := range srv.HostSigners {
+		types = append(types, signer.PublicKey().Type())
+	}
+	requireEqual(t, "ssh-ed25519 ecdsa-sha2-nistp384 ssh-rsa", strings.Join(types, " "))
+}
+
 func TestIsAuthorized(t *testing.T) {
 	t.Run("valid", func(t *testing.T) {
 		requireEqual(t, true, isAuthorized("testdata/authorized_keys", func(k ssh.PublicKey) bool { return true }))
@@ -234,3 +253,38 @@ func requireAuthError(tb testing.TB, err error) {
 	}
 	requireEqual(tb, "ssh: handshake failed: ssh: unable to authenticate, attempted methods [none publickey], no supported methods remain", err.Error())
 }
+
+func TestWithSubsystemMiddleware(t *testing.T) {
+	mw := func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			Print(s, "mw:")
+			sh(s)
+		}
+	}
+	subsystem := func(s ssh.Session) {
+		Print(s, s.Subsystem())
+	}
+	for name, tc := range map[string]struct {
+		opts   []ssh.Option
+		expect string
+	}{
+		"before":    {[]ssh.Option{WithChainedSubsystem("foo", subsystem), WithMiddleware(mw)}, "mw:foo"},
+		"after":     {[]ssh.Option{WithMiddleware(mw), WithChainedSubsystem("foo", subsystem)}, "mw:foo"},
+		"unchained": {[]ssh.Option{WithMiddleware(mw), WithSubsystem("foo", subsystem)}, "foo"},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			srv := &ssh.Server{}
+			for _, opt := range tc.opts {
+				requireNoError(t, opt(srv))
+			}
+			sess := testsession.New(t, srv, nil)
+			stdout, err := sess.StdoutPipe()
+			requireNoError(t, err)
+			requireNoError(t, sess.RequestSubsystem("foo"))
+			out, err := io.ReadAll(stdout)
+			requireNoError(t, err)
+			requireEqual(t, tc.expect, string(out))
+		})
+	}
+}
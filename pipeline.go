@@ -0,0 +1,130 @@
+package wish
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// PipelineError is returned by Pipeline when some of its commands failed.
+type PipelineError struct {
+	// Errs are the errors of the commands, in order, nil for the ones that
+	// succeeded.
+	Errs []error
+}
+
+func (e *PipelineError) Error() string {
+	var parts []string
+	for i, err := range e.Errs {
+		if err != nil {
+			parts = append(parts, fmt.Sprintf("command %d: %s", i+1, err))
+		}
+	}
+	return "pipeline failed: " + strings.Join(parts, "; ")
+}
+
+// Unwrap returns the errors of the commands that failed.
+func (e *PipelineError) Unwrap() []error {
+	var errs []error
+	for _, err := range e.Errs {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Pipeline runs the commands, created with Command or CommandContext for the
+// session, as a shell pipeline: the output of each one is the input of the
+// next, the first one reads the session, or its PTY, and the last one writes
+// to it. They all write their errors to it.
+//
+// It waits for all of them to exit, and returns a *PipelineError if any
+// failed, see ExitStatus to get the exit status of the pipeline. The client's
+// signals are forwarded to all of them. With a PTY, the first one is the
+// session leader, so ^C interrupts it, and the others usually exit as their
+// input is closed.
+func Pipeline(s ssh.Session, cmds ...*Cmd) error {
+	if len(cmds) == 0 {
+		return nil
+	}
+	for _, c := range cmds {
+		defer c.cancel()
+	}
+
+	var tty *os.File
+	if ppty, _, ok := s.Pty(); ok && !s.EmulatedPty() {
+		tty = ptyFile(ppty)
+	}
+
+	// the ends of the pipes the commands use, closed once they're started.
+	var ends []io.Closer
+	defer func() {
+		for _, c := range ends {
+			_ = c.Close()
+		}
+	}()
+	for i := 1; i < len(cmds); i++ {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return err
+		}
+		ends = append(ends, r, w)
+		cmds[i-1].cmd.Stdout = w
+		cmds[i].cmd.Stdin = r
+	}
+	first, last := cmds[0], cmds[len(cmds)-1]
+	var stdin io.WriteCloser
+	if tty != nil {
+		first.cmd.Stdin, last.cmd.Stdout = tty, tty
+	} else {
+		var err error
+		if stdin, err = first.cmd.StdinPipe(); err != nil {
+			return err
+		}
+		last.cmd.Stdout = s
+	}
+	for i, c := range cmds {
+		c.cmd.Stderr = s
+		if tty != nil {
+			c.cmd.Stderr = tty
+		}
+		setProcessGroup(c.cmd, tty != nil && i == 0)
+	}
+
+	for i, c := range cmds {
+		if err := c.cmd.Start(); err != nil {
+			// don't leave the started commands behind.
+			for _, c := range cmds[:i] {
+				signalProcess(c.cmd, ssh.SIGKILL)
+				_ = c.cmd.Wait()
+			}
+			return c.result(err)
+		}
+	}
+	for _, c := range ends {
+		_ = c.Close()
+	}
+	ends = nil
+	if stdin != nil {
+		// not waited for, see runNoPty.
+		go func() {
+			_, _ = io.Copy(stdin, s)
+			_ = stdin.Close()
+		}()
+	}
+
+	errs := waitAll(s, cmds)
+	failed := false
+	for i, c := range cmds {
+		errs[i] = c.result(errs[i])
+		failed = failed || errs[i] != nil
+	}
+	if failed {
+		return &PipelineError{Errs: errs}
+	}
+	return nil
+}
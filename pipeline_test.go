@@ -0,0 +1,108 @@
+package wish
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestPipeline(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	for name, pty := range map[string]bool{"pty": true, "no pty": false} {
+		pty := pty
+		t.Run(name, func(t *testing.T) {
+			srv := &ssh.Server{
+				Handler: func(s ssh.Session) {
+					err := Pipeline(s,
+						Command(s, "printf", `b\na\n`),
+						Command(s, "sort"),
+						Command(s, "tr", "a-z", "A-Z"),
+					)
+					if err != nil {
+						Fatal(s, err)
+					}
+					// let the PTY output reach the client, see TestCommandPty.
+					time.Sleep(100 * time.Millisecond)
+				},
+			}
+			requireNoError(t, ssh.AllocatePty()(srv))
+			sess := testsession.New(t, srv, nil)
+			if pty {
+				requireNoError(t, sess.RequestPty("xterm", 24, 80, nil))
+			}
+			var stdout bytes.Buffer
+			sess.Stdout = &stdout
+			requireNoError(t, sess.Run(""))
+			out := strings.ReplaceAll(stdout.String(), "\r\n", "\n")
+			requireEqual(t, "A\nB\n", out)
+		})
+	}
+}
+
+func TestPipelineStdin(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	sess := testsession.New(t, &ssh.Server{
+		Handler: func(s ssh.Session) {
+			if err := Pipeline(s, Command(s, "cat"), Command(s, "tr", "a-z", "A-Z")); err != nil {
+				Fatal(s, err)
+			}
+		},
+	}, nil)
+	sess.Stdin = strings.NewReader("hey")
+	out, err := sess.Output("")
+	requireNoError(t, err)
+	requireEqual(t, "HEY", string(out))
+}
+
+func TestPipelineError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	errs := make(chan error, 1)
+	sess := testsession.New(t, &ssh.Server{
+		Handler: func(s ssh.Session) {
+			errs <- Pipeline(s,
+				Command(s, "sh", "-c", "exit 3"),
+				Command(s, "sh", "-c", "cat; exit 5"),
+				Command(s, "cat"),
+			)
+		},
+	}, nil)
+	requireNoError(t, sess.Run(""))
+
+	err := <-errs
+	var perr *PipelineError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a pipeline error, got %v", err)
+	}
+	requireEqual(t, 3, len(perr.Errs))
+	requireEqual(t, 3, ExitStatus(perr.Errs[0]))
+	requireEqual(t, nil, perr.Errs[2])
+	requireEqual(t, 5, ExitStatus(err))
+}
+
+func TestPipelineStartError(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip()
+	}
+	errs := make(chan error, 1)
+	sess := testsession.New(t, &ssh.Server{
+		Handler: func(s ssh.Session) {
+			errs <- Pipeline(s, Command(s, "sleep", "10"), Command(s, "nopenopenope"))
+		},
+	}, nil)
+	requireNoError(t, sess.Run(""))
+	if err := <-errs; err == nil || !strings.Contains(err.Error(), "nopenopenope") {
+		t.Errorf("expected a start error, got %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+package wish
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+// proxyHeaderTimeout is how long proxies have to send their PROXY header.
+const proxyHeaderTimeout = 5 * time.Second
+
+// proxyV2Signature starts PROXY protocol v2 headers.
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// WithProxyProtocol returns an ssh.Option that reads the PROXY protocol
+// header, v1 or v2, sent by load balancers like HAProxy in front of the
+// server, so s.RemoteAddr() is the address of the client rather than the one
+// of the proxy.
+//
+// Only connections from the given trusted networks, in CIDR notation, are
+// expected to send a header: they are rejected if they don't. Other
+// connections are served as they are.
+//
+// Connection callbacks run in the reverse order options are set in, so set it
+// after options looking at the remote address, e.g. WithAllowedNetworks.
+func WithProxyProtocol(trustedCIDRs ...string) ssh.Option {
+	return func(s *ssh.Server) error {
+		if len(trustedCIDRs) == 0 {
+			return errors.New("proxy protocol: no trusted network")
+		}
+		trusted := make([]netip.Prefix, 0, len(trustedCIDRs))
+		for _, cidr := range trustedCIDRs {
+			p, err := netip.ParsePrefix(cidr)
+			if err != nil {
+				return fmt.Errorf("proxy protocol: %w", err)
+			}
+			trusted = append(trusted, p.Masked())
+		}
+		next := s.ConnCallback
+		s.ConnCallback = func(ctx ssh.Context, conn net.Conn) net.Conn {
+			if allowed(trusted, conn.RemoteAddr()) {
+				pc, err := readProxyHeader(conn)
+				if err != nil {
+					log.Warn("rejecting connection with an invalid proxy header", "remote-addr", conn.RemoteAddr(), "error", err)
+					return nil
+				}
+				conn = pc
+			}
+			if next != nil {
+				return next(ctx, conn)
+			}
+			return conn
+		}
+		return nil
+	}
+}
+
+// proxyConn is a connection with the remote address read from its PROXY
+// header.
+type proxyConn struct {
+	net.Conn
+	r      *bufio.Reader
+	remote net.Addr
+}
+
+func (c *proxyConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// NetConn returns the underlying connection.
+func (c *proxyConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+func readProxyHeader(conn net.Conn) (net.Conn, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout)); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	// v1 headers are longer than the v2 signature too.
+	sig, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return nil, err
+	}
+	var remote net.Addr
+	if bytes.Equal(sig, proxyV2Signature) {
+		remote, err = readProxyV2(r)
+	} else {
+		remote, err = readProxyV1(r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, err
+	}
+	if remote == nil {
+		// health checks from the proxy itself.
+		remote = conn.RemoteAddr()
+	}
+	return &proxyConn{Conn: conn, r: r, remote: remote}, nil
+}
+
+// readProxyV1 reads a v1 header, e.g.
+// "PROXY TCP4 192.0.2.1 192.0.2.2 56324 22\r\n".
+func readProxyV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	header := string(line)
+	if !strings.HasPrefix(header, "PROXY ") || !strings.HasSuffix(header, "\r\n") {
+		return nil, errors.New("invalid v1 header")
+	}
+	fields := strings.Fields(header)
+	if fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, errors.New("invalid v1 header")
+	}
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 source address: %w", err)
+	}
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid v1 source port: %w", err)
+	}
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, uint16(port))), nil
+}
+
+// readProxyV2 reads a binary v2 header.
+func readProxyV2(r *bufio.Reader) (net.Addr, error) {
+	var header [16]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, errors.New("invalid v2 version")
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	if header[12]&0xF == 0 {
+		// LOCAL command, from the proxy itself.
+		return nil, nil
+	}
+	var ipLen int
+	switch header[13] {
+	case 0x11: // TCP over IPv4
+		ipLen = 4
+	case 0x21: // TCP over IPv6
+		ipLen = 16
+	default:
+		return nil, nil
+	}
+	if len(body) < 2*ipLen+4 {
+		return nil, errors.New("invalid v2 addresses")
+	}
+	ip, _ := netip.AddrFromSlice(body[:ipLen])
+	port := binary.BigEndian.Uint16(body[2*ipLen:])
+	return net.TCPAddrFromAddrPort(netip.AddrPortFrom(ip, port)), nil
+}
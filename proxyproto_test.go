@@ -0,0 +1,87 @@
+package wish
+
+import (
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func proxyV2Header(src netip.AddrPort) []byte {
+	header := append([]byte(nil), proxyV2Signature...)
+	header = append(header, 0x21, 0x21, 0, 36) // v2 PROXY, TCP over IPv6
+	ip := src.Addr().As16()
+	header = append(header, ip[:]...)
+	header = append(header, make([]byte, 16)...)
+	header = binary.BigEndian.AppendUint16(header, src.Port())
+	return binary.BigEndian.AppendUint16(header, 22)
+}
+
+func TestWithProxyProtocol(t *testing.T) {
+	newServer := func(trusted string) string {
+		srv := &ssh.Server{
+			Handler: func(s ssh.Session) {
+				Print(s, s.RemoteAddr().String())
+			},
+		}
+		requireNoError(t, WithProxyProtocol(trusted)(srv))
+		return testsession.Listen(t, srv)
+	}
+	run := func(addr string, header []byte) (string, error) {
+		conn, err := net.Dial("tcp", addr)
+		requireNoError(t, err)
+		t.Cleanup(func() { _ = conn.Close() })
+		if header != nil {
+			_, err = conn.Write(header)
+			requireNoError(t, err)
+		}
+		cc, chans, reqs, err := gossh.NewClientConn(conn, addr, &gossh.ClientConfig{
+			User:            "testuser",
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+		})
+		if err != nil {
+			return "", err
+		}
+		sess, err := gossh.NewClient(cc, chans, reqs).NewSession()
+		requireNoError(t, err)
+		out, err := sess.Output("")
+		return string(out), err
+	}
+
+	trusted := newServer("127.0.0.0/8")
+	for name, tc := range map[string]struct {
+		header   []byte
+		expected string
+	}{
+		"v1":         {[]byte("PROXY TCP4 192.0.2.1 192.0.2.2 56324 22\r\n"), "192.0.2.1:56324"},
+		"v1 unknown": {[]byte("PROXY UNKNOWN\r\n"), "127.0.0.1:"},
+		"v2":         {proxyV2Header(netip.MustParseAddrPort("[2001:db8::1]:1234")), "[2001:db8::1]:1234"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			out, err := run(trusted, tc.header)
+			requireNoError(t, err)
+			if !strings.HasPrefix(out, tc.expected) {
+				t.Errorf("expected %q, got %q", tc.expected, out)
+			}
+		})
+	}
+
+	t.Run("missing header", func(t *testing.T) {
+		if _, err := run(trusted, nil); err == nil {
+			t.Error("expected the connection to be rejected")
+		}
+	})
+
+	t.Run("untrusted", func(t *testing.T) {
+		out, err := run(newServer("10.0.0.0/8"), nil)
+		requireNoError(t, err)
+		if !strings.HasPrefix(out, "127.0.0.1:") {
+			t.Errorf("expected the proxy address, got %q", out)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package ratelimiter
+
+import (
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/log"
+	lru "github.com/hashicorp/golang-lru/v2"
+	gossh "golang.org/x/crypto/ssh"
+	"golang.org/x/time/rate"
+)
+
+// Costs maps commands, by their first word, to their cost. The empty command
+// is the interactive shell.
+type Costs map[string]int
+
+// NewCostLimiter returns a new RateLimiter that deducts the cost of each
+// command from a per-user budget, refilled at rate r up to budget, so that
+// expensive commands are bounded without blocking cheap ones. Commands not in
+// costs cost defaultCost, and commands costing more than budget are never
+// allowed.
+//
+// Users are identified by their public key fingerprint, falling back to their
+// user name, and it keeps the budget of maxEntries users.
+func NewCostLimiter(r rate.Limit, budget int, costs Costs, defaultCost int, maxEntries int) RateLimiter {
+	if maxEntries <= 0 {
+		maxEntries = 1
+	}
+	// only possible error is if maxEntries is <= 0, which is prevented above.
+	cache, _ := lru.New[string, *rate.Limiter](maxEntries)
+	return &costLimiter{
+		rate:        r,
+		budget:      budget,
+		costs:       costs,
+		defaultCost: defaultCost,
+		cache:       cache,
+	}
+}
+
+type costLimiter struct {
+	cache       *lru.Cache[string, *rate.Limiter]
+	rate        rate.Limit
+	budget      int
+	costs       Costs
+	defaultCost int
+}
+
+func (c *costLimiter) Allow(s ssh.Session) error {
+	key := "user:" + s.User()
+	if pk := s.PublicKey(); pk != nil {
+		key = gossh.FingerprintSHA256(pk)
+	}
+	var cmd string
+	if args := s.Command(); len(args) > 0 {
+		cmd = args[0]
+	}
+	cost, ok := c.costs[cmd]
+	if !ok {
+		cost = c.defaultCost
+	}
+
+	limiter, ok := c.cache.Get(key)
+	if !ok {
+		limiter = rate.NewLimiter(c.rate, c.budget)
+		c.cache.Add(key, limiter)
+	}
+	allowed := limiter.AllowN(time.Now(), cost)
+	log.Debug("cost limiter key", "key", key, "command", cmd, "cost", cost, "allowed", allowed)
+	if allowed {
+		return nil
+	}
+	return ErrRateLimitExceeded
+}
@@ -0,0 +1,100 @@
+package ratelimiter
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+	"golang.org/x/time/rate"
+)
+
+// ErrInputRateExceeded happens when a session was disconnected for sending
+// input too fast.
+var ErrInputRateExceeded = errors.New("input rate limit exceeded")
+
+// InputAction is what happens to sessions sending input too fast.
+type InputAction int
+
+const (
+	// Throttle delays reading input until the rate allows it.
+	Throttle InputAction = iota
+
+	// Disconnect ends the session with ErrInputRateExceeded.
+	Disconnect
+)
+
+// LimitInput returns an input filter limiting the input of a session to r
+// bytes per second, with bursts of at most burst bytes, which must be
+// positive, so that bots holding
+// a single session can't spam it with input. Keystrokes are a byte or a few,
+// pastes many more.
+//
+// It's meant to be used with bubbletea.WithInputFilter, for sessions with a
+// PTY; use InputMiddleware otherwise.
+func LimitInput(r rate.Limit, burst int, action InputAction) func(ssh.Session, io.Reader) io.Reader {
+	return func(s ssh.Session, in io.Reader) io.Reader {
+		return &inputReader{
+			s:       s,
+			r:       in,
+			limiter: rate.NewLimiter(r, burst),
+			action:  action,
+		}
+	}
+}
+
+// InputMiddleware limits the input the next handlers read from the session,
+// like LimitInput.
+//
+// Input going through an allocated PTY isn't read from the session, so it
+// isn't limited.
+func InputMiddleware(r rate.Limit, burst int, action InputAction) wish.Middleware {
+	limit := LimitInput(r, burst, action)
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			sh(&inputSession{Session: s, r: limit(s, s)})
+		}
+	}
+}
+
+type inputSession struct {
+	ssh.Session
+	r io.Reader
+}
+
+func (s *inputSession) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+type inputReader struct {
+	s       ssh.Session
+	r       io.Reader
+	limiter *rate.Limiter
+	action  InputAction
+}
+
+func (r *inputReader) Read(p []byte) (int, error) {
+	// never read more than a burst, so it can always be allowed eventually.
+	if burst := r.limiter.Burst(); len(p) > burst {
+		p = p[:burst]
+	}
+	n, err := r.r.Read(p)
+	if n == 0 {
+		return n, err
+	}
+	switch r.action {
+	case Disconnect:
+		if !r.limiter.AllowN(time.Now(), n) {
+			log.Warn("input rate limit exceeded", "user", r.s.User(), "remote", r.s.RemoteAddr().String())
+			wish.Exit(r.s, 1, ErrInputRateExceeded.Error())
+			return 0, ErrInputRateExceeded
+		}
+	default:
+		if werr := r.limiter.WaitN(r.s.Context(), n); werr != nil {
+			return 0, werr
+		}
+	}
+	return n, err
+}
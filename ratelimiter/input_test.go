@@ -0,0 +1,58 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+	"golang.org/x/time/rate"
+)
+
+func TestInputMiddleware(t *testing.T) {
+	newServer := func(r rate.Limit, action InputAction) *ssh.Server {
+		return &ssh.Server{
+			Handler: InputMiddleware(r, 10, action)(func(s ssh.Session) {
+				start := time.Now()
+				bts, err := io.ReadAll(s)
+				if err != nil {
+					return
+				}
+				wish.Printf(s, "%d %d", len(bts), time.Since(start).Milliseconds())
+			}),
+		}
+	}
+
+	t.Run("throttle", func(t *testing.T) {
+		sess := testsession.New(t, newServer(1000, Throttle), nil)
+		sess.Stdin = strings.NewReader(strings.Repeat("a", 100))
+		out, err := sess.Output("")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n, ms int
+		if _, err := fmt.Sscanf(string(out), "%d %d", &n, &ms); err != nil {
+			t.Fatalf("unexpected output %q: %v", out, err)
+		}
+		if n != 100 || ms < 80 {
+			t.Errorf("expected 100 bytes read in at least 80ms, got %d in %dms", n, ms)
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		sess := testsession.New(t, newServer(rate.Every(time.Hour), Disconnect), nil)
+		sess.Stdin = strings.NewReader(strings.Repeat("a", 20))
+		var stderr strings.Builder
+		sess.Stderr = &stderr
+		if err := sess.Run(""); err == nil {
+			t.Error("expected an error")
+		}
+		if !strings.Contains(stderr.String(), ErrInputRateExceeded.Error()) {
+			t.Errorf("unexpected stderr %q", stderr.String())
+		}
+	})
+}
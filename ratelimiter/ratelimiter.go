@@ -5,11 +5,11 @@ package ratelimiter
 
 import (
 	"errors"
-	"net"
 
-	"github.com/charmbracelet/log"
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+	"github.com/charmbracelet/wish/internal/netaddr"
 	lru "github.com/hashicorp/golang-lru/v2"
 	"golang.org/x/time/rate"
 )
@@ -30,7 +30,7 @@ func Middleware(limiter RateLimiter) wish.Middleware {
 	return func(sh ssh.Handler) ssh.Handler {
 		return func(s ssh.Session) {
 			if err := limiter.Allow(s); err != nil {
-				wish.Fatal(s, err)
+				wish.Exit(s, 1, err.Error())
 				return
 			}
 
@@ -39,39 +39,51 @@ func Middleware(limiter RateLimiter) wish.Middleware {
 	}
 }
 
+// Option configures a RateLimiter.
+type Option func(*limiters)
+
+// WithIPv6PrefixLen sets the prefix IPv6 clients are limited by. It defaults
+// to 64, as a single IPv6 host is usually assigned a whole /64. Use 128 to
+// limit every address on its own.
+func WithIPv6PrefixLen(bits int) Option {
+	return func(l *limiters) {
+		l.v6PrefixLen = bits
+	}
+}
+
 // NewRateLimiter returns a new RateLimiter that allows events up to rate rate,
 // permits bursts of at most burst tokens and keeps a cache of maxEntries
 // limiters.
 //
 // Internally, it creates a LRU Cache of *rate.Limiter, in which the key is
-// the remote IP address.
-func NewRateLimiter(r rate.Limit, burst int, maxEntries int) RateLimiter {
+// the remote IP address, or its /64 prefix for IPv6 addresses.
+func NewRateLimiter(r rate.Limit, burst int, maxEntries int, opts ...Option) RateLimiter {
 	if maxEntries <= 0 {
 		maxEntries = 1
 	}
 	// only possible error is if maxEntries is <= 0, which is prevented above.
 	cache, _ := lru.New[string, *rate.Limiter](maxEntries)
-	return &limiters{
-		rate:  r,
-		burst: burst,
-		cache: cache,
+	l := &limiters{
+		rate:        r,
+		burst:       burst,
+		cache:       cache,
+		v6PrefixLen: netaddr.DefaultIPv6PrefixLen,
+	}
+	for _, opt := range opts {
+		opt(l)
 	}
+	return l
 }
 
 type limiters struct {
-	cache *lru.Cache[string, *rate.Limiter]
-	rate  rate.Limit
-	burst int
+	cache       *lru.Cache[string, *rate.Limiter]
+	rate        rate.Limit
+	burst       int
+	v6PrefixLen int
 }
 
 func (r *limiters) Allow(s ssh.Session) error {
-	var key string
-	switch addr := s.RemoteAddr().(type) {
-	case *net.TCPAddr:
-		key = addr.IP.String()
-	default:
-		key = addr.String()
-	}
+	key := netaddr.Key(s.RemoteAddr(), r.v6PrefixLen)
 
 	var allowed bool
 	limiter, ok := r.cache.Get(key)
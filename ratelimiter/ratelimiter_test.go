@@ -1,11 +1,13 @@
 package ratelimiter
 
 import (
+	"net"
 	"testing"
 	"time"
 
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/time/rate"
 )
@@ -73,3 +75,77 @@ func TestRateLimiter(t *testing.T) {
 		t.Fatalf("expected no errors, got %v", err)
 	}
 }
+
+func TestCostLimiter(t *testing.T) {
+	s := &ssh.Server{
+		Handler: Middleware(NewCostLimiter(rate.Every(time.Hour), 12, Costs{
+			"git-upload-pack": 10,
+			"huge":            100,
+		}, 1, 10))(func(s ssh.Session) {
+			// noop
+		}),
+	}
+	addr := testsession.Listen(t, s)
+
+	run := func(user, cmd string) error {
+		sess, err := testsession.NewClientSession(t, addr, &gossh.ClientConfig{User: user})
+		if err != nil {
+			t.Fatalf("expected no errors, got %v", err)
+		}
+		return sess.Run(cmd)
+	}
+
+	if err := run("foo", "huge"); err == nil {
+		t.Error("expected commands costing more than the budget to be denied")
+	}
+	if err := run("foo", "git-upload-pack repo"); err != nil {
+		t.Errorf("expected no errors, got %v", err)
+	}
+	if err := run("foo", "git-upload-pack repo"); err == nil {
+		t.Error("expected the budget to be exhausted")
+	}
+	// cheap commands still fit in the remaining budget.
+	for _, cmd := range []string{"stats", ""} {
+		if err := run("foo", cmd); err != nil {
+			t.Errorf("expected no errors running %q, got %v", cmd, err)
+		}
+	}
+	if err := run("foo", "stats"); err == nil {
+		t.Error("expected the budget to be exhausted")
+	}
+	// budgets are per user.
+	if err := run("bar", "git-upload-pack repo"); err != nil {
+		t.Errorf("expected no errors, got %v", err)
+	}
+}
+
+type addrSession struct {
+	ssh.Session
+	addr net.Addr
+}
+
+func (s addrSession) RemoteAddr() net.Addr { return s.addr }
+
+func TestRateLimiterIPv6Prefix(t *testing.T) {
+	from := func(ip string) ssh.Session {
+		return addrSession{addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 22}}
+	}
+
+	l := NewRateLimiter(rate.Every(time.Hour), 1, 10)
+	if err := l.Allow(from("2001:db8::1")); err != nil {
+		t.Fatalf("expected no errors, got %v", err)
+	}
+	if err := l.Allow(from("2001:db8::2")); err == nil {
+		t.Error("expected addresses in the same /64 to share a limit")
+	}
+	if err := l.Allow(from("2001:db8:0:1::1")); err != nil {
+		t.Errorf("expected another /64 to have its own limit, got %v", err)
+	}
+
+	l = NewRateLimiter(rate.Every(time.Hour), 1, 10, WithIPv6PrefixLen(128))
+	for _, ip := range []string{"2001:db8::1", "2001:db8::2"} {
+		if err := l.Allow(from(ip)); err != nil {
+			t.Errorf("expected no errors for %s, got %v", ip, err)
+		}
+	}
+}
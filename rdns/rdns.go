@@ -0,0 +1,139 @@
+// Package rdns provides a middleware resolving the hostname of clients, from
+// their PTR records, for logging and auditing.
+package rdns
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+	"github.com/charmbracelet/wish/internal/netaddr"
+	"github.com/hashicorp/golang-lru/v2/expirable"
+	"golang.org/x/sync/singleflight"
+)
+
+// Option configures a Resolver.
+type Option func(*Resolver)
+
+// WithTimeout sets how long a lookup can take before giving up. It defaults
+// to 500ms.
+func WithTimeout(d time.Duration) Option {
+	return func(r *Resolver) {
+		r.timeout = d
+	}
+}
+
+// WithCache sets the number of lookups cached, and for how long. It defaults
+// to 1024 lookups, for 10 minutes. Failed lookups are cached too.
+func WithCache(size int, ttl time.Duration) Option {
+	return func(r *Resolver) {
+		r.cacheSize = size
+		r.ttl = ttl
+	}
+}
+
+// WithLookup sets the function used to look up the names of an address. It
+// defaults to net.DefaultResolver.LookupAddr.
+func WithLookup(lookup func(ctx context.Context, addr string) ([]string, error)) Option {
+	return func(r *Resolver) {
+		r.lookup = lookup
+	}
+}
+
+// Resolver resolves and caches the hostnames of IP addresses. It's safe for
+// concurrent use.
+type Resolver struct {
+	timeout   time.Duration
+	cacheSize int
+	ttl       time.Duration
+	lookup    func(ctx context.Context, addr string) ([]string, error)
+	cache     *expirable.LRU[string, string]
+	group     singleflight.Group
+	disabled  atomic.Bool
+}
+
+// New returns a new Resolver with the given options.
+func New(opts ...Option) *Resolver {
+	r := &Resolver{
+		timeout:   500 * time.Millisecond,
+		cacheSize: 1024,
+		ttl:       10 * time.Minute,
+		lookup:    net.DefaultResolver.LookupAddr,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.cache = expirable.NewLRU[string, string](r.cacheSize, nil, r.ttl)
+	return r
+}
+
+// SetEnabled turns lookups on or off. While they're off, Lookup returns no
+// hostname, without querying the DNS. Resolvers are enabled by default.
+func (r *Resolver) SetEnabled(enabled bool) {
+	r.disabled.Store(!enabled)
+}
+
+// Lookup returns the hostname of the given address, without its trailing
+// dot, or false if it has none, the lookup failed or timed out, or lookups
+// are turned off.
+func (r *Resolver) Lookup(ctx context.Context, addr net.Addr) (string, bool) {
+	if r.disabled.Load() {
+		return "", false
+	}
+	ip, ok := netaddr.IP(addr)
+	if !ok {
+		return "", false
+	}
+	key := ip.String()
+	if host, ok := r.cache.Get(key); ok {
+		return host, host != ""
+	}
+
+	v, _, _ := r.group.Do(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+		var host string
+		names, err := r.lookup(ctx, key)
+		if err != nil {
+			log.Debug("could not look up hostname", "addr", key, "error", err)
+		} else if len(names) > 0 {
+			host = strings.TrimSuffix(names[0], ".")
+		}
+		r.cache.Add(key, host)
+		return host, nil
+	})
+	host := v.(string)
+	return host, host != ""
+}
+
+type hostnameKey struct{}
+
+// Middleware resolves the hostname of the client when its connection opens
+// its first session. It's then available to the middlewares it runs before,
+// e.g. logging, with Hostname.
+func Middleware(r *Resolver) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			ctx := s.Context()
+			ctx.Lock()
+			if _, ok := ctx.Value(hostnameKey{}).(string); !ok {
+				host, _ := r.Lookup(ctx, s.RemoteAddr())
+				ctx.SetValue(hostnameKey{}, host)
+			}
+			ctx.Unlock()
+			sh(s)
+		}
+	}
+}
+
+// Hostname returns the hostname of the client resolved by the middleware, if
+// any.
+func Hostname(ctx ssh.Context) (string, bool) {
+	host, _ := ctx.Value(hostnameKey{}).(string)
+	return host, host != ""
+}
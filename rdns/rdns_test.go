@@ -0,0 +1,118 @@
+package rdns_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/logging"
+	"github.com/charmbracelet/wish/rdns"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestResolver(t *testing.T) {
+	var calls atomic.Int64
+	r := rdns.New(
+		rdns.WithTimeout(50*time.Millisecond),
+		rdns.WithLookup(func(ctx context.Context, addr string) ([]string, error) {
+			calls.Add(1)
+			switch addr {
+			case "192.0.2.1":
+				return []string{"host.example.com."}, nil
+			case "192.0.2.2":
+				<-ctx.Done()
+				return nil, ctx.Err()
+			default:
+				return nil, errors.New("no such host")
+			}
+		}),
+	)
+	lookup := func(ip string) (string, bool) {
+		return r.Lookup(context.Background(), &net.TCPAddr{IP: net.ParseIP(ip), Port: 22})
+	}
+
+	for i := 0; i < 2; i++ {
+		if host, ok := lookup("192.0.2.1"); !ok || host != "host.example.com" {
+			t.Errorf("expected host.example.com, got %q", host)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected the lookup to be cached, got %d calls", n)
+	}
+
+	start := time.Now()
+	if host, ok := lookup("192.0.2.2"); ok {
+		t.Errorf("expected the lookup to time out, got %q", host)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expected the lookup to time out quickly, took %s", d)
+	}
+	if _, ok := lookup("192.0.2.3"); ok {
+		t.Error("expected no hostname")
+	}
+
+	r.SetEnabled(false)
+	if _, ok := lookup("192.0.2.1"); ok {
+		t.Error("expected lookups to be turned off")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	var out lines
+	r := rdns.New(rdns.WithLookup(func(context.Context, string) ([]string, error) {
+		return []string{"localhost."}, nil
+	}))
+	srv := &ssh.Server{}
+	requireNoError(t, wish.WithMiddleware(
+		func(ssh.Handler) ssh.Handler {
+			return func(s ssh.Session) {
+				host, _ := rdns.Hostname(s.Context())
+				wish.Print(s, host)
+			}
+		},
+		logging.MiddlewareWithLogger(&out),
+		rdns.Middleware(r),
+	)(srv))
+
+	sess := testsession.New(t, srv, nil)
+	got, err := sess.Output("")
+	requireNoError(t, err)
+	if string(got) != "localhost" {
+		t.Errorf("expected localhost, got %q", got)
+	}
+	if l := out.get(); len(l) == 0 || !strings.Contains(l[0], "(localhost)") {
+		t.Errorf("expected the hostname to be logged, got %q", l)
+	}
+}
+
+type lines struct {
+	mu sync.Mutex
+	l  []string
+}
+
+func (l *lines) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.l = append(l.l, fmt.Sprintf(format, v...))
+}
+
+func (l *lines) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.l...)
+}
+
+func requireNoError(tb testing.TB, err error) {
+	tb.Helper()
+	if err != nil {
+		tb.Fatalf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package wish
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+var (
+	// ErrReauthFailed is returned by Reauthenticate when the user failed to
+	// authenticate again, or gave up with ^C or ^D.
+	ErrReauthFailed = errors.New("reauthentication failed")
+
+	// ErrReauthUnavailable is returned by Reauthenticate when the session
+	// has no PTY to prompt the user in, or the server has neither a
+	// keyboard-interactive nor a password handler.
+	ErrReauthUnavailable = errors.New("reauthentication unavailable")
+)
+
+// Reauthenticate asks the user to authenticate again in the session, before a
+// sensitive action like deleting a repository, and returns nil if they did.
+//
+// SSH only authenticates users when they connect, so the challenge is shown in
+// the session itself, with the server's own handlers: the
+// KeyboardInteractiveHandler if there's one, e.g. asking for a TOTP code, or
+// else the PasswordHandler. The reason is shown to the user first. Failures
+// are logged as warnings, so they end up in the event log.
+//
+// The session must have a PTY, and nothing else may be reading its input at
+// the same time, e.g. a Bubble Tea program should call it with tea.Exec. With
+// an allocated PTY, see ssh.AllocatePty, the prompt reads from and writes to
+// the PTY, in raw mode until it's done.
+func Reauthenticate(s ssh.Session, reason string) error {
+	ctx := s.Context()
+	srv, _ := ctx.Value(ssh.ContextKeyServer).(*ssh.Server)
+	if _, _, ok := s.Pty(); !ok || srv == nil {
+		return ErrReauthUnavailable
+	}
+
+	rw, restore := promptIO(s)
+	defer restore()
+	nl := newline(s)
+
+	var ok bool
+	var err error
+	switch {
+	case srv.KeyboardInteractiveHandler != nil:
+		_, _ = io.WriteString(rw, reason+nl)
+		ok = srv.KeyboardInteractiveHandler(ctx, func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+			for _, line := range []string{name, instruction} {
+				if line != "" {
+					_, _ = io.WriteString(rw, line+nl)
+				}
+			}
+			answers := make([]string, len(questions))
+			for i, q := range questions {
+				_, _ = io.WriteString(rw, q)
+				answers[i], err = readLine(rw, nl, i < len(echos) && echos[i])
+				if err != nil {
+					return nil, err
+				}
+			}
+			return answers, nil
+		})
+	case srv.PasswordHandler != nil:
+		_, _ = io.WriteString(rw, reason+nl+"Password: ")
+		var password string
+		if password, err = readLine(rw, nl, false); err == nil {
+			ok = srv.PasswordHandler(ctx, password)
+		}
+	default:
+		return ErrReauthUnavailable
+	}
+
+	if err == nil && ok {
+		log.Debug("reauthenticated", "user", ctx.User(), "remote-addr", ctx.RemoteAddr(), "reason", reason)
+		return nil
+	}
+	log.Warn("reauthentication failed", "user", ctx.User(), "remote-addr", ctx.RemoteAddr(), "reason", reason)
+	if err != nil && !errors.Is(err, ErrReauthFailed) {
+		return fmt.Errorf("%w: %s", ErrReauthFailed, err)
+	}
+	return ErrReauthFailed
+}
+
+// readLine reads a line typed in the session, echoing it as is, or as
+// asterisks, and then the new line nl. It reads a byte at a time, so nothing
+// typed after the line is consumed.
+func readLine(rw io.ReadWriter, nl string, echo bool) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := rw.Read(b); err != nil {
+			return "", err
+		}
+		switch c := b[0]; {
+		case c == '\r' || c == '\n':
+			_, _ = io.WriteString(rw, nl)
+			return string(line), nil
+		case c == 0x03 || c == 0x04: // ^C, ^D
+			_, _ = io.WriteString(rw, nl)
+			return "", ErrReauthFailed
+		case c == 0x7f || c == '\b':
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				_, _ = io.WriteString(rw, "\b \b")
+			}
+		case c >= ' ':
+			line = append(line, c)
+			if echo {
+				_, _ = rw.Write(b)
+			} else {
+				_, _ = io.WriteString(rw, "*")
+			}
+		}
+	}
+}
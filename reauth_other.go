@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !netbsd && !openbsd && !solaris
+// +build !linux,!darwin,!freebsd,!dragonfly,!netbsd,!openbsd,!solaris
+
+package wish
+
+import (
+	"io"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// promptIO returns what to prompt the user through, and a function restoring
+// it afterwards.
+func promptIO(s ssh.Session) (io.ReadWriter, func()) {
+	return s, func() {}
+}
@@ -0,0 +1,112 @@
+package wish
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestReauthenticate(t *testing.T) {
+	totp := func(ctx ssh.Context, challenge gossh.KeyboardInteractiveChallenge) bool {
+		answers, err := challenge("", "Two-factor authentication", []string{"Code: "}, []bool{true})
+		return err == nil && len(answers) == 1 && answers[0] == "123456"
+	}
+	password := func(_ ssh.Context, password string) bool {
+		return password == "secret"
+	}
+	handler := func(s ssh.Session) {
+		if err := Reauthenticate(s, "Deleting the repository."); err != nil {
+			Print(s, err)
+			return
+		}
+		Print(s, "deleted")
+	}
+
+	run := func(t *testing.T, srv *ssh.Server, auth gossh.AuthMethod, pty bool, stdin string) string {
+		t.Helper()
+		sess := testsession.New(t, srv, &gossh.ClientConfig{
+			User: "testuser",
+			Auth: []gossh.AuthMethod{auth},
+		})
+		if pty {
+			requireNoError(t, sess.RequestPty("xterm", 24, 80, nil))
+		}
+		sess.Stdin = strings.NewReader(stdin)
+		out, err := sess.Output("")
+		requireNoError(t, err)
+		return string(out)
+	}
+
+	kiAuth := gossh.KeyboardInteractive(func(string, string, []string, []bool) ([]string, error) {
+		return []string{"123456"}, nil
+	})
+	kiServer := func() *ssh.Server {
+		return &ssh.Server{Handler: handler, KeyboardInteractiveHandler: totp}
+	}
+	passwordServer := func() *ssh.Server {
+		return &ssh.Server{Handler: handler, PasswordHandler: password}
+	}
+
+	t.Run("keyboard interactive", func(t *testing.T) {
+		out := run(t, kiServer(), kiAuth, true, "123456\r")
+		for _, s := range []string{"Deleting the repository.", "Two-factor authentication", "Code: 123456", "deleted"} {
+			if !strings.Contains(out, s) {
+				t.Errorf("expected %q in %q", s, out)
+			}
+		}
+	})
+
+	t.Run("wrong code", func(t *testing.T) {
+		out := run(t, kiServer(), kiAuth, true, "654321\r")
+		if !strings.HasSuffix(out, ErrReauthFailed.Error()) {
+			t.Errorf("expected the reauthentication to fail, got %q", out)
+		}
+	})
+
+	t.Run("password", func(t *testing.T) {
+		out := run(t, passwordServer(), gossh.Password("secret"), true, "secrex\x7ft\r")
+		if !strings.HasSuffix(out, "deleted") || strings.Contains(out, "secret") {
+			t.Errorf("expected the password to be accepted without being echoed, got %q", out)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		out := run(t, passwordServer(), gossh.Password("secret"), true, "sec\x03")
+		if !strings.HasSuffix(out, ErrReauthFailed.Error()) {
+			t.Errorf("expected the reauthentication to fail, got %q", out)
+		}
+	})
+
+	t.Run("allocated pty", func(t *testing.T) {
+		srv := passwordServer()
+		srv.Handler = func(s ssh.Session) {
+			err := Reauthenticate(s, "Deleting the repository.")
+			// lets the pty output reach the client first.
+			time.Sleep(100 * time.Millisecond)
+			if err != nil {
+				Print(s, err)
+				return
+			}
+			Print(s, "deleted")
+		}
+		requireNoError(t, ssh.AllocatePty()(srv))
+		out := run(t, srv, gossh.Password("secret"), true, "secret\r")
+		if !strings.HasSuffix(out, "deleted") || strings.Contains(out, "secret") {
+			t.Errorf("expected the password to be read from the pty, got %q", out)
+		}
+		if !strings.Contains(out, "Deleting the repository.\r\nPassword: ******\r\n") {
+			t.Errorf("expected \\r\\n new lines, got %q", out)
+		}
+	})
+
+	t.Run("no pty", func(t *testing.T) {
+		out := run(t, passwordServer(), gossh.Password("secret"), false, "")
+		if out != ErrReauthUnavailable.Error() {
+			t.Errorf("expected %q, got %q", ErrReauthUnavailable, out)
+		}
+	})
+}
@@ -0,0 +1,27 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wish
+
+import (
+	"io"
+
+	"github.com/charmbracelet/ssh"
+	"golang.org/x/term"
+)
+
+// promptIO returns what to prompt the user through, and a function restoring
+// it afterwards. With an allocated PTY, the session's input is already copied
+// to the PTY, so prompts must read from it, or they would race the copy.
+func promptIO(s ssh.Session) (io.ReadWriter, func()) {
+	pty, _, ok := s.Pty()
+	if !ok || s.EmulatedPty() || pty.Slave == nil {
+		return s, func() {}
+	}
+	fd := int(pty.Slave.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return pty.Slave, func() {}
+	}
+	return pty.Slave, func() { _ = term.Restore(fd, state) }
+}
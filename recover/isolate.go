@@ -0,0 +1,98 @@
+package recover
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+// PanicError is a panic recovered by Isolate.
+type PanicError struct {
+	// Middleware is the name of the middleware that panicked, or "handler"
+	// for the handler the chain wraps.
+	Middleware string
+
+	// Value is the value the middleware panicked with.
+	Value interface{}
+
+	// Stack is the stack trace of the panic.
+	Stack []byte
+}
+
+// Error implements error.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in %s: %v", e.Middleware, e.Value)
+}
+
+type panicKey struct{}
+
+// Err returns the last panic Isolate recovered from in the session context,
+// if any. Middlewares can check it after calling the next handler.
+func Err(ctx ssh.Context) *PanicError {
+	err, _ := ctx.Value(panicKey{}).(*PanicError)
+	return err
+}
+
+// Isolate composes the given middlewares like wish.WithMiddleware does,
+// recovering from panics in each of them, and in the handler, individually.
+//
+// A panic ends the part of the session run by the middleware that panicked,
+// and the middlewares before it carry on as if it returned. The panic is
+// logged to the given logger, or the standard one if nil, attributed to the
+// middleware by its position in the chain and its function name, and made
+// available to them with Err.
+func Isolate(logger Logger, mw ...wish.Middleware) wish.Middleware {
+	if logger == nil {
+		logger = log.StandardLog()
+	}
+	return func(sh ssh.Handler) ssh.Handler {
+		h := isolate(logger, "handler", sh)
+		for i, m := range mw {
+			h = isolate(logger, fmt.Sprintf("#%d %s", i+1, funcName(m)), m(h))
+		}
+		return h
+	}
+}
+
+// isolate returns a handler recovering from the panics of h, attributing
+// them to the given name. Panics from handlers h calls are recovered by their
+// own isolation, so what's left is h's own.
+func isolate(logger Logger, name string, h ssh.Handler) ssh.Handler {
+	return func(s ssh.Session) {
+		defer func() {
+			if r := recover(); r != nil {
+				err := &PanicError{
+					Middleware: name,
+					Value:      r,
+					Stack:      debug.Stack(),
+				}
+				logger.Printf("%v\n%s", err, err.Stack)
+				s.Context().SetValue(panicKey{}, err)
+			}
+		}()
+		h(s)
+	}
+}
+
+var closureSuffix = regexp.MustCompile(`(\.func\d+)+$`)
+
+// funcName returns the name of the function that created the middleware,
+// e.g. "activeterm.Middleware".
+func funcName(m wish.Middleware) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(m).Pointer())
+	if fn == nil {
+		return "middleware"
+	}
+	name := closureSuffix.ReplaceAllString(fn.Name(), "")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,98 @@
+package recover
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/activeterm"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestIsolate(t *testing.T) {
+	panicking := func(h ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			panic("boom")
+		}
+	}
+	outer := func(h ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			h(s)
+			if err := Err(s.Context()); err != nil {
+				wish.Print(s, "recovered: ", err.Middleware)
+			}
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		mw      []wish.Middleware
+		handler ssh.Handler
+		out     string
+		logged  string
+	}{
+		"middleware": {
+			mw:      []wish.Middleware{panicking, outer},
+			handler: func(ssh.Session) {},
+			out:     "recovered: #1 recover.TestIsolate",
+			logged:  "panic in #1 recover.TestIsolate: boom",
+		},
+		"handler": {
+			mw:      []wish.Middleware{activeterm.Middleware(), outer},
+			handler: func(ssh.Session) { panic("boom") },
+			out:     "recovered: handler",
+			logged:  "panic in handler: boom",
+		},
+		"none": {
+			mw:      []wish.Middleware{outer},
+			handler: func(s ssh.Session) { wish.Print(s, "ok") },
+			out:     "ok",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var logger logLines
+			srv := &ssh.Server{
+				Handler: Isolate(&logger, tc.mw...)(tc.handler),
+			}
+			sess := testsession.New(t, srv, nil)
+			if name == "handler" {
+				if err := sess.RequestPty("xterm", 24, 80, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			out, err := sess.Output("")
+			requireNoError(t, err)
+			if got := strings.ReplaceAll(string(out), "\r\n", "\n"); got != tc.out {
+				t.Errorf("expected output %q, got %q", tc.out, got)
+			}
+			if logged := logger.String(); !strings.HasPrefix(logged, tc.logged) || (tc.logged == "") != (logged == "") {
+				t.Errorf("expected log to start with %q, got %q", tc.logged, logged)
+			}
+		})
+	}
+}
+
+func TestFuncName(t *testing.T) {
+	if name := funcName(activeterm.Middleware()); name != "activeterm.Middleware" {
+		t.Errorf("unexpected name %q", name)
+	}
+}
+
+type logLines struct {
+	mu sync.Mutex
+	sb strings.Builder
+}
+
+func (l *logLines) Printf(format string, v ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	fmt.Fprintf(&l.sb, format, v...)
+}
+
+func (l *logLines) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sb.String()
+}
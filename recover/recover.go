@@ -3,9 +3,9 @@ package recover
 import (
 	"runtime/debug"
 
-	"github.com/charmbracelet/log"
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
 )
 
 // Middleware is a wish middleware that recovers from panics and log to stderr.
@@ -0,0 +1,152 @@
+package wish
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// Format is the format of a response.
+type Format string
+
+// Formats.
+const (
+	// FormatText is human readable text.
+	FormatText Format = "text"
+
+	// FormatJSON is a single JSON document.
+	FormatJSON Format = "json"
+
+	// FormatNDJSON is newline delimited JSON: each element of a slice is
+	// written as a JSON document on its own line.
+	FormatNDJSON Format = "ndjson"
+)
+
+// FormatEnv is the environment variable scripted clients can set to request a
+// format, e.g. with ssh -o SetEnv=WISH_FORMAT=json.
+const FormatEnv = "WISH_FORMAT"
+
+func parseFormat(s string) (Format, error) {
+	switch f := Format(strings.ToLower(s)); f {
+	case FormatText, FormatJSON, FormatNDJSON:
+		return f, nil
+	case "plain":
+		return FormatText, nil
+	default:
+		return "", fmt.Errorf("unknown format %q, expected text, json or ndjson", s)
+	}
+}
+
+// ParseFormat looks for a --format or -o flag in args, e.g. "--format=json"
+// or "-o ndjson", and returns the format it requests, if any, and the args
+// without it, for handlers to parse their own.
+func ParseFormat(args []string) (Format, []string, error) {
+	rest := make([]string, 0, len(args))
+	var format Format
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		var value string
+		switch {
+		case arg == "--":
+			return format, append(rest, args[i:]...), nil
+		case strings.HasPrefix(arg, "--format="):
+			value = strings.TrimPrefix(arg, "--format=")
+		case arg == "--format" || arg == "-o":
+			if i+1 == len(args) {
+				return "", nil, fmt.Errorf("flag needs an argument: %s", arg)
+			}
+			i++
+			value = args[i]
+		default:
+			rest = append(rest, arg)
+			continue
+		}
+		f, err := parseFormat(value)
+		if err != nil {
+			return "", nil, err
+		}
+		format = f
+	}
+	return format, rest, nil
+}
+
+// FormatOf returns the format the session's client requested: with a format
+// flag in its command, see ParseFormat, or the WISH_FORMAT environment
+// variable. Otherwise, it's text on PTYs, for humans, and JSON for everything
+// else, e.g. scripts.
+func FormatOf(s ssh.Session) Format {
+	if f, _, err := ParseFormat(s.Command()); err == nil && f != "" {
+		return f
+	}
+	for _, kv := range s.Environ() {
+		if strings.HasPrefix(kv, FormatEnv+"=") {
+			if f, err := parseFormat(strings.TrimPrefix(kv, FormatEnv+"=")); err == nil {
+				return f
+			}
+		}
+	}
+	if _, _, ok := s.Pty(); ok {
+		return FormatText
+	}
+	return FormatJSON
+}
+
+// Respond writes v to the session in the format its client requested, see
+// FormatOf.
+//
+// As text, strings and fmt.Stringers are written as they are, slices one
+// element per line, and anything else with the %v verb.
+func Respond(s ssh.Session, v interface{}) error {
+	return RespondFormat(s, FormatOf(s), v)
+}
+
+// RespondFormat writes v to the session in the given format, see Respond.
+func RespondFormat(s ssh.Session, f Format, v interface{}) error {
+	switch f {
+	case FormatJSON:
+		return json.NewEncoder(s).Encode(v)
+	case FormatNDJSON:
+		enc := json.NewEncoder(s)
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return enc.Encode(v)
+		}
+		for i := 0; i < rv.Len(); i++ {
+			if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		_, err := WriteString(s, formatText(v))
+		return err
+	}
+}
+
+func formatText(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return withNewline(v)
+	case fmt.Stringer:
+		return withNewline(v.String())
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+		var sb strings.Builder
+		for i := 0; i < rv.Len(); i++ {
+			sb.WriteString(formatText(rv.Index(i).Interface()))
+		}
+		return sb.String()
+	}
+	return withNewline(fmt.Sprintf("%v", v))
+}
+
+func withNewline(s string) string {
+	if strings.HasSuffix(s, "\n") {
+		return s
+	}
+	return s + "\n"
+}
@@ -0,0 +1,77 @@
+package wish
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestParseFormat(t *testing.T) {
+	for _, tc := range []struct {
+		args   []string
+		format Format
+		rest   []string
+	}{
+		{[]string{"list"}, "", []string{"list"}},
+		{[]string{"list", "--format=json", "-v"}, FormatJSON, []string{"list", "-v"}},
+		{[]string{"-o", "NDJSON", "list"}, FormatNDJSON, []string{"list"}},
+		{[]string{"--format", "plain"}, FormatText, []string{}},
+		{[]string{"run", "--", "-o", "json"}, "", []string{"run", "--", "-o", "json"}},
+	} {
+		format, rest, err := ParseFormat(tc.args)
+		requireNoError(t, err)
+		if format != tc.format || !reflect.DeepEqual(rest, tc.rest) {
+			t.Errorf("%q: expected %q %q, got %q %q", tc.args, tc.format, tc.rest, format, rest)
+		}
+	}
+	for _, args := range [][]string{{"-o"}, {"--format=yaml"}} {
+		if _, _, err := ParseFormat(args); err == nil {
+			t.Errorf("%q: expected an error", args)
+		}
+	}
+}
+
+func TestRespond(t *testing.T) {
+	type item struct {
+		Name string `json:"name"`
+	}
+	items := []item{{"foo"}, {"bar"}}
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			requireNoError(t, Respond(s, items))
+		},
+	}
+	addr := testsession.Listen(t, srv)
+
+	for name, tc := range map[string]struct {
+		cmd      string
+		env      string
+		pty      bool
+		expected string
+	}{
+		"json by default":  {expected: `[{"name":"foo"},{"name":"bar"}]` + "\n"},
+		"text on ptys":     {pty: true, expected: "{foo}\r\n{bar}\r\n"},
+		"env":              {env: "ndjson", expected: `{"name":"foo"}` + "\n" + `{"name":"bar"}` + "\n"},
+		"flag":             {cmd: "list --format=text", expected: "{foo}\n{bar}\n"},
+		"flag wins on pty": {cmd: "-o json", pty: true, expected: `[{"name":"foo"},{"name":"bar"}]` + "\r\n"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sess, err := testsession.NewClientSession(t, addr, nil)
+			requireNoError(t, err)
+			if tc.env != "" {
+				requireNoError(t, sess.Setenv(FormatEnv, tc.env))
+			}
+			if tc.pty {
+				requireNoError(t, sess.RequestPty("xterm", 24, 80, gossh.TerminalModes{}))
+			}
+			out, err := sess.Output(tc.cmd)
+			requireNoError(t, err)
+			if string(out) != tc.expected {
+				t.Errorf("expected %q, got %q", tc.expected, out)
+			}
+		})
+	}
+}
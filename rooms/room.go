@@ -0,0 +1,376 @@
+package rooms
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/wish/internal/relay"
+)
+
+// ErrNotYourTurn is returned when ending the turn of another player.
+var ErrNotYourTurn = errors.New("rooms: not your turn")
+
+// Role is the role of a member of a room.
+type Role int
+
+const (
+	// Player members take turns, and take seats.
+	Player Role = iota
+
+	// Spectator members only watch.
+	Spectator
+)
+
+// String implements fmt.Stringer.
+func (r Role) String() string {
+	if r == Spectator {
+		return "spectator"
+	}
+	return "player"
+}
+
+// Member is a member of a room.
+type Member struct {
+	// ID identifies the member in the room, e.g. from SessionMember.
+	ID string
+
+	// User is the name of the member, e.g. its SSH user.
+	User string
+
+	Role Role
+}
+
+// Sender is what members get messages through, e.g. a *tea.Program.
+type Sender interface {
+	Send(tea.Msg)
+}
+
+// JoinMsg is sent to the members of a room, including the new one, when a
+// member joins it.
+type JoinMsg struct {
+	Room   string
+	Member Member
+}
+
+// LeaveMsg is sent to the members of a room when a member leaves it.
+type LeaveMsg struct {
+	Room   string
+	Member Member
+}
+
+// RoleMsg is sent to the members of a room when the role of a member
+// changes.
+type RoleMsg struct {
+	Room   string
+	Member Member
+}
+
+// TurnMsg is sent to the members of a room when the turn passes to a player.
+type TurnMsg struct {
+	Room   string
+	Member Member
+}
+
+// ClosedMsg is sent to the members of a room when it's closed. They're no
+// longer members after it.
+type ClosedMsg struct {
+	Room string
+}
+
+type member struct {
+	Member
+	relay *relay.Relay
+}
+
+// Room is a room of a Lobby, joined with its code.
+type Room struct {
+	lobby  *Lobby
+	code   string
+	name   string
+	public bool
+	seq    uint64
+
+	mu      sync.Mutex
+	members []*member
+	turn    string
+	state   []byte
+	closed  bool
+}
+
+// Code returns the join code of the room.
+func (r *Room) Code() string {
+	return r.code
+}
+
+// Name returns the name of the room. Rooms created by Lobby.Match have none.
+func (r *Room) Name() string {
+	return r.name
+}
+
+// Public returns whether the room was created by Lobby.Match.
+func (r *Room) Public() bool {
+	return r.public
+}
+
+// Join adds the member to the room until the context is done or the
+// returned function is called, e.g. with the context of the session of a
+// program:
+//
+//	leave, err := room.Join(s.Context(), rooms.SessionMember(s, rooms.Player), p)
+//
+// Members are sent the messages of the room in order, without blocking it.
+// Members whose program falls over a thousand messages behind leave the
+// room. The first player gets the turn.
+func (r *Room) Join(ctx context.Context, m Member, s Sender) (func(), error) {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return nil, ErrClosed
+	}
+	if r.index(m.ID) >= 0 {
+		r.mu.Unlock()
+		return nil, ErrJoined
+	}
+	if m.Role == Player && r.full() {
+		r.mu.Unlock()
+		return nil, ErrFull
+	}
+	mem := &member{Member: m, relay: relay.New(s)}
+	r.members = append(r.members, mem)
+	r.broadcast(JoinMsg{Room: r.code, Member: m})
+	if m.Role == Player && r.turn == "" {
+		r.setTurn(len(r.members) - 1)
+	}
+	r.mu.Unlock()
+
+	var once sync.Once
+	leave := func() {
+		once.Do(func() { r.leave(mem) })
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-mem.relay.Done():
+			// the room was closed, or the member fell too far behind.
+		}
+		leave()
+	}()
+	return leave, nil
+}
+
+func (r *Room) leave(mem *member) {
+	r.mu.Lock()
+	i := -1
+	for j, m := range r.members {
+		if m == mem {
+			i = j
+		}
+	}
+	if i < 0 {
+		r.mu.Unlock()
+		return
+	}
+	r.members = append(r.members[:i], r.members[i+1:]...)
+	mem.relay.Close()
+	r.broadcast(LeaveMsg{Room: r.code, Member: mem.Member})
+	if r.turn == mem.ID {
+		r.setTurn(r.next(i))
+	}
+	empty := len(r.members) == 0
+	r.mu.Unlock()
+
+	if empty && r.public {
+		_ = r.lobby.closeIfEmpty(r)
+	}
+}
+
+// Members returns the members of the room, in the order they joined.
+func (r *Room) Members() []Member {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	members := make([]Member, len(r.members))
+	for i, m := range r.members {
+		members[i] = m.Member
+	}
+	return members
+}
+
+// Broadcast sends the message to all the members of the room.
+func (r *Room) Broadcast(msg tea.Msg) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.broadcast(msg)
+}
+
+// Send sends the message to the member with the given ID, and returns false
+// if there's none.
+func (r *Room) Send(id string, msg tea.Msg) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.index(id)
+	if i < 0 {
+		return false
+	}
+	r.members[i].relay.Push(msg)
+	return true
+}
+
+// SetRole changes the role of the member with the given ID. Players who
+// become spectators pass the turn on.
+func (r *Room) SetRole(id string, role Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.index(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	m := r.members[i]
+	if m.Role == role {
+		return nil
+	}
+	if role == Player && r.full() {
+		return ErrFull
+	}
+	m.Role = role
+	r.broadcast(RoleMsg{Room: r.code, Member: m.Member})
+	switch {
+	case role == Spectator && r.turn == id:
+		r.setTurn(r.next(i + 1))
+	case role == Player && r.turn == "":
+		r.setTurn(i)
+	}
+	return nil
+}
+
+// Turn returns the player whose turn it is, if there are players.
+func (r *Room) Turn() (Member, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i := r.index(r.turn)
+	if i < 0 {
+		return Member{}, false
+	}
+	return r.members[i].Member, true
+}
+
+// EndTurn passes the turn of the player with the given ID to the next one,
+// in the order they joined.
+func (r *Room) EndTurn(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if id == "" || r.turn != id {
+		return ErrNotYourTurn
+	}
+	r.setTurn(r.next(r.index(id) + 1))
+	return nil
+}
+
+// State returns the state of the room, as last set with SetState.
+func (r *Room) State() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]byte(nil), r.state...)
+}
+
+// SetState sets the state of the room, e.g. the board of a game, and saves
+// the room to the store of the lobby, if any. The state isn't changed if
+// saving fails.
+func (r *Room) SetState(state []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	snap := r.snapshot()
+	snap.State = append([]byte(nil), state...)
+	if err := r.lobby.save(snap); err != nil {
+		return err
+	}
+	r.state = snap.State
+	return nil
+}
+
+func (r *Room) snapshot() Snapshot {
+	return Snapshot{Code: r.code, Name: r.name, Public: r.public, State: r.state}
+}
+
+// full returns whether all the seats are taken. r.mu must be held.
+func (r *Room) full() bool {
+	max := r.lobby.cfg.maxPlayers
+	if max <= 0 {
+		return false
+	}
+	players := 0
+	for _, m := range r.members {
+		if m.Role == Player {
+			players++
+		}
+	}
+	return players >= max
+}
+
+// index returns the index of the member with the given ID, or -1. r.mu must
+// be held.
+func (r *Room) index(id string) int {
+	for i, m := range r.members {
+		if m.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// next returns the index of the first player from the given index, wrapping
+// around, or -1 if there are no players. r.mu must be held.
+func (r *Room) next(from int) int {
+	n := len(r.members)
+	for k := 0; k < n; k++ {
+		i := (from + k) % n
+		if r.members[i].Role == Player {
+			return i
+		}
+	}
+	return -1
+}
+
+// setTurn gives the turn to the member at the given index, or to no one if
+// it's -1. r.mu must be held.
+func (r *Room) setTurn(i int) {
+	if i < 0 {
+		r.turn = ""
+		return
+	}
+	r.turn = r.members[i].ID
+	r.broadcast(TurnMsg{Room: r.code, Member: r.members[i].Member})
+}
+
+// broadcast sends the message to all the members. r.mu must be held.
+func (r *Room) broadcast(msg tea.Msg) {
+	for _, m := range r.members {
+		m.relay.Push(msg)
+	}
+}
+
+// close closes the room. l.mu must be held.
+func (r *Room) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	r.broadcast(ClosedMsg{Room: r.code})
+	for _, m := range r.members {
+		m.relay.Finish()
+	}
+	r.members = nil
+	r.turn = ""
+}
+
+// closeIfEmpty closes the room if no one is in it, and returns whether it
+// did. l.mu must be held.
+func (r *Room) closeIfEmpty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.members) > 0 {
+		return false
+	}
+	r.closed = true
+	return true
+}
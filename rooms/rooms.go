@@ -0,0 +1,321 @@
+// Package rooms provides lobbies for multiplayer apps, e.g. turn-based games:
+// sessions create rooms, join them by code or through matchmaking, as
+// players or spectators, and get messages broadcast to their room.
+//
+// Messages are sent to the programs of the members, e.g. *tea.Program, in
+// order, without blocking the room:
+//
+//	lobby := rooms.NewLobby(rooms.WithMaxPlayers(2))
+//	room, leave, err := lobby.Match(s.Context(), rooms.SessionMember(s, rooms.Player), p)
+//	defer leave()
+//	room.Broadcast(moveMsg{...})
+//
+// Rooms can be persisted, with their state, through a Store, and restored
+// when the server starts with Lobby.Restore.
+package rooms
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/charmbracelet/ssh"
+)
+
+var (
+	// ErrNotFound is returned when joining a room that doesn't exist.
+	ErrNotFound = errors.New("rooms: no such room")
+
+	// ErrFull is returned when joining a room as a player when all the
+	// seats are taken.
+	ErrFull = errors.New("rooms: room is full")
+
+	// ErrClosed is returned when joining a room that was closed.
+	ErrClosed = errors.New("rooms: room is closed")
+
+	// ErrJoined is returned when joining a room twice.
+	ErrJoined = errors.New("rooms: already joined")
+
+	// ErrCodeInUse is returned when restoring a room with the code of
+	// another.
+	ErrCodeInUse = errors.New("rooms: code in use")
+)
+
+// Snapshot is what's persisted of a room.
+type Snapshot struct {
+	Code   string
+	Name   string
+	Public bool
+	State  []byte
+}
+
+// Store persists rooms.
+type Store interface {
+	// Save stores the snapshot, replacing the one of the room if any. It's
+	// called when rooms are created, and when their state changes.
+	Save(Snapshot) error
+
+	// Delete deletes the snapshot of the room with the given code. It's
+	// called when rooms are closed.
+	Delete(code string) error
+}
+
+// codeAlphabet has no characters easily mistaken for others, e.g. 0 and O.
+const codeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+type config struct {
+	maxPlayers int
+	codeLen    int
+	store      Store
+}
+
+// Option configures a Lobby.
+type Option func(*config)
+
+// WithMaxPlayers sets the number of players of each room. Rooms have no
+// limit by default. Spectators are never limited.
+func WithMaxPlayers(n int) Option {
+	return func(c *config) {
+		c.maxPlayers = n
+	}
+}
+
+// WithCodeLength sets the length of the join codes. It defaults to 6.
+func WithCodeLength(n int) Option {
+	return func(c *config) {
+		c.codeLen = n
+	}
+}
+
+// WithStore persists the rooms to the store.
+func WithStore(store Store) Option {
+	return func(c *config) {
+		c.store = store
+	}
+}
+
+// memberSeq numbers the members returned by SessionMember.
+var memberSeq uint64
+
+// SessionMember returns a new member for the session with the given role and
+// its user. Sessions multiplexed on a connection share their session ID, so
+// the member ID also has a number unique to the call: call it once per
+// session, and keep the member.
+func SessionMember(s ssh.Session, role Role) Member {
+	n := atomic.AddUint64(&memberSeq, 1)
+	return Member{
+		ID:   s.Context().SessionID() + "-" + strconv.FormatUint(n, 10),
+		User: s.User(),
+		Role: role,
+	}
+}
+
+// Lobby keeps the rooms.
+type Lobby struct {
+	cfg config
+
+	mu    sync.Mutex
+	rooms map[string]*Room
+	seq   uint64
+}
+
+// NewLobby returns a lobby without rooms.
+func NewLobby(opts ...Option) *Lobby {
+	cfg := config{codeLen: 6}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return &Lobby{cfg: cfg, rooms: map[string]*Room{}}
+}
+
+// Create creates a room with the given name, joined with its code.
+func (l *Lobby) Create(name string) (*Room, error) {
+	return l.create(name, false)
+}
+
+func (l *Lobby) create(name string, public bool) (*Room, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.createLocked(name, public)
+}
+
+// createLocked creates a room, and saves it. l.mu must be held.
+func (l *Lobby) createLocked(name string, public bool) (*Room, error) {
+	code, err := l.newCode()
+	if err != nil {
+		return nil, err
+	}
+	r := l.add(Snapshot{Code: code, Name: name, Public: public})
+	if err := l.save(r.snapshot()); err != nil {
+		delete(l.rooms, code)
+		return nil, err
+	}
+	return r, nil
+}
+
+// add adds a room. l.mu must be held.
+func (l *Lobby) add(snap Snapshot) *Room {
+	l.seq++
+	r := &Room{
+		lobby:  l,
+		code:   snap.Code,
+		name:   snap.Name,
+		public: snap.Public,
+		seq:    l.seq,
+		state:  snap.State,
+	}
+	l.rooms[snap.Code] = r
+	return r
+}
+
+// newCode returns a code no room has. l.mu must be held.
+func (l *Lobby) newCode() (string, error) {
+	b := make([]byte, l.cfg.codeLen)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			return "", err
+		}
+		for i := range b {
+			b[i] = codeAlphabet[int(b[i])%len(codeAlphabet)]
+		}
+		if _, ok := l.rooms[string(b)]; !ok {
+			return string(b), nil
+		}
+	}
+}
+
+// Restore recreates persisted rooms, without members, e.g. when the server
+// starts. It stops at the first room whose code is in use.
+func (l *Lobby) Restore(snaps ...Snapshot) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, snap := range snaps {
+		snap.Code = normalize(snap.Code)
+		if _, ok := l.rooms[snap.Code]; ok {
+			return ErrCodeInUse
+		}
+		l.add(snap)
+	}
+	return nil
+}
+
+// normalize makes codes case insensitive, and ignores spaces around them, as
+// users type them.
+func normalize(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Room returns the room with the given code.
+func (l *Lobby) Room(code string) (*Room, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r, ok := l.rooms[normalize(code)]
+	return r, ok
+}
+
+// Rooms returns the rooms, oldest first.
+func (l *Lobby) Rooms() []*Room {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sorted()
+}
+
+// sorted returns the rooms, oldest first. l.mu must be held.
+func (l *Lobby) sorted() []*Room {
+	rooms := make([]*Room, 0, len(l.rooms))
+	for _, r := range l.rooms {
+		rooms = append(rooms, r)
+	}
+	sort.Slice(rooms, func(i, j int) bool {
+		return rooms[i].seq < rooms[j].seq
+	})
+	return rooms
+}
+
+// Join joins the room with the given code, see Room.Join.
+func (l *Lobby) Join(ctx context.Context, code string, m Member, s Sender) (*Room, func(), error) {
+	r, ok := l.Room(code)
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+	leave, err := r.Join(ctx, m, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, leave, nil
+}
+
+// Match joins the oldest public room with a free seat, or creates one if
+// there's none, see Room.Join. Public rooms are closed once everyone left.
+func (l *Lobby) Match(ctx context.Context, m Member, s Sender) (*Room, func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, r := range l.sorted() {
+		if !r.public {
+			continue
+		}
+		leave, err := r.Join(ctx, m, s)
+		if err == nil {
+			return r, leave, nil
+		}
+		if !errors.Is(err, ErrFull) && !errors.Is(err, ErrClosed) {
+			return nil, nil, err
+		}
+	}
+
+	r, err := l.createLocked("", true)
+	if err != nil {
+		return nil, nil, err
+	}
+	leave, err := r.Join(ctx, m, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r, leave, nil
+}
+
+// Close closes the room with the given code: its members get a ClosedMsg,
+// and it's deleted from the store.
+func (l *Lobby) Close(code string) error {
+	l.mu.Lock()
+	r, ok := l.rooms[normalize(code)]
+	if !ok {
+		l.mu.Unlock()
+		return ErrNotFound
+	}
+	delete(l.rooms, r.code)
+	r.close()
+	l.mu.Unlock()
+	return l.delete(r.code)
+}
+
+// closeIfEmpty closes the room if no one is in it.
+func (l *Lobby) closeIfEmpty(r *Room) error {
+	l.mu.Lock()
+	if l.rooms[r.code] != r || !r.closeIfEmpty() {
+		l.mu.Unlock()
+		return nil
+	}
+	delete(l.rooms, r.code)
+	l.mu.Unlock()
+	return l.delete(r.code)
+}
+
+func (l *Lobby) save(snap Snapshot) error {
+	if l.cfg.store == nil {
+		return nil
+	}
+	return l.cfg.store.Save(snap)
+}
+
+func (l *Lobby) delete(code string) error {
+	if l.cfg.store == nil {
+		return nil
+	}
+	return l.cfg.store.Delete(code)
+}
@@ -0,0 +1,329 @@
+package rooms
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/relay"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+type sender chan tea.Msg
+
+func (s sender) Send(msg tea.Msg) { s <- msg }
+
+func newSender() sender {
+	return make(sender, 100)
+}
+
+func receive(tb testing.TB, s sender) tea.Msg {
+	tb.Helper()
+	select {
+	case msg := <-s:
+		return msg
+	case <-time.After(time.Second):
+		tb.Fatal("timed out waiting for a message")
+	}
+	return nil
+}
+
+func requireMsg(tb testing.TB, s sender, expected tea.Msg) {
+	tb.Helper()
+	if msg := receive(tb, s); !reflect.DeepEqual(msg, expected) {
+		tb.Fatalf("expected %+v, got %+v", expected, msg)
+	}
+}
+
+func requireNoError(tb testing.TB, err error) {
+	tb.Helper()
+	if err != nil {
+		tb.Fatalf("expected no error, got %v", err)
+	}
+}
+
+type memStore struct {
+	mu    sync.Mutex
+	snaps map[string]Snapshot
+}
+
+func (s *memStore) Save(snap Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.snaps[snap.Code] = snap
+	return nil
+}
+
+func (s *memStore) Delete(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.snaps, code)
+	return nil
+}
+
+func TestCreateAndJoin(t *testing.T) {
+	l := NewLobby(WithMaxPlayers(2))
+	r, err := l.Create("chess")
+	requireNoError(t, err)
+	if len(r.Code()) != 6 {
+		t.Errorf("expected a code of 6 characters, got %q", r.Code())
+	}
+	if r.Public() {
+		t.Error("expected a private room")
+	}
+	if _, _, err := l.Match(context.Background(), Member{ID: "x"}, newSender()); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(l.Rooms()); n != 2 {
+		t.Errorf("expected matchmaking to skip private rooms, got %d rooms", n)
+	}
+
+	ctx := context.Background()
+	alice, bob, carol := newSender(), newSender(), newSender()
+	a := Member{ID: "a", User: "alice"}
+	_, _, err = l.Join(ctx, " "+strings.ToLower(r.Code())+" ", a, alice)
+	requireNoError(t, err)
+	requireMsg(t, alice, JoinMsg{Room: r.Code(), Member: a})
+	requireMsg(t, alice, TurnMsg{Room: r.Code(), Member: a})
+
+	b := Member{ID: "b", User: "bob"}
+	_, err = r.Join(ctx, b, bob)
+	requireNoError(t, err)
+	requireMsg(t, alice, JoinMsg{Room: r.Code(), Member: b})
+	requireMsg(t, bob, JoinMsg{Room: r.Code(), Member: b})
+
+	if _, err := r.Join(ctx, Member{ID: "c"}, carol); !errors.Is(err, ErrFull) {
+		t.Errorf("expected the room to be full, got %v", err)
+	}
+	if _, err := r.Join(ctx, a, alice); !errors.Is(err, ErrJoined) {
+		t.Errorf("expected an already joined error, got %v", err)
+	}
+	c := Member{ID: "c", User: "carol", Role: Spectator}
+	_, err = r.Join(ctx, c, carol)
+	requireNoError(t, err)
+	requireMsg(t, carol, JoinMsg{Room: r.Code(), Member: c})
+	if members := r.Members(); !reflect.DeepEqual(members, []Member{a, b, c}) {
+		t.Errorf("unexpected members: %+v", members)
+	}
+
+	r.Broadcast("hi")
+	for _, s := range []sender{alice, bob} {
+		requireMsg(t, s, JoinMsg{Room: r.Code(), Member: c})
+		requireMsg(t, s, "hi")
+	}
+	requireMsg(t, carol, "hi")
+	if !r.Send("c", "psst") || r.Send("d", "psst") {
+		t.Error("expected to send only to members")
+	}
+	requireMsg(t, carol, "psst")
+
+	if _, _, err := l.Join(ctx, "nope", a, alice); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected no such room, got %v", err)
+	}
+}
+
+func TestTurns(t *testing.T) {
+	l := NewLobby()
+	r, _ := l.Create("")
+	ctx := context.Background()
+	a, b, c := Member{ID: "a"}, Member{ID: "b", Role: Spectator}, Member{ID: "c"}
+	s := newSender()
+	_, _ = r.Join(ctx, a, s)
+	_, _ = r.Join(ctx, b, newSender())
+	leaveC, _ := r.Join(ctx, c, newSender())
+
+	requireTurn := func(expected string) {
+		t.Helper()
+		m, ok := r.Turn()
+		if !ok || m.ID != expected {
+			t.Fatalf("expected the turn of %q, got %q", expected, m.ID)
+		}
+	}
+	requireTurn("a")
+	if err := r.EndTurn("c"); !errors.Is(err, ErrNotYourTurn) {
+		t.Errorf("expected not your turn, got %v", err)
+	}
+	requireNoError(t, r.EndTurn("a"))
+	requireTurn("c") // spectators are skipped
+	requireNoError(t, r.EndTurn("c"))
+	requireTurn("a")
+
+	requireNoError(t, r.SetRole("b", Player))
+	requireNoError(t, r.EndTurn("a"))
+	requireTurn("b")
+	requireNoError(t, r.SetRole("b", Spectator))
+	requireTurn("c")
+
+	leaveC()
+	requireTurn("a")
+	requireNoError(t, r.SetRole("a", Spectator))
+	if _, ok := r.Turn(); ok {
+		t.Error("expected no turn without players")
+	}
+	requireNoError(t, r.SetRole("a", Player))
+	requireTurn("a")
+
+	requireMsg(t, s, JoinMsg{Room: r.Code(), Member: a})
+	requireMsg(t, s, TurnMsg{Room: r.Code(), Member: a})
+	requireMsg(t, s, JoinMsg{Room: r.Code(), Member: b})
+	requireMsg(t, s, JoinMsg{Room: r.Code(), Member: c})
+	requireMsg(t, s, TurnMsg{Room: r.Code(), Member: c})
+}
+
+func TestMatch(t *testing.T) {
+	l := NewLobby(WithMaxPlayers(2))
+	ctx, cancel := context.WithCancel(context.Background())
+	r1, _, err := l.Match(ctx, Member{ID: "a"}, newSender())
+	requireNoError(t, err)
+	r2, leaveB, err := l.Match(context.Background(), Member{ID: "b"}, newSender())
+	requireNoError(t, err)
+	if r1 != r2 {
+		t.Fatal("expected the second player to join the first room")
+	}
+	r3, leaveC, err := l.Match(context.Background(), Member{ID: "c"}, newSender())
+	requireNoError(t, err)
+	if r3 == r1 || !r3.Public() {
+		t.Fatal("expected a new public room once the first one is full")
+	}
+
+	// leaving when the session ends.
+	cancel()
+	deadline := time.Now().Add(time.Second)
+	for len(r1.Members()) > 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the member to leave")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	r4, _, err := l.Match(context.Background(), Member{ID: "d"}, newSender())
+	requireNoError(t, err)
+	if r4 != r1 {
+		t.Error("expected to join the free seat of the oldest room")
+	}
+
+	leaveC()
+	leaveC()
+	if _, ok := l.Room(r3.Code()); ok {
+		t.Error("expected the empty public room to be closed")
+	}
+	if _, err := r3.Join(context.Background(), Member{ID: "e"}, newSender()); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected a closed room, got %v", err)
+	}
+	leaveB()
+	if _, ok := l.Room(r1.Code()); !ok {
+		t.Error("expected the room to stay open with a member")
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	store := &memStore{snaps: map[string]Snapshot{}}
+	l := NewLobby(WithStore(store), WithCodeLength(4))
+	r, err := l.Create("go")
+	requireNoError(t, err)
+	requireNoError(t, r.SetState([]byte("board")))
+	if string(r.State()) != "board" {
+		t.Errorf("unexpected state: %q", r.State())
+	}
+
+	s := newSender()
+	_, err = r.Join(context.Background(), Member{ID: "a"}, s)
+	requireNoError(t, err)
+	if _, err := l.Create("other"); err != nil {
+		t.Fatal(err)
+	}
+
+	// restarting the server.
+	restored := NewLobby(WithStore(store))
+	snaps := make([]Snapshot, 0, len(store.snaps))
+	for _, snap := range store.snaps {
+		snaps = append(snaps, snap)
+	}
+	requireNoError(t, restored.Restore(snaps...))
+	rr, ok := restored.Room(r.Code())
+	if !ok {
+		t.Fatal("expected the room to be restored")
+	}
+	if rr.Name() != "go" || string(rr.State()) != "board" || len(rr.Members()) != 0 {
+		t.Errorf("unexpected restored room: %q %q %+v", rr.Name(), rr.State(), rr.Members())
+	}
+	if err := restored.Restore(snaps[0]); !errors.Is(err, ErrCodeInUse) {
+		t.Errorf("expected a code in use, got %v", err)
+	}
+
+	requireNoError(t, l.Close(r.Code()))
+	requireMsg(t, s, JoinMsg{Room: r.Code(), Member: Member{ID: "a"}})
+	requireMsg(t, s, TurnMsg{Room: r.Code(), Member: Member{ID: "a"}})
+	requireMsg(t, s, ClosedMsg{Room: r.Code()})
+	if _, ok := store.snaps[r.Code()]; ok {
+		t.Error("expected the closed room to be deleted from the store")
+	}
+	if err := l.Close(r.Code()); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected no such room, got %v", err)
+	}
+}
+
+func TestSessionMember(t *testing.T) {
+	members := make(chan Member, 2)
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			members <- SessionMember(s, Player)
+		},
+	}
+	client, err := gossh.Dial("tcp", testsession.Listen(t, srv), &gossh.ClientConfig{
+		User:            "testuser",
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+	})
+	requireNoError(t, err)
+	defer client.Close() // nolint: errcheck
+
+	// two sessions multiplexed on the same connection.
+	for i := 0; i < 2; i++ {
+		sess, err := client.NewSession()
+		requireNoError(t, err)
+		requireNoError(t, sess.Run(""))
+	}
+	a, b := <-members, <-members
+	if a.ID == b.ID {
+		t.Fatalf("expected different member IDs, got %q twice", a.ID)
+	}
+
+	r, err := NewLobby().Create("")
+	requireNoError(t, err)
+	for _, m := range []Member{a, b} {
+		leave, err := r.Join(context.Background(), m, newSender())
+		requireNoError(t, err)
+		defer leave()
+	}
+}
+
+// blockedSender never takes messages, until unblocked.
+type blockedSender chan struct{}
+
+func (s blockedSender) Send(tea.Msg) { <-s }
+
+func TestSlowMember(t *testing.T) {
+	r, err := NewLobby().Create("")
+	requireNoError(t, err)
+	slow := make(blockedSender)
+	defer close(slow)
+	_, err = r.Join(context.Background(), Member{ID: "slow", Role: Spectator}, slow)
+	requireNoError(t, err)
+
+	for i := 0; i < 2*relay.MaxQueue+2; i++ {
+		r.Broadcast(i)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(r.Members()) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the slow member to leave the room")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,188 @@
+// Package rpc provides a middleware exposing small APIs over SSH, so they can
+// be authenticated with SSH keys instead of HTTPS and tokens.
+//
+// Commands have the form:
+//
+//	ssh host api <resource> <verb> [json]
+//
+// The JSON argument is decoded into the request of the handler registered for
+// the resource and verb, and its response is written as JSON, or as text if
+// the client asked for it, see wish.Respond. Use "-" as the argument to read
+// the request from stdin instead. Errors are written to stderr, and the
+// session exits with status 1.
+//
+// Running "api" alone lists the registered routes.
+package rpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+)
+
+// Command is the command the middleware handles.
+const Command = "api"
+
+// Error codes.
+const (
+	CodeNotFound = "not_found"
+	CodeInvalid  = "invalid"
+	CodeInternal = "internal"
+)
+
+// Error is an error returned to the client. Handlers can return one to
+// choose its code, other errors are returned with CodeInternal.
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	return e.Code + ": " + e.Message
+}
+
+// Errorf returns an *Error with the given code, and formatted message.
+func Errorf(code, format string, v ...interface{}) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, v...)}
+}
+
+// Validator is implemented by requests that can be validated. Requests
+// failing validation are rejected with CodeInvalid before their handler
+// runs.
+type Validator interface {
+	Validate() error
+}
+
+// handler decodes a request, and handles it.
+type handler func(s ssh.Session, req []byte) (interface{}, error)
+
+// Router maps resources and verbs to handlers. It's safe for concurrent use.
+type Router struct {
+	mu     sync.RWMutex
+	routes map[string]handler
+}
+
+// NewRouter returns an empty Router.
+func NewRouter() *Router {
+	return &Router{routes: map[string]handler{}}
+}
+
+// Handle registers the handler of the given resource and verb, replacing any
+// previous one.
+//
+// Requests are decoded from JSON into Req, rejecting unknown fields, and
+// validated if Req implements Validator. A missing argument decodes into the
+// zero value of Req.
+func Handle[Req, Resp any](r *Router, resource, verb string, fn func(s ssh.Session, req Req) (Resp, error)) {
+	h := func(s ssh.Session, data []byte) (interface{}, error) {
+		var req Req
+		if len(data) > 0 {
+			dec := json.NewDecoder(bytes.NewReader(data))
+			dec.DisallowUnknownFields()
+			if err := dec.Decode(&req); err != nil {
+				return nil, Errorf(CodeInvalid, "invalid request: %v", err)
+			}
+		}
+		if v, ok := interface{}(req).(Validator); ok {
+			if err := v.Validate(); err != nil {
+				return nil, Errorf(CodeInvalid, "%v", err)
+			}
+		}
+		return fn(s, req)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes[resource+" "+verb] = h
+}
+
+// Routes returns the registered routes, as "resource verb", sorted.
+func (r *Router) Routes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	routes := make([]string, 0, len(r.routes))
+	for route := range r.routes {
+		routes = append(routes, route)
+	}
+	sort.Strings(routes)
+	return routes
+}
+
+// Middleware handles the api commands with the given router. Other commands
+// are passed through.
+func Middleware(r *Router) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			args := s.Command()
+			if len(args) == 0 || args[0] != Command {
+				sh(s)
+				return
+			}
+			format, args, err := wish.ParseFormat(args[1:])
+			if err != nil {
+				fail(s, wish.FormatOf(s), Errorf(CodeInvalid, "%v", err))
+				return
+			}
+			if format == "" {
+				format = wish.FormatOf(s)
+			}
+			if len(args) == 0 {
+				_ = wish.RespondFormat(s, format, r.Routes())
+				return
+			}
+			resp, err := r.serve(s, args)
+			if err != nil {
+				fail(s, format, err)
+				return
+			}
+			if err := wish.RespondFormat(s, format, resp); err != nil {
+				fail(s, format, err)
+			}
+		}
+	}
+}
+
+func (r *Router) serve(s ssh.Session, args []string) (interface{}, error) {
+	if len(args) < 2 || len(args) > 3 {
+		return nil, Errorf(CodeInvalid, "usage: %s <resource> <verb> [json]", Command)
+	}
+	r.mu.RLock()
+	h, ok := r.routes[args[0]+" "+args[1]]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, Errorf(CodeNotFound, "no such route: %s %s", args[0], args[1])
+	}
+	var data []byte
+	if len(args) == 3 {
+		data = []byte(args[2])
+		if args[2] == "-" {
+			var err error
+			if data, err = io.ReadAll(s); err != nil {
+				return nil, Errorf(CodeInvalid, "could not read request: %v", err)
+			}
+		}
+	}
+	return h(s, data)
+}
+
+func fail(s ssh.Session, format wish.Format, err error) {
+	var rerr *Error
+	if !errors.As(err, &rerr) {
+		rerr = &Error{Code: CodeInternal, Message: err.Error()}
+	}
+	if format == wish.FormatText {
+		wish.Errorln(s, "error:", rerr.Message)
+	} else {
+		_ = json.NewEncoder(s.Stderr()).Encode(struct {
+			Error *Error `json:"error"`
+		}{rerr})
+	}
+	_ = s.Exit(1)
+}
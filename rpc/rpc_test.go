@@ -0,0 +1,85 @@
+package rpc
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+type greetRequest struct {
+	Name string `json:"name"`
+}
+
+func (r greetRequest) Validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	return nil
+}
+
+type greetResponse struct {
+	Greeting string `json:"greeting"`
+}
+
+func TestMiddleware(t *testing.T) {
+	r := NewRouter()
+	Handle(r, "greeting", "create", func(s ssh.Session, req greetRequest) (greetResponse, error) {
+		return greetResponse{Greeting: "hello " + req.Name + " from " + s.User()}, nil
+	})
+	Handle(r, "greeting", "fail", func(ssh.Session, struct{}) (struct{}, error) {
+		return struct{}{}, errors.New("boom")
+	})
+	srv := &ssh.Server{
+		Handler: Middleware(r)(func(s ssh.Session) {
+			wish.Print(s, "next")
+		}),
+	}
+	addr := testsession.Listen(t, srv)
+
+	run := func(cmd, stdin string) (string, string, error) {
+		sess, err := testsession.NewClientSession(t, addr, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		var stdout, stderr strings.Builder
+		sess.Stdout = &stdout
+		sess.Stderr = &stderr
+		sess.Stdin = strings.NewReader(stdin)
+		err = sess.Run(cmd)
+		return stdout.String(), stderr.String(), err
+	}
+
+	for name, tc := range map[string]struct {
+		cmd, stdin     string
+		stdout, stderr string
+		fails          bool
+	}{
+		"routes":     {cmd: "api", stdout: `["greeting create","greeting fail"]` + "\n"},
+		"call":       {cmd: `api greeting create '{"name":"foo"}'`, stdout: `{"greeting":"hello foo from testuser"}` + "\n"},
+		"stdin":      {cmd: "api greeting create -", stdin: `{"name":"bar"}`, stdout: `{"greeting":"hello bar from testuser"}` + "\n"},
+		"text":       {cmd: `api --format=text greeting create '{"name":"foo"}'`, stdout: "{hello foo from testuser}\n"},
+		"invalid":    {cmd: "api greeting create", stderr: `{"error":{"code":"invalid","message":"name is required"}}` + "\n", fails: true},
+		"unknown":    {cmd: `api greeting create '{"nope":1}'`, stderr: `"code":"invalid"`, fails: true},
+		"not found":  {cmd: "api greeting delete", stderr: `{"error":{"code":"not_found","message":"no such route: greeting delete"}}` + "\n", fails: true},
+		"internal":   {cmd: "api greeting fail", stderr: `{"error":{"code":"internal","message":"boom"}}` + "\n", fails: true},
+		"text error": {cmd: "api -o text greeting fail", stderr: "error: boom\n", fails: true},
+		"other":      {cmd: "foo", stdout: "next"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			stdout, stderr, err := run(tc.cmd, tc.stdin)
+			if tc.fails != (err != nil) {
+				t.Errorf("expected failure to be %v, got %v", tc.fails, err)
+			}
+			if stdout != tc.stdout {
+				t.Errorf("expected stdout %q, got %q", tc.stdout, stdout)
+			}
+			if !strings.Contains(stderr, tc.stderr) {
+				t.Errorf("expected stderr %q, got %q", tc.stderr, stderr)
+			}
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
@@ -28,7 +29,7 @@ func (e parseError) Error() string {
 	return fmt.Sprintf("failed to parse: %q", e.subject)
 }
 
-func copyFromClient(s ssh.Session, info Info, handler CopyFromClientHandler) error {
+func copyFromClient(s ssh.Session, info Info, handler CopyFromClientHandler, cfg *config) error {
 	// accepts the request
 	_, _ = s.Write(NULL)
 
@@ -37,7 +38,9 @@ func copyFromClient(s ssh.Session, info Info, handler CopyFromClientHandler) err
 		r     = bufio.NewReader(s)
 		mtime int64
 		atime int64
+		st    stage
 	)
+	defer st.close()
 
 	for {
 		line, err := r.ReadString('\n')
@@ -83,15 +86,29 @@ func copyFromClient(s ssh.Session, info Info, handler CopyFromClientHandler) err
 			// accepts the header
 			_, _ = s.Write(NULL)
 
+			fpath := filepath.Join(path, name)
+			reader := newLimitReader(r, int(size))
+			var staged *os.File
+			if cfg.scanner != nil {
+				staged, err = st.scan(fpath, reader, size, cfg.scanner)
+				if err != nil {
+					return fmt.Errorf("failed to write file: %q: %w", name, err)
+				}
+				reader = staged
+			}
+
 			written, err := handler.Write(s, &FileEntry{
 				Name:     name,
-				Filepath: filepath.Join(path, name),
+				Filepath: fpath,
 				Mode:     fs.FileMode(mode),
 				Size:     size,
 				Mtime:    mtime,
 				Atime:    atime,
-				Reader:   newLimitReader(r, int(size)),
+				Reader:   reader,
 			})
+			if staged != nil {
+				st.release(staged)
+			}
 			if err != nil {
 				return fmt.Errorf("failed to write file: %q: %w", name, err)
 			}
@@ -13,15 +13,37 @@ import (
 )
 
 // fileSystemHandler is a Handler implementation for a given root path.
-type fileSystemHandler struct{ root string }
+type fileSystemHandler struct {
+	root     string
+	versions int
+}
 
 var _ Handler = &fileSystemHandler{}
 
+// FileSystemOption configures a Handler created with NewFileSystemHandler.
+type FileSystemOption func(*fileSystemHandler)
+
+// WithVersions keeps up to n previous versions of overwritten files, next to
+// them, as name.~1~ (the most recent one) to name.~n~.
+func WithVersions(n int) FileSystemOption {
+	return func(h *fileSystemHandler) {
+		h.versions = n
+	}
+}
+
 // NewFileSystemHandler return a Handler based on the given dir.
-func NewFileSystemHandler(root string) Handler {
-	return &fileSystemHandler{
+//
+// Files copied from the client are written to a temporary file next to their
+// destination, and renamed once complete, so that they're never observed half
+// written. Incomplete files are removed, e.g. if the client disconnects.
+func NewFileSystemHandler(root string, opts ...FileSystemOption) Handler {
+	h := &fileSystemHandler{
 		root: filepath.Clean(root),
 	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
 func (h *fileSystemHandler) chtimes(path string, mtime, atime int64) error {
@@ -117,17 +139,110 @@ func (h *fileSystemHandler) Mkdir(_ ssh.Session, entry *DirEntry) error {
 }
 
 func (h *fileSystemHandler) Write(_ ssh.Session, entry *FileEntry) (int64, error) {
-	f, err := os.OpenFile(h.prefixed(entry.Filepath), os.O_TRUNC|os.O_RDWR|os.O_CREATE, entry.Mode)
+	path := h.prefixed(entry.Filepath)
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
 	if err != nil {
 		return 0, fmt.Errorf("failed to open file: %q: %w", entry.Filepath, err)
 	}
+	written, err := h.writeTemp(f, entry)
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return 0, err
+	}
+	if err := h.backup(path); err != nil {
+		_ = os.Remove(f.Name())
+		return 0, fmt.Errorf("failed to keep previous version: %q: %w", entry.Filepath, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		_ = os.Remove(f.Name())
+		return 0, fmt.Errorf("failed to rename file: %q: %w", entry.Filepath, err)
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return 0, fmt.Errorf("failed to sync dir: %q: %w", entry.Filepath, err)
+	}
+	return written, h.chtimes(entry.Filepath, entry.Mtime, entry.Atime)
+}
+
+// writeTemp writes the entry contents to the given temporary file, syncing and
+// closing it.
+func (h *fileSystemHandler) writeTemp(f *os.File, entry *FileEntry) (int64, error) {
 	defer f.Close() //nolint:errcheck
 	written, err := io.Copy(f, entry.Reader)
 	if err != nil {
 		return 0, fmt.Errorf("failed to write file: %q: %w", entry.Filepath, err)
 	}
+	if written != entry.Size {
+		return 0, fmt.Errorf("failed to write file: %q: written %d out of %d bytes", entry.Filepath, written, entry.Size)
+	}
+	// the mode comes from the client, so the umask applies, as when
+	// creating the file with it.
+	if err := f.Chmod(entry.Mode.Perm() &^ umask()); err != nil {
+		return 0, fmt.Errorf("failed to chmod file: %q: %w", entry.Filepath, err)
+	}
+	if err := f.Sync(); err != nil {
+		return 0, fmt.Errorf("failed to sync file: %q: %w", entry.Filepath, err)
+	}
 	if err := f.Close(); err != nil {
 		return 0, fmt.Errorf("failed to close file: %q: %w", entry.Filepath, err)
 	}
-	return written, h.chtimes(entry.Filepath, entry.Mtime, entry.Atime)
+	return written, nil
+}
+
+// backup keeps the current version of the file at path, if enabled, shifting
+// the older ones.
+func (h *fileSystemHandler) backup(path string) error {
+	if h.versions <= 0 {
+		return nil
+	}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	version := func(i int) string {
+		return fmt.Sprintf("%s.~%d~", path, i)
+	}
+	_ = os.Remove(version(h.versions))
+	for i := h.versions - 1; i >= 1; i-- {
+		if err := os.Rename(version(i), version(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	// link rather than rename, so the file never goes missing, and copy
+	// where links aren't supported.
+	if err := os.Link(path, version(1)); err != nil {
+		return copyFile(path, version(1))
+	}
+	return nil
+}
+
+// copyFile copies the file at src to dst, with the same mode, through a
+// temporary file so dst is never observed half written.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close() //nolint:errcheck
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(out.Name()) //nolint:errcheck
+	defer out.Close()           //nolint:errcheck
+	if _, err := io.Copy(out, in); err != nil {
+		return err
+	}
+	if err := out.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), dst)
 }
@@ -0,0 +1,17 @@
+//go:build !linux && !darwin && !freebsd && !dragonfly && !netbsd && !openbsd && !solaris
+// +build !linux,!darwin,!freebsd,!dragonfly,!netbsd,!openbsd,!solaris
+
+package scp
+
+import "os"
+
+// umask returns the umask of the process. There's none on this platform.
+func umask() os.FileMode {
+	return 0
+}
+
+// syncDir syncs the directory, so the entries renamed into it persist.
+// Directories can't be synced on this platform.
+func syncDir(string) error {
+	return nil
+}
@@ -3,6 +3,7 @@ package scp
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -185,16 +186,123 @@ func TestFilesystem(t *testing.T) {
 		})
 	})
 
+	t.Run("scp -t with versions", func(t *testing.T) {
+		is := is.New(t)
+		dir := t.TempDir()
+		h := NewFileSystemHandler(dir, WithVersions(2))
+		for _, content := range []string{"v1", "v2", "v3", "v4"} {
+			_, err := h.Write(nil, &FileEntry{
+				Name:     "a.txt",
+				Filepath: "a.txt",
+				Mode:     0o644,
+				Size:     int64(len(content)),
+				Reader:   bytes.NewBufferString(content),
+			})
+			is.NoErr(err)
+		}
+		for name, expected := range map[string]string{
+			"a.txt":     "v4",
+			"a.txt.~1~": "v3",
+			"a.txt.~2~": "v2",
+		} {
+			bts, err := os.ReadFile(filepath.Join(dir, name))
+			is.NoErr(err)
+			is.Equal(expected, string(bts))
+		}
+		_, err := os.Stat(filepath.Join(dir, "a.txt.~3~"))
+		is.True(os.IsNotExist(err))
+	})
+
+	t.Run("scp -t with umask", func(t *testing.T) {
+		is := is.New(t)
+		dir := t.TempDir()
+		h := NewFileSystemHandler(dir)
+		_, err := h.Write(nil, &FileEntry{
+			Name:     "a.sh",
+			Filepath: "a.sh",
+			Mode:     0o777,
+			Size:     2,
+			Reader:   bytes.NewBufferString("v1"),
+		})
+		is.NoErr(err)
+		info, err := os.Stat(filepath.Join(dir, "a.sh"))
+		is.NoErr(err)
+		is.Equal(os.FileMode(0o777)&^umask(), info.Mode().Perm())
+	})
+
+	t.Run("copyFile", func(t *testing.T) {
+		is := is.New(t)
+		dir := t.TempDir()
+		src, dst := filepath.Join(dir, "a.txt"), filepath.Join(dir, "a.txt.~1~")
+		is.NoErr(os.WriteFile(src, []byte("v1"), 0o640))
+		is.NoErr(os.Chmod(src, 0o640))
+		is.NoErr(copyFile(src, dst))
+		bts, err := os.ReadFile(dst)
+		is.NoErr(err)
+		is.Equal("v1", string(bts))
+		info, err := os.Stat(dst)
+		is.NoErr(err)
+		is.Equal(os.FileMode(0o640), info.Mode().Perm())
+		entries, err := os.ReadDir(dir)
+		is.NoErr(err)
+		is.Equal(2, len(entries)) // no temporary file left
+	})
+
+	t.Run("scp -t with content scanner", func(t *testing.T) {
+		scanner := func(path string, r io.Reader) error {
+			bts, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+			if bytes.Contains(bts, []byte("virus")) {
+				return fmt.Errorf("%s is infected", path)
+			}
+			return nil
+		}
+		upload := func(name, content string) *bytes.Buffer {
+			var in bytes.Buffer
+			fmt.Fprintf(&in, "C0644 %d %s\n%s", len(content), name, content)
+			in.Write(NULL)
+			return &in
+		}
+
+		t.Run("clean file", func(t *testing.T) {
+			is := is.New(t)
+			dir := t.TempDir()
+			session := setup(t, nil, NewFileSystemHandler(dir), WithContentScanner(scanner))
+			session.Stdin = upload("a.txt", "hello\n")
+			_, err := session.CombinedOutput("scp -t .")
+			is.NoErr(err)
+
+			bts, err := os.ReadFile(filepath.Join(dir, "a.txt"))
+			is.NoErr(err)
+			is.Equal("hello\n", string(bts))
+		})
+
+		t.Run("rejected file", func(t *testing.T) {
+			is := is.New(t)
+			dir := t.TempDir()
+			session := setup(t, nil, NewFileSystemHandler(dir), WithContentScanner(scanner))
+			session.Stdin = upload("a.txt", "a virus\n")
+			out, err := session.CombinedOutput("scp -t .")
+			is.True(err != nil)
+			is.True(bytes.Contains(out, []byte(ErrRejected.Error())))
+
+			_, err = os.Stat(filepath.Join(dir, "a.txt"))
+			is.True(os.IsNotExist(err))
+		})
+	})
+
 	t.Run("errors", func(t *testing.T) {
 		t.Run("chtimes", func(t *testing.T) {
-			h := &fileSystemHandler{t.TempDir()}
+			h := &fileSystemHandler{root: t.TempDir()}
 			is.New(t).True(h.chtimes("nope", 1212212, 323232) != nil) // should err
 		})
 
 		t.Run("glob", func(t *testing.T) {
 			t.Run("invalid glob", func(t *testing.T) {
 				is := is.New(t)
-				h := &fileSystemHandler{t.TempDir()}
+				h := &fileSystemHandler{root: t.TempDir()}
 				matches, err := h.Glob(nil, "[asda")
 				is.True(err != nil) // should err
 				is.Equal([]string{}, matches)
@@ -204,7 +312,7 @@ func TestFilesystem(t *testing.T) {
 		t.Run("NewDirEntry", func(t *testing.T) {
 			t.Run("do not exist", func(t *testing.T) {
 				is := is.New(t)
-				h := &fileSystemHandler{t.TempDir()}
+				h := &fileSystemHandler{root: t.TempDir()}
 				_, err := h.NewDirEntry(nil, "foo")
 				is.True(err != nil) // should err
 			})
@@ -213,7 +321,7 @@ func TestFilesystem(t *testing.T) {
 		t.Run("NewFileEntry", func(t *testing.T) {
 			t.Run("do not exist", func(t *testing.T) {
 				is := is.New(t)
-				h := &fileSystemHandler{t.TempDir()}
+				h := &fileSystemHandler{root: t.TempDir()}
 				_, _, err := h.NewFileEntry(nil, "foo")
 				is.True(err != nil) // should err
 			})
@@ -222,7 +330,7 @@ func TestFilesystem(t *testing.T) {
 		t.Run("Mkdir", func(t *testing.T) {
 			t.Run("parent do not exist", func(t *testing.T) {
 				is := is.New(t)
-				h := &fileSystemHandler{t.TempDir()}
+				h := &fileSystemHandler{root: t.TempDir()}
 				err := h.Mkdir(nil, &DirEntry{
 					Name:     "foo",
 					Filepath: "foo/bar/baz",
@@ -235,7 +343,7 @@ func TestFilesystem(t *testing.T) {
 		t.Run("Write", func(t *testing.T) {
 			t.Run("parent do not exist", func(t *testing.T) {
 				is := is.New(t)
-				h := &fileSystemHandler{t.TempDir()}
+				h := &fileSystemHandler{root: t.TempDir()}
 				_, err := h.Write(nil, &FileEntry{
 					Name:     "foo.txt",
 					Filepath: "baz/foo.txt",
@@ -247,7 +355,7 @@ func TestFilesystem(t *testing.T) {
 
 			t.Run("reader fails", func(t *testing.T) {
 				is := is.New(t)
-				h := &fileSystemHandler{t.TempDir()}
+				h := &fileSystemHandler{root: t.TempDir()}
 				_, err := h.Write(nil, &FileEntry{
 					Name:     "foo.txt",
 					Filepath: "foo.txt",
@@ -256,6 +364,26 @@ func TestFilesystem(t *testing.T) {
 					Reader:   iotest.ErrReader(fmt.Errorf("fake err")),
 				})
 				is.True(err != nil) // should err
+				entries, err := os.ReadDir(h.root)
+				is.NoErr(err)
+				is.Equal(0, len(entries)) // should clean up
+			})
+
+			t.Run("incomplete file", func(t *testing.T) {
+				is := is.New(t)
+				h := &fileSystemHandler{root: t.TempDir()}
+				is.NoErr(os.WriteFile(filepath.Join(h.root, "foo.txt"), []byte("previous"), 0o644))
+				_, err := h.Write(nil, &FileEntry{
+					Name:     "foo.txt",
+					Filepath: "foo.txt",
+					Mode:     0o644,
+					Size:     10,
+					Reader:   bytes.NewBufferString("short"),
+				})
+				is.True(err != nil) // should err
+				bts, err := os.ReadFile(filepath.Join(h.root, "foo.txt"))
+				is.NoErr(err)
+				is.Equal("previous", string(bts)) // should keep the previous file
 			})
 		})
 	})
@@ -0,0 +1,51 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package scp
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+var processUmask = struct {
+	once sync.Once
+	mode os.FileMode
+}{}
+
+// umask returns the umask of the process. It's read from /proc when possible,
+// as reading it otherwise means setting it, which briefly affects the files
+// other goroutines create.
+func umask() os.FileMode {
+	processUmask.once.Do(func() {
+		if b, err := os.ReadFile("/proc/self/status"); err == nil {
+			for _, line := range strings.Split(string(b), "\n") {
+				if !strings.HasPrefix(line, "Umask:") {
+					continue
+				}
+				v, err := strconv.ParseUint(strings.TrimSpace(strings.TrimPrefix(line, "Umask:")), 8, 32)
+				if err == nil {
+					processUmask.mode = os.FileMode(v)
+					return
+				}
+			}
+		}
+		old := syscall.Umask(0)
+		syscall.Umask(old)
+		processUmask.mode = os.FileMode(old)
+	})
+	return processUmask.mode
+}
+
+// syncDir syncs the directory, so the entries renamed into it persist.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close() //nolint:errcheck
+	return d.Sync()
+}
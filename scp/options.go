@@ -0,0 +1,25 @@
+package scp
+
+import (
+	"io"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+)
+
+// Option configures the middleware.
+type Option func(*config)
+
+type config struct {
+	scanner     func(path string, r io.Reader) error
+	readOnly    func(ssh.Session) bool
+	maintenance *wish.Maintenance
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
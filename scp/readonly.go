@@ -0,0 +1,50 @@
+package scp
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+)
+
+// ErrReadOnly is returned when a read-only session copies files to the
+// server.
+var ErrReadOnly = errors.New("copying files to the server is not allowed")
+
+// ErrMaintenance is returned when files are copied to the server during
+// maintenance.
+var ErrMaintenance = errors.New("copying files to the server is disabled for maintenance")
+
+// WithReadOnly rejects copies to the server from the sessions for which
+// readOnly returns true, e.g. based on their user. Use
+// func(ssh.Session) bool { return true } to make the server read-only.
+func WithReadOnly(readOnly func(ssh.Session) bool) Option {
+	return func(c *config) {
+		c.readOnly = readOnly
+	}
+}
+
+// WithMaintenance rejects copies to the server while m is in maintenance, from
+// the users it doesn't allow in. Unlike the admin package's maintenance
+// middleware, sessions are still accepted, so files can be downloaded. Copies
+// already running when maintenance starts aren't interrupted.
+func WithMaintenance(m *wish.Maintenance) Option {
+	return func(c *config) {
+		c.maintenance = m
+	}
+}
+
+// checkWrite returns the reason copies to the server are rejected for the
+// given session, if any.
+func (c *config) checkWrite(s ssh.Session) error {
+	if c.readOnly != nil && c.readOnly(s) {
+		return ErrReadOnly
+	}
+	if c.maintenance != nil {
+		if msg, ok := c.maintenance.Blocks(s.Context()); ok {
+			return fmt.Errorf("%w: %s", ErrMaintenance, msg)
+		}
+	}
+	return nil
+}
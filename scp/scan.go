@@ -0,0 +1,81 @@
+package scp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrRejected is returned when a content scanner rejects an upload.
+var ErrRejected = errors.New("upload rejected")
+
+// WithContentScanner calls scan with the path and contents of every file
+// copied from the client before handing it to the CopyFromClientHandler, e.g.
+// to check it with an antivirus or against a MIME type policy. If scan
+// returns an error, the copy is aborted with it and the file isn't written.
+//
+// Files are staged in a temporary directory, removed once the session ends,
+// while they're scanned.
+func WithContentScanner(scan func(path string, r io.Reader) error) Option {
+	return func(c *config) {
+		c.scanner = scan
+	}
+}
+
+// stage stages the files copied from the client of a session.
+type stage struct {
+	dir string
+}
+
+// scan copies r, of the given size, to a staging file and scans it. The
+// returned file is rewound, and must be closed with release.
+func (st *stage) scan(path string, r io.Reader, size int64, scanner func(string, io.Reader) error) (*os.File, error) {
+	if st.dir == "" {
+		dir, err := os.MkdirTemp("", "wish-scp-")
+		if err != nil {
+			return nil, err
+		}
+		st.dir = dir
+	}
+	f, err := os.CreateTemp(st.dir, "upload-")
+	if err != nil {
+		return nil, err
+	}
+	if err := st.fill(f, path, r, size, scanner); err != nil {
+		st.release(f)
+		return nil, err
+	}
+	return f, nil
+}
+
+func (st *stage) fill(f *os.File, path string, r io.Reader, size int64, scanner func(string, io.Reader) error) error {
+	written, err := io.Copy(f, r)
+	if err != nil {
+		return err
+	}
+	if written != size {
+		return fmt.Errorf("received %d out of %d bytes", written, size)
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := scanner(path, f); err != nil {
+		return fmt.Errorf("%w: %s", ErrRejected, err)
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return err
+}
+
+// release closes and removes a staging file.
+func (st *stage) release(f *os.File) {
+	_ = f.Close()
+	_ = os.Remove(f.Name())
+}
+
+// close removes the staging directory.
+func (st *stage) close() {
+	if st.dir != "" {
+		_ = os.RemoveAll(st.dir)
+	}
+}
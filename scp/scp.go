@@ -57,7 +57,8 @@ type Handler interface {
 
 // Middleware provides a wish middleware using the given CopyToClientHandler
 // and CopyFromClientHandler.
-func Middleware(rh CopyToClientHandler, wh CopyFromClientHandler) wish.Middleware {
+func Middleware(rh CopyToClientHandler, wh CopyFromClientHandler, opts ...Option) wish.Middleware {
+	cfg := newConfig(opts)
 	return func(sh ssh.Handler) ssh.Handler {
 		return func(s ssh.Session) {
 			info := GetInfo(s.Command())
@@ -79,7 +80,10 @@ func Middleware(rh CopyToClientHandler, wh CopyFromClientHandler) wish.Middlewar
 					err = fmt.Errorf("no handler provided for scp -t")
 					break
 				}
-				err = copyFromClient(s, info, wh)
+				if err = cfg.checkWrite(s); err != nil {
+					break
+				}
+				err = copyFromClient(s, info, wh, cfg)
 			}
 			if err != nil {
 				wish.Fatal(s, err)
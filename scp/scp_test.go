@@ -6,8 +6,10 @@ import (
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
 	"github.com/charmbracelet/wish/testsession"
 	"github.com/google/go-cmp/cmp"
 	"github.com/matryer/is"
@@ -112,10 +114,55 @@ func TestInvalidOps(t *testing.T) {
 	})
 }
 
-func setup(tb testing.TB, rh CopyToClientHandler, wh CopyFromClientHandler) *gossh.Session {
+func TestReadOnly(t *testing.T) {
+	upload := func(tb testing.TB, dir string, opts ...Option) error {
+		tb.Helper()
+		var in bytes.Buffer
+		in.WriteString("C0644 6 a.txt\nhello\n")
+		in.Write(NULL)
+		session := setup(tb, nil, NewFileSystemHandler(dir), opts...)
+		session.Stdin = &in
+		_, err := session.CombinedOutput("scp -t .")
+		return err
+	}
+
+	t.Run("read-only", func(t *testing.T) {
+		is := is.New(t)
+		readOnly := func(s ssh.Session) bool { return s.User() != "admin" }
+		is.True(upload(t, t.TempDir(), WithReadOnly(readOnly)) != nil)
+	})
+
+	t.Run("maintenance", func(t *testing.T) {
+		is := is.New(t)
+		var m wish.Maintenance
+		is.NoErr(upload(t, t.TempDir(), WithMaintenance(&m)))
+
+		m.Schedule(wish.Period{Start: time.Now()}, "back at noon")
+		is.Equal(1, len(m.Windows()))
+		err := upload(t, t.TempDir(), WithMaintenance(&m))
+		is.True(err != nil)
+
+		m.Set("back at noon", wish.Principal{User: "testuser"})
+		is.NoErr(upload(t, t.TempDir(), WithMaintenance(&m)))
+
+		m.Clear()
+		is.NoErr(upload(t, t.TempDir(), WithMaintenance(&m)))
+	})
+
+	t.Run("maintenance window", func(t *testing.T) {
+		is := is.New(t)
+		var m wish.Maintenance
+		now := time.Now()
+		m.Schedule(wish.Period{Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)}, "")
+		is.Equal("", m.Message())
+		is.NoErr(upload(t, t.TempDir(), WithMaintenance(&m)))
+	})
+}
+
+func setup(tb testing.TB, rh CopyToClientHandler, wh CopyFromClientHandler, opts ...Option) *gossh.Session {
 	tb.Helper()
 	return testsession.New(tb, &ssh.Server{
-		Handler: Middleware(rh, wh)(func(s ssh.Session) {
+		Handler: Middleware(rh, wh, opts...)(func(s ssh.Session) {
 			s.Exit(0)
 		}),
 	}, nil)
@@ -0,0 +1,113 @@
+// Package scrollback provides a middleware that keeps the recent output of
+// each user's sessions, so they can print it again if their terminal closed
+// unexpectedly.
+package scrollback
+
+import (
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	lru "github.com/hashicorp/golang-lru/v2"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Command is the command users run to print the output of their last session
+// again, e.g. `ssh host last`.
+const Command = "last"
+
+// Middleware keeps the last size bytes of output of the last session of up
+// to maxUsers users, and prints it again when they run Command. Users are
+// identified by their public key fingerprint, falling back to their user
+// name.
+//
+// Only the output written by the handlers to the session is kept: with
+// ssh.AllocatePty, the output of the PTY is copied to the session by the
+// server itself, and isn't seen by the middleware.
+func Middleware(size, maxUsers int) wish.Middleware {
+	if maxUsers <= 0 {
+		maxUsers = 1
+	}
+	// only possible error is if maxUsers is <= 0, which is prevented above.
+	buffers, _ := lru.New[string, *ring](maxUsers)
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			id := userID(s)
+			if cmd := s.Command(); len(cmd) == 1 && cmd[0] == Command {
+				buf, ok := buffers.Get(id)
+				if !ok {
+					wish.Exit(s, 1, "no output to show")
+					return
+				}
+				_, _ = s.Write(buf.Bytes())
+				return
+			}
+			buf := newRing(size)
+			buffers.Add(id, buf)
+			sh(&session{Session: s, buf: buf})
+		}
+	}
+}
+
+func userID(s ssh.Session) string {
+	if pk := s.PublicKey(); pk != nil {
+		return gossh.FingerprintSHA256(pk)
+	}
+	return "user:" + s.User()
+}
+
+// session records everything written to it.
+type session struct {
+	ssh.Session
+	buf *ring
+}
+
+func (s *session) Write(p []byte) (int, error) {
+	_, _ = s.buf.Write(p)
+	return s.Session.Write(p)
+}
+
+// ring keeps the last bytes written to it.
+type ring struct {
+	mu    sync.Mutex
+	b     []byte
+	start int
+	full  bool
+}
+
+func newRing(size int) *ring {
+	if size <= 0 {
+		size = 1
+	}
+	return &ring{b: make([]byte, size)}
+}
+
+func (r *ring) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := len(p)
+	if len(p) >= len(r.b) {
+		copy(r.b, p[len(p)-len(r.b):])
+		r.start, r.full = 0, true
+		return n, nil
+	}
+	for len(p) > 0 {
+		c := copy(r.b[r.start:], p)
+		p = p[c:]
+		r.start += c
+		if r.start == len(r.b) {
+			r.start, r.full = 0, true
+		}
+	}
+	return n, nil
+}
+
+// Bytes returns a copy of the kept bytes, oldest first.
+func (r *ring) Bytes() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]byte(nil), r.b[:r.start]...)
+	}
+	return append(append([]byte(nil), r.b[r.start:]...), r.b[:r.start]...)
+}
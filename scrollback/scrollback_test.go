@@ -0,0 +1,67 @@
+package scrollback
+
+import (
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestMiddleware(t *testing.T) {
+	addr := testsession.Listen(t, &ssh.Server{
+		Handler: Middleware(8, 10)(func(s ssh.Session) {
+			wish.Print(s, "hello world")
+		}),
+	})
+
+	run := func(cmd string) (string, error) {
+		t.Helper()
+		sess, err := testsession.NewClientSession(t, addr, nil)
+		requireNoError(t, err)
+		out, err := sess.CombinedOutput(cmd)
+		return string(out), err
+	}
+
+	if _, err := run(Command); err == nil {
+		t.Fatal("expected an error without previous sessions")
+	}
+
+	out, err := run("")
+	requireNoError(t, err)
+	if out != "hello world" {
+		t.Errorf("unexpected output: %q", out)
+	}
+
+	out, err = run(Command)
+	requireNoError(t, err)
+	if out != "lo world" {
+		t.Errorf("unexpected scrollback: %q", out)
+	}
+}
+
+func TestRing(t *testing.T) {
+	r := newRing(5)
+	for _, tc := range []struct {
+		input    string
+		expected string
+	}{
+		{"ab", "ab"},
+		{"cd", "abcd"},
+		{"efg", "cdefg"},
+		{"hijklmn", "jklmn"},
+	} {
+		_, _ = r.Write([]byte(tc.input))
+		if got := string(r.Bytes()); got != tc.expected {
+			t.Errorf("after writing %q, expected %q, got %q", tc.input, tc.expected, got)
+		}
+	}
+}
+
+func requireNoError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err.Error())
+	}
+}
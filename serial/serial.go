@@ -0,0 +1,208 @@
+// Package serial serves wish apps on serial consoles and other terminal
+// devices, e.g. /dev/ttyS0 or /dev/ttyUSB0, like getty does, so the same app
+// can be used from hardware consoles and over SSH from one binary.
+//
+// There's no authentication: whoever is at the console gets sessions, as the
+// user set with WithUser, without a public key. Sessions go through the same
+// handler chain as SSH sessions, with an emulated PTY. Serial lines don't tell
+// about the terminal at the other end, so its type and size are set with
+// WithTerm and WithWindow, and the line's speed isn't changed: set it with
+// stty beforehand.
+package serial
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/log"
+	"github.com/charmbracelet/wish/internal/session"
+	"golang.org/x/term"
+)
+
+// ClientVersion is the client version of the contexts of serial sessions.
+const ClientVersion = "serial"
+
+// DefaultUser is the name of the user of serial sessions when none is set with
+// WithUser.
+const DefaultUser = "console"
+
+// DefaultTerm and DefaultWindow describe the terminal when none is set with
+// WithTerm and WithWindow.
+var (
+	DefaultTerm   = "vt100"
+	DefaultWindow = ssh.Window{Width: 80, Height: 24}
+)
+
+// IsSerial returns whether the session with the given context is a serial
+// session.
+func IsSerial(ctx ssh.Context) bool {
+	return ctx.ClientVersion() == ClientVersion
+}
+
+type config struct {
+	user string
+	term string
+	win  ssh.Window
+}
+
+// Option configures Serve.
+type Option func(*config)
+
+// WithUser sets the name of the user of the sessions.
+func WithUser(name string) Option {
+	return func(c *config) {
+		c.user = name
+	}
+}
+
+// WithTerm sets the type of the terminal, i.e. the TERM of the sessions.
+func WithTerm(term string) Option {
+	return func(c *config) {
+		c.term = term
+	}
+}
+
+// WithWindow sets the size of the terminal.
+func WithWindow(win ssh.Window) Option {
+	return func(c *config) {
+		c.win = win
+	}
+}
+
+// Serve serves the handler of srv, with its middlewares, e.g. as set up with
+// wish.NewServer, on the terminal device at path, until the context is done or
+// the device fails.
+//
+// Sessions run one after another: each one starts when a key is pressed, and
+// the key is discarded, so the console doesn't spin when an app exits right
+// away, e.g. because nothing is connected to the line. Keys typed as a session
+// ends that it didn't read go to the next one, the first starting it.
+func Serve(ctx context.Context, srv *ssh.Server, path string, opts ...Option) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close() // nolint: errcheck
+
+	if fd := int(f.Fd()); term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer term.Restore(fd, state) // nolint: errcheck
+	}
+	return serve(ctx, srv, f, path, opts...)
+}
+
+func serve(ctx context.Context, srv *ssh.Server, dev io.ReadWriteCloser, path string, opts ...Option) error {
+	cfg := config{
+		user: DefaultUser,
+		term: DefaultTerm,
+		win:  DefaultWindow,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	devAddr := addr(path)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		// unblocks reads.
+		<-ctx.Done()
+		_ = dev.Close()
+	}()
+
+	input := make(chan []byte)
+	errc := make(chan error, 1)
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, err := dev.Read(buf)
+			if n > 0 {
+				select {
+				case input <- append([]byte(nil), buf[:n]...):
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+	fail := func(err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return err
+	}
+
+	// pending is what was typed as a session ended that it didn't read.
+	var pending []byte
+	for {
+		if len(pending) > 0 {
+			// its first key starts the session.
+			pending = pending[1:]
+		} else {
+			select {
+			case p := <-input:
+				pending = p[1:]
+			case err := <-errc:
+				return fail(err)
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		log.Debug("serial session", "device", path)
+		sess := session.New(ctx, dev, session.Config{
+			Server:        srv,
+			User:          cfg.user,
+			ClientVersion: ClientVersion,
+			Term:          cfg.term,
+			Window:        cfg.win,
+			Environ:       []string{"TERM=" + cfg.term},
+			LocalAddr:     devAddr,
+			RemoteAddr:    devAddr,
+		})
+		if len(pending) > 0 {
+			sess.Input(pending)
+		}
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			sess.Run()
+		}()
+
+		// late is what was typed once the handler returned, which the
+		// session didn't take.
+		var late []byte
+	running:
+		for {
+			select {
+			case p := <-input:
+				if !sess.Input(p) {
+					late = append(late, p...)
+				}
+			case err := <-errc:
+				sess.CloseInput(err)
+				_ = sess.Close()
+				<-done
+				return fail(err)
+			case <-done:
+				break running
+			}
+		}
+		pending = append(sess.Unread(), late...)
+	}
+}
+
+// addr is the address of a device.
+type addr string
+
+func (a addr) Network() string { return "serial" }
+func (a addr) String() string  { return string(a) }
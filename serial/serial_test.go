@@ -0,0 +1,121 @@
+package serial
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// device is the end of a serial line the server is attached to.
+type device struct {
+	io.Reader
+	io.Writer
+	closers []io.Closer
+}
+
+func (d device) Close() error {
+	for _, c := range d.closers {
+		_ = c.Close()
+	}
+	return nil
+}
+
+func TestServe(t *testing.T) {
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			pty, _, ok := s.Pty()
+			fmt.Fprintf(s, "pty=%v term=%s size=%dx%d user=%s serial=%v\n",
+				ok, pty.Term, pty.Window.Width, pty.Window.Height, s.User(), IsSerial(s.Context()))
+			line, _ := bufio.NewReader(s).ReadString('\r')
+			fmt.Fprintf(s, "got %q\n", line)
+		},
+	}
+
+	// in is what's typed on the console, out what's shown on it.
+	inr, inw := io.Pipe()
+	outr, outw := io.Pipe()
+	dev := device{inr, outw, []io.Closer{inr, outw}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		errc <- serve(ctx, srv, dev, "/dev/ttyS0", WithUser("operator"), WithTerm("vt220"), WithWindow(ssh.Window{Width: 132, Height: 43}))
+	}()
+
+	out := bufio.NewReader(outr)
+	for i := 0; i < 2; i++ {
+		// the key starting the session is discarded.
+		if _, err := io.WriteString(inw, "x"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expectLine(t, out, "pty=true term=vt220 size=132x43 user=operator serial=true\r\n")
+		if _, err := io.WriteString(inw, "hello\r"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expectLine(t, out, "got \"hello\\r\"\r\n")
+	}
+
+	cancel()
+	select {
+	case err := <-errc:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context.Canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected serve to return")
+	}
+}
+
+func TestServeKeysAsSessionEnds(t *testing.T) {
+	var sessions atomic.Int64
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			n := sessions.Add(1)
+			fmt.Fprintf(s, "session %d\n", n)
+			if n%2 == 1 {
+				return
+			}
+			line, _ := bufio.NewReader(s).ReadString('\r')
+			fmt.Fprintf(s, "got %q\n", line)
+		},
+	}
+
+	inr, inw := io.Pipe()
+	outr, outw := io.Pipe()
+	dev := device{inr, outw, []io.Closer{inr, outw}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = serve(ctx, srv, dev, "/dev/ttyS0") }()
+
+	out := bufio.NewReader(outr)
+	for i := 1; i < 6; i += 2 {
+		if _, err := io.WriteString(inw, "x"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expectLine(t, out, fmt.Sprintf("session %d\r\n", i))
+		// typed while the session ends, it starts the next one.
+		if _, err := io.WriteString(inw, "yhi\r"); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		expectLine(t, out, fmt.Sprintf("session %d\r\n", i+1))
+		expectLine(t, out, "got \"hi\\r\"\r\n")
+	}
+}
+
+func expectLine(tb testing.TB, r *bufio.Reader, expect string) {
+	tb.Helper()
+	line, err := r.ReadString('\n')
+	if err != nil {
+		tb.Fatalf("expected no error, got %v", err)
+	}
+	if line != expect {
+		tb.Errorf("expected %q, got %q", expect, line)
+	}
+}
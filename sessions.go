@@ -0,0 +1,250 @@
+package wish
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// noMoreSessionsRequest is the request OpenSSH clients send to tell the
+// server they won't open more sessions on their connection.
+const noMoreSessionsRequest = "no-more-sessions@openssh.com"
+
+type sessionLimitsKey struct{}
+
+// sessionLimits is the state of a connection's session limits.
+type sessionLimits struct {
+	open           atomic.Int64
+	noMoreSessions atomic.Bool
+}
+
+func sessionLimitsFor(ctx ssh.Context) *sessionLimits {
+	ctx.Lock()
+	defer ctx.Unlock()
+	l, ok := ctx.Value(sessionLimitsKey{}).(*sessionLimits)
+	if !ok {
+		l = &sessionLimits{}
+		ctx.SetValue(sessionLimitsKey{}, l)
+	}
+	return l
+}
+
+// WithMaxSessions returns an ssh.Option that limits the number of channels a
+// connection can have open at the same time, whatever their type: sessions,
+// and port forwardings alike. Clients multiplexing them over a single
+// connection, e.g. with OpenSSH's ControlMaster, would otherwise get around
+// per-connection limits. Channels past the limit are rejected. A max of zero
+// or less doesn't limit channels.
+func WithMaxSessions(n int) ssh.Option {
+	return func(s *ssh.Server) error {
+		if n <= 0 {
+			return nil
+		}
+		wrapHandlers(s, func(h ssh.ChannelHandler) ssh.ChannelHandler {
+			return func(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
+				l := sessionLimitsFor(ctx)
+				if l.open.Add(1) > int64(n) {
+					l.open.Add(-1)
+					_ = newChan.Reject(gossh.ResourceShortage, "too many channels")
+					return
+				}
+				var once sync.Once
+				cc := &countedChannel{NewChannel: newChan, release: func() {
+					once.Do(func() { l.open.Add(-1) })
+				}}
+				h(srv, conn, cc, ctx)
+				if !cc.accepted.Load() {
+					cc.release()
+				}
+			}
+		}, nil)
+		return nil
+	}
+}
+
+// countedChannel releases its slot once the channel it accepts is closed, as
+// handlers, e.g. for port forwarding, can return before it is.
+type countedChannel struct {
+	gossh.NewChannel
+	accepted atomic.Bool
+	release  func()
+}
+
+// Accept implements gossh.NewChannel.
+func (c *countedChannel) Accept() (gossh.Channel, <-chan *gossh.Request, error) {
+	ch, reqs, err := c.NewChannel.Accept()
+	if err != nil {
+		return nil, nil, err
+	}
+	c.accepted.Store(true)
+	// the requests of a channel are closed along with it.
+	out := make(chan *gossh.Request)
+	go func() {
+		defer c.release()
+		defer close(out)
+		for req := range reqs {
+			out <- req
+		}
+	}()
+	return ch, out, nil
+}
+
+// WithNoMoreSessions returns an ssh.Option that honors the
+// no-more-sessions@openssh.com request: once a client sends it, new sessions
+// on its connection are rejected.
+func WithNoMoreSessions() ssh.Option {
+	return func(s *ssh.Server) error {
+		if s.RequestHandlers == nil {
+			s.RequestHandlers = map[string]ssh.RequestHandler{}
+			for k, v := range ssh.DefaultRequestHandlers {
+				s.RequestHandlers[k] = v
+			}
+		}
+		s.RequestHandlers[noMoreSessionsRequest] = func(ctx ssh.Context, _ *ssh.Server, _ *gossh.Request) (bool, []byte) {
+			sessionLimitsFor(ctx).noMoreSessions.Store(true)
+			return true, nil
+		}
+		wrapSessionHandler(s, func(h ssh.ChannelHandler) ssh.ChannelHandler {
+			return func(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
+				if sessionLimitsFor(ctx).noMoreSessions.Load() {
+					_ = newChan.Reject(gossh.Prohibited, "no more sessions")
+					return
+				}
+				h(srv, conn, newChan, ctx)
+			}
+		})
+		return nil
+	}
+}
+
+// wrapSessionHandler wraps the server session channel handler.
+func wrapSessionHandler(s *ssh.Server, wrap func(ssh.ChannelHandler) ssh.ChannelHandler) {
+	initChannelHandlers(s)
+	h, ok := s.ChannelHandlers["session"]
+	if !ok {
+		h = ssh.DefaultSessionHandler
+	}
+	s.ChannelHandlers["session"] = wrap(h)
+}
+
+// initChannelHandlers sets the server channel handlers to the default ones if
+// there are none, so others can be added.
+func initChannelHandlers(s *ssh.Server) {
+	if s.ChannelHandlers == nil {
+		s.ChannelHandlers = map[string]ssh.ChannelHandler{}
+		for k, v := range ssh.DefaultChannelHandlers {
+			s.ChannelHandlers[k] = v
+		}
+	}
+}
+
+// wrapHandlers wraps all the server channel and request handlers, e.g. for
+// port forwarding, when the first connection comes in, so those set by the
+// options applied after it are wrapped too. Request handlers are only
+// wrapped if wrapRequest isn't nil.
+func wrapHandlers(s *ssh.Server, wrapChannel func(ssh.ChannelHandler) ssh.ChannelHandler, wrapRequest func(ssh.RequestHandler) ssh.RequestHandler) {
+	var once sync.Once
+	next := s.ConnCallback
+	s.ConnCallback = func(ctx ssh.Context, conn net.Conn) net.Conn {
+		// connections only read the handlers once they went through
+		// here, so they're never changed while being read.
+		once.Do(func() {
+			initChannelHandlers(s)
+			for k, h := range s.ChannelHandlers {
+				s.ChannelHandlers[k] = wrapChannel(h)
+			}
+			if wrapRequest == nil {
+				return
+			}
+			if s.RequestHandlers == nil {
+				s.RequestHandlers = map[string]ssh.RequestHandler{}
+				for k, v := range ssh.DefaultRequestHandlers {
+					s.RequestHandlers[k] = v
+				}
+			}
+			for k, h := range s.RequestHandlers {
+				s.RequestHandlers[k] = wrapRequest(h)
+			}
+		})
+		if next != nil {
+			return next(ctx, conn)
+		}
+		return conn
+	}
+}
+
+// ConnHandler is run once per connection, after authentication and before its
+// first channel, e.g. a session or a port forwarding, is opened, or its first
+// global request, e.g. a remote port forwarding, is handled.
+//
+// Returning an error rejects the channel or request and closes the
+// connection. The error message is sent to the client when rejecting a
+// channel.
+type ConnHandler func(ctx ssh.Context, conn *gossh.ServerConn) error
+
+// connStateKey is the context key of the state of a WithConnHandler option.
+// Each option has its own, and it isn't zero-sized so their addresses differ.
+type connStateKey struct{ _ byte }
+
+// connState is the result of a connection's handlers.
+type connState struct {
+	once sync.Once
+	err  error
+}
+
+// WithConnHandler returns an ssh.Option running the given handlers in order,
+// once per connection, rather than once per session like middlewares. It's
+// useful for work that doesn't need to be repeated for every session of
+// clients multiplexing them over a connection, e.g. looking up the remote
+// address, or checking bans. Values they set in the context are visible to
+// all the sessions of the connection.
+//
+// They gate every channel and global request of the connection, so clients
+// can't get around them by only forwarding ports, e.g. with ssh -N -L.
+func WithConnHandler(handlers ...ConnHandler) ssh.Option {
+	return func(s *ssh.Server) error {
+		key := &connStateKey{}
+		check := func(ctx ssh.Context, conn *gossh.ServerConn) error {
+			ctx.Lock()
+			st, ok := ctx.Value(key).(*connState)
+			if !ok {
+				st = &connState{}
+				ctx.SetValue(key, st)
+			}
+			ctx.Unlock()
+			st.once.Do(func() {
+				for _, ch := range handlers {
+					if st.err = ch(ctx, conn); st.err != nil {
+						return
+					}
+				}
+			})
+			return st.err
+		}
+		wrapHandlers(s, func(h ssh.ChannelHandler) ssh.ChannelHandler {
+			return func(srv *ssh.Server, conn *gossh.ServerConn, newChan gossh.NewChannel, ctx ssh.Context) {
+				if err := check(ctx, conn); err != nil {
+					_ = newChan.Reject(gossh.Prohibited, err.Error())
+					_ = conn.Close()
+					return
+				}
+				h(srv, conn, newChan, ctx)
+			}
+		}, func(h ssh.RequestHandler) ssh.RequestHandler {
+			return func(ctx ssh.Context, srv *ssh.Server, req *gossh.Request) (bool, []byte) {
+				conn, _ := ctx.Value(ssh.ContextKeyConn).(*gossh.ServerConn)
+				if err := check(ctx, conn); err != nil {
+					if conn != nil {
+						_ = conn.Close()
+					}
+					return false, nil
+				}
+				return h(ctx, srv, req)
+			}
+		})
+		return nil
+	}
+}
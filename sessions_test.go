@@ -0,0 +1,266 @@
+package wish
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestWithMaxSessions(t *testing.T) {
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			_, _ = io.Copy(io.Discard, s)
+		},
+	}
+	requireNoError(t, WithMaxSessions(1)(srv))
+	c := dial(t, testsession.Listen(t, srv))
+
+	first, err := c.NewSession()
+	requireNoError(t, err)
+	if _, err := c.NewSession(); err == nil {
+		t.Fatal("expected the second session to be rejected")
+	}
+
+	// closing the first session frees its slot, once the server is done
+	// with it.
+	stdin, err := first.StdinPipe()
+	requireNoError(t, err)
+	requireNoError(t, first.Shell())
+	requireNoError(t, stdin.Close())
+	requireNoError(t, first.Wait())
+	deadline := time.Now().Add(time.Second)
+	for {
+		sess, err := c.NewSession()
+		if err == nil {
+			requireNoError(t, sess.Run(""))
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWithMaxSessionsForwarding(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	requireNoError(t, err)
+	defer ln.Close() // nolint: errcheck
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() { _, _ = io.Copy(conn, conn) }()
+		}
+	}()
+
+	srv := &ssh.Server{
+		Handler: func(ssh.Session) {},
+		ChannelHandlers: map[string]ssh.ChannelHandler{
+			"session":      ssh.DefaultSessionHandler,
+			"direct-tcpip": ssh.DirectTCPIPHandler,
+		},
+		LocalPortForwardingCallback: func(ssh.Context, string, uint32) bool {
+			return true
+		},
+	}
+	requireNoError(t, WithMaxSessions(1)(srv))
+	c := dial(t, testsession.Listen(t, srv))
+
+	// the forwarding handler returns right away, but its channel stays
+	// open.
+	conn, err := c.Dial("tcp", ln.Addr().String())
+	requireNoError(t, err)
+	time.Sleep(50 * time.Millisecond)
+	if _, err := c.NewSession(); err == nil {
+		t.Fatal("expected the session to be rejected while forwarding")
+	}
+	if _, err := c.Dial("tcp", ln.Addr().String()); err == nil {
+		t.Fatal("expected the second forwarding to be rejected")
+	}
+
+	requireNoError(t, conn.Close())
+	deadline := time.Now().Add(time.Second)
+	for {
+		sess, err := c.NewSession()
+		if err == nil {
+			requireNoError(t, sess.Run(""))
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWithNoMoreSessions(t *testing.T) {
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {},
+	}
+	requireNoError(t, WithNoMoreSessions()(srv))
+	c := dial(t, testsession.Listen(t, srv))
+
+	sess, err := c.NewSession()
+	requireNoError(t, err)
+	requireNoError(t, sess.Run(""))
+
+	ok, _, err := c.SendRequest(noMoreSessionsRequest, true, nil)
+	requireNoError(t, err)
+	if !ok {
+		t.Fatal("expected the request to be accepted")
+	}
+	if _, err := c.NewSession(); err == nil {
+		t.Fatal("expected the session to be rejected")
+	}
+}
+
+func dial(tb testing.TB, addr string) *gossh.Client {
+	tb.Helper()
+	c, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+		User:            "testuser",
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+	})
+	requireNoError(tb, err)
+	tb.Cleanup(func() { _ = c.Close() })
+	return c
+}
+
+func TestWithConnHandler(t *testing.T) {
+	type countKey struct{}
+	var calls atomic.Int64
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			Print(s, s.Context().Value(countKey{}))
+		},
+	}
+	requireNoError(t, WithConnHandler(
+		func(ctx ssh.Context, _ *gossh.ServerConn) error {
+			ctx.SetValue(countKey{}, calls.Add(1))
+			return nil
+		},
+		func(ctx ssh.Context, _ *gossh.ServerConn) error {
+			if ctx.User() == "banned" {
+				return errors.New("you are banned")
+			}
+			return nil
+		},
+	)(srv))
+	addr := testsession.Listen(t, srv)
+
+	c := dial(t, addr)
+	for i := 0; i < 3; i++ {
+		sess, err := c.NewSession()
+		requireNoError(t, err)
+		out, err := sess.Output("")
+		requireNoError(t, err)
+		requireEqual(t, "1", string(out))
+	}
+	c = dial(t, addr)
+	sess, err := c.NewSession()
+	requireNoError(t, err)
+	out, err := sess.Output("")
+	requireNoError(t, err)
+	requireEqual(t, "2", string(out))
+
+	c, err = gossh.Dial("tcp", addr, &gossh.ClientConfig{
+		User:            "banned",
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+	})
+	requireNoError(t, err)
+	defer c.Close() // nolint: errcheck
+	if _, err := c.NewSession(); err == nil || !strings.Contains(err.Error(), "you are banned") {
+		t.Errorf("expected the session to be rejected, got %v", err)
+	}
+	if err := c.Wait(); err == nil {
+		t.Error("expected the connection to be closed")
+	}
+}
+
+func TestWithConnHandlerTwice(t *testing.T) {
+	var first, second atomic.Int64
+	srv := &ssh.Server{
+		Handler: func(ssh.Session) {},
+	}
+	requireNoError(t, WithConnHandler(func(ssh.Context, *gossh.ServerConn) error {
+		first.Add(1)
+		return nil
+	})(srv))
+	requireNoError(t, WithConnHandler(func(ssh.Context, *gossh.ServerConn) error {
+		second.Add(1)
+		return nil
+	})(srv))
+	addr := testsession.Listen(t, srv)
+
+	c := dial(t, addr)
+	for i := 0; i < 2; i++ {
+		sess, err := c.NewSession()
+		requireNoError(t, err)
+		requireNoError(t, sess.Run(""))
+	}
+	requireEqual(t, int64(1), first.Load())
+	requireEqual(t, int64(1), second.Load())
+}
+
+func TestWithConnHandlerForwarding(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	requireNoError(t, err)
+	defer ln.Close() // nolint: errcheck
+
+	forwardHandler := &ssh.ForwardedTCPHandler{}
+	srv := &ssh.Server{
+		Handler: func(ssh.Session) {},
+		LocalPortForwardingCallback: func(ssh.Context, string, uint32) bool {
+			return true
+		},
+		ReversePortForwardingCallback: func(ssh.Context, string, uint32) bool {
+			return true
+		},
+	}
+	requireNoError(t, WithConnHandler(func(ctx ssh.Context, _ *gossh.ServerConn) error {
+		if ctx.User() == "banned" {
+			return errors.New("you are banned")
+		}
+		return nil
+	})(srv))
+	// handlers set after the option are gated too.
+	srv.ChannelHandlers = map[string]ssh.ChannelHandler{
+		"session":      ssh.DefaultSessionHandler,
+		"direct-tcpip": ssh.DirectTCPIPHandler,
+	}
+	srv.RequestHandlers = map[string]ssh.RequestHandler{
+		"tcpip-forward":        forwardHandler.HandleSSHRequest,
+		"cancel-tcpip-forward": forwardHandler.HandleSSHRequest,
+	}
+	addr := testsession.Listen(t, srv)
+
+	conn, err := dial(t, addr).Dial("tcp", ln.Addr().String())
+	requireNoError(t, err)
+	_ = conn.Close()
+
+	dialBanned := func() *gossh.Client {
+		c, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+			User:            "banned",
+			HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+		})
+		requireNoError(t, err)
+		t.Cleanup(func() { _ = c.Close() })
+		return c
+	}
+	if _, err := dialBanned().Dial("tcp", ln.Addr().String()); err == nil || !strings.Contains(err.Error(), "you are banned") {
+		t.Errorf("expected the local forwarding to be rejected, got %v", err)
+	}
+	if _, err := dialBanned().Listen("tcp", "127.0.0.1:0"); err == nil {
+		t.Error("expected the remote forwarding to be rejected")
+	}
+}
@@ -0,0 +1,470 @@
+// Package sftp serves the SFTP subsystem from a directory, so OpenSSH clients
+// can use sftp, and scp, which uses SFTP by default since OpenSSH 9.0.
+//
+// The directory is the root of what clients see: paths can't go above it.
+// Symbolic links can't be created, but the ones already in the directory are
+// followed, so don't put links to the outside in there.
+//
+// The posix-rename, statvfs and hardlink OpenSSH extensions are served, for
+// clients like sshfs, see WithoutExtensions.
+//
+// # Performance
+//
+// The requests of a session are handled concurrently, so the parallel reads
+// sshfs issues to read ahead are served in parallel. Use WithAllocator to
+// reuse packet buffers under such workloads. Write coalescing and attribute
+// caching are up to clients, e.g. sshfs's kernel_cache and cache_timeout
+// options, as SFTP has no way to hint them, and the maximum packet size is
+// fixed by pkg/sftp, at 256KiB.
+package sftp
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+	gosftp "github.com/pkg/sftp"
+)
+
+// Subsystem is the name of the SFTP subsystem.
+const Subsystem = "sftp"
+
+// The OpenSSH extensions served, unless disabled with WithoutExtensions.
+const (
+	ExtensionPosixRename = "posix-rename@openssh.com"
+	ExtensionStatVFS     = "statvfs@openssh.com"
+	ExtensionHardlink    = "hardlink@openssh.com"
+)
+
+type config struct {
+	readOnly    func(ssh.Session) bool
+	maintenance *wish.Maintenance
+	filter      func(ssh.Session, string) bool
+	disabled    map[string]bool
+	allocator   bool
+}
+
+// Option configures Middleware.
+type Option func(*config)
+
+// ErrMaintenance is returned when files are changed during maintenance.
+var ErrMaintenance = errors.New("changing files is disabled for maintenance")
+
+// WithReadOnly denies every change to the sessions for which readOnly returns
+// true, e.g. based on their user: they can only list and download files. Use
+// func(ssh.Session) bool { return true } to make the server read-only.
+func WithReadOnly(readOnly func(ssh.Session) bool) Option {
+	return func(c *config) {
+		c.readOnly = readOnly
+	}
+}
+
+// WithMaintenance denies every change while m is in maintenance, to the users
+// it doesn't allow in. Unlike the admin package's maintenance middleware,
+// sessions are still accepted, so files can be downloaded.
+func WithMaintenance(m *wish.Maintenance) Option {
+	return func(c *config) {
+		c.maintenance = m
+	}
+}
+
+// WithPathFilter only lets sessions access the paths fn returns true for.
+// Paths are relative to the root, with forward slashes, e.g. "/docs/a.txt".
+// Others are denied, and left out of directory listings.
+//
+// fn is called for every path of every request: the paths of directories
+// are filtered too, but that doesn't apply to what's in them.
+func WithPathFilter(fn func(s ssh.Session, path string) bool) Option {
+	return func(c *config) {
+		c.filter = fn
+	}
+}
+
+// WithoutExtensions disables the given OpenSSH extensions, e.g.
+// ExtensionHardlink. Their requests fail as unsupported.
+//
+// pkg/sftp advertises the extensions to clients for the whole process, so
+// they're still advertised, unless disabled with sftp.SetSFTPExtensions from
+// github.com/pkg/sftp too.
+func WithoutExtensions(extensions ...string) Option {
+	return func(c *config) {
+		if c.disabled == nil {
+			c.disabled = map[string]bool{}
+		}
+		for _, ext := range extensions {
+			c.disabled[ext] = true
+		}
+	}
+}
+
+// WithAllocator reuses the buffers of the packets of each session, instead of
+// allocating them for every request, which lowers the garbage collection load
+// of sessions reading or writing a lot, like sshfs mounts. It uses pkg/sftp's
+// allocator, which it marks as experimental.
+func WithAllocator() Option {
+	return func(c *config) {
+		c.allocator = true
+	}
+}
+
+// Enable returns an ssh.Option accepting the SFTP subsystem, so its sessions
+// go through the middlewares, to the one set up with Middleware:
+//
+//	var m wish.Maintenance
+//	wish.NewServer(
+//		sftp.Enable(),
+//		wish.WithMiddleware(
+//			sftp.Middleware("/srv/files", sftp.WithMaintenance(&m)),
+//			logging.Middleware(),
+//		),
+//	)
+//
+// Sessions are rejected if no middleware serves them.
+func Enable() ssh.Option {
+	return wish.WithChainedSubsystem(Subsystem, func(s ssh.Session) {
+		wish.Exit(s, 1, "sftp is not available")
+	})
+}
+
+// Middleware serves SFTP sessions from the root directory, and passes the
+// other sessions to the next handler. See Enable.
+func Middleware(root string, opts ...Option) wish.Middleware {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if s.Subsystem() != Subsystem {
+				sh(s)
+				return
+			}
+			h := &handler{root: root, cfg: cfg, s: s}
+			var opts []gosftp.RequestServerOption
+			if cfg.allocator {
+				opts = append(opts, gosftp.WithRSAllocator())
+			}
+			srv := gosftp.NewRequestServer(s, gosftp.Handlers{
+				FileGet:  h,
+				FilePut:  h,
+				FileCmd:  h,
+				FileList: h,
+			}, opts...)
+			err := srv.Serve()
+			_ = srv.Close()
+			if err != nil && !errors.Is(err, io.EOF) {
+				log.Error("sftp session failed", "user", s.User(), "error", err)
+				wish.Exit(s, 1, "sftp: "+err.Error())
+			}
+		}
+	}
+}
+
+// handler handles the requests of a session.
+type handler struct {
+	root string
+	cfg  config
+	s    ssh.Session
+}
+
+var (
+	_ gosftp.FileReader           = &handler{}
+	_ gosftp.FileWriter           = &handler{}
+	_ gosftp.OpenFileWriter       = &handler{}
+	_ gosftp.FileCmder            = &handler{}
+	_ gosftp.FileLister           = &handler{}
+	_ gosftp.LstatFileLister      = &handler{}
+	_ gosftp.PosixRenameFileCmder = &handler{}
+	_ gosftp.StatVFSFileCmder     = &handler{}
+)
+
+// allowed returns whether the session can access the path.
+func (h *handler) allowed(p string) bool {
+	return h.cfg.filter == nil || h.cfg.filter(h.s, p)
+}
+
+// local returns the local path of the path of a request, which is always
+// absolute and clean, so it can't go above the root.
+func (h *handler) local(p string) (string, error) {
+	if !h.allowed(p) {
+		return "", gosftp.ErrSSHFxPermissionDenied
+	}
+	return filepath.Join(h.root, filepath.FromSlash(path.Clean("/"+p))), nil
+}
+
+// supports returns an error if the extension is disabled.
+func (h *handler) supports(ext string) error {
+	if h.cfg.disabled[ext] {
+		return gosftp.ErrSSHFxOpUnsupported
+	}
+	return nil
+}
+
+// writable returns an error if changes are denied. The message of
+// maintenance errors is sent to the client.
+func (h *handler) writable() error {
+	if h.cfg.readOnly != nil && h.cfg.readOnly(h.s) {
+		return gosftp.ErrSSHFxPermissionDenied
+	}
+	if h.cfg.maintenance != nil {
+		if msg, ok := h.cfg.maintenance.Blocks(h.s.Context()); ok {
+			return fmt.Errorf("%w: %s", ErrMaintenance, msg)
+		}
+	}
+	return nil
+}
+
+// clientError replaces the local path in the error with the path the client
+// asked for, so clients don't learn about the root.
+func clientError(err error, p string) error {
+	var perr *os.PathError
+	if errors.As(err, &perr) {
+		return &os.PathError{Op: perr.Op, Path: p, Err: perr.Err}
+	}
+	var lerr *os.LinkError
+	if errors.As(err, &lerr) {
+		return &os.PathError{Op: lerr.Op, Path: p, Err: lerr.Err}
+	}
+	return err
+}
+
+// Fileread implements sftp.FileReader.
+func (h *handler) Fileread(r *gosftp.Request) (io.ReaderAt, error) {
+	p, err := h.local(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, clientError(err, r.Filepath)
+	}
+	return f, nil
+}
+
+// Filewrite implements sftp.FileWriter.
+func (h *handler) Filewrite(r *gosftp.Request) (io.WriterAt, error) {
+	return h.OpenFile(r)
+}
+
+// OpenFile implements sftp.OpenFileWriter.
+func (h *handler) OpenFile(r *gosftp.Request) (gosftp.WriterAtReaderAt, error) {
+	pflags := r.Pflags()
+	if pflags.Write {
+		if err := h.writable(); err != nil {
+			return nil, err
+		}
+	}
+	p, err := h.local(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(p, openFlags(pflags), 0o644)
+	if err != nil {
+		return nil, clientError(err, r.Filepath)
+	}
+	return f, nil
+}
+
+func openFlags(pflags gosftp.FileOpenFlags) int {
+	var flags int
+	switch {
+	case pflags.Read && pflags.Write:
+		flags = os.O_RDWR
+	case pflags.Write:
+		flags = os.O_WRONLY
+	default:
+		flags = os.O_RDONLY
+	}
+	if pflags.Append {
+		flags |= os.O_APPEND
+	}
+	if pflags.Creat {
+		flags |= os.O_CREATE
+	}
+	if pflags.Excl {
+		flags |= os.O_EXCL
+	}
+	if pflags.Trunc {
+		flags |= os.O_TRUNC
+	}
+	return flags
+}
+
+// Filecmd implements sftp.FileCmder.
+func (h *handler) Filecmd(r *gosftp.Request) error {
+	if err := h.writable(); err != nil {
+		return err
+	}
+	p, err := h.local(r.Filepath)
+	if err != nil {
+		return err
+	}
+	switch r.Method {
+	case "Setstat":
+		err = h.setstat(p, r)
+	case "Rename":
+		var target string
+		if target, err = h.local(r.Target); err != nil {
+			return err
+		}
+		// unlike POSIX renames, SFTP ones don't replace files.
+		if _, err := os.Lstat(target); err == nil {
+			return gosftp.ErrSSHFxFailure
+		}
+		err = os.Rename(p, target)
+	case "Mkdir":
+		err = os.Mkdir(p, 0o755)
+	case "Rmdir", "Remove":
+		var fi os.FileInfo
+		if fi, err = os.Lstat(p); err == nil {
+			if fi.IsDir() != (r.Method == "Rmdir") {
+				return gosftp.ErrSSHFxFailure
+			}
+			err = os.Remove(p)
+		}
+	case "Link":
+		// hard links, unlike symbolic ones, can only point to files that are
+		// in the root.
+		if err := h.supports(ExtensionHardlink); err != nil {
+			return err
+		}
+		var target string
+		if target, err = h.local(r.Target); err != nil {
+			return err
+		}
+		err = os.Link(p, target)
+	default:
+		// symbolic links could point outside of the root.
+		return gosftp.ErrSSHFxOpUnsupported
+	}
+	return clientError(err, r.Filepath)
+}
+
+// PosixRename implements sftp.PosixRenameFileCmder.
+func (h *handler) PosixRename(r *gosftp.Request) error {
+	if err := h.supports(ExtensionPosixRename); err != nil {
+		return err
+	}
+	if err := h.writable(); err != nil {
+		return err
+	}
+	p, err := h.local(r.Filepath)
+	if err != nil {
+		return err
+	}
+	target, err := h.local(r.Target)
+	if err != nil {
+		return err
+	}
+	return clientError(os.Rename(p, target), r.Filepath)
+}
+
+// StatVFS implements sftp.StatVFSFileCmder, with the statistics of the file
+// system of the path.
+func (h *handler) StatVFS(r *gosftp.Request) (*gosftp.StatVFS, error) {
+	if err := h.supports(ExtensionStatVFS); err != nil {
+		return nil, err
+	}
+	p, err := h.local(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := statVFS(p)
+	if err != nil {
+		return nil, clientError(err, r.Filepath)
+	}
+	return stat, nil
+}
+
+func (h *handler) setstat(p string, r *gosftp.Request) error {
+	flags, attrs := r.AttrFlags(), r.Attributes()
+	if flags.Size {
+		if err := os.Truncate(p, int64(attrs.Size)); err != nil {
+			return err
+		}
+	}
+	if flags.Permissions {
+		if err := os.Chmod(p, attrs.FileMode().Perm()); err != nil {
+			return err
+		}
+	}
+	if flags.Acmodtime {
+		atime, mtime := time.Unix(int64(attrs.Atime), 0), time.Unix(int64(attrs.Mtime), 0)
+		if err := os.Chtimes(p, atime, mtime); err != nil {
+			return err
+		}
+	}
+	// owners are left alone.
+	return nil
+}
+
+// Filelist implements sftp.FileLister.
+func (h *handler) Filelist(r *gosftp.Request) (gosftp.ListerAt, error) {
+	p, err := h.local(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	switch r.Method {
+	case "List":
+		entries, err := os.ReadDir(p)
+		if err != nil {
+			return nil, clientError(err, r.Filepath)
+		}
+		infos := make([]os.FileInfo, 0, len(entries))
+		for _, entry := range entries {
+			if !h.allowed(path.Join(r.Filepath, entry.Name())) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				// removed meanwhile.
+				continue
+			}
+			infos = append(infos, info)
+		}
+		return listerAt(infos), nil
+	case "Stat":
+		fi, err := os.Stat(p)
+		if err != nil {
+			return nil, clientError(err, r.Filepath)
+		}
+		return listerAt{fi}, nil
+	default:
+		// reading links would tell about local paths.
+		return nil, gosftp.ErrSSHFxOpUnsupported
+	}
+}
+
+// Lstat implements sftp.LstatFileLister.
+func (h *handler) Lstat(r *gosftp.Request) (gosftp.ListerAt, error) {
+	p, err := h.local(r.Filepath)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Lstat(p)
+	if err != nil {
+		return nil, clientError(err, r.Filepath)
+	}
+	return listerAt{fi}, nil
+}
+
+type listerAt []os.FileInfo
+
+// ListAt implements sftp.ListerAt.
+func (l listerAt) ListAt(ls []os.FileInfo, offset int64) (int, error) {
+	if offset >= int64(len(l)) {
+		return 0, io.EOF
+	}
+	n := copy(ls, l[offset:])
+	if n < len(ls) {
+		return n, io.EOF
+	}
+	return n, nil
+}
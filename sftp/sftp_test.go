@@ -0,0 +1,323 @@
+package sftp
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+	gosftp "github.com/pkg/sftp"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func setup(tb testing.TB, opts ...Option) (*gosftp.Client, string) {
+	tb.Helper()
+	root := tb.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "hello.txt"), []byte("hello"), 0o600); err != nil {
+		tb.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(root, "secret"), 0o700); err != nil {
+		tb.Fatal(err)
+	}
+	srv := &ssh.Server{}
+	for _, opt := range []ssh.Option{
+		Enable(),
+		wish.WithMiddleware(Middleware(root, opts...)),
+	} {
+		if err := srv.SetOption(opt); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	conn, err := gossh.Dial("tcp", testsession.Listen(tb, srv), &gossh.ClientConfig{
+		User:            "testuser",
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = conn.Close() })
+	client, err := gosftp.NewClient(conn)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = client.Close() })
+	return client, root
+}
+
+func readFile(tb testing.TB, client *gosftp.Client, path string) string {
+	tb.Helper()
+	f, err := client.Open(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	defer f.Close() // nolint: errcheck
+	b, err := io.ReadAll(f)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return string(b)
+}
+
+func list(tb testing.TB, client *gosftp.Client, path string) string {
+	tb.Helper()
+	infos, err := client.ReadDir(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+func requirePermissionDenied(tb testing.TB, err error) {
+	tb.Helper()
+	if !errors.Is(err, os.ErrPermission) {
+		tb.Errorf("expected permission denied, got %v", err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	client, root := setup(t)
+
+	if got := readFile(t, client, "/hello.txt"); got != "hello" {
+		t.Errorf("expected hello, got %q", got)
+	}
+	if got := list(t, client, "/"); got != "hello.txt,secret" {
+		t.Errorf("unexpected listing: %q", got)
+	}
+
+	f, err := client.Create("/new.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "new.txt")); err != nil || string(b) != "new" {
+		t.Errorf("expected the file to be written, got %q, %v", b, err)
+	}
+
+	if err := client.Mkdir("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Rename("/new.txt", "/dir/renamed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Rename("/dir/renamed.txt", "/hello.txt"); err == nil {
+		t.Error("expected renames not to replace files")
+	}
+	if got := list(t, client, "/dir"); got != "renamed.txt" {
+		t.Errorf("unexpected listing: %q", got)
+	}
+	if err := client.Remove("/dir/renamed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.RemoveDirectory("/dir"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Symlink("/hello.txt", "/link"); err == nil {
+		t.Error("expected symlinks to be unsupported")
+	}
+
+	t.Run("root", func(t *testing.T) {
+		if got := readFile(t, client, "../../hello.txt"); got != "hello" {
+			t.Errorf("expected paths to stay in the root, got %q", got)
+		}
+		_, err := client.Stat("/missing")
+		if err == nil || strings.Contains(err.Error(), root) {
+			t.Errorf("expected an error not telling about the root, got %v", err)
+		}
+	})
+}
+
+func TestMiddlewareReadOnly(t *testing.T) {
+	client, root := setup(t, WithReadOnly(func(s ssh.Session) bool {
+		return s.User() != "admin"
+	}))
+
+	if got := readFile(t, client, "/hello.txt"); got != "hello" {
+		t.Errorf("expected hello, got %q", got)
+	}
+	_, err := client.Create("/new.txt")
+	requirePermissionDenied(t, err)
+	requirePermissionDenied(t, client.Remove("/hello.txt"))
+	requirePermissionDenied(t, client.Mkdir("/dir"))
+	requirePermissionDenied(t, client.Chmod("/hello.txt", 0o777))
+	if _, err := os.Stat(filepath.Join(root, "hello.txt")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMiddlewareMaintenance(t *testing.T) {
+	var m wish.Maintenance
+	client, _ := setup(t, WithMaintenance(&m))
+
+	m.Set("back at noon")
+	if got := readFile(t, client, "/hello.txt"); got != "hello" {
+		t.Errorf("expected hello, got %q", got)
+	}
+	_, err := client.Create("/new.txt")
+	if err == nil || !strings.Contains(err.Error(), "back at noon") {
+		t.Errorf("expected the maintenance message, got %v", err)
+	}
+
+	m.Set("back at noon", wish.Principal{User: "testuser"})
+	if err := client.Mkdir("/dir"); err != nil {
+		t.Errorf("expected allowed users to make changes, got %v", err)
+	}
+
+	m.Clear()
+	if _, err := client.Create("/new.txt"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMiddlewareExtensions(t *testing.T) {
+	t.Run("enabled", func(t *testing.T) {
+		client, root := setup(t)
+		if err := client.Link("/hello.txt", "/link.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFile(t, client, "/link.txt"); got != "hello" {
+			t.Errorf("expected hello, got %q", got)
+		}
+		if err := client.PosixRename("/link.txt", "/renamed.txt"); err != nil {
+			t.Error(err)
+		}
+		if _, err := os.Stat(filepath.Join(root, "link.txt")); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("expected the link to be renamed, got %v", err)
+		}
+		if runtime.GOOS == "linux" || runtime.GOOS == "darwin" {
+			stat, err := client.StatVFS("/")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stat.TotalSpace() == 0 {
+				t.Error("expected the total space of the file system")
+			}
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		client, _ := setup(t, WithoutExtensions(ExtensionHardlink, ExtensionPosixRename, ExtensionStatVFS))
+		for name, err := range map[string]error{
+			"hardlink":     client.Link("/hello.txt", "/link.txt"),
+			"posix-rename": client.PosixRename("/hello.txt", "/renamed.txt"),
+		} {
+			if err == nil {
+				t.Errorf("expected %s to be unsupported", name)
+			}
+		}
+		if _, err := client.StatVFS("/"); err == nil {
+			t.Error("expected statvfs to be unsupported")
+		}
+	})
+}
+
+func TestMiddlewareAllocator(t *testing.T) {
+	client, _ := setup(t, WithAllocator())
+	if got := readFile(t, client, "/hello.txt"); got != "hello" {
+		t.Errorf("expected hello, got %q", got)
+	}
+}
+
+func TestMiddlewarePathFilter(t *testing.T) {
+	client, _ := setup(t, WithPathFilter(func(s ssh.Session, path string) bool {
+		return s.User() == "testuser" && !strings.HasPrefix(path, "/secret")
+	}))
+
+	if got := list(t, client, "/"); got != "hello.txt" {
+		t.Errorf("expected the secret dir to be hidden, got %q", got)
+	}
+	_, err := client.ReadDir("/secret")
+	requirePermissionDenied(t, err)
+	_, err = client.Create("/secret/new.txt")
+	requirePermissionDenied(t, err)
+	requirePermissionDenied(t, client.Rename("/hello.txt", "/secret/hello.txt"))
+}
+
+func TestMiddlewareOtherSessions(t *testing.T) {
+	srv := &ssh.Server{}
+	if err := srv.SetOption(wish.WithMiddleware(
+		func(ssh.Handler) ssh.Handler {
+			return func(s ssh.Session) {
+				wish.Print(s, "next")
+			}
+		},
+		Middleware(t.TempDir()),
+	)); err != nil {
+		t.Fatal(err)
+	}
+	out, err := testsession.New(t, srv, nil).Output("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != "next" {
+		t.Errorf("expected the session to reach the next handler, got %q", out)
+	}
+}
+
+func TestEnable(t *testing.T) {
+	srv := &ssh.Server{}
+	if err := srv.SetOption(Enable()); err != nil {
+		t.Fatal(err)
+	}
+	sess := testsession.New(t, srv, nil)
+	stderr, err := sess.StderrPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sess.RequestSubsystem(Subsystem); err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "sftp is not available\n" {
+		t.Errorf("expected the session to be rejected, got %q", b)
+	}
+}
+
+func BenchmarkMiddleware(b *testing.B) {
+	data := bytes.Repeat([]byte("x"), 4<<20)
+	for name, opts := range map[string][]Option{
+		"default":   nil,
+		"allocator": {WithAllocator()},
+	} {
+		b.Run(name, func(b *testing.B) {
+			client, root := setup(b, opts...)
+			if err := os.WriteFile(filepath.Join(root, "big"), data, 0o600); err != nil {
+				b.Fatal(err)
+			}
+			b.SetBytes(int64(len(data)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				f, err := client.Open("/big")
+				if err != nil {
+					b.Fatal(err)
+				}
+				// WriteTo issues concurrent reads, like sshfs's read-ahead.
+				if _, err := f.WriteTo(io.Discard); err != nil {
+					b.Fatal(err)
+				}
+				_ = f.Close()
+			}
+		})
+	}
+}
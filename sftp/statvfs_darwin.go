@@ -0,0 +1,30 @@
+//go:build darwin
+// +build darwin
+
+package sftp
+
+import (
+	"os"
+	"syscall"
+
+	gosftp "github.com/pkg/sftp"
+)
+
+func statVFS(p string) (*gosftp.StatVFS, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(p, &stat); err != nil {
+		return nil, &os.PathError{Op: "statvfs", Path: p, Err: err}
+	}
+	return &gosftp.StatVFS{
+		Bsize:   uint64(stat.Bsize),
+		Frsize:  uint64(stat.Bsize),
+		Blocks:  stat.Blocks,
+		Bfree:   stat.Bfree,
+		Bavail:  stat.Bavail,
+		Files:   stat.Files,
+		Ffree:   stat.Ffree,
+		Favail:  stat.Ffree,
+		Flag:    uint64(stat.Flags),
+		Namemax: 255,
+	}, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package sftp
+
+import gosftp "github.com/pkg/sftp"
+
+func statVFS(string) (*gosftp.StatVFS, error) {
+	return nil, gosftp.ErrSSHFxOpUnsupported
+}
@@ -0,0 +1,98 @@
+package wish
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// Shutdowner shuts a server down gracefully, notifying its active sessions
+// first. The zero value is ready to use, once its Option is applied to the
+// server:
+//
+//	var sd wish.Shutdowner
+//	srv, err := wish.NewServer(sd.Option(), ...)
+//	// later, e.g. on SIGTERM:
+//	err = sd.Shutdown(ctx)
+type Shutdowner struct {
+	mu       sync.Mutex
+	srv      *ssh.Server
+	ch       chan struct{}
+	shutdown bool
+}
+
+// shutdownKey is the key of the Shutdowner of the server in the contexts of
+// its connections.
+type shutdownKey struct{}
+
+// Option returns an ssh.Option making the server shut down by Shutdown, and
+// its sessions notified through ShuttingDown.
+//
+// The Shutdowner is set in the context of each connection by the server's
+// ConnCallback, which it chains: set ConnCallback before applying it, not
+// after, or sessions aren't notified.
+func (sd *Shutdowner) Option() ssh.Option {
+	return func(s *ssh.Server) error {
+		sd.mu.Lock()
+		sd.srv = s
+		sd.mu.Unlock()
+		setConnValue(s, shutdownKey{}, sd)
+		return nil
+	}
+}
+
+// chanLocked returns the channel closed on shutdown. sd.mu must be held.
+func (sd *Shutdowner) chanLocked() chan struct{} {
+	if sd.ch == nil {
+		sd.ch = make(chan struct{})
+	}
+	return sd.ch
+}
+
+// ShuttingDown returns a channel closed when the server of the given session
+// context starts shutting down with Shutdowner.Shutdown. Middlewares can use
+// it to warn users, or to save their state and exit, before the connection
+// is closed.
+//
+// It returns nil, which blocks forever, if the server has no Shutdowner.
+func ShuttingDown(ctx ssh.Context) <-chan struct{} {
+	sd, ok := ctx.Value(shutdownKey{}).(*Shutdowner)
+	if !ok {
+		return nil
+	}
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+	return sd.chanLocked()
+}
+
+// Shutdown gracefully shuts down the server: it stops accepting new
+// connections, notifies active sessions through ShuttingDown, and waits for
+// their connections to close. If the context is done first, the remaining
+// connections are closed and the context's error is returned. Clients keeping
+// idle connections open, e.g. to multiplex sessions, hold the shutdown until
+// the deadline.
+//
+// The bubbletea middleware sends a ShutdownMsg to its programs, so they can
+// quit before the deadline. It's safe to call concurrently, and more than
+// once.
+func (sd *Shutdowner) Shutdown(ctx context.Context) error {
+	sd.mu.Lock()
+	srv := sd.srv
+	if srv == nil {
+		sd.mu.Unlock()
+		return errors.New("shutdowner option wasn't applied to a server")
+	}
+	if !sd.shutdown {
+		sd.shutdown = true
+		close(sd.chanLocked())
+	}
+	sd.mu.Unlock()
+
+	if err := srv.Shutdown(ctx); err != nil {
+		_ = srv.Close()
+		return err
+	}
+	return nil
+}
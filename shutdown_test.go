@@ -0,0 +1,83 @@
+package wish
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestShutdown(t *testing.T) {
+	t.Run("notified", func(t *testing.T) {
+		started := make(chan struct{})
+		srv := &ssh.Server{
+			Handler: func(s ssh.Session) {
+				close(started)
+				<-ShuttingDown(s.Context())
+				Print(s, "bye")
+			},
+		}
+		var sd Shutdowner
+		requireNoError(t, sd.Option()(srv))
+		c := dial(t, testsession.Listen(t, srv))
+		sess, err := c.NewSession()
+		requireNoError(t, err)
+		out := make(chan string, 1)
+		go func() {
+			b, _ := sess.Output("")
+			// clients close their connection once their session is over.
+			_ = c.Close()
+			out <- string(b)
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		errs := make(chan error, 2)
+		for i := 0; i < 2; i++ {
+			go func() { errs <- sd.Shutdown(ctx) }()
+		}
+		requireNoError(t, <-errs)
+		requireNoError(t, <-errs)
+		if got := <-out; got != "bye" {
+			t.Errorf("expected the session to be notified, got %q", got)
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		started := make(chan struct{})
+		srv := &ssh.Server{
+			Handler: func(s ssh.Session) {
+				close(started)
+				<-s.Context().Done()
+			},
+		}
+		var sd Shutdowner
+		requireNoError(t, sd.Option()(srv))
+		sess := testsession.New(t, srv, nil)
+		done := make(chan error, 1)
+		go func() { done <- sess.Run("") }()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := sd.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("expected the deadline to be exceeded, got %v", err)
+		}
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Error("expected the connection to be closed")
+		}
+	})
+
+	t.Run("no server", func(t *testing.T) {
+		var sd Shutdowner
+		if err := sd.Shutdown(context.Background()); err == nil {
+			t.Error("expected an error without a server")
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package wish
+
+import (
+	"net"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+// SocketOptions are the socket options set on every accepted connection, so
+// network policy and QoS rules can tell wish traffic apart. Zero values leave
+// the system defaults in place.
+type SocketOptions struct {
+	// Nagle enables Nagle's algorithm. Go sets TCP_NODELAY by default,
+	// which is usually what interactive sessions want.
+	Nagle bool
+
+	// KeepAlive is the idle time before TCP keep-alive probes are sent. A
+	// negative value disables keep-alives.
+	KeepAlive time.Duration
+
+	// KeepAliveInterval is the time between keep-alive probes, and
+	// KeepAliveCount the number of unanswered probes before the connection
+	// is dropped. Linux only.
+	KeepAliveInterval time.Duration
+	KeepAliveCount    int
+
+	// Mark is the SO_MARK set on the socket, for use in iptables, nftables,
+	// eBPF or conntrack rules. Setting it requires CAP_NET_ADMIN. Linux only.
+	Mark int
+
+	// TOS is the IP_TOS, or IPV6_TCLASS for IPv6 connections, set on the
+	// socket, e.g. 0x10 for low delay. Linux only.
+	TOS int
+}
+
+// WithSocketOptions returns an ssh.Option that sets the given socket options
+// on accepted TCP connections. It fails if an option isn't supported on the
+// current platform.
+//
+// Connections that can't be configured are still served, and the error is
+// logged.
+func WithSocketOptions(opts SocketOptions) ssh.Option {
+	return func(s *ssh.Server) error {
+		if err := opts.supported(); err != nil {
+			return err
+		}
+		next := s.ConnCallback
+		s.ConnCallback = func(ctx ssh.Context, conn net.Conn) net.Conn {
+			if err := opts.apply(conn); err != nil {
+				log.Error("could not set socket options", "remote-addr", conn.RemoteAddr(), "error", err)
+			}
+			if next != nil {
+				return next(ctx, conn)
+			}
+			return conn
+		}
+		return nil
+	}
+}
+
+func (o SocketOptions) apply(conn net.Conn) error {
+	if u, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		// e.g. connections read through WithProxyProtocol.
+		conn = u.NetConn()
+	}
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	if o.Nagle {
+		if err := tcp.SetNoDelay(false); err != nil {
+			return err
+		}
+	}
+	switch {
+	case o.KeepAlive < 0:
+		if err := tcp.SetKeepAlive(false); err != nil {
+			return err
+		}
+	case o.KeepAlive > 0:
+		if err := tcp.SetKeepAlive(true); err != nil {
+			return err
+		}
+		if err := tcp.SetKeepAlivePeriod(o.KeepAlive); err != nil {
+			return err
+		}
+	}
+	if o.KeepAliveInterval == 0 && o.KeepAliveCount == 0 && o.Mark == 0 && o.TOS == 0 {
+		return nil
+	}
+	rc, err := tcp.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var serr error
+	if err := rc.Control(func(fd uintptr) {
+		serr = o.control(fd, isIPv6(tcp.LocalAddr()))
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+func isIPv6(addr net.Addr) bool {
+	a, ok := addr.(*net.TCPAddr)
+	return ok && a.IP.To4() == nil
+}
@@ -0,0 +1,44 @@
+//go:build linux
+// +build linux
+
+package wish
+
+import (
+	"os"
+	"syscall"
+)
+
+// sockopt is an integer socket option.
+type sockopt struct {
+	level, name, value int
+}
+
+func (o SocketOptions) supported() error {
+	return nil
+}
+
+func (o SocketOptions) control(fd uintptr, ipv6 bool) error {
+	var opts []sockopt
+	if o.KeepAliveInterval > 0 {
+		opts = append(opts, sockopt{syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, int(o.KeepAliveInterval.Seconds())})
+	}
+	if o.KeepAliveCount > 0 {
+		opts = append(opts, sockopt{syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, o.KeepAliveCount})
+	}
+	if o.Mark != 0 {
+		opts = append(opts, sockopt{syscall.SOL_SOCKET, syscall.SO_MARK, o.Mark})
+	}
+	if o.TOS != 0 {
+		if ipv6 {
+			opts = append(opts, sockopt{syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, o.TOS})
+		} else {
+			opts = append(opts, sockopt{syscall.IPPROTO_IP, syscall.IP_TOS, o.TOS})
+		}
+	}
+	for _, opt := range opts {
+		if err := syscall.SetsockoptInt(int(fd), opt.level, opt.name, opt.value); err != nil {
+			return os.NewSyscallError("setsockopt", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+//go:build linux
+// +build linux
+
+package wish
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestWithSocketOptions(t *testing.T) {
+	expected := []struct {
+		name  string
+		level int
+		opt   int
+		value int
+	}{
+		{"IP_TOS", syscall.IPPROTO_IP, syscall.IP_TOS, 0x10},
+		{"TCP_KEEPINTVL", syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, 10},
+		{"TCP_KEEPCNT", syscall.IPPROTO_TCP, syscall.TCP_KEEPCNT, 3},
+		{"TCP_NODELAY", syscall.IPPROTO_TCP, syscall.TCP_NODELAY, 0},
+	}
+	got := make(chan []int, 1)
+	srv := &ssh.Server{
+		Handler: func(ssh.Session) {},
+		// runs after the options are set.
+		ConnCallback: func(_ ssh.Context, conn net.Conn) net.Conn {
+			rc, err := conn.(*net.TCPConn).SyscallConn()
+			requireNoError(t, err)
+			var values []int
+			requireNoError(t, rc.Control(func(fd uintptr) {
+				for _, e := range expected {
+					v, err := syscall.GetsockoptInt(int(fd), e.level, e.opt)
+					requireNoError(t, err)
+					values = append(values, v)
+				}
+			}))
+			got <- values
+			return conn
+		},
+	}
+	requireNoError(t, WithSocketOptions(SocketOptions{
+		Nagle:             true,
+		KeepAlive:         time.Minute,
+		KeepAliveInterval: 10 * time.Second,
+		KeepAliveCount:    3,
+		TOS:               0x10,
+	})(srv))
+
+	sess := testsession.New(t, srv, nil)
+	requireNoError(t, sess.Run(""))
+
+	values := <-got
+	for i, e := range expected {
+		if values[i] != e.value {
+			t.Errorf("%s: expected %d, got %d", e.name, e.value, values[i])
+		}
+	}
+}
@@ -0,0 +1,20 @@
+//go:build !linux
+// +build !linux
+
+package wish
+
+import (
+	"fmt"
+	"runtime"
+)
+
+func (o SocketOptions) supported() error {
+	if o.KeepAliveInterval != 0 || o.KeepAliveCount != 0 || o.Mark != 0 || o.TOS != 0 {
+		return fmt.Errorf("socket options: keep-alive interval and count, mark and TOS are not supported on %s", runtime.GOOS)
+	}
+	return nil
+}
+
+func (o SocketOptions) control(uintptr, bool) error {
+	return nil
+}
@@ -0,0 +1,17 @@
+package wish
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+)
+
+func TestWithSocketOptionsUnsupported(t *testing.T) {
+	err := WithSocketOptions(SocketOptions{Mark: 42})(&ssh.Server{})
+	if runtime.GOOS == "linux" {
+		requireNoError(t, err)
+	} else if err == nil {
+		t.Error("expected an error")
+	}
+}
@@ -0,0 +1,177 @@
+// Package splash provides a middleware showing a spinner on the PTY of
+// sessions while the next handler prepares, e.g. connects to a database or
+// loads a model, instead of a blank screen.
+package splash
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+)
+
+// Dots are the default spinner frames.
+var Dots = []string{"⣾", "⣽", "⣻", "⢿", "⡿", "⣟", "⣯", "⣷"}
+
+const (
+	hideCursor = "\x1b[?25l"
+	showCursor = "\x1b[?25h"
+	clearLine  = "\r\x1b[2K"
+)
+
+type config struct {
+	message  string
+	frames   []string
+	interval time.Duration
+	delay    time.Duration
+}
+
+// Option configures the splash screen.
+type Option func(*config)
+
+// WithMessage sets the message shown next to the spinner. Defaults to
+// "Loading…".
+func WithMessage(msg string) Option {
+	return func(c *config) {
+		c.message = msg
+	}
+}
+
+// WithFrames sets the spinner frames, and the interval between them. Defaults
+// to Dots, every 100ms.
+func WithFrames(interval time.Duration, frames ...string) Option {
+	return func(c *config) {
+		c.interval = interval
+		c.frames = frames
+	}
+}
+
+// WithDelay only shows the splash screen once the next handler took longer
+// than the given delay to get ready, so fast apps don't flicker.
+func WithDelay(d time.Duration) Option {
+	return func(c *config) {
+		c.delay = d
+	}
+}
+
+type readyKey struct{}
+
+// Middleware shows a spinner on the PTY of sessions until the next handler is
+// ready: once it first writes to the session, calls Ready, or returns.
+// Sessions without a PTY are left alone.
+func Middleware(opts ...Option) wish.Middleware {
+	cfg := config{
+		message:  "Loading…",
+		frames:   Dots,
+		interval: 100 * time.Millisecond,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if _, _, ok := s.Pty(); !ok || len(cfg.frames) == 0 {
+				sh(s)
+				return
+			}
+			sp := newSpinner(s, cfg)
+			s.Context().SetValue(readyKey{}, sp)
+			defer sp.stop()
+			sh(&session{Session: s, sp: sp})
+		}
+	}
+}
+
+// Ready hides the splash screen of the session with the given context, e.g.
+// before waiting for input without writing anything first. It does nothing if
+// the session doesn't show one.
+func Ready(ctx ssh.Context) {
+	if sp, ok := ctx.Value(readyKey{}).(*spinner); ok {
+		sp.stop()
+	}
+}
+
+type spinner struct {
+	w       io.Writer
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+func newSpinner(w io.Writer, cfg config) *spinner {
+	sp := &spinner{
+		w:       w,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go sp.run(cfg)
+	return sp
+}
+
+func (sp *spinner) run(cfg config) {
+	defer close(sp.stopped)
+	if cfg.delay > 0 {
+		t := time.NewTimer(cfg.delay)
+		select {
+		case <-sp.done:
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+
+	_, _ = io.WriteString(sp.w, hideCursor)
+	defer func() {
+		_, _ = io.WriteString(sp.w, clearLine+showCursor)
+	}()
+	ticker := time.NewTicker(cfg.interval)
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		frame := cfg.frames[i%len(cfg.frames)]
+		if _, err := fmt.Fprintf(sp.w, "%s%s %s", clearLine, frame, cfg.message); err != nil {
+			return
+		}
+		select {
+		case <-sp.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stop stops the spinner and clears it, waiting for it to be cleared so it
+// doesn't mix with the output of the next handler.
+func (sp *spinner) stop() {
+	sp.once.Do(func() {
+		close(sp.done)
+	})
+	<-sp.stopped
+}
+
+// session hides the splash screen when the next handler first writes to it.
+type session struct {
+	ssh.Session
+	sp *spinner
+}
+
+func (s *session) Write(p []byte) (int, error) {
+	s.sp.stop()
+	return s.Session.Write(p)
+}
+
+func (s *session) Stderr() io.ReadWriter {
+	return &stderr{ReadWriter: s.Session.Stderr(), sp: s.sp}
+}
+
+type stderr struct {
+	io.ReadWriter
+	sp *spinner
+}
+
+func (s *stderr) Write(p []byte) (int, error) {
+	s.sp.stop()
+	return s.ReadWriter.Write(p)
+}
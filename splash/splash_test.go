@@ -0,0 +1,66 @@
+package splash
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func run(tb testing.TB, mw wish.Middleware, sh ssh.Handler, pty bool) string {
+	tb.Helper()
+	sess := testsession.New(tb, &ssh.Server{Handler: mw(sh)}, nil)
+	if pty {
+		if err := sess.RequestPty("xterm", 24, 80, gossh.TerminalModes{}); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	out, err := sess.Output("")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestMiddleware(t *testing.T) {
+	slow := func(s ssh.Session) {
+		time.Sleep(250 * time.Millisecond)
+		wish.Print(s, "app")
+	}
+
+	t.Run("pty", func(t *testing.T) {
+		out := run(t, Middleware(WithMessage("Warming up"), WithFrames(50*time.Millisecond, "a", "b")), slow, true)
+		if !strings.HasPrefix(out, hideCursor+clearLine+"a Warming up"+clearLine+"b Warming up") {
+			t.Errorf("expected the spinner to be shown, got %q", out)
+		}
+		if !strings.HasSuffix(out, clearLine+showCursor+"app") {
+			t.Errorf("expected the spinner to be cleared before the output, got %q", out)
+		}
+	})
+
+	t.Run("no pty", func(t *testing.T) {
+		if out := run(t, Middleware(), slow, false); out != "app" {
+			t.Errorf("expected %q, got %q", "app", out)
+		}
+	})
+
+	t.Run("delay", func(t *testing.T) {
+		if out := run(t, Middleware(WithDelay(time.Second)), slow, true); out != "app" {
+			t.Errorf("expected %q, got %q", "app", out)
+		}
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		out := run(t, Middleware(), func(s ssh.Session) {
+			Ready(s.Context())
+			time.Sleep(250 * time.Millisecond)
+		}, true)
+		if !strings.HasSuffix(out, clearLine+showCursor) || strings.Count(out, "Loading…") != 1 {
+			t.Errorf("expected the spinner to be cleared right away, got %q", out)
+		}
+	})
+}
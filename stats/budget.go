@@ -0,0 +1,72 @@
+package stats
+
+import (
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+// Budget is the resources a session can use, as attributed to it by
+// SampleGoroutines and SampleCPU. Zero fields aren't limited.
+//
+// There's no memory budget: the Go runtime doesn't label heap allocations,
+// so they can't be attributed to sessions.
+type Budget struct {
+	// Goroutines is the most goroutines the session can run at once.
+	Goroutines int
+
+	// CPU is the most CPU time the session can use.
+	CPU time.Duration
+
+	// Exceeded is called once, when the session goes over its budget, with
+	// the resource it exceeded: "goroutines" or "cpu". It defaults to
+	// telling the user, and closing the session.
+	Exceeded func(s ssh.Session, resource string)
+}
+
+// budget is the budget of a running session.
+type budget struct {
+	Budget
+	s    ssh.Session
+	once sync.Once
+}
+
+// exceed calls the Exceeded function of the budget, once.
+func (b *budget) exceed(resource string) {
+	b.once.Do(func() {
+		log.Warn("session over budget", "user", b.s.User(), "resource", resource, "remote-addr", b.s.RemoteAddr())
+		go b.Exceeded(b.s, resource)
+	})
+}
+
+// Enforce returns a middleware enforcing the budget on every session. It must
+// run inside Middleware, which tracks their usage, e.g.:
+//
+//	wish.WithMiddleware(
+//		stats.Enforce(stats.Budget{Goroutines: 100, CPU: time.Minute}),
+//		stats.Middleware(store),
+//	)
+//
+// Budgets are checked when sampling, so run SampleGoroutines or SampleCPU.
+func Enforce(b Budget) wish.Middleware {
+	if b.Exceeded == nil {
+		b.Exceeded = func(s ssh.Session, resource string) {
+			wish.Exit(s, 1, "This session used too much "+resource+".")
+		}
+	}
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			u, ok := wish.ContextValue(s.Context(), usageKey)
+			if !ok {
+				log.Warn("stats.Enforce must run inside stats.Middleware, not enforcing the budget")
+				sh(s)
+				return
+			}
+			u.budget.Store(&budget{Budget: b, s: s})
+			sh(s)
+		}
+	}
+}
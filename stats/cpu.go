@@ -0,0 +1,99 @@
+package stats
+
+import (
+	"bytes"
+	"io"
+	"runtime/pprof"
+	"time"
+
+	"github.com/charmbracelet/wish/internal/log"
+	"github.com/google/pprof/profile"
+)
+
+// SampleCPU runs the CPU profiler in windows of the given duration, until the
+// returned function is called. The CPU time of every running session is
+// recorded in Session.CPU.
+//
+// CPU time is attributed with the same profiler labels as goroutines, see
+// SampleGoroutines. The profiler can only run once per process, so it fails
+// if it's already running, e.g. from net/http/pprof, and profiling the
+// process fails while it runs.
+func SampleCPU(window time.Duration) (stop func(), err error) {
+	if window <= 0 {
+		return nil, ErrInvalidInterval
+	}
+	var buf bytes.Buffer
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		return nil, err
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(window)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				pprof.StopCPUProfile()
+				recordCPU(&buf)
+				return
+			case <-ticker.C:
+				pprof.StopCPUProfile()
+				recordCPU(&buf)
+				buf.Reset()
+				if err := pprof.StartCPUProfile(&buf); err != nil {
+					log.Error("could not restart the cpu profiler", "error", err)
+					<-done
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}, nil
+}
+
+// recordCPU adds the CPU time of the given profile to the running sessions.
+func recordCPU(r io.Reader) {
+	cpu, err := cpuBySession(r)
+	if err != nil {
+		log.Error("could not read the cpu profile", "error", err)
+		return
+	}
+	running.mu.Lock()
+	defer running.mu.Unlock()
+	for id, u := range running.usage {
+		u.cpu.Add(cpu[id])
+		u.check()
+	}
+}
+
+// cpuBySession sums the CPU time of the samples of the given CPU profile per
+// session label value.
+func cpuBySession(r io.Reader) (map[string]int64, error) {
+	p, err := profile.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	cpu := map[string]int64{}
+	value := -1
+	for i, t := range p.SampleType {
+		if t.Type == "cpu" {
+			value = i
+		}
+	}
+	if value < 0 {
+		return cpu, nil
+	}
+	for _, s := range p.Sample {
+		ids := s.Label[sessionLabel]
+		if len(ids) == 0 || value >= len(s.Value) {
+			continue
+		}
+		cpu[ids[0]] += s.Value[value]
+	}
+	return cpu, nil
+}
@@ -0,0 +1,150 @@
+package stats
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/log"
+	"github.com/charmbracelet/wish/internal/netaddr"
+	lru "github.com/hashicorp/golang-lru/v2"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// FailureKind classifies connections failing before a session starts.
+type FailureKind string
+
+// Failure kinds.
+const (
+	// FailureBanner is a client sending garbage instead of its version.
+	FailureBanner FailureKind = "banner"
+
+	// FailureKex is a failed key exchange, e.g. with no common algorithm.
+	FailureKex FailureKind = "kex"
+
+	// FailureAuth is a client failing to authenticate.
+	FailureAuth FailureKind = "auth"
+
+	// FailureDisconnect is a client disconnecting during the handshake,
+	// like port scanners do.
+	FailureDisconnect FailureKind = "disconnect"
+
+	// FailureOther is any other handshake failure.
+	FailureOther FailureKind = "other"
+)
+
+// Reporter reports abusive hosts, e.g. to an AbuseIPDB-like service.
+type Reporter interface {
+	// Report reports the host, which failed the handshake with the given
+	// kind of failure and error. IPv6 hosts are reported by their /64
+	// prefix, e.g. "2001:db8::/64".
+	Report(host string, kind FailureKind, err error) error
+}
+
+// Failures counts the connections failing before a session starts, separately
+// from the sessions of a Store. It's safe for concurrent use.
+type Failures struct {
+	mu        sync.Mutex
+	counts    map[FailureKind]int64
+	hosts     *lru.Cache[string, int]
+	reporter  Reporter
+	threshold int
+}
+
+// NewFailures returns a Failures keeping the failure count of up to maxHosts
+// hosts.
+//
+// If reporter isn't nil, hosts are reported to it once they failed threshold
+// times. Reports are made from the failed connection goroutine.
+func NewFailures(maxHosts int, reporter Reporter, threshold int) *Failures {
+	if maxHosts <= 0 {
+		maxHosts = 1
+	}
+	// only possible error is if maxHosts is <= 0, which is prevented above.
+	hosts, _ := lru.New[string, int](maxHosts)
+	return &Failures{
+		counts:    map[FailureKind]int64{},
+		hosts:     hosts,
+		reporter:  reporter,
+		threshold: threshold,
+	}
+}
+
+// Option returns an ssh.Option recording the failed connections of the
+// server. It calls the server's previous ConnectionFailedCallback, if any.
+func (f *Failures) Option() ssh.Option {
+	return func(s *ssh.Server) error {
+		prev := s.ConnectionFailedCallback
+		s.ConnectionFailedCallback = func(conn net.Conn, err error) {
+			f.Record(conn.RemoteAddr(), err)
+			if prev != nil {
+				prev(conn, err)
+			}
+		}
+		return nil
+	}
+}
+
+// Record records a connection from addr failing with the given error.
+func (f *Failures) Record(addr net.Addr, err error) {
+	kind := classify(err)
+	host := netaddr.Key(addr, netaddr.DefaultIPv6PrefixLen)
+
+	f.mu.Lock()
+	f.counts[kind]++
+	n, _ := f.hosts.Get(host)
+	n++
+	f.hosts.Add(host, n)
+	f.mu.Unlock()
+
+	if f.reporter != nil && n == f.threshold {
+		if rerr := f.reporter.Report(host, kind, err); rerr != nil {
+			log.Error("could not report host", "host", host, "error", rerr)
+		}
+	}
+}
+
+// Counts returns the number of failures of each kind so far.
+func (f *Failures) Counts() map[FailureKind]int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	counts := make(map[FailureKind]int64, len(f.counts))
+	for k, v := range f.counts {
+		counts[k] = v
+	}
+	return counts
+}
+
+// Host returns the number of failures of the given host. IPv6 hosts are
+// counted, and reported, by their /64 prefix.
+func (f *Failures) Host(host string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n, _ := f.hosts.Peek(netaddr.HostKey(host, netaddr.DefaultIPv6PrefixLen))
+	return n
+}
+
+func classify(err error) FailureKind {
+	var authErr *gossh.ServerAuthError
+	var authErrValue gossh.ServerAuthError
+	switch {
+	case errors.As(err, &authErr), errors.As(err, &authErrValue):
+		return FailureAuth
+	case errors.Is(err, io.EOF), errors.Is(err, net.ErrClosed):
+		return FailureDisconnect
+	}
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "version"):
+		return FailureBanner
+	case strings.Contains(msg, "no common algorithm"), strings.Contains(msg, "key exchange"):
+		return FailureKex
+	case strings.Contains(msg, "connection reset"):
+		return FailureDisconnect
+	default:
+		return FailureOther
+	}
+}
@@ -0,0 +1,127 @@
+package stats
+
+import (
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+type reports struct {
+	mu    sync.Mutex
+	hosts []string
+}
+
+func (r *reports) Report(host string, _ FailureKind, _ error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.hosts = append(r.hosts, host)
+	return nil
+}
+
+func (r *reports) get() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.hosts...)
+}
+
+func TestFailures(t *testing.T) {
+	var rep reports
+	f := NewFailures(10, &rep, 3)
+	var wg sync.WaitGroup
+	srv := &ssh.Server{
+		Handler:         func(ssh.Session) {},
+		PasswordHandler: func(_ ssh.Context, pass string) bool { return pass == "secret" },
+	}
+	requireNoError(t, f.Option()(srv))
+	prev := srv.ConnectionFailedCallback
+	srv.ConnectionFailedCallback = func(conn net.Conn, err error) {
+		defer wg.Done()
+		prev(conn, err)
+	}
+	addr := testsession.Listen(t, srv)
+
+	raw := func(data string) {
+		t.Helper()
+		conn, err := net.Dial("tcp", addr)
+		requireNoError(t, err)
+		if data != "" {
+			_, err = conn.Write([]byte(data))
+			requireNoError(t, err)
+			time.Sleep(50 * time.Millisecond)
+		}
+		requireNoError(t, conn.Close())
+	}
+
+	wg.Add(1)
+	raw("")
+	wg.Add(1)
+	raw("GET / HTTP/1.1\r\nHost: foo\r\n\r\n" + string(make([]byte, 300)))
+	wg.Add(1)
+	_, err := gossh.Dial("tcp", addr, &gossh.ClientConfig{
+		User:            "foo",
+		Auth:            []gossh.AuthMethod{gossh.Password("wrong")},
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+	})
+	if err == nil {
+		t.Fatal("expected authentication to fail")
+	}
+	wg.Add(1)
+	_, err = gossh.Dial("tcp", addr, &gossh.ClientConfig{
+		User:            "foo",
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+		Config: gossh.Config{
+			Ciphers: []string{"3des-cbc"},
+		},
+	})
+	if err == nil {
+		t.Fatal("expected key exchange to fail")
+	}
+	wg.Wait()
+
+	counts := f.Counts()
+	for _, kind := range []FailureKind{FailureDisconnect, FailureBanner, FailureAuth, FailureKex} {
+		if counts[kind] != 1 {
+			t.Errorf("expected 1 %s failure, got %v", kind, counts)
+		}
+	}
+	if n := f.Host("127.0.0.1"); n != 4 {
+		t.Errorf("expected 4 failures for the host, got %d", n)
+	}
+	if hosts := rep.get(); len(hosts) != 1 || hosts[0] != "127.0.0.1" {
+		t.Errorf("expected the host to be reported once, got %v", hosts)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	for err, kind := range map[error]FailureKind{
+		errors.New("ssh: overflow reading version string"):                 FailureBanner,
+		errors.New("ssh: no common algorithm for client to server cipher"): FailureKex,
+		&gossh.ServerAuthError{}:                                           FailureAuth,
+		errors.New("something else"):                                       FailureOther,
+	} {
+		if got := classify(err); got != kind {
+			t.Errorf("expected %q to be %s, got %s", err, kind, got)
+		}
+	}
+}
+
+func TestFailuresIPv6(t *testing.T) {
+	var rep reports
+	f := NewFailures(10, &rep, 2)
+	f.Record(&net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 1234}, io.EOF)
+	f.Record(&net.TCPAddr{IP: net.ParseIP("2001:db8::ff:2"), Port: 1234}, io.EOF)
+	f.Record(&net.TCPAddr{IP: net.ParseIP("2001:db8:0:1::1"), Port: 1234}, io.EOF)
+	if n := f.Host("2001:db8::3"); n != 2 {
+		t.Errorf("expected the /64 to have 2 failures, got %d", n)
+	}
+	if hosts := rep.get(); len(hosts) != 1 || hosts[0] != "2001:db8::/64" {
+		t.Errorf("expected the /64 to be reported, got %v", hosts)
+	}
+}
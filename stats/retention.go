@@ -0,0 +1,99 @@
+package stats
+
+import (
+	"errors"
+	"time"
+
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+// ErrNotSupported is returned when a store doesn't support an operation.
+var ErrNotSupported = errors.New("operation not supported by store")
+
+// Pruner is implemented by stores able to delete old sessions.
+type Pruner interface {
+	// Prune deletes the sessions started before the given time.
+	Prune(before time.Time) error
+}
+
+// Eraser is implemented by stores able to delete all the sessions of a user,
+// e.g. to honor erasure requests.
+type Eraser interface {
+	// Erase deletes all the sessions with the given ID, see Session.ID.
+	Erase(id string) error
+}
+
+// Prune deletes the sessions older than maxAge from the store.
+func Prune(store Store, maxAge time.Duration) error {
+	p, ok := store.(Pruner)
+	if !ok {
+		return ErrNotSupported
+	}
+	return p.Prune(time.Now().Add(-maxAge))
+}
+
+// Erase deletes all the sessions of the user with the given ID from the
+// store, see Session.ID.
+func Erase(store Store, id string) error {
+	e, ok := store.(Eraser)
+	if !ok {
+		return ErrNotSupported
+	}
+	return e.Erase(id)
+}
+
+// Retain prunes the sessions older than maxAge from the store every interval,
+// until the returned function is called. It returns ErrInvalidInterval if the
+// interval isn't positive.
+func Retain(store Store, maxAge, interval time.Duration) (stop func(), err error) {
+	if interval <= 0 {
+		return nil, ErrInvalidInterval
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := Prune(store, maxAge); err != nil {
+					log.Error("could not prune sessions", "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}, nil
+}
+
+func (m *memoryStore) Prune(before time.Time) error {
+	return m.filter(func(s Session) bool {
+		return !s.Start.Before(before)
+	})
+}
+
+func (m *memoryStore) Erase(id string) error {
+	return m.filter(func(s Session) bool {
+		return s.ID() != id
+	})
+}
+
+// filter keeps only the sessions for which keep returns true.
+func (m *memoryStore) filter(keep func(Session) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sessions := m.sessions[:0]
+	for _, s := range m.sessions {
+		if keep(s) {
+			sessions = append(sessions, s)
+		}
+	}
+	m.sessions = sessions
+	return nil
+}
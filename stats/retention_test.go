@@ -0,0 +1,69 @@
+package stats
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPrune(t *testing.T) {
+	store := NewMemoryStore(10)
+	now := time.Now()
+	requireNoError(t, store.Record(Session{User: "old", Start: now.Add(-2 * time.Hour)}))
+	requireNoError(t, store.Record(Session{User: "new", Start: now}))
+	requireNoError(t, Prune(store, time.Hour))
+	sessions, err := store.Sessions()
+	requireNoError(t, err)
+	if len(sessions) != 1 || sessions[0].User != "new" {
+		t.Errorf("unexpected sessions: %v", sessions)
+	}
+}
+
+func TestErase(t *testing.T) {
+	store := NewMemoryStore(10)
+	requireNoError(t, store.Record(Session{User: "a", Fingerprint: "SHA256:a"}))
+	requireNoError(t, store.Record(Session{User: "b"}))
+	requireNoError(t, store.Record(Session{User: "a", Fingerprint: "SHA256:a"}))
+	requireNoError(t, Erase(store, "SHA256:a"))
+	requireNoError(t, Erase(store, "user:nobody"))
+	sessions, err := store.Sessions()
+	requireNoError(t, err)
+	if len(sessions) != 1 || sessions[0].User != "b" {
+		t.Errorf("unexpected sessions: %v", sessions)
+	}
+}
+
+type recordOnlyStore struct{ Store }
+
+func TestNotSupported(t *testing.T) {
+	store := recordOnlyStore{NewMemoryStore(1)}
+	if err := Prune(store, time.Hour); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+	if err := Erase(store, "user:a"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("expected ErrNotSupported, got %v", err)
+	}
+}
+
+func TestRetain(t *testing.T) {
+	store := NewMemoryStore(10)
+	requireNoError(t, store.Record(Session{User: "old", Start: time.Now().Add(-time.Hour)}))
+	if _, err := Retain(store, time.Minute, 0); !errors.Is(err, ErrInvalidInterval) {
+		t.Errorf("expected ErrInvalidInterval, got %v", err)
+	}
+	stop, err := Retain(store, time.Minute, time.Millisecond)
+	requireNoError(t, err)
+	defer stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		sessions, err := store.Sessions()
+		requireNoError(t, err)
+		if len(sessions) == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sessions were not pruned: %v", sessions)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
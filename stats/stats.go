@@ -0,0 +1,252 @@
+// Package stats provides a middleware that collects basic usage statistics
+// and exposes them to the app owners through the `stats` command.
+package stats
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Session is the record of a finished session.
+type Session struct {
+	// User is the user name the session authenticated with.
+	User string
+
+	// Fingerprint is the SHA256 fingerprint of the public key used, if any.
+	Fingerprint string
+
+	// Command is the raw command the session executed. It's empty for
+	// interactive shells.
+	Command string
+
+	// Start is when the session started.
+	Start time.Time
+
+	// Duration is how long the session lasted.
+	Duration time.Duration
+
+	// BytesIn and BytesOut are the number of bytes the session read from and
+	// wrote to the client. Bytes going through an allocated PTY aren't
+	// counted.
+	BytesIn  int64
+	BytesOut int64
+
+	// Goroutines is the peak number of goroutines the session ran, as seen
+	// by SampleGoroutines. It's zero when sampling isn't running.
+	Goroutines int
+
+	// CPU is the CPU time the goroutines of the session used, as seen by
+	// SampleCPU. It's zero when sampling isn't running.
+	CPU time.Duration
+}
+
+// ID identifies the user of the session: their public key fingerprint,
+// falling back to "user:" followed by their user name.
+func (s Session) ID() string {
+	if s.Fingerprint != "" {
+		return s.Fingerprint
+	}
+	return "user:" + s.User
+}
+
+// Store implementations persist session records.
+type Store interface {
+	// Record stores the given session.
+	Record(Session) error
+
+	// Sessions returns all the stored sessions.
+	Sessions() ([]Session, error)
+}
+
+// NewMemoryStore returns a Store that keeps up to max sessions in memory,
+// discarding the oldest ones first.
+func NewMemoryStore(max int) Store {
+	if max <= 0 {
+		max = 1
+	}
+	return &memoryStore{max: max}
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	max      int
+	sessions []Session
+}
+
+func (m *memoryStore) Record(s Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sessions = append(m.sessions, s)
+	if n := len(m.sessions) - m.max; n > 0 {
+		m.sessions = append([]Session(nil), m.sessions[n:]...)
+	}
+	return nil
+}
+
+func (m *memoryStore) Sessions() ([]Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Session(nil), m.sessions...), nil
+}
+
+// CommandCount is the number of times a command was executed.
+type CommandCount struct {
+	Command string
+	Count   int
+}
+
+// Summary is an aggregated view over a set of sessions.
+type Summary struct {
+	UniqueUsers     int
+	Sessions        int
+	SessionsPerDay  map[string]int
+	TopCommands     []CommandCount
+	TopConsumers    []Consumer
+	AverageDuration time.Duration
+}
+
+// Summarize aggregates the given sessions, keeping at most top commands and
+// top consumers.
+//
+// Users are identified by their public key fingerprint, falling back to their
+// user name. Commands are identified by their first word.
+func Summarize(sessions []Session, top int) Summary {
+	sum := Summary{
+		Sessions:       len(sessions),
+		SessionsPerDay: map[string]int{},
+	}
+	users := map[string]struct{}{}
+	cmds := map[string]int{}
+	var total time.Duration
+	for _, s := range sessions {
+		users[s.ID()] = struct{}{}
+		cmds[commandName(s.Command)]++
+		sum.SessionsPerDay[s.Start.UTC().Format("2006-01-02")]++
+		total += s.Duration
+	}
+	sum.UniqueUsers = len(users)
+	if len(sessions) > 0 {
+		sum.AverageDuration = total / time.Duration(len(sessions))
+	}
+
+	for cmd, n := range cmds {
+		sum.TopCommands = append(sum.TopCommands, CommandCount{cmd, n})
+	}
+	sort.Slice(sum.TopCommands, func(i, j int) bool {
+		a, b := sum.TopCommands[i], sum.TopCommands[j]
+		if a.Count == b.Count {
+			return a.Command < b.Command
+		}
+		return a.Count > b.Count
+	})
+	if len(sum.TopCommands) > top {
+		sum.TopCommands = sum.TopCommands[:top]
+	}
+	sum.TopConsumers = topConsumers(sessions, top)
+	return sum
+}
+
+// Write writes the summary in a human readable format to the given writer.
+func (sum Summary) Write(w io.Writer) error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "unique users:     %d\n", sum.UniqueUsers)
+	fmt.Fprintf(&sb, "sessions:         %d\n", sum.Sessions)
+	fmt.Fprintf(&sb, "average duration: %s\n", sum.AverageDuration.Round(time.Millisecond))
+
+	days := make([]string, 0, len(sum.SessionsPerDay))
+	for day := range sum.SessionsPerDay {
+		days = append(days, day)
+	}
+	sort.Strings(days)
+	sb.WriteString("sessions per day:\n")
+	for _, day := range days {
+		fmt.Fprintf(&sb, "  %s %d\n", day, sum.SessionsPerDay[day])
+	}
+
+	sb.WriteString("top commands:\n")
+	for _, cc := range sum.TopCommands {
+		fmt.Fprintf(&sb, "  %5d %s\n", cc.Count, cc.Command)
+	}
+
+	sb.WriteString("top consumers (bytes in, bytes out, peak goroutines, cpu):\n")
+	for _, c := range sum.TopConsumers {
+		fmt.Fprintf(&sb, "  %10d %10d %5d %8s %s\n", c.BytesIn, c.BytesOut, c.Goroutines, c.CPU.Round(time.Millisecond), c.ID)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Middleware records every session into the given store, along with the
+// bytes it transferred. Run SampleGoroutines and SampleCPU to also record
+// their goroutine counts and CPU time, e.g. to enforce budgets with Enforce.
+//
+// If the session is authenticated with one of the owners public keys and runs
+// the `stats` command, a summary of the stored sessions is printed instead of
+// calling the next handler.
+func Middleware(store Store, owners ...ssh.PublicKey) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if cmd := s.Command(); len(cmd) == 1 && cmd[0] == "stats" && isOwner(s, owners) {
+				sessions, err := store.Sessions()
+				if err != nil {
+					log.Error("could not get sessions", "error", err)
+					wish.Exit(s, 1, "could not get stats")
+					return
+				}
+				if err := Summarize(sessions, 10).Write(s); err != nil {
+					log.Error("could not write stats", "error", err)
+				}
+				return
+			}
+
+			start := time.Now()
+			u := track(sh, s)
+			rec := Session{
+				User:       s.User(),
+				Command:    s.RawCommand(),
+				Start:      start,
+				Duration:   time.Since(start),
+				BytesIn:    u.in.Load(),
+				BytesOut:   u.out.Load(),
+				Goroutines: int(u.goroutines.Load()),
+				CPU:        time.Duration(u.cpu.Load()),
+			}
+			if pk := s.PublicKey(); pk != nil {
+				rec.Fingerprint = gossh.FingerprintSHA256(pk)
+			}
+			if err := store.Record(rec); err != nil {
+				log.Error("could not record session", "error", err)
+			}
+		}
+	}
+}
+
+func isOwner(s ssh.Session, owners []ssh.PublicKey) bool {
+	pk := s.PublicKey()
+	if pk == nil {
+		return false
+	}
+	for _, owner := range owners {
+		if ssh.KeysEqual(pk, owner) {
+			return true
+		}
+	}
+	return false
+}
+
+func commandName(cmd string) string {
+	if fields := strings.Fields(cmd); len(fields) > 0 {
+		return fields[0]
+	}
+	return "(shell)"
+}
@@ -0,0 +1,100 @@
+package stats
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestMiddleware(t *testing.T) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	requireNoError(t, err)
+	signer, err := gossh.NewSignerFromKey(priv)
+	requireNoError(t, err)
+
+	store := NewMemoryStore(10)
+	srv := &ssh.Server{
+		Handler: Middleware(store, signer.PublicKey())(func(s ssh.Session) {
+			s.Write([]byte("hello"))
+		}),
+		PasswordHandler:  func(ssh.Context, string) bool { return true },
+		PublicKeyHandler: func(ssh.Context, ssh.PublicKey) bool { return true },
+	}
+	addr := testsession.Listen(t, srv)
+
+	for _, cmd := range []string{"", "foo", "foo bar", "stats"} {
+		sess, err := testsession.NewClientSession(t, addr, nil)
+		requireNoError(t, err)
+		out, err := sess.Output(cmd)
+		requireNoError(t, err)
+		if string(out) != "hello" {
+			t.Errorf("expected %q, got %q", "hello", string(out))
+		}
+	}
+
+	sess, err := testsession.NewClientSession(t, addr, &gossh.ClientConfig{
+		User: "owner",
+		Auth: []gossh.AuthMethod{gossh.PublicKeys(signer)},
+	})
+	requireNoError(t, err)
+	out, err := sess.Output("stats")
+	requireNoError(t, err)
+	for _, s := range []string{
+		"unique users:     1\n",
+		"sessions:         4\n",
+		"      2 foo\n",
+		"      1 (shell)\n",
+		"      1 stats\n",
+	} {
+		if !strings.Contains(string(out), s) {
+			t.Errorf("expected %q to contain %q", string(out), s)
+		}
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	day := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	sum := Summarize([]Session{
+		{User: "a", Command: "git-upload-pack foo", Start: day, Duration: time.Second},
+		{User: "a", Command: "", Start: day, Duration: 3 * time.Second},
+		{User: "b", Fingerprint: "SHA256:b", Command: "git-upload-pack bar", Start: day.Add(24 * time.Hour), Duration: 2 * time.Second},
+	}, 1)
+	if sum.UniqueUsers != 2 {
+		t.Errorf("expected 2 unique users, got %d", sum.UniqueUsers)
+	}
+	if sum.AverageDuration != 2*time.Second {
+		t.Errorf("expected 2s average, got %s", sum.AverageDuration)
+	}
+	if len(sum.TopCommands) != 1 || sum.TopCommands[0] != (CommandCount{"git-upload-pack", 2}) {
+		t.Errorf("unexpected top commands: %v", sum.TopCommands)
+	}
+	if sum.SessionsPerDay["2024-01-02"] != 2 || sum.SessionsPerDay["2024-01-03"] != 1 {
+		t.Errorf("unexpected sessions per day: %v", sum.SessionsPerDay)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore(2)
+	for _, u := range []string{"a", "b", "c"} {
+		requireNoError(t, store.Record(Session{User: u}))
+	}
+	sessions, err := store.Sessions()
+	requireNoError(t, err)
+	if len(sessions) != 2 || sessions[0].User != "b" || sessions[1].User != "c" {
+		t.Errorf("unexpected sessions: %v", sessions)
+	}
+}
+
+func requireNoError(t *testing.T, err error) {
+	t.Helper()
+
+	if err != nil {
+		t.Fatalf("expected no error, got %q", err.Error())
+	}
+}
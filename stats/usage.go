@@ -0,0 +1,259 @@
+package stats
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+// ErrInvalidInterval is returned when sampling or pruning with an interval
+// that isn't positive.
+var ErrInvalidInterval = errors.New("interval must be positive")
+
+// usageKey is the key of the usage of a session in its context.
+var usageKey = wish.NewContextKey[*usage]("stats.usage")
+
+// sessionLabel is the profiler label set on the goroutines of a session, so
+// they can be attributed to it when sampling.
+const sessionLabel = "wish.stats.session"
+
+// Consumer is the aggregated resource usage of a user, see Session.ID.
+type Consumer struct {
+	ID         string
+	Sessions   int
+	BytesIn    int64
+	BytesOut   int64
+	Goroutines int
+	CPU        time.Duration
+}
+
+// topConsumers aggregates the usage of the given sessions per user, ranked by
+// the bytes they transferred, then by their peak goroutine count.
+func topConsumers(sessions []Session, top int) []Consumer {
+	byID := map[string]*Consumer{}
+	for _, s := range sessions {
+		c, ok := byID[s.ID()]
+		if !ok {
+			c = &Consumer{ID: s.ID()}
+			byID[s.ID()] = c
+		}
+		c.Sessions++
+		c.BytesIn += s.BytesIn
+		c.BytesOut += s.BytesOut
+		c.CPU += s.CPU
+		if s.Goroutines > c.Goroutines {
+			c.Goroutines = s.Goroutines
+		}
+	}
+
+	consumers := make([]Consumer, 0, len(byID))
+	for _, c := range byID {
+		consumers = append(consumers, *c)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		a, b := consumers[i], consumers[j]
+		if at, bt := a.BytesIn+a.BytesOut, b.BytesIn+b.BytesOut; at != bt {
+			return at > bt
+		}
+		if a.Goroutines != b.Goroutines {
+			return a.Goroutines > b.Goroutines
+		}
+		return a.ID < b.ID
+	})
+	if len(consumers) > top {
+		consumers = consumers[:top]
+	}
+	return consumers
+}
+
+// SampleGoroutines counts the goroutines of every running session each
+// interval, until the returned function is called. The peak count of each
+// session is recorded in Session.Goroutines.
+//
+// Goroutines are attributed to the session whose handler started them,
+// directly or not. Sampling takes a goroutine profile, which briefly stops
+// the world, so the interval shouldn't be too short.
+func SampleGoroutines(interval time.Duration) (stop func(), err error) {
+	if interval <= 0 {
+		return nil, ErrInvalidInterval
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				sampleGoroutines()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}, nil
+}
+
+// running holds the usage of the sessions currently running, by label value.
+var running = struct {
+	mu    sync.Mutex
+	next  uint64
+	usage map[string]*usage
+}{usage: map[string]*usage{}}
+
+// usage is the resource usage of a running session.
+type usage struct {
+	id         string
+	in         atomic.Int64
+	out        atomic.Int64
+	goroutines atomic.Int64
+	cpu        atomic.Int64
+	budget     atomic.Pointer[budget]
+}
+
+// check calls the budget of the session, if any, when it's exceeded.
+func (u *usage) check() {
+	b := u.budget.Load()
+	if b == nil {
+		return
+	}
+	if b.Goroutines > 0 && u.goroutines.Load() > int64(b.Goroutines) {
+		b.exceed("goroutines")
+	}
+	if b.CPU > 0 && u.cpu.Load() > int64(b.CPU) {
+		b.exceed("cpu")
+	}
+}
+
+// observe records the given goroutine count, if it's a new peak.
+func (u *usage) observe(n int64) {
+	for {
+		peak := u.goroutines.Load()
+		if n <= peak || u.goroutines.CompareAndSwap(peak, n) {
+			return
+		}
+	}
+}
+
+// track runs the handler with a wrapped session counting its bytes, and with
+// its goroutines labeled, returning the usage of the session.
+func track(sh ssh.Handler, s ssh.Session) *usage {
+	running.mu.Lock()
+	running.next++
+	u := &usage{id: strconv.FormatUint(running.next, 10)}
+	running.usage[u.id] = u
+	running.mu.Unlock()
+	defer func() {
+		running.mu.Lock()
+		delete(running.usage, u.id)
+		running.mu.Unlock()
+	}()
+
+	pprof.Do(s.Context(), pprof.Labels(sessionLabel, u.id), func(context.Context) {
+		sh(wish.SessionWithValue(&session{Session: s, u: u}, usageKey, u))
+	})
+	return u
+}
+
+// sampleGoroutines records the goroutine count of every running session.
+func sampleGoroutines() {
+	running.mu.Lock()
+	n := len(running.usage)
+	running.mu.Unlock()
+	if n == 0 {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		log.Error("could not sample goroutines", "error", err)
+		return
+	}
+	counts := countGoroutines(&buf)
+
+	running.mu.Lock()
+	defer running.mu.Unlock()
+	for id, u := range running.usage {
+		u.observe(int64(counts[id]))
+		u.check()
+	}
+}
+
+// countGoroutines counts the goroutines per session label value in the given
+// goroutine profile, in its debug=1 text format.
+func countGoroutines(r io.Reader) map[string]int {
+	counts := map[string]int{}
+	key := strconv.Quote(sessionLabel) + ":"
+	var n int
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if count, _, ok := strings.Cut(line, " @ "); ok {
+			n, _ = strconv.Atoi(count)
+			continue
+		}
+		if !strings.HasPrefix(line, "# labels: ") {
+			continue
+		}
+		i := strings.Index(line, key)
+		if i < 0 {
+			continue
+		}
+		value := strings.TrimPrefix(line[i+len(key):], `"`)
+		if id, _, ok := strings.Cut(value, `"`); ok {
+			counts[id] += n
+		}
+	}
+	return counts
+}
+
+// session counts the bytes going through a session.
+type session struct {
+	ssh.Session
+	u *usage
+}
+
+func (s *session) Read(p []byte) (int, error) {
+	n, err := s.Session.Read(p)
+	s.u.in.Add(int64(n))
+	return n, err
+}
+
+func (s *session) Write(p []byte) (int, error) {
+	n, err := s.Session.Write(p)
+	s.u.out.Add(int64(n))
+	return n, err
+}
+
+func (s *session) Stderr() io.ReadWriter {
+	return &stderr{ReadWriter: s.Session.Stderr(), u: s.u}
+}
+
+// stderr counts the bytes written to a session's stderr.
+type stderr struct {
+	io.ReadWriter
+	u *usage
+}
+
+func (e *stderr) Write(p []byte) (int, error) {
+	n, err := e.ReadWriter.Write(p)
+	e.u.out.Add(int64(n))
+	return n, err
+}
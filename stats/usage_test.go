@@ -0,0 +1,163 @@
+package stats
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestUsage(t *testing.T) {
+	store := NewMemoryStore(10)
+	srv := &ssh.Server{
+		Handler: Middleware(store)(func(s ssh.Session) {
+			_, _ = io.Copy(io.Discard, s)
+			release := make(chan struct{})
+			started := make(chan struct{}, 3)
+			for i := 0; i < 3; i++ {
+				go func() {
+					started <- struct{}{}
+					<-release
+				}()
+			}
+			for i := 0; i < 3; i++ {
+				<-started
+			}
+			sampleGoroutines()
+			close(release)
+			_, _ = s.Write([]byte("hello"))
+			_, _ = s.Stderr().Write([]byte("oops"))
+		}),
+	}
+	sess := testsession.New(t, srv, nil)
+	sess.Stdin = strings.NewReader("some input")
+	requireNoError(t, sess.Run(""))
+
+	sessions, err := store.Sessions()
+	requireNoError(t, err)
+	if len(sessions) != 1 {
+		t.Fatalf("expected 1 session, got %d", len(sessions))
+	}
+	s := sessions[0]
+	if s.BytesIn != 10 || s.BytesOut != 9 {
+		t.Errorf("expected 10 bytes in and 9 out, got %d and %d", s.BytesIn, s.BytesOut)
+	}
+	if s.Goroutines != 4 {
+		t.Errorf("expected 4 goroutines, got %d", s.Goroutines)
+	}
+}
+
+func TestCountGoroutines(t *testing.T) {
+	counts := countGoroutines(strings.NewReader(`goroutine profile: total 6
+3 @ 0x43a1b6 0x4081c5
+# labels: {"other":"x", "wish.stats.session":"1"}
+#	0x4081c4	main.main+0x24	/tmp/main.go:10
+
+2 @ 0x43a1b6 0x4081c5
+# labels: {"wish.stats.session":"2"}
+#	0x4081c4	main.main+0x24	/tmp/main.go:10
+
+1 @ 0x43a1b6 0x4081c5
+#	0x4081c4	main.main+0x24	/tmp/main.go:10
+`))
+	if len(counts) != 2 || counts["1"] != 3 || counts["2"] != 2 {
+		t.Errorf("unexpected counts: %v", counts)
+	}
+}
+
+func TestTopConsumers(t *testing.T) {
+	sum := Summarize([]Session{
+		{User: "a", BytesIn: 10, BytesOut: 10, Goroutines: 2},
+		{User: "a", BytesIn: 5, Goroutines: 7},
+		{User: "b", BytesOut: 100, Goroutines: 1},
+		{User: "c", Goroutines: 50},
+	}, 2)
+	expected := []Consumer{
+		{ID: "user:b", Sessions: 1, BytesOut: 100, Goroutines: 1},
+		{ID: "user:a", Sessions: 2, BytesIn: 15, BytesOut: 10, Goroutines: 7},
+	}
+	if len(sum.TopConsumers) != len(expected) {
+		t.Fatalf("unexpected top consumers: %v", sum.TopConsumers)
+	}
+	for i, c := range expected {
+		if sum.TopConsumers[i] != c {
+			t.Errorf("expected %v, got %v", c, sum.TopConsumers[i])
+		}
+	}
+}
+
+func TestSampleCPU(t *testing.T) {
+	stop, err := SampleCPU(50 * time.Millisecond)
+	requireNoError(t, err)
+	if _, err := SampleCPU(time.Second); err == nil {
+		t.Error("expected the profiler to be running")
+	}
+
+	store := NewMemoryStore(10)
+	srv := &ssh.Server{
+		Handler: Middleware(store)(func(s ssh.Session) {
+			// busy loop in a goroutine of the session.
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for start := time.Now(); time.Since(start) < 300*time.Millisecond; {
+				}
+			}()
+			<-done
+			time.Sleep(100 * time.Millisecond)
+		}),
+	}
+	requireNoError(t, testsession.New(t, srv, nil).Run(""))
+	stop()
+
+	sessions, err := store.Sessions()
+	requireNoError(t, err)
+	if len(sessions) != 1 || sessions[0].CPU <= 0 {
+		t.Errorf("expected the session to use cpu, got %v", sessions)
+	}
+}
+
+func TestEnforce(t *testing.T) {
+	exceeded := make(chan string, 1)
+	srv := &ssh.Server{
+		Handler: Enforce(Budget{
+			Goroutines: 2,
+			Exceeded: func(s ssh.Session, resource string) {
+				exceeded <- resource
+				_ = s.Close()
+			},
+		})(func(s ssh.Session) {
+			for i := 0; i < 3; i++ {
+				go func() { <-s.Context().Done() }()
+			}
+			<-s.Context().Done()
+		}),
+	}
+	srv.Handler = Middleware(NewMemoryStore(10))(srv.Handler)
+	stop, err := SampleGoroutines(10 * time.Millisecond)
+	requireNoError(t, err)
+	defer stop()
+
+	_ = testsession.New(t, srv, nil).Run("")
+	select {
+	case resource := <-exceeded:
+		if resource != "goroutines" {
+			t.Errorf("expected the goroutines to be exceeded, got %q", resource)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the budget to be exceeded")
+	}
+}
+
+func TestSampleInvalidInterval(t *testing.T) {
+	if _, err := SampleGoroutines(0); !errors.Is(err, ErrInvalidInterval) {
+		t.Errorf("expected ErrInvalidInterval, got %v", err)
+	}
+	if _, err := SampleCPU(-time.Second); !errors.Is(err, ErrInvalidInterval) {
+		t.Errorf("expected ErrInvalidInterval, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package wish
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd.
+const listenFDsStart = 3
+
+// SystemdListeners returns the listeners passed by systemd socket activation,
+// in the order of the socket unit, or none if the process wasn't socket
+// activated. Serve them with Serve, so the server doesn't bind its own port,
+// and systemd keeps accepting connections while it restarts.
+//
+// The LISTEN_* environment variables are unset, so they aren't inherited by
+// child processes.
+func SystemdListeners() ([]net.Listener, error) {
+	return systemdListeners(listenFDsStart)
+}
+
+func systemdListeners(start int) ([]net.Listener, error) {
+	pid, fds, names := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES")
+	if fds == "" {
+		return nil, nil
+	}
+	for _, env := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		_ = os.Unsetenv(env)
+	}
+	if pid != strconv.Itoa(os.Getpid()) {
+		// passed to another process.
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS: %q", fds)
+	}
+	fdNames := strings.Split(names, ":")
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(start+i)
+		if i < len(fdNames) && fdNames[i] != "" {
+			name = fdNames[i]
+		}
+		f := os.NewFile(uintptr(start+i), name)
+		// the listener gets its own copy of the file descriptor.
+		ln, err := net.FileListener(f)
+		_ = f.Close()
+		if err != nil {
+			for _, ln := range listeners {
+				_ = ln.Close()
+			}
+			return nil, fmt.Errorf("socket activation: %s: %w", name, err)
+		}
+		listeners = append(listeners, ln)
+	}
+	return listeners, nil
+}
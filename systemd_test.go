@@ -0,0 +1,57 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package wish
+
+import (
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+)
+
+func TestSystemdListeners(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	requireNoError(t, err)
+	f, err := ln.(*net.TCPListener).File()
+	requireNoError(t, err)
+	requireNoError(t, ln.Close())
+	defer f.Close() // nolint: errcheck
+
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "1")
+	t.Setenv("LISTEN_FDNAMES", "ssh")
+	listeners, err := systemdListeners(int(f.Fd()))
+	requireNoError(t, err)
+	if len(listeners) != 1 {
+		t.Fatalf("expected 1 listener, got %d", len(listeners))
+	}
+	if _, ok := os.LookupEnv("LISTEN_FDS"); ok {
+		t.Error("expected the environment to be unset")
+	}
+
+	srv, err := NewServer(WithHostKeyPath(t.TempDir()+"/id_ed25519"), func(s *ssh.Server) error {
+		s.Handler = func(ssh.Session) {}
+		return nil
+	})
+	requireNoError(t, err)
+	done := make(chan error, 1)
+	go func() { done <- Serve(srv, listeners...) }()
+	sess, err := dialRetry(t, listeners[0].Addr().String()).NewSession()
+	requireNoError(t, err)
+	requireNoError(t, sess.Run(""))
+
+	requireNoError(t, srv.Close())
+	if err := <-done; !errors.Is(err, ssh.ErrServerClosed) {
+		t.Errorf("expected ssh.ErrServerClosed, got %v", err)
+	}
+
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	if listeners, err := SystemdListeners(); err != nil || len(listeners) != 0 {
+		t.Errorf("expected no listeners for another process, got %v: %v", listeners, err)
+	}
+}
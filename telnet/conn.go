@@ -0,0 +1,241 @@
+package telnet
+
+import (
+	"encoding/binary"
+	"net"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+)
+
+// Telnet commands, see RFC 854.
+const (
+	cmdSE   = 240
+	cmdBRK  = 243
+	cmdIP   = 244
+	cmdAYT  = 246
+	cmdSB   = 250
+	cmdWILL = 251
+	cmdWONT = 252
+	cmdDO   = 253
+	cmdDONT = 254
+	cmdIAC  = 255
+)
+
+// Telnet options.
+const (
+	optEcho  = 1  // RFC 857
+	optSGA   = 3  // RFC 858
+	optTType = 24 // RFC 1091
+	optNAWS  = 31 // RFC 1073
+)
+
+// Terminal type subnegotiation commands.
+const (
+	ttypeIS   = 0
+	ttypeSEND = 1
+)
+
+type state int
+
+const (
+	stateData state = iota
+	stateCR
+	stateIAC
+	stateOption
+	stateSB
+	stateSBIAC
+)
+
+// conn speaks telnet on a connection: it negotiates a character at a time
+// mode, with the server echoing, and the terminal type and window size of the
+// client, decodes what it sends, and escapes what's written to it.
+type conn struct {
+	net.Conn
+
+	wmu sync.Mutex
+
+	state state
+	cmd   byte
+	sb    []byte
+
+	// term and win are what the client told about its terminal, and
+	// ttypeDone and nawsDone whether it did, or refused to.
+	term      string
+	win       ssh.Window
+	ttypeDone bool
+	nawsDone  bool
+
+	// resize, signal and brk are called as the client sends window
+	// changes, interrupts and breaks, once set. Interrupts sent before are
+	// kept in sigs.
+	resize func(ssh.Window)
+	signal func(ssh.Signal)
+	brk    func()
+	sigs   []ssh.Signal
+}
+
+func newConn(c net.Conn) *conn {
+	return &conn{Conn: c}
+}
+
+// Write writes p to the client, escaping IAC bytes.
+func (c *conn) Write(p []byte) (int, error) {
+	buf := make([]byte, 0, len(p))
+	for _, b := range p {
+		if b == cmdIAC {
+			buf = append(buf, cmdIAC)
+		}
+		buf = append(buf, b)
+	}
+	if _, err := c.writeRaw(buf); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *conn) writeRaw(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.Conn.Write(p)
+}
+
+// negotiate asks the client for the options the server wants.
+func (c *conn) negotiate() error {
+	_, err := c.writeRaw([]byte{
+		cmdIAC, cmdWILL, optEcho,
+		cmdIAC, cmdWILL, optSGA,
+		cmdIAC, cmdDO, optSGA,
+		cmdIAC, cmdDO, optTType,
+		cmdIAC, cmdDO, optNAWS,
+	})
+	return err
+}
+
+// negotiated returns whether the client told about its terminal, or refused
+// to.
+func (c *conn) negotiated() bool {
+	return c.ttypeDone && c.nawsDone
+}
+
+// decode decodes what the client sent, handling the commands, and returns the
+// data. Carriage returns followed by a NUL or a line feed, as clients send
+// them for the return key, are returned alone, as SSH clients do.
+func (c *conn) decode(p []byte) []byte {
+	data := make([]byte, 0, len(p))
+	for _, b := range p {
+		switch c.state {
+		case stateData, stateCR:
+			cr := c.state == stateCR
+			c.state = stateData
+			switch {
+			case b == cmdIAC:
+				c.state = stateIAC
+			case cr && (b == '\n' || b == 0):
+			case b == '\r':
+				data = append(data, b)
+				c.state = stateCR
+			default:
+				data = append(data, b)
+			}
+		case stateIAC:
+			c.state = stateData
+			switch b {
+			case cmdIAC:
+				data = append(data, b)
+			case cmdWILL, cmdWONT, cmdDO, cmdDONT:
+				c.cmd = b
+				c.state = stateOption
+			case cmdSB:
+				c.sb = c.sb[:0]
+				c.state = stateSB
+			case cmdIP:
+				if c.signal != nil {
+					c.signal(ssh.SIGINT)
+				} else {
+					c.sigs = append(c.sigs, ssh.SIGINT)
+				}
+			case cmdBRK:
+				if c.brk != nil {
+					c.brk()
+				}
+			case cmdAYT:
+				_, _ = c.writeRaw([]byte("\r\n[yes]\r\n"))
+			}
+		case stateOption:
+			c.state = stateData
+			c.option(c.cmd, b)
+		case stateSB:
+			if b == cmdIAC {
+				c.state = stateSBIAC
+			} else if len(c.sb) < 512 {
+				c.sb = append(c.sb, b)
+			}
+		case stateSBIAC:
+			switch b {
+			case cmdSE:
+				c.state = stateData
+				c.subnegotiation(c.sb)
+			case cmdIAC:
+				c.state = stateSB
+				c.sb = append(c.sb, b)
+			default:
+				c.state = stateData
+			}
+		}
+	}
+	return data
+}
+
+// option handles the client's answers to the server's requests, and refuses
+// what it asks for otherwise.
+func (c *conn) option(cmd, opt byte) {
+	switch cmd {
+	case cmdWILL:
+		switch opt {
+		case optTType:
+			_, _ = c.writeRaw([]byte{cmdIAC, cmdSB, optTType, ttypeSEND, cmdIAC, cmdSE})
+		case optNAWS, optSGA:
+		default:
+			_, _ = c.writeRaw([]byte{cmdIAC, cmdDONT, opt})
+		}
+	case cmdWONT:
+		switch opt {
+		case optTType:
+			c.ttypeDone = true
+		case optNAWS:
+			c.nawsDone = true
+		}
+	case cmdDO:
+		switch opt {
+		case optEcho, optSGA:
+		default:
+			_, _ = c.writeRaw([]byte{cmdIAC, cmdWONT, opt})
+		}
+	}
+}
+
+func (c *conn) subnegotiation(sb []byte) {
+	if len(sb) == 0 {
+		return
+	}
+	switch sb[0] {
+	case optTType:
+		if len(sb) > 1 && sb[1] == ttypeIS {
+			c.term = string(sb[2:])
+			c.ttypeDone = true
+		}
+	case optNAWS:
+		if len(sb) != 5 {
+			return
+		}
+		c.win = ssh.Window{
+			Width:  int(binary.BigEndian.Uint16(sb[1:3])),
+			Height: int(binary.BigEndian.Uint16(sb[3:5])),
+		}
+		c.nawsDone = true
+		if c.resize != nil {
+			c.resize(c.win)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+// Package telnet serves wish apps over telnet, for clients that can't speak
+// SSH, e.g. retro computers and old terminals.
+//
+// Telnet is insecure: nothing is encrypted, and no one is authenticated. All
+// users get the same guest identity, without a public key, and the server's
+// auth handlers and connection callbacks are skipped. Its session request
+// callback is called, as for SSH shells. Only serve apps meant for anyone, on
+// networks you trust, and use IsTelnet in handlers that must not run over it.
+//
+// Sessions go through the same handler chain as SSH sessions, with an
+// emulated PTY of the terminal type and window size the client tells about.
+package telnet
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/internal/log"
+	"github.com/charmbracelet/wish/internal/session"
+)
+
+// ClientVersion is the client version of the contexts of telnet sessions.
+const ClientVersion = "telnet"
+
+// DefaultUser is the name of the user of telnet sessions when none is set
+// with WithUser.
+const DefaultUser = "guest"
+
+// DefaultTerm and DefaultWindow describe the terminal of clients that don't
+// tell about theirs.
+var (
+	DefaultTerm   = "vt100"
+	DefaultWindow = ssh.Window{Width: 80, Height: 24}
+)
+
+// IsTelnet returns whether the session with the given context is a telnet
+// session.
+func IsTelnet(ctx ssh.Context) bool {
+	return ctx.ClientVersion() == ClientVersion
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithUser sets the name of the user of telnet sessions.
+func WithUser(name string) Option {
+	return func(s *Server) {
+		s.user = name
+	}
+}
+
+// WithNegotiationTimeout sets how long the server waits for clients to tell
+// about their terminal before starting sessions. It defaults to a second.
+func WithNegotiationTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.negotiation = d
+	}
+}
+
+// Server serves the handler of an SSH server over telnet.
+type Server struct {
+	srv         *ssh.Server
+	user        string
+	negotiation time.Duration
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// New returns a telnet server serving the handler of srv, with its
+// middlewares, e.g. as set up with wish.NewServer.
+func New(srv *ssh.Server, opts ...Option) *Server {
+	s := &Server{
+		srv:         srv,
+		user:        DefaultUser,
+		negotiation: time.Second,
+		listeners:   map[net.Listener]struct{}{},
+		conns:       map[net.Conn]struct{}{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ListenAndServe listens on the TCP address, e.g. ":23", and serves it.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve serves the connections accepted from the listener, until the server is
+// closed, in which case it returns ssh.ErrServerClosed, or the listener fails.
+func (s *Server) Serve(ln net.Listener) error {
+	if !s.track(ln, nil) {
+		return ssh.ErrServerClosed
+	}
+	defer s.untrack(ln, nil)
+	log.Warn("serving telnet, connections are neither encrypted nor authenticated", "addr", ln.Addr())
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ssh.ErrServerClosed
+			}
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				time.Sleep(10 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		if !s.track(nil, conn) {
+			_ = conn.Close()
+			return ssh.ErrServerClosed
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer s.untrack(nil, conn)
+			s.handle(conn)
+		}()
+	}
+}
+
+// Shutdown stops accepting connections, and waits for the sessions to end, or
+// for the context to be done, in which case it closes them.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.closeListeners()
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		_ = s.Close()
+		return ctx.Err()
+	}
+}
+
+// Close closes the listeners and the connections.
+func (s *Server) Close() error {
+	s.closeListeners()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for c := range s.conns {
+		_ = c.Close()
+	}
+	return nil
+}
+
+func (s *Server) closeListeners() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	for ln := range s.listeners {
+		_ = ln.Close()
+	}
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// track adds the listener or connection to the server, and returns false if
+// it's closed.
+func (s *Server) track(ln net.Listener, c net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	if ln != nil {
+		s.listeners[ln] = struct{}{}
+	}
+	if c != nil {
+		s.conns[c] = struct{}{}
+	}
+	return true
+}
+
+func (s *Server) untrack(ln net.Listener, c net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.listeners, ln)
+	delete(s.conns, c)
+}
+
+func (s *Server) handle(nc net.Conn) {
+	log.Debug("telnet connection", "remote-addr", nc.RemoteAddr())
+	c := newConn(nc)
+	if err := c.negotiate(); err != nil {
+		_ = nc.Close()
+		return
+	}
+
+	// wait for the client to tell about its terminal, keeping what it
+	// types meanwhile.
+	var pending []byte
+	buf := make([]byte, 1024)
+	_ = nc.SetReadDeadline(time.Now().Add(s.negotiation))
+	for !c.negotiated() {
+		n, err := nc.Read(buf)
+		pending = append(pending, c.decode(buf[:n])...)
+		if err != nil {
+			var nerr net.Error
+			if errors.As(err, &nerr) && nerr.Timeout() {
+				break
+			}
+			_ = nc.Close()
+			return
+		}
+	}
+	_ = nc.SetReadDeadline(time.Time{})
+
+	term, win := DefaultTerm, DefaultWindow
+	if c.term != "" {
+		term = strings.ToLower(c.term)
+	}
+	if c.win.Width > 0 && c.win.Height > 0 {
+		win = c.win
+	}
+	sess := session.New(context.Background(), c, session.Config{
+		Server:        s.srv,
+		User:          s.user,
+		ClientVersion: ClientVersion,
+		Term:          term,
+		Window:        win,
+		Environ:       []string{"TERM=" + term},
+		LocalAddr:     nc.LocalAddr(),
+		RemoteAddr:    nc.RemoteAddr(),
+		Close:         nc.Close,
+	})
+	c.resize = sess.Resize
+	c.signal = sess.Signal
+	c.brk = sess.SendBreak
+	sess.Input(pending)
+	for _, sig := range c.sigs {
+		sess.Signal(sig)
+	}
+
+	go func() {
+		for {
+			n, err := nc.Read(buf)
+			if data := c.decode(buf[:n]); len(data) > 0 {
+				sess.Input(data)
+			}
+			if err != nil {
+				sess.CloseInput(err)
+				_ = sess.Close()
+				return
+			}
+		}
+	}()
+	sess.Run()
+}
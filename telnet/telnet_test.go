@@ -0,0 +1,170 @@
+package telnet
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+)
+
+func TestServer(t *testing.T) {
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			pty, _, ok := s.Pty()
+			fmt.Fprintf(s, "pty=%v term=%s size=%dx%d user=%s telnet=%v\n",
+				ok, pty.Term, pty.Window.Width, pty.Window.Height, s.User(), IsTelnet(s.Context()))
+			line, _ := bufio.NewReader(s).ReadString('\r')
+			fmt.Fprintf(s, "got %q \xff\n", line)
+		},
+	}
+	addr := listen(t, New(srv))
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer c.Close() // nolint: errcheck
+	r := bufio.NewReader(c)
+
+	// the server asks for the terminal type and the window size.
+	expectRead(t, r, []byte{cmdIAC, cmdWILL, optEcho, cmdIAC, cmdWILL, optSGA, cmdIAC, cmdDO, optSGA, cmdIAC, cmdDO, optTType, cmdIAC, cmdDO, optNAWS})
+	write(t, c, []byte{cmdIAC, cmdWILL, optTType, cmdIAC, cmdWILL, optNAWS, cmdIAC, cmdSB, optNAWS, 0, 100, 0, 40, cmdIAC, cmdSE})
+	expectRead(t, r, []byte{cmdIAC, cmdSB, optTType, ttypeSEND, cmdIAC, cmdSE})
+	write(t, c, append(append([]byte{cmdIAC, cmdSB, optTType, ttypeIS}, "XTERM"...), cmdIAC, cmdSE))
+
+	expectRead(t, r, []byte("pty=true term=xterm size=100x40 user=guest telnet=true\r\n"))
+	write(t, c, []byte("hi \xff\xff\r\x00"))
+	expectRead(t, r, []byte("got \"hi \\xff\\r\" \xff\xff\r\n"))
+	if _, err := r.ReadByte(); !errors.Is(err, io.EOF) {
+		t.Errorf("expected the connection to be closed, got %v", err)
+	}
+}
+
+func TestServerNoNegotiation(t *testing.T) {
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			pty, _, _ := s.Pty()
+			fmt.Fprintf(s, "term=%s size=%dx%d\n", pty.Term, pty.Window.Width, pty.Window.Height)
+		},
+	}
+	addr := listen(t, New(srv, WithUser("visitor"), WithNegotiationTimeout(50*time.Millisecond)))
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer c.Close() // nolint: errcheck
+	out, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !bytes.HasSuffix(out, []byte("term=vt100 size=80x24\r\n")) {
+		t.Errorf("expected the default terminal, got %q", out)
+	}
+}
+
+func TestServerSessionRequestCallback(t *testing.T) {
+	type greetingKey struct{}
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			fmt.Fprintf(s, "%s\n", s.Context().Value(greetingKey{}))
+		},
+		SessionRequestCallback: func(s ssh.Session, requestType string) bool {
+			s.Context().SetValue(greetingKey{}, "hello "+requestType)
+			return true
+		},
+	}
+	addr := listen(t, New(srv, WithNegotiationTimeout(50*time.Millisecond)))
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer c.Close() // nolint: errcheck
+	out, err := io.ReadAll(c)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !bytes.HasSuffix(out, []byte("hello shell\r\n")) {
+		t.Errorf("expected the callback to run before the handler, got %q", out)
+	}
+}
+
+func TestServerInterrupt(t *testing.T) {
+	sigs := make(chan ssh.Signal, 1)
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			s.Signals(sigs)
+			<-s.Context().Done()
+		},
+	}
+	addr := listen(t, New(srv, WithNegotiationTimeout(50*time.Millisecond)))
+
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	write(t, c, []byte{cmdIAC, cmdIP})
+	select {
+	case sig := <-sigs:
+		if sig != ssh.SIGINT {
+			t.Errorf("expected SIGINT, got %s", sig)
+		}
+	case <-time.After(time.Second):
+		t.Error("expected a signal")
+	}
+	_ = c.Close()
+}
+
+func TestServerShutdown(t *testing.T) {
+	s := New(&ssh.Server{Handler: func(ssh.Session) {}})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(ln) }()
+	time.Sleep(50 * time.Millisecond)
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := <-done; !errors.Is(err, ssh.ErrServerClosed) {
+		t.Errorf("expected ssh.ErrServerClosed, got %v", err)
+	}
+}
+
+func listen(tb testing.TB, s *Server) string {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatalf("expected no error, got %v", err)
+	}
+	go s.Serve(ln) // nolint: errcheck
+	tb.Cleanup(func() { _ = s.Close() })
+	return ln.Addr().String()
+}
+
+func write(tb testing.TB, w io.Writer, p []byte) {
+	tb.Helper()
+	if _, err := w.Write(p); err != nil {
+		tb.Fatalf("expected no error, got %v", err)
+	}
+}
+
+func expectRead(tb testing.TB, r io.Reader, expect []byte) {
+	tb.Helper()
+	got := make([]byte, len(expect))
+	if _, err := io.ReadFull(r, got); err != nil {
+		tb.Fatalf("expected no error, got %v", err)
+	}
+	if !bytes.Equal(got, expect) {
+		tb.Fatalf("expected %q, got %q", expect, got)
+	}
+}
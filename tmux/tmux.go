@@ -0,0 +1,226 @@
+// Package tmux provides a development middleware mirroring sessions into
+// local tmux sessions, so developers can watch, read-only, what remote users
+// see, e.g. to debug rendering issues they report.
+//
+// Don't use it in production: anyone with access to the tmux server sees
+// everything the users see.
+package tmux
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+// DefaultSocket is the name of the tmux server socket sessions are mirrored
+// to, i.e. tmux's -L flag, when none is set with WithSocket.
+const DefaultSocket = "wish"
+
+type config struct {
+	bin    string
+	socket string
+	name   func(ssh.Session) string
+}
+
+// Option configures Middleware.
+type Option func(*config)
+
+// WithBinary sets the path of the tmux binary. It defaults to finding tmux in
+// the PATH.
+func WithBinary(path string) Option {
+	return func(c *config) {
+		c.bin = path
+	}
+}
+
+// WithSocket sets the name of the tmux server socket.
+func WithSocket(name string) Option {
+	return func(c *config) {
+		c.socket = name
+	}
+}
+
+// WithName sets the function naming the tmux session of a session. It
+// defaults to DefaultName.
+func WithName(fn func(ssh.Session) string) Option {
+	return func(c *config) {
+		c.name = fn
+	}
+}
+
+// DefaultName names the tmux session of a session after its user and the
+// start of its session ID, e.g. "wish-carlos-1a2b3c4d".
+func DefaultName(s ssh.Session) string {
+	id := s.Context().SessionID()
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	// tmux doesn't allow dots and colons in session names.
+	user := strings.NewReplacer(".", "_", ":", "_").Replace(s.User())
+	return fmt.Sprintf("wish-%s-%s", user, id)
+}
+
+// Middleware mirrors the output of each session with a PTY into a detached
+// tmux session of the same size, following the window changes, and logs how
+// to attach to it, e.g.:
+//
+//	tmux -L wish attach -r -t wish-carlos-1a2b3c4d
+//
+// The tmux session is killed when the session ends. Sessions are served
+// without mirroring if tmux fails, e.g. because it isn't installed.
+//
+// Only the output written by the handlers to the session is mirrored: with
+// ssh.AllocatePty, the output of the PTY is copied to the session by the
+// server itself, and isn't seen by the middleware.
+func Middleware(opts ...Option) wish.Middleware {
+	cfg := config{
+		bin:    "tmux",
+		socket: DefaultSocket,
+		name:   DefaultName,
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			pty, winCh, ok := s.Pty()
+			if !ok {
+				sh(s)
+				return
+			}
+			m, err := cfg.mirror(cfg.name(s), pty.Window)
+			if err != nil {
+				log.Warn("could not mirror session into tmux", "user", s.User(), "error", err)
+				sh(s)
+				return
+			}
+			defer m.close()
+			log.Warn("mirroring session into tmux, anyone with access to the tmux server can see it",
+				"user", s.User(), "attach", fmt.Sprintf("%s -L %s attach -r -t %s", cfg.bin, cfg.socket, m.name))
+			sh(&session{Session: s, m: m, winCh: m.follow(winCh)})
+		}
+	}
+}
+
+// mirror is a tmux session mirroring a session.
+type mirror struct {
+	cfg  config
+	name string
+	mu   sync.Mutex
+	tty  *os.File
+}
+
+func (c config) tmux(args ...string) ([]byte, error) {
+	out, err := exec.Command(c.bin, append([]string{"-L", c.socket}, args...)...).Output() // nolint: gosec
+	var eerr *exec.ExitError
+	if errors.As(err, &eerr) && len(eerr.Stderr) > 0 {
+		return out, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(eerr.Stderr)))
+	}
+	return out, err
+}
+
+// mirror starts a tmux session of the given size, and opens the TTY of its
+// pane. It runs a program doing nothing, so what's written to the TTY is
+// shown as is.
+func (c config) mirror(name string, win ssh.Window) (*mirror, error) {
+	out, err := c.tmux(
+		"new-session", "-d", "-P", "-F", "#{pane_tty}",
+		"-s", name,
+		"-x", strconv.Itoa(win.Width), "-y", strconv.Itoa(win.Height),
+		"exec tail -f /dev/null",
+		";", "set-option", "-t", name, "window-size", "manual",
+		";", "set-option", "-t", name, "status", "off",
+	)
+	if err != nil {
+		return nil, err
+	}
+	path := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	tty, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		_, _ = c.tmux("kill-session", "-t", name)
+		return nil, err
+	}
+	return &mirror{cfg: c, name: name, tty: tty}, nil
+}
+
+func (m *mirror) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tty.Write(p)
+}
+
+func (m *mirror) resize(win ssh.Window) {
+	if _, err := m.cfg.tmux("resize-window", "-t", m.name, "-x", strconv.Itoa(win.Width), "-y", strconv.Itoa(win.Height)); err != nil {
+		log.Debug("could not resize tmux mirror", "name", m.name, "error", err)
+	}
+}
+
+// follow resizes the tmux session as the window changes, and returns a channel
+// relaying the changes, for the handler. Only the latest change is kept until
+// the handler reads it, so a handler not reading them doesn't stop the
+// resizes.
+func (m *mirror) follow(winCh <-chan ssh.Window) <-chan ssh.Window {
+	relay := make(chan ssh.Window, 1)
+	go func() {
+		defer close(relay)
+		for win := range winCh {
+			m.resize(win)
+			select {
+			case <-relay:
+			default:
+			}
+			relay <- win
+		}
+	}()
+	return relay
+}
+
+func (m *mirror) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_ = m.tty.Close()
+	if _, err := m.cfg.tmux("kill-session", "-t", m.name); err != nil {
+		log.Debug("could not kill tmux mirror", "name", m.name, "error", err)
+	}
+}
+
+// session mirrors what's written to it.
+type session struct {
+	ssh.Session
+	m     *mirror
+	winCh <-chan ssh.Window
+}
+
+func (s *session) Write(p []byte) (int, error) {
+	_, _ = s.m.Write(p)
+	return s.Session.Write(p)
+}
+
+func (s *session) Stderr() io.ReadWriter {
+	return &stderr{ReadWriter: s.Session.Stderr(), m: s.m}
+}
+
+func (s *session) Pty() (ssh.Pty, <-chan ssh.Window, bool) {
+	pty, _, ok := s.Session.Pty()
+	return pty, s.winCh, ok
+}
+
+// stderr mirrors what's written to a session's stderr.
+type stderr struct {
+	io.ReadWriter
+	m *mirror
+}
+
+func (e *stderr) Write(p []byte) (int, error) {
+	_, _ = e.m.Write(p)
+	return e.ReadWriter.Write(p)
+}
@@ -0,0 +1,78 @@
+package tmux
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+func TestMiddleware(t *testing.T) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not found")
+	}
+	socket := fmt.Sprintf("wish-test-%d", time.Now().UnixNano())
+	t.Cleanup(func() { _ = exec.Command("tmux", "-L", socket, "kill-server").Run() })
+	cfg := config{bin: "tmux", socket: socket}
+
+	type pane struct {
+		content string
+		size    string
+	}
+	panes := make(chan pane, 1)
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			fmt.Fprintln(s, "hello from the mirror")
+			time.Sleep(100 * time.Millisecond)
+			content, _ := cfg.tmux("capture-pane", "-p", "-t", "mirrored")
+			size, _ := cfg.tmux("display-message", "-p", "-t", "mirrored", "#{window_width}x#{window_height}")
+			panes <- pane{string(content), strings.TrimSpace(string(size))}
+		},
+	}
+	srv.Handler = Middleware(
+		WithSocket(socket),
+		WithName(func(ssh.Session) string { return "mirrored" }),
+	)(srv.Handler)
+
+	sess := testsession.New(t, srv, nil)
+	if err := sess.RequestPty("xterm", 30, 100, nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := sess.Run(""); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	p := <-panes
+	if !strings.Contains(p.content, "hello from the mirror") {
+		t.Errorf("expected the output to be mirrored, got %q", p.content)
+	}
+	if p.size != "100x30" {
+		t.Errorf("expected a 100x30 window, got %q", p.size)
+	}
+	if err := exec.Command("tmux", "-L", socket, "has-session", "-t", "mirrored").Run(); err == nil {
+		t.Error("expected the tmux session to be killed")
+	}
+}
+
+func TestMiddlewareNoTmux(t *testing.T) {
+	srv := &ssh.Server{
+		Handler: func(s ssh.Session) {
+			fmt.Fprint(s, "still served")
+		},
+	}
+	srv.Handler = Middleware(WithBinary("nopenopenope"))(srv.Handler)
+	sess := testsession.New(t, srv, nil)
+	if err := sess.RequestPty("xterm", 30, 100, nil); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	out, err := sess.Output("")
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(out) != "still served" {
+		t.Errorf("expected %q, got %q", "still served", out)
+	}
+}
@@ -0,0 +1,140 @@
+// Package trailer provides a middleware appending a machine-readable summary
+// of non-interactive sessions to their output, so CI systems and scripts
+// running commands over wish can reliably check how they went.
+package trailer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+)
+
+// Prefix starts trailer lines, so they can be told apart from the rest of
+// the output.
+const Prefix = "wish-trailer: "
+
+// ErrNoTrailer is returned when parsing a line that isn't a trailer.
+var ErrNoTrailer = errors.New("not a trailer line")
+
+// Summary summarizes a session.
+type Summary struct {
+	// ExitStatus is the exit status sent to the client.
+	ExitStatus int `json:"exit_status"`
+
+	// Duration is the duration of the session, in seconds.
+	Duration float64 `json:"duration_seconds"`
+
+	// BytesIn is the number of bytes read from the client.
+	BytesIn int64 `json:"bytes_in"`
+
+	// BytesOut is the number of bytes written to the client, on stdout and
+	// stderr, excluding the trailer itself.
+	BytesOut int64 `json:"bytes_out"`
+}
+
+// Parse parses a trailer line, e.g. the last line of a session's stderr.
+func Parse(line string) (Summary, error) {
+	var sum Summary
+	line = strings.TrimSpace(line)
+	if !strings.HasPrefix(line, Prefix) {
+		return sum, ErrNoTrailer
+	}
+	if err := json.Unmarshal([]byte(line[len(Prefix):]), &sum); err != nil {
+		return sum, fmt.Errorf("%w: %s", ErrNoTrailer, err)
+	}
+	return sum, nil
+}
+
+// Middleware appends a trailer line, made of Prefix and the JSON encoded
+// Summary of the session, to the stderr of sessions without a PTY, right
+// before they exit. Sessions with a PTY are interactive, and left alone.
+//
+// It should be the first middleware in the chain, so it sees everything
+// written by the others.
+func Middleware() wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if _, _, ok := s.Pty(); ok {
+				sh(s)
+				return
+			}
+			ts := &session{Session: s, start: time.Now()}
+			sh(ts)
+			ts.trail(0)
+		}
+	}
+}
+
+// session counts the bytes going through a session, and writes its trailer
+// when it exits.
+type session struct {
+	ssh.Session
+	start time.Time
+	in    atomic.Int64
+	out   atomic.Int64
+	once  sync.Once
+
+	// midLine is whether the output to stderr doesn't end with a newline.
+	midLine atomic.Bool
+}
+
+func (s *session) Read(p []byte) (int, error) {
+	n, err := s.Session.Read(p)
+	s.in.Add(int64(n))
+	return n, err
+}
+
+func (s *session) Write(p []byte) (int, error) {
+	n, err := s.Session.Write(p)
+	s.out.Add(int64(n))
+	return n, err
+}
+
+func (s *session) Stderr() io.ReadWriter {
+	return &stderr{ReadWriter: s.Session.Stderr(), s: s}
+}
+
+func (s *session) Exit(code int) error {
+	s.trail(code)
+	return s.Session.Exit(code)
+}
+
+// trail writes the trailer, once.
+func (s *session) trail(code int) {
+	s.once.Do(func() {
+		bts, _ := json.Marshal(Summary{
+			ExitStatus: code,
+			Duration:   time.Since(s.start).Seconds(),
+			BytesIn:    s.in.Load(),
+			BytesOut:   s.out.Load(),
+		})
+		var nl string
+		if s.midLine.Load() {
+			nl = "\n"
+		}
+		_, _ = fmt.Fprintf(s.Session.Stderr(), "%s%s%s\n", nl, Prefix, bts)
+	})
+}
+
+// stderr counts the bytes written to a session's stderr.
+type stderr struct {
+	io.ReadWriter
+	s *session
+}
+
+func (e *stderr) Write(p []byte) (int, error) {
+	n, err := e.ReadWriter.Write(p)
+	e.s.out.Add(int64(n))
+	if n > 0 {
+		e.s.midLine.Store(p[n-1] != '\n')
+	}
+	return n, err
+}
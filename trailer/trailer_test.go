@@ -0,0 +1,95 @@
+package trailer
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func TestMiddleware(t *testing.T) {
+	newServer := func() *ssh.Server {
+		return &ssh.Server{
+			Handler: Middleware()(func(s ssh.Session) {
+				switch s.RawCommand() {
+				case "fail":
+					wish.Print(s, "hello")
+					wish.Error(s, "oops")
+					_ = s.Exit(3)
+				case "echo":
+					_, _ = io.Copy(s, s)
+				}
+			}),
+		}
+	}
+
+	t.Run("exit status", func(t *testing.T) {
+		sess := testsession.New(t, newServer(), nil)
+		var stdout, stderr bytes.Buffer
+		sess.Stdout, sess.Stderr = &stdout, &stderr
+		var exitErr *gossh.ExitError
+		if err := sess.Run("fail"); !errors.As(err, &exitErr) || exitErr.ExitStatus() != 3 {
+			t.Fatalf("expected exit status 3, got %v", err)
+		}
+		if stdout.String() != "hello" {
+			t.Errorf("unexpected stdout %q", stdout.String())
+		}
+		errOut, line, _ := strings.Cut(stderr.String(), "\n")
+		if errOut != "oops" {
+			t.Fatalf("unexpected stderr %q", stderr.String())
+		}
+		sum, err := Parse(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum.ExitStatus != 3 || sum.BytesIn != 0 || sum.BytesOut != 9 || sum.Duration <= 0 {
+			t.Errorf("unexpected summary %+v", sum)
+		}
+	})
+
+	t.Run("input", func(t *testing.T) {
+		sess := testsession.New(t, newServer(), nil)
+		var stdout, stderr bytes.Buffer
+		sess.Stdin = strings.NewReader("some input")
+		sess.Stdout, sess.Stderr = &stdout, &stderr
+		if err := sess.Run("echo"); err != nil {
+			t.Fatal(err)
+		}
+		sum, err := Parse(stderr.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sum.ExitStatus != 0 || sum.BytesIn != 10 || sum.BytesOut != 10 {
+			t.Errorf("unexpected summary %+v", sum)
+		}
+	})
+
+	t.Run("pty", func(t *testing.T) {
+		sess := testsession.New(t, newServer(), nil)
+		var stderr bytes.Buffer
+		sess.Stderr = &stderr
+		if err := sess.RequestPty("xterm", 24, 80, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := sess.Run("fail"); err == nil {
+			t.Fatal("expected an error")
+		}
+		if strings.Contains(stderr.String(), Prefix) {
+			t.Errorf("unexpected trailer in %q", stderr.String())
+		}
+	})
+}
+
+func TestParse(t *testing.T) {
+	for _, line := range []string{"", "hello", Prefix + "{"} {
+		if _, err := Parse(line); !errors.Is(err, ErrNoTrailer) {
+			t.Errorf("%q: expected ErrNoTrailer, got %v", line, err)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Package tunnel bridges SSH subsystem sessions to a net.Listener, so servers
+// of other protocols, like gRPC or HTTP, can be reached through SSH
+// connections, authenticated by them.
+//
+// On the server:
+//
+//	l := tunnel.NewListener()
+//	srv, _ := wish.NewServer(wish.WithSubsystem("grpc", l.Handler))
+//	go grpcServer.Serve(l)
+//
+// The SSH identity of each connection is available from its remote address,
+// e.g. in gRPC handlers:
+//
+//	p, _ := peer.FromContext(ctx)
+//	addr := p.Addr.(*tunnel.Addr)
+//
+// On the client:
+//
+//	grpc.Dial("ssh", grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+//		return tunnel.Dial(sshClient, "grpc")
+//	}), grpc.WithTransportCredentials(insecure.NewCredentials()))
+package tunnel
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Addr is the remote address of a tunneled connection, with the SSH identity
+// of its client.
+type Addr struct {
+	// User is the user the client authenticated as.
+	User string
+
+	// PublicKey is the key the client authenticated with, if any.
+	PublicKey ssh.PublicKey
+
+	// Remote is the address of the SSH connection.
+	Remote net.Addr
+}
+
+// Network implements net.Addr.
+func (a *Addr) Network() string {
+	return "ssh"
+}
+
+// String implements net.Addr.
+func (a *Addr) String() string {
+	return a.User + "@" + a.Remote.String()
+}
+
+// Listener is a net.Listener accepting the sessions of an SSH subsystem as
+// connections.
+type Listener struct {
+	conns     chan *conn
+	done      chan struct{}
+	closeOnce sync.Once
+	addr      net.Addr
+}
+
+var _ net.Listener = &Listener{}
+
+// NewListener returns a new Listener. Register its Handler as a subsystem
+// handler for it to accept connections.
+func NewListener() *Listener {
+	return &Listener{
+		conns: make(chan *conn),
+		done:  make(chan struct{}),
+		addr:  &Addr{Remote: &net.UnixAddr{Name: "tunnel", Net: "ssh"}},
+	}
+}
+
+// Handler handles the sessions of the subsystem, passing them to Accept. It
+// returns once the connection is closed.
+func (l *Listener) Handler(s ssh.Session) {
+	c := &conn{
+		Session: s,
+		closed:  make(chan struct{}),
+		remote: &Addr{
+			User:      s.User(),
+			PublicKey: s.PublicKey(),
+			Remote:    s.RemoteAddr(),
+		},
+	}
+	select {
+	case l.conns <- c:
+	case <-l.done:
+		_ = s.Exit(1)
+		return
+	case <-s.Context().Done():
+		return
+	}
+	select {
+	case <-c.closed:
+	case <-s.Context().Done():
+		_ = c.Close()
+	}
+}
+
+// Accept implements net.Listener.
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close implements net.Listener. Sessions waiting to be accepted are closed,
+// while accepted connections are left open.
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+// Addr implements net.Listener.
+func (l *Listener) Addr() net.Addr {
+	return l.addr
+}
+
+// conn is a subsystem session, as a net.Conn.
+type conn struct {
+	ssh.Session
+	remote    *Addr
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func (c *conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		_ = c.Session.Exit(0)
+		err = c.Session.Close()
+		close(c.closed)
+	})
+	return err
+}
+
+func (c *conn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+// Deadlines aren't supported by SSH channels: they're ignored.
+
+func (c *conn) SetDeadline(time.Time) error      { return nil }
+func (c *conn) SetReadDeadline(time.Time) error  { return nil }
+func (c *conn) SetWriteDeadline(time.Time) error { return nil }
+
+// Dial opens a session on the client for the given subsystem, and returns it
+// as a net.Conn.
+func Dial(c *gossh.Client, subsystem string) (net.Conn, error) {
+	sess, err := c.NewSession()
+	if err != nil {
+		return nil, err
+	}
+	stdin, err := sess.StdinPipe()
+	if err != nil {
+		_ = sess.Close()
+		return nil, err
+	}
+	stdout, err := sess.StdoutPipe()
+	if err != nil {
+		_ = sess.Close()
+		return nil, err
+	}
+	if err := sess.RequestSubsystem(subsystem); err != nil {
+		_ = sess.Close()
+		return nil, err
+	}
+	return &clientConn{
+		Reader: stdout,
+		stdin:  stdin,
+		sess:   sess,
+		client: c,
+	}, nil
+}
+
+// clientConn is the client side of a tunneled connection.
+type clientConn struct {
+	io.Reader
+	stdin  io.WriteCloser
+	sess   *gossh.Session
+	client *gossh.Client
+}
+
+func (c *clientConn) Write(p []byte) (int, error) {
+	return c.stdin.Write(p)
+}
+
+func (c *clientConn) Close() error {
+	_ = c.stdin.Close()
+	return c.sess.Close()
+}
+
+func (c *clientConn) LocalAddr() net.Addr {
+	return c.client.LocalAddr()
+}
+
+func (c *clientConn) RemoteAddr() net.Addr {
+	return c.client.RemoteAddr()
+}
+
+func (c *clientConn) SetDeadline(time.Time) error      { return nil }
+func (c *clientConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *clientConn) SetWriteDeadline(time.Time) error { return nil }
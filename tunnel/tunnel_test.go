@@ -0,0 +1,101 @@
+package tunnel
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+func setup(tb testing.TB) (*Listener, *gossh.Client) {
+	tb.Helper()
+	l := NewListener()
+	tb.Cleanup(func() { _ = l.Close() })
+	srv := &ssh.Server{}
+	requireNoError(tb, wish.WithSubsystem("test", l.Handler)(srv))
+	c, err := gossh.Dial("tcp", testsession.Listen(tb, srv), &gossh.ClientConfig{
+		User:            "testuser",
+		HostKeyCallback: gossh.InsecureIgnoreHostKey(), // nolint: gosec
+	})
+	requireNoError(tb, err)
+	tb.Cleanup(func() { _ = c.Close() })
+	return l, c
+}
+
+func TestListener(t *testing.T) {
+	l, c := setup(t)
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		requireNoError(t, err)
+		accepted <- conn
+		_, _ = io.Copy(conn, conn)
+		_ = conn.Close()
+	}()
+
+	conn, err := Dial(c, "test")
+	requireNoError(t, err)
+	defer conn.Close() // nolint: errcheck
+	_, err = fmt.Fprintln(conn, "hello")
+	requireNoError(t, err)
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	requireNoError(t, err)
+	if line != "hello\n" {
+		t.Errorf("expected the line to be echoed, got %q", line)
+	}
+
+	addr, ok := (<-accepted).RemoteAddr().(*Addr)
+	if !ok || addr.User != "testuser" || addr.Network() != "ssh" {
+		t.Errorf("expected the SSH identity, got %v", addr)
+	}
+
+	requireNoError(t, l.Close())
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("expected net.ErrClosed, got %v", err)
+	}
+}
+
+func TestHTTP(t *testing.T) {
+	l, c := setup(t)
+	hs := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "hello ", r.RemoteAddr)
+		}),
+	}
+	go hs.Serve(l)   // nolint: errcheck
+	defer hs.Close() // nolint: errcheck
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(context.Context, string, string) (net.Conn, error) {
+				return Dial(c, "test")
+			},
+		},
+	}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get("http://ssh/")
+		requireNoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		requireNoError(t, err)
+		_ = resp.Body.Close()
+		if got := string(body); len(got) < 15 || got[:15] != "hello testuser@" {
+			t.Errorf("unexpected response: %q", got)
+		}
+	}
+}
+
+func requireNoError(tb testing.TB, err error) {
+	tb.Helper()
+	if err != nil {
+		tb.Fatalf("expected no error, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+// Package warmpool keeps expensive per-session values, e.g. a loaded model or
+// dataset, initialized ahead of time, so sessions don't have to wait for
+// them.
+package warmpool
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+)
+
+// RetryDelay is how long the pool waits before trying again when creating a
+// value fails.
+var RetryDelay = time.Second
+
+// Pool keeps values ready to be bound to sessions. Values aren't reused: each
+// one is bound to a single session, and replaced by a new one in the
+// background. Values implementing io.Closer are closed once their session
+// ends, or when the pool is closed.
+type Pool[T any] struct {
+	create func(context.Context) (T, error)
+	ready  chan T
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// New returns a pool keeping size values, created with create, ready.
+func New[T any](size int, create func(context.Context) (T, error)) *Pool[T] {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool[T]{
+		create: create,
+		ready:  make(chan T),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for i := 0; i < size; i++ {
+		p.wg.Add(1)
+		go p.fill()
+	}
+	return p
+}
+
+// fill creates values, one at a time, until the pool is closed.
+func (p *Pool[T]) fill() {
+	defer p.wg.Done()
+	for {
+		v, err := p.create(p.ctx)
+		if err != nil {
+			if p.ctx.Err() != nil {
+				return
+			}
+			log.Error("failed to warm up value", "error", err)
+			select {
+			case <-time.After(RetryDelay):
+				continue
+			case <-p.ctx.Done():
+				return
+			}
+		}
+		select {
+		case p.ready <- v:
+		case <-p.ctx.Done():
+			closeValue(v)
+			return
+		}
+	}
+}
+
+// Get returns a warm value, or creates one if none is ready.
+func (p *Pool[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case v := <-p.ready:
+		return v, nil
+	default:
+		return p.create(ctx)
+	}
+}
+
+// Close stops warming up values, closing the ones ready.
+func (p *Pool[T]) Close() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// Middleware binds a value of the pool to each session, to be retrieved with
+// Value.
+func (p *Pool[T]) Middleware() wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			v, err := p.Get(s.Context())
+			if err != nil {
+				log.Error("failed to get warm value", "error", err)
+				wish.Exit(s, 1, "something went wrong")
+				return
+			}
+			defer closeValue(v)
+			s.Context().SetValue(p, v)
+			sh(s)
+		}
+	}
+}
+
+// Value returns the value bound to the session by Middleware.
+func (p *Pool[T]) Value(s ssh.Session) (T, bool) {
+	v, ok := s.Context().Value(p).(T)
+	return v, ok
+}
+
+func closeValue(v interface{}) {
+	if c, ok := v.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			log.Error("failed to close warm value", "error", err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package warmpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish/testsession"
+)
+
+type value struct {
+	id     int32
+	closed atomic.Bool
+}
+
+func (v *value) Close() error {
+	v.closed.Store(true)
+	return nil
+}
+
+type factory struct {
+	mu      sync.Mutex
+	created []*value
+	fail    atomic.Bool
+}
+
+func (f *factory) create(context.Context) (*value, error) {
+	if f.fail.Load() {
+		return nil, errors.New("fail")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	v := &value{id: int32(len(f.created))}
+	f.created = append(f.created, v)
+	return v, nil
+}
+
+func (f *factory) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.created)
+}
+
+func waitFor(tb testing.TB, cond func() bool) {
+	tb.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			tb.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPool(t *testing.T) {
+	f := &factory{}
+	p := New(2, f.create)
+
+	// each filler holds a value ready, and replaces it once taken.
+	waitFor(t, func() bool { return f.count() == 2 })
+
+	v, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, func() bool { return f.count() == 3 })
+
+	p.Close()
+	if v.closed.Load() {
+		t.Error("expected the value handed out to be left open")
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, c := range f.created {
+		if c != v && !c.closed.Load() {
+			t.Errorf("expected value %d to be closed", c.id)
+		}
+	}
+}
+
+func TestPoolNoneReady(t *testing.T) {
+	f := &factory{}
+	f.fail.Store(true)
+	p := New(1, f.create)
+	defer p.Close()
+	if _, err := p.Get(context.Background()); err == nil {
+		t.Fatal("expected an error")
+	}
+	f.fail.Store(false)
+	if _, err := p.Get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	f := &factory{}
+	p := New(1, f.create)
+	defer p.Close()
+	waitFor(t, func() bool { return f.count() == 1 })
+
+	var got *value
+	srv := &ssh.Server{
+		Handler: p.Middleware()(func(s ssh.Session) {
+			got, _ = p.Value(s)
+		}),
+	}
+	if err := testsession.New(t, srv, nil).Run(""); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.id != 0 {
+		t.Fatalf("expected the warm value, got %+v", got)
+	}
+	waitFor(t, got.closed.Load)
+}
@@ -0,0 +1,132 @@
+// Package whatsnew provides a middleware showing users what changed in the
+// app since they last used it, once after each upgrade.
+package whatsnew
+
+import (
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/internal/log"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Release is a version of the app, and what changed in it.
+type Release struct {
+	Version string
+	Notes   string
+}
+
+// Store implementations persist the last version each user saw.
+type Store interface {
+	// LastSeen returns the last version the given user saw, empty if they
+	// never used the app.
+	LastSeen(id string) (string, error)
+
+	// SetLastSeen sets the last version the given user saw.
+	SetLastSeen(id, version string) error
+}
+
+// NewMemoryStore returns a Store keeping the versions in memory.
+func NewMemoryStore() Store {
+	return &memoryStore{versions: map[string]string{}}
+}
+
+type memoryStore struct {
+	mu       sync.Mutex
+	versions map[string]string
+}
+
+func (m *memoryStore) LastSeen(id string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.versions[id], nil
+}
+
+func (m *memoryStore) SetLastSeen(id, version string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.versions[id] = version
+	return nil
+}
+
+// Middleware shows the releases of the changelog the user didn't see yet,
+// and waits for a key press before continuing to the app. The changelog is
+// ordered newest first, its first release being the current one.
+//
+// It's only shown in interactive sessions, with a PTY. New users don't see
+// it: they didn't know the app before.
+//
+// Users are identified by their public key fingerprint, falling back to their
+// user name.
+func Middleware(store Store, changelog []Release) wish.Middleware {
+	return func(sh ssh.Handler) ssh.Handler {
+		return func(s ssh.Session) {
+			if _, _, ok := s.Pty(); ok && len(changelog) > 0 {
+				show(s, store, changelog)
+			}
+			sh(s)
+		}
+	}
+}
+
+func show(s ssh.Session, store Store, changelog []Release) {
+	id := UserID(s)
+	current := changelog[0].Version
+	last, err := store.LastSeen(id)
+	if err != nil {
+		log.Error("could not get the last version seen", "error", err)
+		return
+	}
+	if last == current {
+		return
+	}
+	if err := store.SetLastSeen(id, current); err != nil {
+		log.Error("could not set the last version seen", "error", err)
+		return
+	}
+	if unseen := Unseen(changelog, last); len(unseen) > 0 {
+		wish.Print(s, Render(unseen))
+		wish.Print(s, "\nPress any key to continue...")
+		var b [1]byte
+		_, _ = io.ReadFull(s, b[:])
+		// clear the screen.
+		wish.Print(s, "\x1b[2J\x1b[H")
+	}
+}
+
+// Unseen returns the releases of the changelog newer than the given version.
+// It returns none if the version is empty, or isn't in the changelog, so users
+// don't see the whole changelog.
+func Unseen(changelog []Release, last string) []Release {
+	for i, r := range changelog {
+		if r.Version == last {
+			return changelog[:i]
+		}
+	}
+	return nil
+}
+
+// Render renders the releases as text.
+func Render(releases []Release) string {
+	var sb strings.Builder
+	sb.WriteString("What's new\n")
+	for _, r := range releases {
+		sb.WriteString("\n" + r.Version + "\n")
+		for _, line := range strings.Split(strings.TrimSpace(r.Notes), "\n") {
+			sb.WriteString("  " + line + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// UserID identifies the user of a session in the store: their public key
+// fingerprint, falling back to "user:" followed by their user name.
+func UserID(s ssh.Session) string {
+	if pk := s.PublicKey(); pk != nil {
+		return gossh.FingerprintSHA256(pk)
+	}
+	return "user:" + s.User()
+}
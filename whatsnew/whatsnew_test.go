@@ -0,0 +1,71 @@
+package whatsnew
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/ssh"
+	"github.com/charmbracelet/wish"
+	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+var changelog = []Release{
+	{Version: "1.2.0", Notes: "Dark mode."},
+	{Version: "1.1.0", Notes: "Faster search.\nFixed a crash."},
+	{Version: "1.0.0", Notes: "Initial release."},
+}
+
+func TestMiddleware(t *testing.T) {
+	store := NewMemoryStore()
+	srv := &ssh.Server{
+		Handler: Middleware(store, changelog)(func(s ssh.Session) {
+			wish.Print(s, "app")
+		}),
+	}
+	addr := testsession.Listen(t, srv)
+	run := func(pty bool, stdin string) string {
+		sess, err := testsession.NewClientSession(t, addr, nil)
+		requireNoError(t, err)
+		if pty {
+			requireNoError(t, sess.RequestPty("xterm", 24, 80, gossh.TerminalModes{}))
+		}
+		if stdin != "" {
+			sess.Stdin = strings.NewReader(stdin)
+		}
+		out, err := sess.Output("")
+		requireNoError(t, err)
+		return string(out)
+	}
+
+	if out := run(true, ""); out != "app" {
+		t.Errorf("expected new users not to see the changelog, got %q", out)
+	}
+	if v, _ := store.LastSeen("user:testuser"); v != "1.2.0" {
+		t.Errorf("expected the current version to be recorded, got %q", v)
+	}
+
+	requireNoError(t, store.SetLastSeen("user:testuser", "1.0.0"))
+	if out := run(false, ""); out != "app" {
+		t.Errorf("expected scripts not to see the changelog, got %q", out)
+	}
+	out := run(true, "x")
+	for _, s := range []string{"What's new", "1.2.0", "Dark mode.", "1.1.0", "Fixed a crash.", "Press any key", "app"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("expected %q in %q", s, out)
+		}
+	}
+	if strings.Contains(out, "Initial release.") {
+		t.Errorf("expected seen releases not to be shown, got %q", out)
+	}
+	if out := run(true, ""); out != "app" {
+		t.Errorf("expected the changelog to be shown once, got %q", out)
+	}
+}
+
+func requireNoError(tb testing.TB, err error) {
+	tb.Helper()
+	if err != nil {
+		tb.Fatalf("expected no error, got %v", err)
+	}
+}
@@ -38,6 +38,35 @@ func NewServer(ops ...ssh.Option) (*ssh.Server, error) {
 	return s, nil
 }
 
+// Exit prints the message, if any, to the session's STDERR followed by a new
+// line, exits with the given code, and closes the session. With a PTY, the new
+// line is a \r\n, so whatever the client prints next starts at the beginning
+// of the line.
+//
+// It's meant for middlewares ending sessions, e.g. to reject them.
+func Exit(s ssh.Session, code int, msg string) {
+	if msg != "" {
+		_, _ = io.WriteString(s.Stderr(), msg+newline(s))
+	}
+	_ = s.Exit(code)
+	_ = s.Close()
+}
+
+// Exitf is like Exit, with the message formatted according to the given
+// format.
+func Exitf(s ssh.Session, code int, f string, v ...interface{}) {
+	Exit(s, code, fmt.Sprintf(f, v...))
+}
+
+// newline returns the new line to write to the session: a \r\n with a PTY,
+// unless it's emulated, as the session translates \n then.
+func newline(s ssh.Session) string {
+	if _, _, ok := s.Pty(); ok && !s.EmulatedPty() {
+		return "\r\n"
+	}
+	return "\n"
+}
+
 // Fatal prints to the given session's STDERR and exits 1.
 func Fatal(s ssh.Session, v ...interface{}) {
 	Error(s, v...)
@@ -11,6 +11,7 @@ import (
 
 	"github.com/charmbracelet/ssh"
 	"github.com/charmbracelet/wish/testsession"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 func TestNewServer(t *testing.T) {
@@ -66,3 +67,34 @@ func TestFatal(t *testing.T) {
 		t.Errorf("expected %s, got %s", s, err)
 	}
 }
+
+func TestExit(t *testing.T) {
+	for name, tc := range map[string]struct {
+		pty      bool
+		expected string
+	}{
+		"no pty": {expected: "bye 3\n"},
+		"pty":    {pty: true, expected: "bye 3\r\n"},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			sess := testsession.New(t, &ssh.Server{
+				Handler: func(s ssh.Session) {
+					Exitf(s, 3, "bye %d", 3)
+				},
+			}, nil)
+			if tc.pty {
+				requireNoError(t, sess.RequestPty("xterm", 24, 80, nil))
+			}
+			var out bytes.Buffer
+			sess.Stderr = &out
+			err := sess.Run("")
+			var eerr *gossh.ExitError
+			if !errors.As(err, &eerr) {
+				t.Fatalf("expected an exit error, got %v", err)
+			}
+			requireEqual(t, 3, eerr.ExitStatus())
+			requireEqual(t, tc.expected, out.String())
+		})
+	}
+}